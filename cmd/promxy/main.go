@@ -46,13 +46,21 @@ import (
 	"github.com/prometheus/prometheus/rules"
 	"github.com/prometheus/prometheus/scrape"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/util/strutil"
 	"github.com/prometheus/prometheus/web"
 	"github.com/sirupsen/logrus"
 
 	proxyconfig "github.com/jacksontj/promxy/pkg/config"
 	"github.com/jacksontj/promxy/pkg/logging"
+	"github.com/jacksontj/promxy/pkg/proxyapi"
 	"github.com/jacksontj/promxy/pkg/proxystorage"
+	"github.com/jacksontj/promxy/pkg/queryage"
+	"github.com/jacksontj/promxy/pkg/querydeny"
+	"github.com/jacksontj/promxy/pkg/queryqueue"
+	"github.com/jacksontj/promxy/pkg/queryrewrite"
+	"github.com/jacksontj/promxy/pkg/remote"
+	"github.com/jacksontj/promxy/pkg/servergroup"
 )
 
 var (
@@ -88,8 +96,10 @@ type cliOpts struct {
 
 	MetricsPath string `long:"metrics-path" description:"URL path for the prometheus metrics endpoint." default:"/metrics"`
 
-	ExternalURL     string `long:"web.external-url" description:"The URL under which Prometheus is externally reachable (for example, if Prometheus is served via a reverse proxy). Used for generating relative and absolute links back to Prometheus itself. If the URL has a path portion, it will be used to prefix all HTTP endpoints served by Prometheus. If omitted, relevant URL components will be derived automatically."`
-	EnableLifecycle bool   `long:"web.enable-lifecycle" description:"Enable shutdown and reload via HTTP request."`
+	ExternalURL               string `long:"web.external-url" description:"The URL under which Prometheus is externally reachable (for example, if Prometheus is served via a reverse proxy). Used for generating relative and absolute links back to Prometheus itself. If the URL has a path portion, it will be used to prefix all HTTP endpoints served by Prometheus. If omitted, relevant URL components will be derived automatically."`
+	EnableLifecycle           bool   `long:"web.enable-lifecycle" description:"Enable shutdown and reload via HTTP request."`
+	EnableAdminAPI            bool   `long:"web.enable-admin-api" description:"Enable API endpoints for admin control actions on the downstreams (e.g. reading their configuration, deleting series, snapshots) and managing the server groups."`
+	EnableRemoteWriteReceiver bool   `long:"web.enable-remote-write-receiver" description:"Enable the remote write receiver (/api/v1/write), the received samples are appended to promxy's storage (i.e. the local TSDB and/or the remote_write endpoints)."`
 
 	QueryTimeout        time.Duration `long:"query.timeout" description:"Maximum time a query may take before being aborted." default:"2m"`
 	QueryMaxSamples     int           `long:"query.max-samples" description:"Maximum number of samples a single query can load into memory. Note that queries will fail if they would load more samples than this into memory, so this also limits the number of samples a query can return." default:"50000000"`
@@ -97,6 +107,9 @@ type cliOpts struct {
 	QueryMaxConcurrency int           `long:"query.max-concurrency" default:"-1" description:"Maximum number of queries executed concurrently."`
 	LocalStoragePath    string        `long:"storage.tsdb.path" description:"Base path for metrics storage."`
 
+	EnableLocalStorage    bool          `long:"storage.tsdb.enable" description:"Enable the local TSDB (in storage.tsdb.path) which the output of the recording rules is written to, its series are merged into the query results."`
+	LocalStorageRetention time.Duration `long:"storage.tsdb.retention.time" description:"How long to retain samples in the local TSDB." default:"360h"`
+
 	RemoteReadMaxConcurrency int `long:"remote-read.max-concurrency" description:"Maximum number of concurrent remote read calls." default:"10"`
 
 	NotificationQueueCapacity int           `long:"alertmanager.notification-queue-capacity" description:"The capacity of the queue for pending alert manager notifications." default:"10000"`
@@ -150,6 +163,26 @@ func reloadConfig(noStepSuqueryInterval *safePromQLNoStepSubqueryInterval, rls .
 	return nil
 }
 
+// checkConfig parses and checks the config file, printing the problems found, and
+// returns the exit code
+func checkConfig(path string) int {
+	fmt.Printf("Checking %s\n", path)
+	cfg, err := proxyconfig.ConfigFromFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: %v\n", err)
+		return 1
+	}
+	errs := cfg.Check()
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "  FAILED: %v\n", err)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	fmt.Printf("  SUCCESS: %d server group(s)\n", len(cfg.ServerGroups))
+	return 0
+}
+
 func main() {
 	// Wait for reload or termination signals. Start the handler for SIGHUP as
 	// early as possible, but ignore it until we are ready to handle reloading
@@ -161,6 +194,11 @@ func main() {
 	reloadables := make([]proxyconfig.Reloadable, 0)
 
 	parser := flags.NewParser(&opts, flags.Default)
+	parser.SubcommandsOptional = true
+	if _, err := parser.AddCommand("check-config", "Check the config file",
+		"Parse and check the config file (--config) without starting promxy, exiting non-zero if it has any problems", &struct{}{}); err != nil {
+		logrus.Fatalf("error adding command: %v", err)
+	}
 	if _, err := parser.Parse(); err != nil {
 		// If the error was from the parser, then we can simply return
 		// as Parse() prints the error already
@@ -175,6 +213,10 @@ func main() {
 		os.Exit(0)
 	}
 
+	if parser.Active != nil && parser.Active.Name == "check-config" {
+		os.Exit(checkConfig(opts.ConfigFile))
+	}
+
 	logging.SetMaxFormPrefix(opts.LogMaxFormPrefix)
 
 	// Use log level
@@ -222,6 +264,9 @@ func main() {
 	if err != nil {
 		logrus.Fatalf("Error creating proxy: %v", err)
 	}
+	// On reload the queries in-flight through the previous config are given up to
+	// the query timeout to finish
+	ps.DrainTimeout = opts.QueryTimeout
 	reloadables = append(reloadables, ps)
 	proxyStorage = ps
 
@@ -235,6 +280,20 @@ func main() {
 
 	logger := promlog.New(logCfg)
 
+	if opts.EnableLocalStorage {
+		if opts.LocalStoragePath == "" {
+			logrus.Fatalf("local storage path must be defined if you wish to enable the local TSDB")
+		}
+		tsdbOpts := tsdb.DefaultOptions()
+		tsdbOpts.RetentionDuration = int64(opts.LocalStorageRetention / time.Millisecond)
+		db, err := tsdb.Open(opts.LocalStoragePath, kitlog.With(logger, "component", "tsdb"), prometheus.DefaultRegisterer, tsdbOpts)
+		if err != nil {
+			logrus.Fatalf("Error opening local TSDB: %v", err)
+		}
+		defer db.Close()
+		ps.LocalStorage = db
+	}
+
 	engineOpts := promql.EngineOpts{
 		Reg:                      prometheus.DefaultRegisterer,
 		Timeout:                  opts.QueryTimeout,
@@ -293,10 +352,38 @@ func main() {
 		logrus.Infof("Notifier manager stopped")
 	}()
 
+	// Queries are evaluated through the query queue, the rules with the highest priority
+	queryQueue := queryqueue.New()
+	reloadables = append(reloadables, proxyconfig.ReloadableFunc(func(cfg *proxyconfig.Config) error {
+		return queryQueue.ApplyConfig(cfg.QueryQueue)
+	}))
+	// Denied (or too old) queries are rejected, and the others rewritten, before they are queued
+	queryDenyList := querydeny.New()
+	reloadables = append(reloadables, proxyconfig.ReloadableFunc(func(cfg *proxyconfig.Config) error {
+		return queryDenyList.ApplyConfig(cfg.QueryDenyList)
+	}))
+	queryMaxAge := queryage.New()
+	reloadables = append(reloadables, proxyconfig.ReloadableFunc(func(cfg *proxyconfig.Config) error {
+		return queryMaxAge.ApplyConfig(cfg.QueryMaxAge)
+	}))
+	queryRewriter := queryrewrite.New()
+	reloadables = append(reloadables, proxyconfig.ReloadableFunc(func(cfg *proxyconfig.Config) error {
+		return queryRewriter.ApplyConfig(cfg.QueryRewriteRules)
+	}))
+	engineQueryFunc := rules.EngineQueryFunc(engine, proxyStorage)
+	ruleQueryFunc := func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+		release, err := queryQueue.Acquire(ctx, queryqueue.PriorityHigh)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return engineQueryFunc(ctx, q, t)
+	}
+
 	ruleManager := rules.NewManager(&rules.ManagerOptions{
 		Context:         ctx,         // base context for all background tasks
 		ExternalURL:     externalUrl, // URL listed as URL for "who fired this alert"
-		QueryFunc:       rules.EngineQueryFunc(engine, proxyStorage),
+		QueryFunc:       ruleQueryFunc,
 		NotifyFunc:      sendAlerts(notifierManager, externalUrl.String()),
 		Appendable:      proxyStorage,
 		Queryable:       proxyStorage,
@@ -323,7 +410,7 @@ func main() {
 			return err
 		}
 
-		if cfg.RemoteWriteConfigs == nil {
+		if cfg.RemoteWriteConfigs == nil && !opts.EnableLocalStorage {
 			ruleList := ruleManager.Rules()
 			// check for any recording rules, if we find any lets log a fatal and stop
 			for _, rule := range ruleList {
@@ -394,6 +481,33 @@ func main() {
 
 	r.HandlerFunc("GET", opts.MetricsPath, promhttp.Handler().ServeHTTP)
 
+	// Register the API endpoints which are answered by the downstreams, these
+	// take precedence over the local prometheus API handlers
+	proxyAPI := &proxyapi.API{
+		Client:        ps.Client,
+		Rules:         ruleManager,
+		Alertmanagers: notifierManager,
+		EnableAdmin:   opts.EnableAdminAPI,
+		Query:         queryDenyList.Handler(queryMaxAge.Handler(queryRewriter.Handler(queryQueue.Handler(webHandler.GetRouter())))),
+	}
+	// Server groups changed through the API are written to the config file and reloaded
+	serverGroupReload := make(chan chan error)
+	proxyAPI.ServerGroups = &proxyconfig.FileServerGroupStore{
+		Path: opts.ConfigFile,
+		Reload: func() error {
+			rc := make(chan error)
+			serverGroupReload <- rc
+			return <-rc
+		},
+	}
+	proxyAPI.Register(r, apiPrefix)
+	reloadables = append(reloadables, proxyAPI)
+	// Federation is answered from the merged view of the downstreams
+	r.HandlerFunc("GET", path.Join(webOptions.RoutePrefix, "/federate"), proxyAPI.Federate)
+	if opts.EnableRemoteWriteReceiver {
+		r.Handler("POST", path.Join(apiPrefix, "/write"), remote.NewWriteHandler(proxyStorage))
+	}
+
 	stopping := false
 	r.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Have our fallback rules
@@ -433,22 +547,57 @@ func main() {
 		logrus.Fatalf("Invalid AccessLogDestination: %s", opts.AccessLogDestination)
 	}
 
-	srv, err := server.CreateAndStart(opts.BindAddr, opts.LogFormat, opts.WebReadTimeout, accessLogOut, r, opts.WebConfigFile)
+	srv, err := server.CreateAndStart(opts.BindAddr, opts.LogFormat, opts.WebReadTimeout, accessLogOut, servergroup.RequestHeaderHandler(r), opts.WebConfigFile)
 	if err != nil {
 		logrus.Fatalf("Error creating server: %v", err)
 	}
 
+	// shutdown gracefully stops promxy, on SIGTERM/SIGINT or POST /-/quit
+	shutdown := func() {
+		// Stop all services we are running
+		stopping = true        // start failing healthchecks
+		notifierManager.Stop() // stop alert notifier
+		ruleManager.Stop()     // Stop rule manager
+
+		if opts.ShutdownDelay > 0 {
+			log.Infof("promxy delaying shutdown by %v", opts.ShutdownDelay)
+			time.Sleep(opts.ShutdownDelay)
+		}
+		log.Infof("promxy exiting with timeout: %v", opts.ShutdownTimeout)
+		ctx := ctx
+		if opts.ShutdownTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.ShutdownTimeout)
+			defer cancel()
+		}
+		srv.Shutdown(ctx)
+	}
+
 	// wait for signals etc.
 	for {
 		select {
 		case rc := <-webHandler.Reload():
-			log.Infof("Reloading config")
+			// POST /-/reload (with --web.enable-lifecycle) takes the same path as SIGHUP
+			log.Infof("Reloading config (requested over HTTP)")
 			if err := reloadConfig(noStepSubqueryInterval, reloadables...); err != nil {
 				log.Errorf("Error reloading config: %s", err)
 				rc <- err
 			} else {
 				rc <- nil
 			}
+		case rc := <-serverGroupReload:
+			log.Infof("Reloading config for server group change")
+			if err := reloadConfig(noStepSubqueryInterval, reloadables...); err != nil {
+				log.Errorf("Error reloading config: %s", err)
+				rc <- err
+			} else {
+				rc <- nil
+			}
+		case <-webHandler.Quit():
+			// POST /-/quit (with --web.enable-lifecycle) takes the same path as SIGTERM
+			log.Info("promxy received quit request over HTTP, starting graceful shutdown")
+			shutdown()
+			return
 		case sig := <-sigs:
 			switch sig {
 			case syscall.SIGHUP:
@@ -458,23 +607,7 @@ func main() {
 				}
 			case syscall.SIGTERM, syscall.SIGINT:
 				log.Info("promxy received exit signal, starting graceful shutdown")
-
-				// Stop all services we are running
-				stopping = true        // start failing healthchecks
-				notifierManager.Stop() // stop alert notifier
-				ruleManager.Stop()     // Stop rule manager
-
-				if opts.ShutdownDelay > 0 {
-					log.Infof("promxy delaying shutdown by %v", opts.ShutdownDelay)
-					time.Sleep(opts.ShutdownDelay)
-				}
-				log.Infof("promxy exiting with timeout: %v", opts.ShutdownTimeout)
-				defer cancel()
-				if opts.ShutdownTimeout > 0 {
-					ctx, cancel = context.WithTimeout(ctx, opts.ShutdownTimeout)
-					defer cancel()
-				}
-				srv.Shutdown(ctx)
+				shutdown()
 				return
 			default:
 				log.Errorf("Uncaught signal: %v", sig)
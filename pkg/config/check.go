@@ -0,0 +1,124 @@
+package proxyconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/file"
+
+	"github.com/jacksontj/promxy/pkg/servergroup"
+)
+
+// Check runs the checks of the config which go beyond parsing it (e.g. whether the
+// files it references exist), such that a config can be vetted before it is deployed.
+// All of the problems found are returned.
+func (c *Config) Check() []error {
+	var errs []error
+	for _, f := range []struct{ option, path string }{
+		{"tls_server_config cert_file", c.WebConfig.TLSCertPath},
+		{"tls_server_config key_file", c.WebConfig.TLSKeyPath},
+		{"tls_server_config client_ca_file", c.WebConfig.ClientCAs},
+	} {
+		if err := checkFile(f.option, f.path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// The series of servergroups with the same labels can't be told apart, they
+	// are merged. Shadow and fallback servergroups are queried separately.
+	labelSets := make(map[model.Fingerprint]string)
+	for i, sg := range c.ServerGroups {
+		name := sg.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		for _, err := range checkServerGroup(sg) {
+			errs = append(errs, fmt.Errorf("server group %q: %v", name, err))
+		}
+
+		if len(sg.Labels) == 0 || sg.Shadow || sg.Fallback {
+			continue
+		}
+		fp := sg.Labels.Fingerprint()
+		if other, ok := labelSets[fp]; ok {
+			errs = append(errs, fmt.Errorf("server group %q: has the same labels %v as server group %q, set distinct labels to tell their series apart", name, sg.Labels, other))
+			continue
+		}
+		labelSets[fp] = name
+	}
+	return errs
+}
+
+// checkServerGroup checks the service discovery, the files and the anti-affinity of a servergroup
+func checkServerGroup(sg *servergroup.Config) []error {
+	var errs []error
+
+	if len(sg.ServiceDiscoveryConfigs) == 0 {
+		errs = append(errs, fmt.Errorf("no hosts are configured, add a service discovery config (e.g. static_configs)"))
+	}
+	for _, sd := range sg.ServiceDiscoveryConfigs {
+		switch sd := sd.(type) {
+		case discovery.StaticConfig:
+			for _, tg := range sd {
+				if len(tg.Targets) == 0 {
+					errs = append(errs, fmt.Errorf("static_configs entry has no targets"))
+				}
+				for _, target := range tg.Targets {
+					addr := string(target[model.AddressLabel])
+					if strings.Contains(addr, "/") {
+						errs = append(errs, fmt.Errorf("static_configs target %q must be a host:port, the scheme is set with scheme and the path with path_prefix", addr))
+					}
+				}
+			}
+		case *file.SDConfig:
+			for _, pattern := range sd.Files {
+				if matches, err := filepath.Glob(pattern); err != nil || len(matches) == 0 {
+					errs = append(errs, fmt.Errorf("file_sd_configs files %q match no files", pattern))
+				}
+			}
+		}
+	}
+
+	httpCfg := sg.HTTPConfig.HTTPConfig
+	files := []struct{ option, path string }{
+		{"tls_config ca_file", httpCfg.TLSConfig.CAFile},
+		{"tls_config cert_file", httpCfg.TLSConfig.CertFile},
+		{"tls_config key_file", httpCfg.TLSConfig.KeyFile},
+		{"bearer_token_file", httpCfg.BearerTokenFile},
+	}
+	if httpCfg.BasicAuth != nil {
+		files = append(files, struct{ option, path string }{"basic_auth password_file", httpCfg.BasicAuth.PasswordFile})
+	}
+	if sg.HTTPConfig.OAuth2 != nil {
+		files = append(files, struct{ option, path string }{"oauth2 client_secret_file", sg.HTTPConfig.OAuth2.ClientSecretFile})
+	}
+	for _, f := range files {
+		if err := checkFile(f.option, f.path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// The scrape_interval is used as the anti_affinity, a different (non-default)
+	// anti_affinity is silently ignored
+	if sg.ScrapeInterval > 0 && sg.AntiAffinity != servergroup.DefaultConfig.AntiAffinity && sg.AntiAffinity != sg.ScrapeInterval {
+		errs = append(errs, fmt.Errorf("anti_affinity %v conflicts with scrape_interval %v (which is used as the anti_affinity), remove one of them", model.Duration(sg.AntiAffinity), model.Duration(sg.ScrapeInterval)))
+	}
+
+	return errs
+}
+
+// checkFile checks that the file of the option (if set) exists
+func checkFile(option, path string) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s: %v", option, err)
+	}
+	return nil
+}
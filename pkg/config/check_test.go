@@ -0,0 +1,147 @@
+package proxyconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := ioutil.WriteFile(caFile, []byte("ca"), 0600); err != nil {
+		t.Fatalf("Could not create file: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "targets.yml"), nil, 0600); err != nil {
+		t.Fatalf("Could not create file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+		errors   []string
+	}{
+		{
+			name: "valid",
+			contents: `
+promxy:
+  server_groups:
+    - name: a
+      static_configs:
+        - targets: ['localhost:9090']
+      labels:
+        sg: a
+      scrape_interval: 15s
+      http_client:
+        tls_config:
+          ca_file: ` + caFile + `
+    - name: b
+      file_sd_configs:
+        - files: ['` + filepath.Join(dir, "*.yml") + `']
+      labels:
+        sg: b
+    - name: shadow
+      static_configs:
+        - targets: ['localhost:9091']
+      labels:
+        sg: a
+      shadow: true
+`,
+		},
+		{
+			name: "service discovery",
+			contents: `
+promxy:
+  server_groups:
+    - name: none
+    - name: scheme
+      static_configs:
+        - targets: ['http://localhost:9090']
+    - name: files
+      file_sd_configs:
+        - files: ['` + filepath.Join(dir, "*.json") + `']
+`,
+			errors: []string{
+				`server group "none": no hosts are configured`,
+				`server group "scheme": static_configs target "http://localhost:9090" must be a host:port`,
+				`server group "files": file_sd_configs files`,
+			},
+		},
+		{
+			name: "missing files",
+			contents: `
+tls_server_config:
+  cert_file: ` + filepath.Join(dir, "server.crt") + `
+  key_file: ` + filepath.Join(dir, "server.key") + `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: ['localhost:9090']
+      http_client:
+        tls_config:
+          cert_file: ` + filepath.Join(dir, "client.crt") + `
+          key_file: ` + filepath.Join(dir, "client.key") + `
+`,
+			errors: []string{
+				"tls_server_config cert_file",
+				"tls_server_config key_file",
+				`server group "0": tls_config cert_file`,
+				`server group "0": tls_config key_file`,
+			},
+		},
+		{
+			name: "duplicate labels",
+			contents: `
+promxy:
+  server_groups:
+    - name: a
+      static_configs:
+        - targets: ['localhost:9090']
+      labels:
+        sg: a
+    - name: b
+      static_configs:
+        - targets: ['localhost:9091']
+      labels:
+        sg: a
+`,
+			errors: []string{
+				`server group "b": has the same labels {sg="a"} as server group "a"`,
+			},
+		},
+		{
+			name: "conflicting anti-affinity",
+			contents: `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: ['localhost:9090']
+      anti_affinity: 30s
+      scrape_interval: 15s
+`,
+			errors: []string{
+				`server group "0": anti_affinity 30s conflicts with scrape_interval 15s`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs := configFromString(t, test.contents).Check()
+			if len(errs) != len(test.errors) {
+				t.Fatalf("expected %d errors, got %d: %v", len(test.errors), len(errs), errs)
+			}
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), test.errors[i]) {
+					t.Errorf("expected error %d to contain %q, got %q", i, test.errors[i], err)
+				}
+			}
+		})
+	}
+}
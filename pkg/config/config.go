@@ -3,11 +3,17 @@ package proxyconfig
 import (
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"github.com/prometheus/exporter-toolkit/web"
 
 	"github.com/prometheus/prometheus/config"
 
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+	"github.com/jacksontj/promxy/pkg/queryage"
+	"github.com/jacksontj/promxy/pkg/querydeny"
+	"github.com/jacksontj/promxy/pkg/queryqueue"
+	"github.com/jacksontj/promxy/pkg/queryrewrite"
 	"github.com/jacksontj/promxy/pkg/servergroup"
 
 	yaml "gopkg.in/yaml.v2"
@@ -20,18 +26,27 @@ var DefaultPromxyConfig = PromxyConfig{}
 // ConfigFromFile loads a config file at path
 func ConfigFromFile(path string) (*Config, error) {
 	// load the config file
-	cfg := &Config{
-		PromConfig:   config.DefaultConfig,
-		PromxyConfig: DefaultPromxyConfig,
-	}
 	configBytes, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("error loading config: %v", err)
 	}
-	err = yaml.Unmarshal([]byte(configBytes), &cfg)
+	return configFromBytes(configBytes)
+}
+
+// configFromBytes loads the config from the contents of a config file
+func configFromBytes(configBytes []byte) (*Config, error) {
+	cfg := &Config{
+		PromConfig:   config.DefaultConfig,
+		PromxyConfig: DefaultPromxyConfig,
+	}
+	err := yaml.Unmarshal(configBytes, &cfg)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %v", err)
 	}
+	if err := cfg.PromxyConfig.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	cfg.PromxyConfig.setServerGroupDefaults()
 
 	return cfg, nil
 }
@@ -54,4 +69,102 @@ type Config struct {
 type PromxyConfig struct {
 	// Config for each of the server groups promxy is configured to aggregate
 	ServerGroups []*servergroup.Config `yaml:"server_groups"`
+
+	// MaxConcurrentRequests, if non-zero, limits the number of concurrent requests
+	// to the hosts of all server groups; requests over the limit wait in a queue
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests"`
+
+	// ShadowTimeout, if non-zero, is the maximum amount of time to wait for the
+	// shadow server groups to respond before the comparison counts as an error
+	ShadowTimeout time.Duration `yaml:"shadow_timeout"`
+
+	// LookbackDelta and AlignQueriesWithStep are the defaults of the server groups'
+	// lookback_delta and align_queries_with_step (see servergroup.Config)
+	LookbackDelta        time.Duration `yaml:"lookback_delta"`
+	AlignQueriesWithStep bool          `yaml:"align_queries_with_step"`
+
+	// QueryQueue, if set, limits the number of concurrent queries evaluated by promxy;
+	// queries over the limit wait in a queue and are evaluated by priority
+	QueryQueue *queryqueue.Config `yaml:"query_queue"`
+
+	// QueryMaxAge, if set, limits the age of the start of the queries evaluated by promxy
+	QueryMaxAge *queryage.Config `yaml:"query_max_age"`
+
+	// QueryDenyList are the rules of the queries promxy refuses to evaluate
+	QueryDenyList []*querydeny.Rule `yaml:"query_deny_list"`
+
+	// QueryRewriteRules are the rules rewriting the queries before they are evaluated
+	QueryRewriteRules []*queryrewrite.Rule `yaml:"query_rewrite_rules"`
+
+	// QueryLimits, if set, limits the size of the results merged from all server groups,
+	// protecting promxy's memory from selectors matching too many series
+	QueryLimits *QueryLimitsConfig `yaml:"query_limits"`
+}
+
+// QueryLimitsConfig configures the limits of the results merged from all server groups,
+// a zero limit means no limit
+type QueryLimitsConfig struct {
+	// MaxSeries is the maximum number of series in a result
+	MaxSeries int `yaml:"max_series"`
+	// MaxSamples is the maximum number of samples in a result
+	MaxSamples int `yaml:"max_samples"`
+	// Fail fails the queries with results over the limits, instead of returning the
+	// results truncated (to whole series) with a warning
+	Fail bool `yaml:"fail"`
+	// MaxMergeSamples and MaxMergeBytes cap the samples (and their estimated size with the
+	// labels) of the results while they are merged, in each server group and across them.
+	// The series over the cap are truncated with a warning identifying them, such that a
+	// downstream returning an enormous result can't balloon promxy's memory.
+	MaxMergeSamples int `yaml:"max_merge_samples"`
+	MaxMergeBytes   int `yaml:"max_merge_bytes"`
+}
+
+// MergeLimits returns the limits of the merged results (none if c is nil)
+func (c *QueryLimitsConfig) MergeLimits() promhttputil.MergeLimits {
+	if c == nil {
+		return promhttputil.MergeLimits{}
+	}
+	return promhttputil.MergeLimits{MaxSamples: c.MaxMergeSamples, MaxBytes: c.MaxMergeBytes}
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *QueryLimitsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = QueryLimitsConfig{}
+	type plain QueryLimitsConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.MaxSeries < 0 || c.MaxSamples < 0 || c.MaxMergeSamples < 0 || c.MaxMergeBytes < 0 {
+		return fmt.Errorf("query_limits must not be negative, got max_series=%d max_samples=%d max_merge_samples=%d max_merge_bytes=%d", c.MaxSeries, c.MaxSamples, c.MaxMergeSamples, c.MaxMergeBytes)
+	}
+	return nil
+}
+
+// validate checks the parts of the config which span server groups
+func (c *PromxyConfig) validate() error {
+	names := make(map[string]struct{}, len(c.ServerGroups))
+	for _, sg := range c.ServerGroups {
+		if sg.Name == "" {
+			continue
+		}
+		if _, ok := names[sg.Name]; ok {
+			return fmt.Errorf("duplicate server group name %q", sg.Name)
+		}
+		names[sg.Name] = struct{}{}
+	}
+	return nil
+}
+
+// setServerGroupDefaults sets the options of the server groups which default to the global ones
+func (c *PromxyConfig) setServerGroupDefaults() {
+	for _, sg := range c.ServerGroups {
+		if sg.LookbackDelta == 0 {
+			sg.LookbackDelta = c.LookbackDelta
+		}
+		if sg.AlignQueriesWithStep == nil {
+			align := c.AlignQueriesWithStep
+			sg.AlignQueriesWithStep = &align
+		}
+	}
 }
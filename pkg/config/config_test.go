@@ -1,9 +1,27 @@
 package proxyconfig
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/azure"
+	"github.com/prometheus/prometheus/discovery/consul"
+	"github.com/prometheus/prometheus/discovery/dns"
+	"github.com/prometheus/prometheus/discovery/ec2"
+	"github.com/prometheus/prometheus/discovery/file"
+	"github.com/prometheus/prometheus/discovery/gce"
+	"github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+	"github.com/jacksontj/promxy/pkg/queryqueue"
 )
 
 func TestConfigFromFile(t *testing.T) {
@@ -40,3 +58,1117 @@ tls_server_config:
 		t.Errorf("Invalid ClientCAs. Expected 'tls-ca-chain.pem', Got '%s'", cfg.WebConfig.ClientCAs)
 	}
 }
+
+// loadConfigString loads the config with the given contents
+func loadConfigString(t *testing.T, contents string) (*Config, error) {
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("Could not create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.Write([]byte(contents))
+	file.Close()
+
+	return ConfigFromFile(file.Name())
+}
+
+// configFromString loads the config with the given contents, failing the test on error
+func configFromString(t *testing.T, contents string) *Config {
+	cfg, err := loadConfigString(t, contents)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	return cfg
+}
+
+func TestServerGroupServiceDiscovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		check    func(t *testing.T, cfg discovery.Config)
+	}{
+		{
+			name: "kubernetes",
+			contents: `
+promxy:
+  server_groups:
+    - kubernetes_sd_configs:
+        - role: pod
+          namespaces:
+            names: [monitoring]
+          selectors:
+            - role: pod
+              label: app=prometheus
+      relabel_configs:
+        - source_labels: [__meta_kubernetes_pod_container_port_name]
+          regex: web
+          action: keep
+`,
+			check: func(t *testing.T, cfg discovery.Config) {
+				sdCfg, ok := cfg.(*kubernetes.SDConfig)
+				if !ok {
+					t.Fatalf("expected kubernetes config, got %T", cfg)
+				}
+				if sdCfg.Role != kubernetes.RolePod || len(sdCfg.NamespaceDiscovery.Names) != 1 || len(sdCfg.Selectors) != 1 {
+					t.Fatalf("unexpected kubernetes config: %+v", sdCfg)
+				}
+			},
+		},
+		{
+			name: "consul",
+			contents: `
+promxy:
+  server_groups:
+    - consul_sd_configs:
+        - server: consul.service:8500
+          datacenter: dc1
+          token: secret
+          services: [prometheus]
+          tags: [production]
+`,
+			check: func(t *testing.T, cfg discovery.Config) {
+				sdCfg, ok := cfg.(*consul.SDConfig)
+				if !ok {
+					t.Fatalf("expected consul config, got %T", cfg)
+				}
+				if sdCfg.Datacenter != "dc1" || sdCfg.Token != "secret" || len(sdCfg.Services) != 1 || len(sdCfg.ServiceTags) != 1 {
+					t.Fatalf("unexpected consul config: %+v", sdCfg)
+				}
+			},
+		},
+		{
+			name: "dns",
+			contents: `
+promxy:
+  server_groups:
+    - dns_sd_configs:
+        - names: [prometheus.monitoring.svc.cluster.local]
+          type: A
+          port: 9090
+          refresh_interval: 10s
+`,
+			check: func(t *testing.T, cfg discovery.Config) {
+				sdCfg, ok := cfg.(*dns.SDConfig)
+				if !ok {
+					t.Fatalf("expected dns config, got %T", cfg)
+				}
+				if sdCfg.Type != "A" || sdCfg.Port != 9090 || time.Duration(sdCfg.RefreshInterval) != 10*time.Second {
+					t.Fatalf("unexpected dns config: %+v", sdCfg)
+				}
+			},
+		},
+		{
+			name: "file",
+			contents: `
+promxy:
+  server_groups:
+    - file_sd_configs:
+        - files: [/etc/promxy/targets/*.json, /etc/promxy/targets/*.yml]
+`,
+			check: func(t *testing.T, cfg discovery.Config) {
+				sdCfg, ok := cfg.(*file.SDConfig)
+				if !ok {
+					t.Fatalf("expected file config, got %T", cfg)
+				}
+				if len(sdCfg.Files) != 2 {
+					t.Fatalf("unexpected file config: %+v", sdCfg)
+				}
+			},
+		},
+		{
+			name: "ec2",
+			contents: `
+promxy:
+  server_groups:
+    - ec2_sd_configs:
+        - region: us-east-1
+          port: 9090
+          filters:
+            - name: tag:role
+              values: [prometheus]
+`,
+			check: func(t *testing.T, cfg discovery.Config) {
+				sdCfg, ok := cfg.(*ec2.SDConfig)
+				if !ok {
+					t.Fatalf("expected ec2 config, got %T", cfg)
+				}
+				if sdCfg.Region != "us-east-1" || sdCfg.Port != 9090 || len(sdCfg.Filters) != 1 {
+					t.Fatalf("unexpected ec2 config: %+v", sdCfg)
+				}
+			},
+		},
+		{
+			name: "gce",
+			contents: `
+promxy:
+  server_groups:
+    - gce_sd_configs:
+        - project: my-project
+          zone: us-central1-a
+          filter: labels.role = "prometheus"
+          port: 9090
+`,
+			check: func(t *testing.T, cfg discovery.Config) {
+				sdCfg, ok := cfg.(*gce.SDConfig)
+				if !ok {
+					t.Fatalf("expected gce config, got %T", cfg)
+				}
+				if sdCfg.Project != "my-project" || sdCfg.Filter == "" || sdCfg.Port != 9090 {
+					t.Fatalf("unexpected gce config: %+v", sdCfg)
+				}
+			},
+		},
+		{
+			name: "azure",
+			contents: `
+promxy:
+  server_groups:
+    - azure_sd_configs:
+        - subscription_id: 11111111-1111-1111-1111-111111111111
+          authentication_method: ManagedIdentity
+          port: 9090
+`,
+			check: func(t *testing.T, cfg discovery.Config) {
+				sdCfg, ok := cfg.(*azure.SDConfig)
+				if !ok {
+					t.Fatalf("expected azure config, got %T", cfg)
+				}
+				if sdCfg.AuthenticationMethod != "ManagedIdentity" || sdCfg.Port != 9090 {
+					t.Fatalf("unexpected azure config: %+v", sdCfg)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := configFromString(t, test.contents)
+			if len(cfg.ServerGroups) != 1 {
+				t.Fatalf("expected 1 server group, got %d", len(cfg.ServerGroups))
+			}
+			sdConfigs := cfg.ServerGroups[0].ServiceDiscoveryConfigs
+			if len(sdConfigs) != 1 {
+				t.Fatalf("expected 1 service discovery config, got %d", len(sdConfigs))
+			}
+			test.check(t, sdConfigs[0])
+		})
+	}
+}
+
+func TestServerGroupRelabelConfigs(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [a:8080, b:8080]
+          labels:
+            __meta_app: prometheus
+        - targets: [c:8080]
+      relabel_configs:
+        - source_labels: [__meta_app]
+          regex: prometheus
+          action: keep
+        - source_labels: [__address__]
+          regex: (.+):\d+
+          replacement: $1:9090
+          target_label: __address__
+        - source_labels: [__meta_app]
+          target_label: app
+`)
+	if len(cfg.ServerGroups) != 1 {
+		t.Fatalf("expected 1 server group, got %d", len(cfg.ServerGroups))
+	}
+
+	for _, test := range []struct {
+		in       labels.Labels
+		expected labels.Labels
+	}{
+		{
+			in:       labels.FromStrings(model.AddressLabel, "a:8080", "__meta_app", "prometheus"),
+			expected: labels.FromStrings(model.AddressLabel, "a:9090", "__meta_app", "prometheus", "app", "prometheus"),
+		},
+		{
+			in:       labels.FromStrings(model.AddressLabel, "c:8080"),
+			expected: nil,
+		},
+	} {
+		if out := relabel.Process(test.in, cfg.ServerGroups[0].RelabelConfigs...); !labels.Equal(out, test.expected) {
+			t.Fatalf("mismatch in relabeled target expected=%v actual=%v", test.expected, out)
+		}
+	}
+}
+
+func TestServerGroupHTTPClientConfig(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      scheme: https
+      http_client:
+        dial_timeout: 1s
+        tls_config:
+          ca_file: /etc/promxy/ca.crt
+          cert_file: /etc/promxy/client.crt
+          key_file: /etc/promxy/client.key
+          server_name: prometheus.example.com
+          insecure_skip_verify: false
+`)
+	if len(cfg.ServerGroups) != 1 {
+		t.Fatalf("expected 1 server group, got %d", len(cfg.ServerGroups))
+	}
+	httpCfg := cfg.ServerGroups[0].HTTPConfig
+	if httpCfg.DialTimeout != time.Second {
+		t.Fatalf("unexpected dial_timeout: %v", httpCfg.DialTimeout)
+	}
+
+	tlsCfg := httpCfg.HTTPConfig.TLSConfig
+	if tlsCfg.CAFile != "/etc/promxy/ca.crt" || tlsCfg.CertFile != "/etc/promxy/client.crt" || tlsCfg.KeyFile != "/etc/promxy/client.key" || tlsCfg.ServerName != "prometheus.example.com" {
+		t.Fatalf("unexpected tls_config: %+v", tlsCfg)
+	}
+}
+
+func TestServerGroupAuthConfig(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      http_client:
+        basic_auth:
+          username: promxy
+          password_file: /etc/promxy/password
+    - static_configs:
+        - targets: [localhost:9091]
+      http_client:
+        bearer_token_file: /etc/promxy/token
+`)
+	if len(cfg.ServerGroups) != 2 {
+		t.Fatalf("expected 2 server groups, got %d", len(cfg.ServerGroups))
+	}
+	if basicAuth := cfg.ServerGroups[0].HTTPConfig.HTTPConfig.BasicAuth; basicAuth == nil || basicAuth.Username != "promxy" || basicAuth.PasswordFile != "/etc/promxy/password" {
+		t.Fatalf("unexpected basic_auth: %+v", basicAuth)
+	}
+	if tokenFile := cfg.ServerGroups[1].HTTPConfig.HTTPConfig.BearerTokenFile; tokenFile != "/etc/promxy/token" {
+		t.Fatalf("unexpected bearer_token_file: %s", tokenFile)
+	}
+
+	// Only one authentication method may be configured
+	_, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      http_client:
+        bearer_token: token
+        basic_auth:
+          username: promxy
+`)
+	if err == nil {
+		t.Fatal("expected an error configuring both basic_auth and bearer_token")
+	}
+}
+
+func TestServerGroupOAuth2Config(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      http_client:
+        oauth2:
+          client_id: promxy
+          client_secret: secret
+          token_url: https://login.example.com/oauth2/token
+          scopes: [a, b]
+`)
+	oauth2 := cfg.ServerGroups[0].HTTPConfig.OAuth2
+	if oauth2 == nil || oauth2.ClientID != "promxy" || oauth2.ClientSecret != "secret" || len(oauth2.Scopes) != 2 {
+		t.Fatalf("unexpected oauth2 config: %+v", oauth2)
+	}
+
+	for _, contents := range []string{
+		// missing token_url
+		`
+promxy:
+  server_groups:
+    - http_client:
+        oauth2:
+          client_id: promxy
+`,
+		// oauth2 and bearer_token
+		`
+promxy:
+  server_groups:
+    - http_client:
+        bearer_token: token
+        oauth2:
+          client_id: promxy
+          token_url: https://login.example.com/oauth2/token
+`,
+	} {
+		if _, err := loadConfigString(t, contents); err == nil {
+			t.Fatalf("expected an error for config: %s", contents)
+		}
+	}
+}
+
+func TestServerGroupProxyConfig(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      http_client:
+        proxy_url: http://proxy.example.com:3128
+        no_proxy:
+          - .internal
+          - localhost:9090
+          - 10.0.0.0/8
+`)
+	httpCfg := cfg.ServerGroups[0].HTTPConfig
+	for host, useProxy := range map[string]bool{
+		"prometheus.example.com:9090": true,
+		"prometheus.internal:9090":    false,
+		"internal:9090":               false,
+		"localhost:9090":              false,
+		"localhost:9091":              true,
+		"10.1.2.3:9090":               false,
+		"11.1.2.3:9090":               true,
+	} {
+		if actual := httpCfg.UseProxy(host); actual != useProxy {
+			t.Errorf("expected UseProxy(%s)=%v", host, useProxy)
+		}
+	}
+}
+
+func TestServerGroupScheme(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+    - static_configs:
+        - targets: [localhost:9091]
+      scheme: https
+`)
+	if cfg.ServerGroups[0].Scheme != "http" || cfg.ServerGroups[1].Scheme != "https" {
+		t.Fatalf("unexpected schemes %s %s", cfg.ServerGroups[0].Scheme, cfg.ServerGroups[1].Scheme)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - scheme: ftp
+`); err == nil {
+		t.Fatal("expected an error for an invalid scheme")
+	}
+}
+
+func TestServerGroupTimeouts(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      downstream_timeout: 5s
+    - static_configs:
+        - targets: [lts:9090]
+      downstream_timeout: 5m
+      timeout: 1m
+      call_timeouts:
+        query_range: 10m
+`)
+	local, lts := cfg.ServerGroups[0], cfg.ServerGroups[1]
+	if local.DownstreamTimeout != 5*time.Second || local.Timeout != 0 || local.CallTimeouts != nil {
+		t.Fatalf("unexpected timeouts for the local server group: %v %v %v", local.DownstreamTimeout, local.Timeout, local.CallTimeouts)
+	}
+	if lts.DownstreamTimeout != 5*time.Minute || lts.Timeout != time.Minute || lts.CallTimeouts.QueryRange != 10*time.Minute {
+		t.Fatalf("unexpected timeouts for the lts server group: %v %v %v", lts.DownstreamTimeout, lts.Timeout, lts.CallTimeouts)
+	}
+}
+
+func TestServerGroupLabelFilter(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      label_filter:
+        dynamic_labels: [cluster]
+        static_labels_include:
+          region: [eu-west-1]
+`)
+	filter := cfg.ServerGroups[0].LabelFilter
+	if filter == nil || filter.SyncInterval != 5*time.Minute || filter.StaticLabelsInclude["region"][0] != "eu-west-1" {
+		t.Fatalf("unexpected label_filter %+v", filter)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - label_filter:
+        dynamic_labels: ["not a label"]
+`); err == nil {
+		t.Fatal("expected an error for an invalid label name")
+	}
+}
+
+func TestServerGroupHealthCheck(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      health_check:
+        interval: 30s
+`)
+	check := cfg.ServerGroups[0].HealthCheck
+	if check == nil || check.Path != "/-/ready" || check.Interval != 30*time.Second || check.UnhealthyThreshold != 2 {
+		t.Fatalf("unexpected health_check %+v", check)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - health_check:
+        unhealthy_threshold: 0
+`); err == nil {
+		t.Fatal("expected an error for an invalid unhealthy_threshold")
+	}
+}
+
+func TestServerGroupThanosStoreAPI(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:10901]
+      thanos_store_api: true
+`)
+	if !cfg.ServerGroups[0].ThanosStoreAPI {
+		t.Fatal("expected thanos_store_api to be set")
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - thanos_store_api: true
+      remote_read: true
+`); err == nil {
+		t.Fatal("expected an error for thanos_store_api with remote_read")
+	}
+}
+
+func TestServerGroupReplicaLabels(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      replica_labels: [replica, prometheus_replica]
+`)
+	if !reflect.DeepEqual(cfg.ServerGroups[0].ReplicaLabels, []string{"replica", "prometheus_replica"}) {
+		t.Fatalf("unexpected replica_labels: %v", cfg.ServerGroups[0].ReplicaLabels)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - replica_labels: [__name__]
+`); err == nil {
+		t.Fatal("expected an error for an invalid replica label")
+	}
+}
+
+func TestServerGroupSharding(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+          labels:
+            __shard__: "0"
+      sharding:
+        modulus: 1
+        source_labels: [instance]
+`)
+	if sharding := cfg.ServerGroups[0].Sharding; sharding == nil || sharding.ShardLabel != "__shard__" || sharding.Separator != ";" {
+		t.Fatalf("unexpected sharding: %+v", sharding)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - sharding:
+        modulus: 0
+`); err == nil {
+		t.Fatal("expected an error for a modulus of 0")
+	}
+}
+
+func TestServerGroupLoadBalance(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090, localhost:9091]
+      load_balance:
+        weight_label: __weight__
+`)
+	if lb := cfg.ServerGroups[0].LoadBalance; lb == nil || lb.SubsetSize != 1 || lb.WeightLabel != "__weight__" {
+		t.Fatalf("unexpected load_balance: %+v", lb)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - quorum: 2
+      load_balance:
+        subset_size: 1
+`); err == nil {
+		t.Fatal("expected an error for a subset_size below the quorum")
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - load_balance: {}
+      hedge:
+        delay: 100ms
+`); err == nil {
+		t.Fatal("expected an error for load_balance with hedge")
+	}
+}
+
+func TestServerGroupHedge(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090, localhost:9091]
+      hedge:
+        delay: 100ms
+        quantile: 0.95
+`)
+	if hedge := cfg.ServerGroups[0].Hedge; hedge == nil || hedge.Delay != 100*time.Millisecond || hedge.Quantile != 0.95 {
+		t.Fatalf("unexpected hedge: %+v", hedge)
+	}
+
+	// The delay is used until enough latency has been observed, it is required
+	// even with a quantile
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - hedge:
+        quantile: 0.95
+`); err == nil {
+		t.Fatal("expected an error for a hedge without a delay")
+	}
+}
+
+func TestServerGroupCapabilityDetection(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      capability_detection: {}
+`)
+	if detection := cfg.ServerGroups[0].CapabilityDetection; detection == nil || detection.Interval != 10*time.Minute {
+		t.Fatalf("unexpected capability_detection: %+v", detection)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - capability_detection:
+        interval: 0s
+`); err == nil {
+		t.Fatal("expected an error for an invalid interval")
+	}
+}
+
+func TestServerGroupQuerySplit(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      query_split:
+        max_concurrency: 4
+`)
+	if split := cfg.ServerGroups[0].QuerySplit; split == nil || split.Interval != 24*time.Hour || split.MaxConcurrency != 4 {
+		t.Fatalf("unexpected query_split: %+v", split)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - query_split:
+        interval: 0s
+`); err == nil {
+		t.Fatal("expected an error for an invalid interval")
+	}
+}
+
+func TestServerGroupQuerySharding(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+      query_sharding:
+        shards: 16
+`)
+	if sharding := cfg.ServerGroups[0].QuerySharding; sharding == nil || sharding.Shards != 16 || sharding.Label != "__query_shard__" {
+		t.Fatalf("unexpected query_sharding: %+v", sharding)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - query_sharding:
+        shards: 1
+`); err == nil {
+		t.Fatal("expected an error for a single shard")
+	}
+}
+
+func TestServerGroupVictoriaMetrics(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:8428]
+      victoria_metrics: true
+`)
+	if !cfg.ServerGroups[0].VictoriaMetrics {
+		t.Fatal("expected victoria_metrics to be set")
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - victoria_metrics: true
+      remote_read: true
+`); err == nil {
+		t.Fatal("expected an error for victoria_metrics with remote_read")
+	}
+}
+
+func TestServerGroupConnectionPool(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: [localhost:9090]
+    - static_configs:
+        - targets: [localhost:9091]
+      http_client:
+        max_idle_conns_per_host: 50
+        idle_conn_timeout: 90s
+        tls_handshake_timeout: 5s
+`)
+	defaults, tuned := cfg.ServerGroups[0].HTTPConfig, cfg.ServerGroups[1].HTTPConfig
+	if defaults.MaxIdleConnsPerHost != 1000 || defaults.IdleConnTimeout != 5*time.Minute || defaults.DialTimeout != 200*time.Millisecond {
+		t.Fatalf("unexpected default http_client %+v", defaults)
+	}
+	if tuned.MaxIdleConnsPerHost != 50 || tuned.IdleConnTimeout != 90*time.Second || tuned.TLSHandshakeTimeout != 5*time.Second || tuned.MaxIdleConns != 20000 {
+		t.Fatalf("unexpected tuned http_client %+v", tuned)
+	}
+}
+
+func TestServerGroupNames(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - name: local
+      max_concurrent_requests: 10
+    - name: lts
+`)
+	if cfg.ServerGroups[0].Name != "local" || cfg.ServerGroups[0].MaxConcurrentRequests != 10 || cfg.ServerGroups[1].Name != "lts" {
+		t.Fatalf("unexpected server groups %+v %+v", cfg.ServerGroups[0], cfg.ServerGroups[1])
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - name: local
+    - name: local
+`); err == nil {
+		t.Fatal("expected an error for duplicate names")
+	}
+}
+
+func TestLookbackDeltaStepAlignment(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  lookback_delta: 1m
+  align_queries_with_step: true
+  server_groups:
+    - name: default
+    - name: override
+      lookback_delta: 10m
+      align_queries_with_step: false
+`)
+	defaults, override := cfg.ServerGroups[0], cfg.ServerGroups[1]
+	if defaults.LookbackDelta != time.Minute || defaults.AlignQueriesWithStep == nil || !*defaults.AlignQueriesWithStep {
+		t.Fatalf("unexpected defaults lookback_delta=%v align_queries_with_step=%v", defaults.LookbackDelta, defaults.AlignQueriesWithStep)
+	}
+	if override.LookbackDelta != 10*time.Minute || override.AlignQueriesWithStep == nil || *override.AlignQueriesWithStep {
+		t.Fatalf("unexpected overrides lookback_delta=%v align_queries_with_step=%v", override.LookbackDelta, override.AlignQueriesWithStep)
+	}
+}
+
+func TestQueryQueue(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  query_queue:
+    max_concurrency: 20
+    tenant_priorities:
+      scripts: low
+`)
+	queue := cfg.QueryQueue
+	if queue == nil || queue.MaxConcurrency != 20 || queue.PriorityHeader != "X-Query-Priority" || queue.DefaultPriority != queryqueue.PriorityNormal {
+		t.Fatalf("unexpected query_queue: %+v", queue)
+	}
+	if queue.TenantPriorities["scripts"] != queryqueue.PriorityLow {
+		t.Fatalf("unexpected tenant_priorities: %v", queue.TenantPriorities)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  query_queue:
+    max_concurrency: 20
+    default_priority: urgent
+`); err == nil {
+		t.Fatal("expected an error for an invalid priority")
+	}
+	if _, err := loadConfigString(t, `
+promxy:
+  query_queue:
+    priority_header: X-Priority
+`); err == nil {
+		t.Fatal("expected an error without max_concurrency")
+	}
+}
+
+func TestDownsampling(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - downsampling:
+        resolutions: [1h, 5m]
+`)
+	ds := cfg.ServerGroups[0].Downsampling
+	if ds == nil || len(ds.Resolutions) != 2 || ds.Resolutions[0] != 5*time.Minute || ds.Resolutions[1] != time.Hour {
+		t.Fatalf("unexpected downsampling: %+v", ds)
+	}
+	if ds.StepFactor != 5 || ds.Param != "max_source_resolution" {
+		t.Fatalf("unexpected downsampling defaults: %+v", ds)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - downsampling:
+        step_factor: 5
+`); err == nil {
+		t.Fatal("expected an error without resolutions")
+	}
+}
+
+func TestQueryMaxAge(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  query_max_age:
+    max_age: 90d
+    tenant_max_age:
+      archive: 400d
+`)
+	maxAge := cfg.QueryMaxAge
+	if maxAge == nil || time.Duration(maxAge.MaxAge) != 90*24*time.Hour || maxAge.TenantHeader != "X-Scope-OrgID" {
+		t.Fatalf("unexpected query_max_age: %+v", maxAge)
+	}
+	if time.Duration(maxAge.TenantMaxAge["archive"]) != 400*24*time.Hour {
+		t.Fatalf("unexpected tenant_max_age: %v", maxAge.TenantMaxAge)
+	}
+}
+
+func TestQueryDenyList(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  query_deny_list:
+    - regex: '\{__name__=~"\.\+"\}'
+      reason: selects every series
+    - query: sum(rate(foo[5m])) by (job)
+`)
+	if len(cfg.QueryDenyList) != 2 || cfg.QueryDenyList[0].Reason != "selects every series" {
+		t.Fatalf("unexpected query_deny_list: %+v", cfg.QueryDenyList)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  query_deny_list:
+    - reason: missing the regex
+`); err == nil {
+		t.Fatal("expected an error for a rule without a regex or query")
+	}
+}
+
+func TestQueryRewriteRules(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  query_rewrite_rules:
+    - expr: sum(rate(foo[5m])) by (job)
+      replacement: job:foo:rate5m
+    - matchers: ['env="prod"']
+`)
+	if len(cfg.QueryRewriteRules) != 2 || cfg.QueryRewriteRules[0].Replacement != "job:foo:rate5m" || len(cfg.QueryRewriteRules[1].Matchers) != 1 {
+		t.Fatalf("unexpected query_rewrite_rules: %+v", cfg.QueryRewriteRules)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  query_rewrite_rules:
+    - expr: sum(rate(foo[5m])) by (job)
+      replacement: sum(
+`); err == nil {
+		t.Fatal("expected an error for an invalid replacement")
+	}
+}
+
+func TestAntiAffinity(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - anti_affinity: 10s
+    - scrape_interval: 15s
+      anti_affinity_auto: true
+`)
+	if aa := cfg.ServerGroups[0].GetAntiAffinity(); aa != 10000 || cfg.ServerGroups[0].AntiAffinityAuto {
+		t.Fatalf("unexpected anti-affinity: %v", aa)
+	}
+	if aa := cfg.ServerGroups[1].GetAntiAffinity(); aa != 15000 || !cfg.ServerGroups[1].AntiAffinityAuto {
+		t.Fatalf("unexpected anti-affinity: %v", aa)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - scrape_interval: -15s
+`); err == nil {
+		t.Fatal("expected an error for a negative scrape_interval")
+	}
+}
+
+func TestAntiAffinityLabel(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - anti_affinity_label: __anti_affinity__
+`)
+	if label := cfg.ServerGroups[0].AntiAffinityLabel; label != "__anti_affinity__" {
+		t.Fatalf("unexpected anti_affinity_label: %q", label)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - anti_affinity_label: anti-affinity
+`); err == nil {
+		t.Fatal("expected an error for an invalid anti_affinity_label")
+	}
+}
+
+func TestMergeStrategy(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - merge_strategy: max
+    - anti_affinity: 10s
+    - merge_strategy: counter
+`)
+	if cfg.ServerGroups[0].MergeStrategy != promhttputil.MergeStrategyMax || cfg.ServerGroups[1].MergeStrategy != promhttputil.MergeStrategyDefault {
+		t.Fatalf("unexpected merge_strategy: %q %q", cfg.ServerGroups[0].MergeStrategy, cfg.ServerGroups[1].MergeStrategy)
+	}
+	if cfg.ServerGroups[2].MergeStrategy != promhttputil.MergeStrategyCounter {
+		t.Fatalf("unexpected merge_strategy: %q", cfg.ServerGroups[2].MergeStrategy)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - merge_strategy: median
+`); err == nil {
+		t.Fatal("expected an error for an invalid merge_strategy")
+	}
+}
+
+func TestGapFill(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - gap_fill: true
+    - anti_affinity: 10s
+`)
+	if !cfg.ServerGroups[0].GapFill || cfg.ServerGroups[1].GapFill {
+		t.Fatalf("unexpected gap_fill: %v %v", cfg.ServerGroups[0].GapFill, cfg.ServerGroups[1].GapFill)
+	}
+}
+
+func TestDedupTolerance(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - dedup_tolerance:
+        time: 15s
+        ratio: 0.01
+`)
+	tolerance := cfg.ServerGroups[0].DedupTolerance
+	if tolerance == nil || tolerance.Time != 15*time.Second || tolerance.Ratio != 0.01 || tolerance.Value != 0 {
+		t.Fatalf("unexpected dedup_tolerance: %+v", tolerance)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - dedup_tolerance:
+        value: 1
+`); err == nil {
+		t.Fatal("expected an error without a time")
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  query_limits:
+    max_series: 1000
+    max_samples: 50000
+    max_merge_bytes: 1000000
+`)
+	limits := cfg.QueryLimits
+	if limits == nil || limits.MaxSeries != 1000 || limits.MaxSamples != 50000 || limits.Fail {
+		t.Fatalf("unexpected query_limits: %+v", limits)
+	}
+	if mergeLimits := limits.MergeLimits(); mergeLimits != (promhttputil.MergeLimits{MaxBytes: 1000000}) {
+		t.Fatalf("unexpected merge limits: %+v", mergeLimits)
+	}
+	// Without query_limits the merged results aren't limited
+	var noLimits *QueryLimitsConfig
+	if mergeLimits := noLimits.MergeLimits(); mergeLimits != (promhttputil.MergeLimits{}) {
+		t.Fatalf("unexpected merge limits: %+v", mergeLimits)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  query_limits:
+    max_series: -1
+`); err == nil {
+		t.Fatal("expected an error for a negative limit")
+	}
+	if _, err := loadConfigString(t, `
+promxy:
+  query_limits:
+    max_merge_samples: -1
+`); err == nil {
+		t.Fatal("expected an error for a negative limit")
+	}
+}
+
+func TestFileServerGroupStore(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Write([]byte(`
+promxy:
+  server_groups:
+    - name: a
+      static_configs:
+        - targets: ["a:9090"]
+`))
+	file.Close()
+
+	reloads := 0
+	store := &FileServerGroupStore{Path: file.Name(), Reload: func() error {
+		reloads++
+		return nil
+	}}
+
+	if err := store.PutServerGroup("b", []byte("static_configs:\n  - targets: [\"b:9090\"]\nscheme: https\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutServerGroup("a", []byte("static_configs:\n  - targets: [\"a:9091\"]\n")); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := store.ServerGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].Name != "a" || groups[1].Name != "b" || groups[1].Scheme != "https" {
+		t.Fatalf("unexpected server groups: %v", groups)
+	}
+	if target := groups[0].ServiceDiscoveryConfigs[0].(discovery.StaticConfig)[0].Targets[0][model.AddressLabel]; target != "a:9091" {
+		t.Fatalf("server group wasn't replaced, got target %s", target)
+	}
+
+	if err := store.DeleteServerGroup("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.DeleteServerGroup("a").(*ServerGroupNotFoundError); !ok {
+		t.Fatal("expected a ServerGroupNotFoundError deleting a missing server group")
+	}
+	if _, ok := store.PutServerGroup("c", []byte("scheme: ftp\n")).(*InvalidServerGroupError); !ok {
+		t.Fatal("expected an InvalidServerGroupError for an invalid server group")
+	}
+	if reloads != 3 {
+		t.Fatalf("expected 3 reloads, got %d", reloads)
+	}
+
+	// Failed reloads restore the previous config
+	store.Reload = func() error {
+		if reloads++; reloads == 4 {
+			return fmt.Errorf("reload failed")
+		}
+		return nil
+	}
+	if err := store.DeleteServerGroup("b"); err == nil {
+		t.Fatal("expected an error from the failed reload")
+	}
+	if groups, err := store.ServerGroups(); err != nil || len(groups) != 1 {
+		t.Fatalf("previous config wasn't restored: %v %v", groups, err)
+	}
+}
+
+func TestTenant(t *testing.T) {
+	cfg := configFromString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: ['localhost:9090']
+      tenant:
+        map:
+          team-a: cortex-team-a
+        default: promxy
+        reject_unmapped: true
+`)
+	tenant := cfg.ServerGroups[0].Tenant
+	if tenant == nil || tenant.Header != "X-Scope-OrgID" || tenant.Map["team-a"] != "cortex-team-a" || tenant.Default != "promxy" || !tenant.RejectUnmapped {
+		t.Fatalf("unexpected tenant: %+v", tenant)
+	}
+
+	if _, err := loadConfigString(t, `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets: ['localhost:9090']
+      tenant:
+        header: ""
+`); err == nil {
+		t.Fatal("expected an error for an empty tenant header")
+	}
+}
@@ -12,6 +12,14 @@ type Reloadable interface {
 	ApplyConfig(*Config) error
 }
 
+// ReloadableFunc is a function applying a promxy config, which implements Reloadable
+type ReloadableFunc func(*Config) error
+
+// ApplyConfig applies new configuration
+func (f ReloadableFunc) ApplyConfig(c *Config) error {
+	return f(c)
+}
+
 // PromReloadableWrap wraps a PromReloadable into a Reloadable
 type PromReloadableWrap struct {
 	R PromReloadable
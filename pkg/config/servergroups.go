@@ -0,0 +1,186 @@
+package proxyconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/jacksontj/promxy/pkg/servergroup"
+)
+
+// ServerGroupNotFoundError is returned when modifying a server group which isn't in the config
+type ServerGroupNotFoundError struct {
+	Name string
+}
+
+func (e *ServerGroupNotFoundError) Error() string {
+	return fmt.Sprintf("server group %q not found", e.Name)
+}
+
+// InvalidServerGroupError is returned when a server group change results in an invalid config
+type InvalidServerGroupError struct {
+	Err error
+}
+
+func (e *InvalidServerGroupError) Error() string {
+	return e.Err.Error()
+}
+
+// FileServerGroupStore adds, replaces and removes the (named) server groups in
+// a config file at runtime. The file is rewritten (without its comments) and
+// then Reload is called, if the reload fails the previous file is restored
+// (and reloaded).
+type FileServerGroupStore struct {
+	Path string
+	// Reload applies the changed config file
+	Reload func() error
+
+	l sync.Mutex
+}
+
+// ServerGroups returns the server groups in the config file
+func (s *FileServerGroupStore) ServerGroups() ([]*servergroup.Config, error) {
+	cfg, err := ConfigFromFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.ServerGroups, nil
+}
+
+// PutServerGroup adds the server group (as YAML) with the given name, replacing
+// any existing server group with the name
+func (s *FileServerGroupStore) PutServerGroup(name string, cfg []byte) error {
+	var sg yaml.MapSlice
+	if err := yaml.Unmarshal(cfg, &sg); err != nil {
+		return &InvalidServerGroupError{err}
+	}
+	sg = setMapItem(sg, "name", name)
+
+	return s.edit(func(serverGroups []interface{}) ([]interface{}, error) {
+		if i := findServerGroup(serverGroups, name); i >= 0 {
+			serverGroups[i] = sg
+			return serverGroups, nil
+		}
+		return append(serverGroups, sg), nil
+	})
+}
+
+// DeleteServerGroup removes the server group with the given name
+func (s *FileServerGroupStore) DeleteServerGroup(name string) error {
+	return s.edit(func(serverGroups []interface{}) ([]interface{}, error) {
+		i := findServerGroup(serverGroups, name)
+		if i < 0 {
+			return nil, &ServerGroupNotFoundError{name}
+		}
+		return append(serverGroups[:i], serverGroups[i+1:]...), nil
+	})
+}
+
+// edit applies f to the server groups in the config file, validates and writes
+// the resulting config and reloads it
+func (s *FileServerGroupStore) edit(f func([]interface{}) ([]interface{}, error)) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	original, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return err
+	}
+	var root yaml.MapSlice
+	if err := yaml.Unmarshal(original, &root); err != nil {
+		return err
+	}
+
+	promxy, _ := getMapItem(root, "promxy").(yaml.MapSlice)
+	serverGroups, _ := getMapItem(promxy, "server_groups").([]interface{})
+	serverGroups, err = f(serverGroups)
+	if err != nil {
+		return err
+	}
+	root = setMapItem(root, "promxy", setMapItem(promxy, "server_groups", serverGroups))
+
+	b, err := yaml.Marshal(root)
+	if err != nil {
+		return err
+	}
+	if _, err := configFromBytes(b); err != nil {
+		return &InvalidServerGroupError{err}
+	}
+
+	if err := writeFileAtomic(s.Path, b); err != nil {
+		return err
+	}
+	if s.Reload != nil {
+		if err := s.Reload(); err != nil {
+			// Restore (and re-apply) the previous config, as the reload may have been partially applied
+			if restoreErr := writeFileAtomic(s.Path, original); restoreErr != nil {
+				return fmt.Errorf("error reloading config: %v (and restoring the previous config: %v)", err, restoreErr)
+			}
+			if restoreErr := s.Reload(); restoreErr != nil {
+				return fmt.Errorf("error reloading config: %v (and reloading the previous config: %v)", err, restoreErr)
+			}
+			return fmt.Errorf("error reloading config: %v", err)
+		}
+	}
+	return nil
+}
+
+// findServerGroup returns the index of the server group with the given name, or -1
+func findServerGroup(serverGroups []interface{}, name string) int {
+	for i, sg := range serverGroups {
+		if sgMap, ok := sg.(yaml.MapSlice); ok && getMapItem(sgMap, "name") == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// getMapItem returns the value of the key in the map, or nil
+func getMapItem(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+// setMapItem sets the value of the key in the map (keeping the order of the keys)
+func setMapItem(m yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i, item := range m {
+		if item.Key == key {
+			m[i].Value = value
+			return m
+		}
+	}
+	return append(m, yaml.MapItem{Key: key, Value: value})
+}
+
+// writeFileAtomic replaces the file with the contents, such that readers see
+// either the old or the new contents
+func writeFileAtomic(path string, b []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,11 @@
+package promclient
+
+// AdminResult is the result of an admin action (e.g. deleting series) on a single server
+type AdminResult struct {
+	// Server identifies the downstream server the action was sent to
+	Server string `json:"server"`
+	// Error is set if the action failed on the server
+	Error string `json:"error,omitempty"`
+	// Name is the name of the snapshot created on the server
+	Name string `json:"name,omitempty"`
+}
@@ -0,0 +1,83 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestMultiAPIDeleteSeries(t *testing.T) {
+	var lock sync.Mutex
+	var sent [][]string
+	stub := func() API {
+		return &stubAPI{
+			deleteSeries: func(matches []string) []AdminResult {
+				lock.Lock()
+				defer lock.Unlock()
+				sent = append(sent, matches)
+				return []AdminResult{{}}
+			},
+		}
+	}
+
+	// Hedging must not stop the deletion from being sent to all replicas
+	api := NewMultiAPI([]API{
+		&AddLabelClient{stub(), model.LabelSet{"sg": "1"}},
+		&AddLabelClient{stub(), model.LabelSet{"sg": "1"}},
+		&AddLabelClient{&errorAPI{stub(), fmt.Errorf("unavailable")}, model.LabelSet{"sg": "1"}},
+		&AddLabelClient{stub(), model.LabelSet{"sg": "2"}},
+	}, model.Time(0), nil, 1,
+		WithAPINames([]string{"a:9090", "b:9090", "c:9090", "d:9090"}),
+		WithHedging(NewHedgeTracker(time.Minute, 0)),
+	)
+
+	results, _, err := api.DeleteSeries(context.TODO(), []string{`up{sg="1"}`}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// d:9090 doesn't match the selector, so the deletion isn't sent to it
+	expected := []AdminResult{
+		{Server: "a:9090"},
+		{Server: "b:9090"},
+		{Server: "c:9090", Error: "unavailable"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("mismatch in results expected=%v actual=%v", expected, results)
+	}
+	if !reflect.DeepEqual(sent, [][]string{{"up"}, {"up"}}) {
+		t.Fatalf("unexpected matchers sent: %v", sent)
+	}
+}
+
+func TestMultiAPISnapshot(t *testing.T) {
+	stub := func(name string) API {
+		return &stubAPI{
+			admin: func() []AdminResult {
+				return []AdminResult{{Name: name}}
+			},
+		}
+	}
+
+	inner := NewMultiAPI([]API{stub("a"), stub("b")}, model.Time(0), nil, 1, WithAPINames([]string{"a:9090", "b:9090"}))
+	api := NewMultiAPI([]API{inner, &errorAPI{stub("c"), fmt.Errorf("unavailable")}}, model.Time(0), nil, 1)
+
+	results, _, err := api.Snapshot(context.TODO(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []AdminResult{
+		{Server: "a:9090", Name: "a"},
+		{Server: "b:9090", Name: "b"},
+		{Server: "1", Error: "unavailable"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("mismatch in results expected=%v actual=%v", expected, results)
+	}
+}
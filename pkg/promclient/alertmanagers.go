@@ -0,0 +1,28 @@
+package promclient
+
+import (
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// mergeAlertManagerList merges the alertmanagers from b into a, by URL
+func mergeAlertManagerList(a, b []v1.AlertManager) []v1.AlertManager {
+	urls := make(map[string]struct{}, len(a))
+	for _, am := range a {
+		urls[am.URL] = struct{}{}
+	}
+
+	for _, am := range b {
+		if _, ok := urls[am.URL]; !ok {
+			urls[am.URL] = struct{}{}
+			a = append(a, am)
+		}
+	}
+	return a
+}
+
+// MergeAlertManagers merges the alertmanagers from b into a
+func MergeAlertManagers(a, b v1.AlertManagersResult) v1.AlertManagersResult {
+	a.Active = mergeAlertManagerList(a.Active, b.Active)
+	a.Dropped = mergeAlertManagerList(a.Dropped, b.Dropped)
+	return a
+}
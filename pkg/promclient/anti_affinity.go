@@ -0,0 +1,71 @@
+package promclient
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/common/model"
+)
+
+// maxObservedSeries is the maximum number of series of a value the spacing of the samples is
+// observed from, which bounds the cost of observing large values
+const maxObservedSeries = 64
+
+// AntiAffinityTracker learns the typical spacing of the samples (i.e. the scrape interval) of
+// the raw series returned by the apis, from which the anti-affinity is derived: as for a
+// statically configured anti-affinity, it is the scrape interval.
+type AntiAffinityTracker struct {
+	l        sync.Mutex
+	interval model.Time
+	observed bool
+}
+
+// NewAntiAffinityTracker returns an AntiAffinityTracker starting from the anti-affinity
+// `initial` until the spacing of samples is observed
+func NewAntiAffinityTracker(initial model.Time) *AntiAffinityTracker {
+	return &AntiAffinityTracker{interval: initial}
+}
+
+// Observe updates the interval with the median spacing of the samples of the matrix (the
+// value must be the raw samples of a single api, as merged series are interleaved)
+func (t *AntiAffinityTracker) Observe(v model.Value) {
+	m, ok := v.(model.Matrix)
+	if !ok {
+		return
+	}
+	var deltas []model.Time
+	for i, stream := range m {
+		if i == maxObservedSeries {
+			break
+		}
+		for j := 1; j < len(stream.Values); j++ {
+			deltas = append(deltas, stream.Values[j].Timestamp-stream.Values[j-1].Timestamp)
+		}
+	}
+	if len(deltas) == 0 {
+		return
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i] < deltas[j] })
+	median := deltas[len(deltas)/2]
+	if median <= 0 {
+		return
+	}
+
+	t.l.Lock()
+	defer t.l.Unlock()
+	// The first observation replaces the initial anti-affinity, the others are smoothed
+	// such that a single odd value (e.g. of a job with a different interval) has little effect
+	if !t.observed {
+		t.interval = median
+		t.observed = true
+		return
+	}
+	t.interval += (median - t.interval) / 4
+}
+
+// AntiAffinity returns the anti-affinity derived from the observed interval
+func (t *AntiAffinityTracker) AntiAffinity() model.Time {
+	t.l.Lock()
+	defer t.l.Unlock()
+	return t.interval
+}
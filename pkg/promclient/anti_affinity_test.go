@@ -0,0 +1,60 @@
+package promclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestAntiAffinityTracker(t *testing.T) {
+	matrix := func(interval model.Time, offset model.Time) model.Matrix {
+		stream := &model.SampleStream{Metric: model.Metric{model.MetricNameLabel: "testmetric"}}
+		for i := model.Time(0); i < 10; i++ {
+			stream.Values = append(stream.Values, model.SamplePair{Timestamp: i*interval + offset, Value: 1})
+		}
+		return model.Matrix{stream}
+	}
+
+	tracker := NewAntiAffinityTracker(5000)
+	// Values without series (or with single samples) aren't observed
+	tracker.Observe(model.Vector{})
+	tracker.Observe(model.Matrix{{Values: []model.SamplePair{{Timestamp: 1, Value: 1}}}})
+	if aa := tracker.AntiAffinity(); aa != 5000 {
+		t.Fatalf("unexpected anti-affinity %v", aa)
+	}
+
+	// The replicas scrape every 15s, 7s apart
+	replica := func(offset model.Time) API {
+		return &AddLabelClient{&stubAPI{getValue: func() model.Value { return matrix(15000, offset) }}, model.LabelSet{"replica": "set"}}
+	}
+	m := NewMultiAPI([]API{replica(0), replica(7000)}, 0, nil, 1, WithAntiAffinityTracker(tracker))
+
+	// The first merge uses the initial anti-affinity, such that the samples are interleaved
+	v, _, err := m.GetValue(context.TODO(), time.Time{}, time.Time{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(v.(model.Matrix)[0].Values); n != 20 {
+		t.Fatalf("expected interleaved samples, got %d", n)
+	}
+	if aa := tracker.AntiAffinity(); aa != 15000 {
+		t.Fatalf("unexpected anti-affinity %v", aa)
+	}
+
+	// Once observed the samples of the replicas are merged
+	v, _, err = m.GetValue(context.TODO(), time.Time{}, time.Time{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(v.(model.Matrix)[0].Values); n != 10 {
+		t.Fatalf("expected merged samples, got %d", n)
+	}
+
+	// Later observations are smoothed
+	tracker.Observe(matrix(35000, 0))
+	if aa := tracker.AntiAffinity(); aa != 20000 {
+		t.Fatalf("unexpected anti-affinity %v", aa)
+	}
+}
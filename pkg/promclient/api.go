@@ -2,10 +2,15 @@ package promclient
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
+	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
@@ -15,15 +20,75 @@ import (
 	"github.com/jacksontj/promxy/pkg/promhttputil"
 )
 
+// formatTime formats a time as prometheus API expects it
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.Unix())+float64(t.Nanosecond())/1e9, 'f', -1, 64)
+}
+
 var (
 	minTime = time.Unix(math.MinInt64/1000+62135596801, 0).UTC()
 	maxTime = time.Unix(math.MaxInt64/1000-62135596801, 999999999).UTC()
 )
 
+// NewPromAPIV1 returns a PromAPIV1 using the given client
+func NewPromAPIV1(client api.Client) *PromAPIV1 {
+	return &PromAPIV1{API: v1.NewAPI(client), client: client}
+}
+
 // PromAPIV1 implements our internal API interface using *only* the v1 HTTP API
 // Simply wraps the prom API to fullfil our internal API interface
 type PromAPIV1 struct {
 	v1.API
+
+	// client is used for the endpoints the v1 API doesn't support (yet)
+	client api.Client
+}
+
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType v1.ErrorType    `json:"errorType"`
+	Error     string          `json:"error"`
+	Warnings  []string        `json:"warnings,omitempty"`
+}
+
+// get makes a GET request to the given endpoint, returning the data of the response
+func (p *PromAPIV1) get(ctx context.Context, ep string, args url.Values) (json.RawMessage, v1.Warnings, error) {
+	if p.client == nil {
+		return nil, nil, fmt.Errorf("%s not supported by client", ep)
+	}
+
+	u := p.client.URL(ep, nil)
+	q := u.Query()
+	for k, vs := range args {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, body, err := p.client.Do(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Prometheus returns errors with a 4xx/5xx code and the error in the body
+	var result apiResponse
+	if jsonErr := json.Unmarshal(body, &result); jsonErr != nil {
+		if resp.StatusCode/100 != 2 {
+			return nil, nil, &v1.Error{Type: v1.ErrServer, Msg: fmt.Sprintf("server error: %d", resp.StatusCode), Detail: string(body)}
+		}
+		return nil, nil, &v1.Error{Type: v1.ErrBadResponse, Msg: jsonErr.Error()}
+	}
+	if result.Status == "error" {
+		return nil, result.Warnings, &v1.Error{Type: result.ErrorType, Msg: result.Error}
+	}
+	return result.Data, result.Warnings, nil
 }
 
 // LabelNames returns all the unique label names present in the block in sorted order.
@@ -32,8 +97,148 @@ func (p *PromAPIV1) LabelNames(ctx context.Context) ([]string, v1.Warnings, erro
 }
 
 // LabelValues performs a query for the values of the given label.
-func (p *PromAPIV1) LabelValues(ctx context.Context, label string) (model.LabelValues, v1.Warnings, error) {
-	return p.API.LabelValues(ctx, label, minTime, maxTime)
+func (p *PromAPIV1) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	if startTime.IsZero() {
+		startTime = minTime
+	}
+	if endTime.IsZero() {
+		endTime = maxTime
+	}
+
+	// The v1 client doesn't support matchers, so we only use it without them
+	if len(matchers) == 0 {
+		return p.API.LabelValues(ctx, label, startTime, endTime)
+	}
+
+	data, w, err := p.get(ctx, "/api/v1/label/"+url.PathEscape(label)+"/values", url.Values{
+		"match[]": matchers,
+		"start":   []string{formatTime(startTime)},
+		"end":     []string{formatTime(endTime)},
+	})
+	if err != nil {
+		return nil, w, err
+	}
+
+	var v model.LabelValues
+	err = json.Unmarshal(data, &v)
+	return v, w, err
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (p *PromAPIV1) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	v, err := p.API.Metadata(ctx, metric, limit)
+	return v, nil, err
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (p *PromAPIV1) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	v, err := p.API.Targets(ctx)
+	return v, nil, err
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (p *PromAPIV1) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	v, err := p.API.Rules(ctx)
+	return v, nil, err
+}
+
+// Alerts returns a list of all active alerts.
+func (p *PromAPIV1) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	v, err := p.API.Alerts(ctx)
+	return v, nil, err
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+func (p *PromAPIV1) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	v, err := p.API.AlertManagers(ctx)
+	return v, nil, err
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (p *PromAPIV1) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	data, w, err := p.get(ctx, "/api/v1/query_exemplars", url.Values{
+		"query": []string{query},
+		"start": []string{formatTime(startTime)},
+		"end":   []string{formatTime(endTime)},
+	})
+	if err != nil {
+		return nil, w, err
+	}
+
+	var v []ExemplarQueryResult
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, w, err
+	}
+	return v, w, nil
+}
+
+// TSDB returns the cardinality statistics of the TSDB.
+func (p *PromAPIV1) TSDB(ctx context.Context) (TSDBResult, v1.Warnings, error) {
+	var v TSDBResult
+	data, w, err := p.get(ctx, "/api/v1/status/tsdb", nil)
+	if err != nil {
+		return v, w, err
+	}
+
+	err = json.Unmarshal(data, &v)
+	return v, w, err
+}
+
+// Buildinfo returns the build information of the server.
+func (p *PromAPIV1) Buildinfo(ctx context.Context) ([]BuildinfoResult, v1.Warnings, error) {
+	data, w, err := p.get(ctx, "/api/v1/status/buildinfo", nil)
+	if err != nil {
+		return nil, w, err
+	}
+
+	var v BuildinfoResult
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, w, err
+	}
+	return []BuildinfoResult{v}, w, nil
+}
+
+// Runtimeinfo returns the runtime information of the server.
+func (p *PromAPIV1) Runtimeinfo(ctx context.Context) ([]RuntimeinfoResult, v1.Warnings, error) {
+	v, err := p.API.Runtimeinfo(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []RuntimeinfoResult{{RuntimeinfoResult: v}}, nil, nil
+}
+
+// Config returns the configuration of the server.
+func (p *PromAPIV1) Config(ctx context.Context) ([]ConfigResult, v1.Warnings, error) {
+	v, err := p.API.Config(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []ConfigResult{{YAML: v.YAML}}, nil, nil
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+func (p *PromAPIV1) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error) {
+	if err := p.API.DeleteSeries(ctx, matches, startTime, endTime); err != nil {
+		return nil, nil, err
+	}
+	return []AdminResult{{}}, nil, nil
+}
+
+// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+func (p *PromAPIV1) CleanTombstones(ctx context.Context) ([]AdminResult, v1.Warnings, error) {
+	if err := p.API.CleanTombstones(ctx); err != nil {
+		return nil, nil, err
+	}
+	return []AdminResult{{}}, nil, nil
+}
+
+// Snapshot creates a snapshot of all current data on the server.
+func (p *PromAPIV1) Snapshot(ctx context.Context, skipHead bool) ([]AdminResult, v1.Warnings, error) {
+	v, err := p.API.Snapshot(ctx, skipHead)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []AdminResult{{Name: v.Name}}, nil, nil
 }
 
 // GetValue loads the raw data for a given set of matchers in the time range
@@ -0,0 +1,108 @@
+package promclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestPromAPIV1PathPrefix(t *testing.T) {
+	var l sync.Mutex
+	paths := make(map[string]struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Lock()
+		paths[r.URL.Path] = struct{}{}
+		l.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClient(api.Config{Address: srv.URL + "/prometheus"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	promAPI := NewPromAPIV1(client)
+
+	ctx := context.TODO()
+	now := time.Now()
+	promAPI.Query(ctx, "up", now)
+	promAPI.QueryRange(ctx, "up", v1.Range{Start: now, End: now, Step: time.Second})
+	promAPI.GetValue(ctx, now, now, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")})
+	promAPI.Series(ctx, []string{"up"}, now, now)
+	promAPI.LabelNames(ctx)
+	promAPI.LabelValues(ctx, "job", nil, time.Time{}, time.Time{})
+	promAPI.Buildinfo(ctx)
+
+	expected := []string{
+		"/prometheus/api/v1/label/job/values",
+		"/prometheus/api/v1/labels",
+		"/prometheus/api/v1/query",
+		"/prometheus/api/v1/query_range",
+		"/prometheus/api/v1/series",
+		"/prometheus/api/v1/status/buildinfo",
+	}
+	actual := make([]string, 0, len(paths))
+	for p := range paths {
+		actual = append(actual, p)
+	}
+	sort.Strings(actual)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("mismatch in paths expected=%v actual=%v", expected, actual)
+	}
+}
+
+type stubReadClient struct {
+	query  *prompb.Query
+	result *prompb.QueryResult
+}
+
+func (s *stubReadClient) Read(ctx context.Context, query *prompb.Query) (*prompb.QueryResult, error) {
+	s.query = query
+	return s.result, nil
+}
+
+func TestPromAPIRemoteRead(t *testing.T) {
+	readClient := &stubReadClient{
+		result: &prompb.QueryResult{
+			Timeseries: []*prompb.TimeSeries{
+				{
+					Labels:  []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}},
+					Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}},
+				},
+			},
+		},
+	}
+	// Everything but GetValue goes to the query API
+	promAPI := &PromAPIRemoteRead{&stubAPI{}, readClient}
+
+	start, end := time.Unix(1, 0), time.Unix(2, 0)
+	v, _, err := promAPI.GetValue(context.TODO(), start, end, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readClient.query.StartTimestampMs != 1000 || readClient.query.EndTimestampMs != 2000 || len(readClient.query.Matchers) != 1 {
+		t.Fatalf("unexpected remote read query: %v", readClient.query)
+	}
+	expected := model.Matrix{
+		{
+			Metric: model.Metric{"__name__": "up", "job": "a"},
+			Values: []model.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}},
+		},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch in result expected=%v actual=%v", expected, v)
+	}
+}
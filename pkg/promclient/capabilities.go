@@ -0,0 +1,190 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+)
+
+// Capabilities are the (optional) features of the prometheus API supported by a downstream
+type Capabilities struct {
+	// Version is the detected version of the downstream, empty if it is unknown
+	Version string
+	// LabelValuesMatchers is whether match[] is supported on /api/v1/label/<name>/values (2.24+)
+	LabelValuesMatchers bool
+	// Exemplars is whether /api/v1/query_exemplars is supported (2.26+)
+	Exemplars bool
+}
+
+// AllCapabilities are assumed for downstreams whose version is unknown (e.g. not
+// yet detected or not a prometheus), such that they are used as-is
+var AllCapabilities = Capabilities{
+	LabelValuesMatchers: true,
+	Exemplars:           true,
+}
+
+// CapabilitiesForVersion returns the capabilities of the given prometheus version (e.g. 2.26.0)
+func CapabilitiesForVersion(version string) (Capabilities, error) {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return AllCapabilities, fmt.Errorf("invalid version %q", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return AllCapabilities, fmt.Errorf("invalid version %q", version)
+	}
+	minor, err := strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		return AllCapabilities, fmt.Errorf("invalid version %q", version)
+	}
+
+	atLeast := func(wantMajor, wantMinor int) bool {
+		return major > wantMajor || (major == wantMajor && minor >= wantMinor)
+	}
+	return Capabilities{
+		Version:             version,
+		LabelValuesMatchers: atLeast(2, 24),
+		Exemplars:           atLeast(2, 26),
+	}, nil
+}
+
+// NewCapabilityDetector returns a CapabilityDetector detecting the capabilities of
+// the API from its build info every interval
+func NewCapabilityDetector(api API, interval time.Duration) *CapabilityDetector {
+	return &CapabilityDetector{
+		api:          api,
+		interval:     interval,
+		capabilities: AllCapabilities,
+	}
+}
+
+// CapabilityDetector detects the capabilities of a downstream
+type CapabilityDetector struct {
+	api      API
+	interval time.Duration
+
+	l            sync.Mutex
+	capabilities Capabilities
+	cancel       context.CancelFunc
+}
+
+// Start detects the capabilities in the background until ctx is done or Stop is called
+func (d *CapabilityDetector) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	d.l.Lock()
+	d.cancel = cancel
+	d.l.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			d.detect(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops detecting the capabilities
+func (d *CapabilityDetector) Stop() {
+	d.l.Lock()
+	defer d.l.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+// Capabilities returns the last detected capabilities (AllCapabilities until detected)
+func (d *CapabilityDetector) Capabilities() Capabilities {
+	d.l.Lock()
+	defer d.l.Unlock()
+	return d.capabilities
+}
+
+// detect loads the build info of the downstream, failures keep the previous capabilities
+func (d *CapabilityDetector) detect(ctx context.Context) {
+	result, _, err := d.api.Buildinfo(ctx)
+	if err != nil || len(result) == 0 {
+		if ctx.Err() == nil {
+			logrus.Debugf("Error detecting capabilities from build info: %v", err)
+		}
+		return
+	}
+
+	capabilities, err := CapabilitiesForVersion(result[0].Version)
+	if err != nil {
+		logrus.Debugf("Error detecting capabilities from build info: %v", err)
+	}
+
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.capabilities = capabilities
+}
+
+// CapabilityAPI avoids the features of the API its downstream doesn't support,
+// falling back to equivalent calls where possible
+type CapabilityAPI struct {
+	API
+	Detector *CapabilityDetector
+}
+
+// LabelValues performs a query for the values of the given label. If the downstream
+// doesn't support matchers the values are loaded from the matching series instead.
+func (c *CapabilityAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	if len(matchers) == 0 || c.Detector.Capabilities().LabelValuesMatchers {
+		return c.API.LabelValues(ctx, label, matchers, startTime, endTime)
+	}
+
+	if startTime.IsZero() {
+		startTime = minTime
+	}
+	if endTime.IsZero() {
+		endTime = maxTime
+	}
+	series, w, err := c.API.Series(ctx, matchers, startTime, endTime)
+	if err != nil {
+		return nil, w, err
+	}
+
+	seen := make(map[model.LabelValue]struct{})
+	values := make(model.LabelValues, 0)
+	for _, lset := range series {
+		if v, ok := lset[model.LabelName(label)]; ok {
+			if _, ok := seen[v]; !ok {
+				seen[v] = struct{}{}
+				values = append(values, v)
+			}
+		}
+	}
+	sort.Sort(values)
+	return values, w, nil
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range,
+// downstreams which don't support exemplars have none.
+func (c *CapabilityAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	if !c.Detector.Capabilities().Exemplars {
+		return nil, nil, nil
+	}
+	return c.API.QueryExemplars(ctx, query, startTime, endTime)
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (c *CapabilityAPI) Key() model.LabelSet {
+	if apiLabels, ok := c.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package promclient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestCapabilitiesForVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected Capabilities
+		err      bool
+	}{
+		{version: "2.20.1", expected: Capabilities{Version: "2.20.1"}},
+		{version: "2.24.0", expected: Capabilities{Version: "2.24.0", LabelValuesMatchers: true}},
+		{version: "2.26.0-rc.0", expected: Capabilities{Version: "2.26.0-rc.0", LabelValuesMatchers: true, Exemplars: true}},
+		{version: "v3.0.0", expected: Capabilities{Version: "v3.0.0", LabelValuesMatchers: true, Exemplars: true}},
+		{version: "unknown", expected: AllCapabilities, err: true},
+	}
+
+	for _, test := range tests {
+		capabilities, err := CapabilitiesForVersion(test.version)
+		if (err != nil) != test.err {
+			t.Fatalf("%s: unexpected error %v", test.version, err)
+		}
+		if capabilities != test.expected {
+			t.Fatalf("%s: mismatch expected=%+v actual=%+v", test.version, test.expected, capabilities)
+		}
+	}
+}
+
+func TestCapabilityAPI(t *testing.T) {
+	var labelValuesCalled bool
+	stub := &stubAPI{
+		labelValues: func() model.LabelValues {
+			labelValuesCalled = true
+			return model.LabelValues{"a"}
+		},
+		series: func() []model.LabelSet {
+			return []model.LabelSet{{"job": "b"}, {"job": "a"}, {"job": "b"}, {"instance": "c"}}
+		},
+		exemplars: func() []ExemplarQueryResult {
+			return []ExemplarQueryResult{{}}
+		},
+		buildinfo: func() []BuildinfoResult {
+			return []BuildinfoResult{{Version: "2.20.0"}}
+		},
+	}
+
+	detector := NewCapabilityDetector(stub, time.Hour)
+	a := &CapabilityAPI{API: stub, Detector: detector}
+
+	// Until the capabilities are detected the calls are passed as-is
+	if _, _, err := a.LabelValues(context.TODO(), "job", []string{"up"}, time.Time{}, time.Time{}); err != nil || !labelValuesCalled {
+		t.Fatalf("expected label values to be called before detection, err=%v", err)
+	}
+
+	detector.detect(context.TODO())
+	if detector.Capabilities().Version != "2.20.0" {
+		t.Fatalf("unexpected capabilities: %+v", detector.Capabilities())
+	}
+
+	labelValuesCalled = false
+	values, _, err := a.LabelValues(context.TODO(), "job", []string{"up"}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labelValuesCalled {
+		t.Fatal("expected label values with matchers to be loaded from series")
+	}
+	if expected := (model.LabelValues{"a", "b"}); !reflect.DeepEqual(values, expected) {
+		t.Fatalf("mismatch expected=%v actual=%v", expected, values)
+	}
+
+	// Without matchers label values are supported
+	if _, _, err := a.LabelValues(context.TODO(), "job", nil, time.Time{}, time.Time{}); err != nil || !labelValuesCalled {
+		t.Fatalf("expected label values to be called without matchers, err=%v", err)
+	}
+
+	if exemplars, _, err := a.QueryExemplars(context.TODO(), "up", time.Now(), time.Now()); err != nil || len(exemplars) != 0 {
+		t.Fatalf("expected no exemplars, got %v %v", exemplars, err)
+	}
+}
@@ -0,0 +1,254 @@
+package promclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// CircuitBreakerState is the state of a CircuitBreaker
+type CircuitBreakerState int
+
+const (
+	// CircuitClosed means calls are passed through to the downstream
+	CircuitClosed CircuitBreakerState = iota
+	// CircuitOpen means calls are failed immediately without calling the downstream
+	CircuitOpen
+	// CircuitHalfOpen means a single trial call is allowed through to check if
+	// the downstream has recovered
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (s CircuitBreakerState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitOpenError is returned when a call is short-circuited by an open CircuitBreaker
+type CircuitOpenError struct {
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "circuit breaker open until " + e.Until.Format(time.RFC3339)
+}
+
+// NewCircuitBreaker returns a CircuitBreaker which opens after `errorThreshold`
+// consecutive failures and stays open for `cooldown`. If latencyThreshold is
+// non-zero calls which take longer than it are also considered failures.
+// stateFunc (if set) is called whenever the state of the breaker changes.
+func NewCircuitBreaker(errorThreshold int, latencyThreshold, cooldown time.Duration, stateFunc func(CircuitBreakerState)) *CircuitBreaker {
+	return &CircuitBreaker{
+		errorThreshold:   errorThreshold,
+		latencyThreshold: latencyThreshold,
+		cooldown:         cooldown,
+		stateFunc:        stateFunc,
+	}
+}
+
+// CircuitBreaker tracks the health of a downstream
+type CircuitBreaker struct {
+	errorThreshold   int
+	latencyThreshold time.Duration
+	cooldown         time.Duration
+	stateFunc        func(CircuitBreakerState)
+
+	l                   sync.Mutex
+	state               CircuitBreakerState
+	consecutiveFailures int
+	openUntil           time.Time
+	trialInFlight       bool
+}
+
+// State returns the current state of the breaker
+func (c *CircuitBreaker) State() CircuitBreakerState {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.state
+}
+
+func (c *CircuitBreaker) setState(state CircuitBreakerState) {
+	if c.state == state {
+		return
+	}
+	c.state = state
+	if c.stateFunc != nil {
+		c.stateFunc(state)
+	}
+}
+
+// allow returns an error if the call should be short-circuited, otherwise whether
+// the call is the trial call of the half-open breaker (which is passed to record)
+func (c *CircuitBreaker) allow() (bool, error) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	switch c.state {
+	case CircuitOpen:
+		if time.Now().Before(c.openUntil) {
+			return false, &CircuitOpenError{Until: c.openUntil}
+		}
+		c.setState(CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		// Only a single trial call is allowed while half-open
+		if c.trialInFlight {
+			return false, &CircuitOpenError{Until: c.openUntil}
+		}
+		c.trialInFlight = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// isDownstreamFailure returns whether the error is a failure of the downstream (a server-side
+// or transport error), rather than of the call itself (e.g. a bad query or an exceeded limit)
+func isDownstreamFailure(err error) bool {
+	var apiErr *v1.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Type == v1.ErrServer || apiErr.Type == v1.ErrTimeout || apiErr.Type == v1.ErrBadResponse
+	}
+	var limitErr *LimitExceededError
+	return !errors.As(err, &limitErr)
+}
+
+// record records the result of a call that was allowed through, trial is whether
+// the call was the trial call (as returned by allow)
+func (c *CircuitBreaker) record(ctx context.Context, trial bool, took time.Duration, err error) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if trial {
+		c.trialInFlight = false
+	}
+
+	// If the caller cancelled the request it says nothing about the downstream
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	if (err == nil || !isDownstreamFailure(err)) && (c.latencyThreshold <= 0 || took <= c.latencyThreshold) {
+		c.consecutiveFailures = 0
+		c.setState(CircuitClosed)
+		return
+	}
+
+	c.consecutiveFailures++
+	if trial || c.consecutiveFailures >= c.errorThreshold {
+		c.openUntil = time.Now().Add(c.cooldown)
+		c.setState(CircuitOpen)
+	}
+}
+
+// do calls f if the breaker allows it, recording the result
+func (c *CircuitBreaker) do(ctx context.Context, f func() error) error {
+	trial, err := c.allow()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = f()
+	c.record(ctx, trial, time.Since(start), err)
+	return err
+}
+
+// CircuitBreakerAPI short-circuits calls to the API while its CircuitBreaker is
+// open, returning errors immediately instead of waiting on a known-bad downstream
+type CircuitBreakerAPI struct {
+	API
+	Breaker *CircuitBreaker
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (c *CircuitBreakerAPI) LabelNames(ctx context.Context) (v []string, w v1.Warnings, err error) {
+	err = c.Breaker.do(ctx, func() error {
+		v, w, err = c.API.LabelNames(ctx)
+		return err
+	})
+	return v, w, err
+}
+
+// LabelValues performs a query for the values of the given label.
+func (c *CircuitBreakerAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (v model.LabelValues, w v1.Warnings, err error) {
+	err = c.Breaker.do(ctx, func() error {
+		v, w, err = c.API.LabelValues(ctx, label, matchers, startTime, endTime)
+		return err
+	})
+	return v, w, err
+}
+
+// Query performs a query for the given time.
+func (c *CircuitBreakerAPI) Query(ctx context.Context, query string, ts time.Time) (v model.Value, w v1.Warnings, err error) {
+	err = c.Breaker.do(ctx, func() error {
+		v, w, err = c.API.Query(ctx, query, ts)
+		return err
+	})
+	return v, w, err
+}
+
+// QueryRange performs a query for the given range.
+func (c *CircuitBreakerAPI) QueryRange(ctx context.Context, query string, r v1.Range) (v model.Value, w v1.Warnings, err error) {
+	err = c.Breaker.do(ctx, func() error {
+		v, w, err = c.API.QueryRange(ctx, query, r)
+		return err
+	})
+	return v, w, err
+}
+
+// Series finds series by label matchers.
+func (c *CircuitBreakerAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) (v []model.LabelSet, w v1.Warnings, err error) {
+	err = c.Breaker.do(ctx, func() error {
+		v, w, err = c.API.Series(ctx, matches, startTime, endTime)
+		return err
+	})
+	return v, w, err
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (c *CircuitBreakerAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (v model.Value, w v1.Warnings, err error) {
+	err = c.Breaker.do(ctx, func() error {
+		v, w, err = c.API.GetValue(ctx, start, end, matchers)
+		return err
+	})
+	return v, w, err
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (c *CircuitBreakerAPI) Metadata(ctx context.Context, metric, limit string) (v map[string][]v1.Metadata, w v1.Warnings, err error) {
+	err = c.Breaker.do(ctx, func() error {
+		v, w, err = c.API.Metadata(ctx, metric, limit)
+		return err
+	})
+	return v, w, err
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (c *CircuitBreakerAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) (v []ExemplarQueryResult, w v1.Warnings, err error) {
+	err = c.Breaker.do(ctx, func() error {
+		v, w, err = c.API.QueryExemplars(ctx, query, startTime, endTime)
+		return err
+	})
+	return v, w, err
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (c *CircuitBreakerAPI) Key() model.LabelSet {
+	if apiLabels, ok := c.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
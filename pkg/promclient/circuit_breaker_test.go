@@ -0,0 +1,122 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+func TestCircuitBreakerAPI(t *testing.T) {
+	calls := 0
+	stub := &stubAPI{
+		query: func() model.Value {
+			calls++
+			return model.Vector{}
+		},
+	}
+	failing := &errorAPI{stub, fmt.Errorf("error")}
+
+	var states []CircuitBreakerState
+	breaker := NewCircuitBreaker(2, 0, 50*time.Millisecond, func(s CircuitBreakerState) {
+		states = append(states, s)
+	})
+	a := &CircuitBreakerAPI{failing, breaker}
+
+	// The first errors are passed through until we hit the threshold
+	for i := 0; i < 2; i++ {
+		if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err == nil {
+			t.Fatalf("missing expected error")
+		}
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("expected breaker to be open, got %s", breaker.State())
+	}
+
+	// While open calls should be short-circuited
+	a.API = stub
+	if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err == nil {
+		t.Fatalf("missing expected error")
+	} else if _, ok := err.(*CircuitOpenError); !ok {
+		t.Fatalf("expected CircuitOpenError, got %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("expected no calls to the downstream while open, got %d", calls)
+	}
+
+	// After the cooldown a trial call is allowed, which closes the breaker
+	time.Sleep(60 * time.Millisecond)
+	if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("expected breaker to be closed, got %s", breaker.State())
+	}
+
+	expectedStates := []CircuitBreakerState{CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if fmt.Sprint(states) != fmt.Sprint(expectedStates) {
+		t.Fatalf("mismatch in states: expected=%v actual=%v", expectedStates, states)
+	}
+}
+
+func TestCircuitBreakerFailures(t *testing.T) {
+	breaker := NewCircuitBreaker(2, 0, time.Minute, nil)
+	a := &CircuitBreakerAPI{&errorAPI{&stubAPI{}, &v1.Error{Type: v1.ErrBadData}}, breaker}
+
+	// Errors of the call itself say nothing about the downstream
+	for i := 0; i < 3; i++ {
+		if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err == nil {
+			t.Fatalf("missing expected error")
+		}
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("expected breaker to be closed, got %s", breaker.State())
+	}
+
+	// Server errors are failures of the downstream
+	a.API = &errorAPI{&stubAPI{}, &v1.Error{Type: v1.ErrServer}}
+	for i := 0; i < 2; i++ {
+		a.Query(context.TODO(), "testmetric", time.Now())
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("expected breaker to be open, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreakerTrial(t *testing.T) {
+	breaker := NewCircuitBreaker(1, 0, 10*time.Millisecond, nil)
+
+	// A call is in-flight when the breaker opens
+	stale, err := breaker.allow()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	failed, _ := breaker.allow()
+	breaker.record(context.TODO(), failed, 0, fmt.Errorf("error"))
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("expected breaker to be open, got %s", breaker.State())
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	trial, err := breaker.allow()
+	if err != nil || !trial {
+		t.Fatalf("expected a trial call, got trial=%v err=%v", trial, err)
+	}
+
+	// The (cancelled) call which was in-flight isn't the trial, so it doesn't
+	// allow another trial call through
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	breaker.record(ctx, stale, 0, context.Canceled)
+	if _, err := breaker.allow(); err == nil {
+		t.Fatalf("expected a single trial call while half-open")
+	}
+
+	breaker.record(context.TODO(), trial, 0, nil)
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("expected breaker to be closed, got %s", breaker.State())
+	}
+}
@@ -1,6 +1,8 @@
 package promclient
 
 import (
+	"context"
+	"net/http"
 	"net/url"
 
 	"github.com/prometheus/client_golang/api"
@@ -18,6 +20,7 @@ type ClientArgsWrap struct {
 	args map[string]string
 }
 
+// URL returns the URL for the endpoint with the query params added
 func (c *ClientArgsWrap) URL(ep string, args map[string]string) *url.URL {
 	u := c.Client.URL(ep, args)
 
@@ -29,3 +32,47 @@ func (c *ClientArgsWrap) URL(ep string, args map[string]string) *url.URL {
 
 	return u
 }
+
+type queryArgsKey struct{}
+
+// WithQueryArgs returns a context in which the query params are added to the requests
+// made with a ContextArgsClient (in addition to the query params of the parent context)
+func WithQueryArgs(ctx context.Context, args map[string]string) context.Context {
+	merged := make(map[string]string, len(args))
+	for k, v := range queryArgsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range args {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, queryArgsKey{}, merged)
+}
+
+// queryArgsFromContext returns the query params of the context (nil if there are none)
+func queryArgsFromContext(ctx context.Context) map[string]string {
+	args, _ := ctx.Value(queryArgsKey{}).(map[string]string)
+	return args
+}
+
+// NewContextArgsClient returns a client that will add the query params of the request's context
+func NewContextArgsClient(api api.Client) *ContextArgsClient {
+	return &ContextArgsClient{api}
+}
+
+// ContextArgsClient wraps the prom API client to add the query params set with WithQueryArgs
+// on the context of the request, such that they can be chosen per request
+type ContextArgsClient struct {
+	api.Client
+}
+
+// Do makes the request with the query params of the context added
+func (c *ContextArgsClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	if args := queryArgsFromContext(ctx); len(args) > 0 {
+		q := req.URL.Query()
+		for k, v := range args {
+			q.Set(k, v)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+	return c.Client.Do(ctx, req)
+}
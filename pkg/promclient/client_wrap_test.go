@@ -0,0 +1,40 @@
+package promclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+)
+
+func TestClientArgsWrap(t *testing.T) {
+	var query, form map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClient(api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	promAPI := NewPromAPIV1(NewClientArgsWrap(client, map[string]string{"nocache": "1", "tenant": "a"}))
+
+	if _, _, err := promAPI.Query(context.TODO(), "up", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(query["nocache"]) != 1 || query["nocache"][0] != "1" || len(query["tenant"]) != 1 || query["tenant"][0] != "a" {
+		t.Fatalf("missing query params: %v", query)
+	}
+	// The args of the request itself are unaffected
+	if len(form["query"]) != 1 || form["query"][0] != "up" {
+		t.Fatalf("unexpected form: %v", form)
+	}
+}
@@ -40,15 +40,18 @@ func (d *DebugAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error
 }
 
 // LabelValues performs a query for the values of the given label.
-func (d *DebugAPI) LabelValues(ctx context.Context, label string) (model.LabelValues, v1.Warnings, error) {
+func (d *DebugAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
 	fields := logrus.Fields{
-		"api":   "LabelValues",
-		"label": label,
+		"api":      "LabelValues",
+		"label":    label,
+		"matchers": matchers,
+		"start":    startTime,
+		"end":      endTime,
 	}
 	logrus.WithFields(fields).Debug(d.PrefixMessage)
 
 	s := time.Now()
-	v, w, err := d.API.LabelValues(ctx, label)
+	v, w, err := d.API.LabelValues(ctx, label, matchers, startTime, endTime)
 	fields["took"] = time.Since(s)
 
 	if logrus.GetLevel() > logrus.DebugLevel {
@@ -164,3 +167,56 @@ func (d *DebugAPI) GetValue(ctx context.Context, start, end time.Time, matchers
 
 	return v, w, err
 }
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (d *DebugAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	fields := logrus.Fields{
+		"api":    "Metadata",
+		"metric": metric,
+		"limit":  limit,
+	}
+
+	logrus.WithFields(fields).Debug(d.PrefixMessage)
+
+	s := time.Now()
+	v, w, err := d.API.Metadata(ctx, metric, limit)
+	fields["took"] = time.Since(s)
+
+	if logrus.GetLevel() > logrus.DebugLevel {
+		fields["value"] = v
+		fields["warnings"] = w
+		fields["error"] = err
+		logrus.WithFields(fields).Trace(d.PrefixMessage)
+	} else {
+		logrus.WithFields(fields).Debug(d.PrefixMessage)
+	}
+
+	return v, w, err
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (d *DebugAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	fields := logrus.Fields{
+		"api":   "QueryExemplars",
+		"query": query,
+		"start": startTime,
+		"end":   endTime,
+	}
+
+	logrus.WithFields(fields).Debug(d.PrefixMessage)
+
+	s := time.Now()
+	v, w, err := d.API.QueryExemplars(ctx, query, startTime, endTime)
+	fields["took"] = time.Since(s)
+
+	if logrus.GetLevel() > logrus.DebugLevel {
+		fields["value"] = v
+		fields["warnings"] = w
+		fields["error"] = err
+		logrus.WithFields(fields).Trace(d.PrefixMessage)
+	} else {
+		logrus.WithFields(fields).Debug(d.PrefixMessage)
+	}
+
+	return v, w, err
+}
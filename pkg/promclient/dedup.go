@@ -0,0 +1,275 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+type dedupCacheKey struct{}
+
+// dedupCall is a single (possibly in-flight) call shared by DedupAPIs
+type dedupCall struct {
+	done chan struct{}
+	v    interface{}
+	w    v1.Warnings
+	err  error
+}
+
+// dedupCache holds the calls made through DedupAPIs for a single request
+type dedupCache struct {
+	l     sync.Mutex
+	calls map[string]*dedupCall
+}
+
+// WithDedupCache returns a context in which calls made through DedupAPIs with
+// the same key (and arguments) are only sent once
+func WithDedupCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dedupCacheKey{}, &dedupCache{calls: make(map[string]*dedupCall)})
+}
+
+// NewDedupRegistry returns a new DedupRegistry
+func NewDedupRegistry() *DedupRegistry {
+	return &DedupRegistry{counts: make(map[string]int)}
+}
+
+// DedupRegistry tracks how many DedupAPIs exist for each key, such that calls
+// are only deduplicated (which requires copying the results) when there are duplicates
+type DedupRegistry struct {
+	l      sync.Mutex
+	counts map[string]int
+}
+
+// Register registers a DedupAPI with the given key, the returned func unregisters it
+func (r *DedupRegistry) Register(key string) func() {
+	r.l.Lock()
+	r.counts[key]++
+	r.l.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.l.Lock()
+			defer r.l.Unlock()
+			r.counts[key]--
+			if r.counts[key] <= 0 {
+				delete(r.counts, key)
+			}
+		})
+	}
+}
+
+// Shared returns whether there are multiple DedupAPIs with the given key
+func (r *DedupRegistry) Shared(key string) bool {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.counts[key] > 1
+}
+
+// DedupAPI ensures that calls with identical arguments to APIs with the same Key
+// are only made once per request (as scoped by WithDedupCache). This is used when
+// the same downstream appears in multiple servergroups so it isn't queried (and
+// merged) multiple times. The Key must uniquely identify the downstream and anything
+// which changes its responses (e.g. the URL and the labels added to the results).
+type DedupAPI struct {
+	API
+	DedupKey string
+	Registry *DedupRegistry
+}
+
+// do calls f, or waits on an identical call if one was already made for this request
+func (d *DedupAPI) do(ctx context.Context, call string, args []interface{}, copyFunc func(interface{}) interface{}, f func() (interface{}, v1.Warnings, error)) (interface{}, v1.Warnings, error) {
+	cache, ok := ctx.Value(dedupCacheKey{}).(*dedupCache)
+	if !ok || !d.Registry.Shared(d.DedupKey) {
+		return f()
+	}
+
+	key := d.DedupKey + "|" + call + "|" + fmt.Sprint(args...)
+	cache.l.Lock()
+	shared, ok := cache.calls[key]
+	if !ok {
+		shared = &dedupCall{done: make(chan struct{})}
+		cache.calls[key] = shared
+	}
+	cache.l.Unlock()
+
+	// We are the first caller, so we make the call. Results are modified in-place
+	// when merging, so each caller (including us) gets its own copy
+	if !ok {
+		shared.v, shared.w, shared.err = f()
+		close(shared.done)
+		if shared.err != nil {
+			return nil, shared.w, shared.err
+		}
+		return copyFunc(shared.v), shared.w, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case <-shared.done:
+	}
+
+	// If the first caller was cancelled that says nothing about our call
+	if shared.err != nil && (errors.Is(shared.err, context.Canceled) || errors.Is(shared.err, context.DeadlineExceeded)) {
+		return f()
+	}
+	if shared.err != nil {
+		return nil, shared.w, shared.err
+	}
+
+	return copyFunc(shared.v), shared.w, nil
+}
+
+// copyValue returns a deep copy of the model.Value `v`
+func copyValue(v interface{}) interface{} {
+	switch vTyped := v.(type) {
+	case model.Vector:
+		ret := make(model.Vector, len(vTyped))
+		for i, sample := range vTyped {
+			ret[i] = &model.Sample{
+				Metric:    sample.Metric.Clone(),
+				Value:     sample.Value,
+				Timestamp: sample.Timestamp,
+			}
+		}
+		return ret
+	case model.Matrix:
+		ret := make(model.Matrix, len(vTyped))
+		for i, stream := range vTyped {
+			values := make([]model.SamplePair, len(stream.Values))
+			copy(values, stream.Values)
+			ret[i] = &model.SampleStream{
+				Metric: stream.Metric.Clone(),
+				Values: values,
+			}
+		}
+		return ret
+	case *model.Scalar:
+		tmp := *vTyped
+		return &tmp
+	case *model.String:
+		tmp := *vTyped
+		return &tmp
+	}
+	return v
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (d *DedupAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	v, w, err := d.do(ctx, "label_names", nil,
+		func(v interface{}) interface{} { return append([]string(nil), v.([]string)...) },
+		func() (interface{}, v1.Warnings, error) { return d.API.LabelNames(ctx) },
+	)
+	names, _ := v.([]string)
+	return names, w, err
+}
+
+// LabelValues performs a query for the values of the given label.
+func (d *DedupAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	v, w, err := d.do(ctx, "label_values", []interface{}{label, matchers, startTime.UnixNano(), endTime.UnixNano()},
+		func(v interface{}) interface{} { return append(model.LabelValues(nil), v.(model.LabelValues)...) },
+		func() (interface{}, v1.Warnings, error) {
+			return d.API.LabelValues(ctx, label, matchers, startTime, endTime)
+		},
+	)
+	values, _ := v.(model.LabelValues)
+	return values, w, err
+}
+
+// Query performs a query for the given time.
+func (d *DedupAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	v, w, err := d.do(ctx, "query", []interface{}{query, ts.UnixNano()},
+		copyValue,
+		func() (interface{}, v1.Warnings, error) { return d.API.Query(ctx, query, ts) },
+	)
+	value, _ := v.(model.Value)
+	return value, w, err
+}
+
+// QueryRange performs a query for the given range.
+func (d *DedupAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	v, w, err := d.do(ctx, "query_range", []interface{}{query, r.Start.UnixNano(), r.End.UnixNano(), r.Step},
+		copyValue,
+		func() (interface{}, v1.Warnings, error) { return d.API.QueryRange(ctx, query, r) },
+	)
+	value, _ := v.(model.Value)
+	return value, w, err
+}
+
+// Series finds series by label matchers.
+func (d *DedupAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	v, w, err := d.do(ctx, "series", []interface{}{matches, startTime.UnixNano(), endTime.UnixNano()},
+		func(v interface{}) interface{} {
+			labelSets := v.([]model.LabelSet)
+			ret := make([]model.LabelSet, len(labelSets))
+			for i, ls := range labelSets {
+				ret[i] = ls.Clone()
+			}
+			return ret
+		},
+		func() (interface{}, v1.Warnings, error) { return d.API.Series(ctx, matches, startTime, endTime) },
+	)
+	series, _ := v.([]model.LabelSet)
+	return series, w, err
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (d *DedupAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	v, w, err := d.do(ctx, "get_value", []interface{}{start.UnixNano(), end.UnixNano(), matchers},
+		copyValue,
+		func() (interface{}, v1.Warnings, error) { return d.API.GetValue(ctx, start, end, matchers) },
+	)
+	value, _ := v.(model.Value)
+	return value, w, err
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (d *DedupAPI) Key() model.LabelSet {
+	if apiLabels, ok := d.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
+
+// DedupScopeAPI scopes the deduplication of DedupAPIs to each call made to it,
+// this is meant to wrap the top-level API such that each request is deduplicated
+type DedupScopeAPI struct {
+	API
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (d *DedupScopeAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	return d.API.LabelNames(WithDedupCache(ctx))
+}
+
+// LabelValues performs a query for the values of the given label.
+func (d *DedupScopeAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	return d.API.LabelValues(WithDedupCache(ctx), label, matchers, startTime, endTime)
+}
+
+// Query performs a query for the given time.
+func (d *DedupScopeAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	return d.API.Query(WithDedupCache(ctx), query, ts)
+}
+
+// QueryRange performs a query for the given range.
+func (d *DedupScopeAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	return d.API.QueryRange(WithDedupCache(ctx), query, r)
+}
+
+// Series finds series by label matchers.
+func (d *DedupScopeAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	return d.API.Series(WithDedupCache(ctx), matches, startTime, endTime)
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (d *DedupScopeAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	return d.API.GetValue(WithDedupCache(ctx), start, end, matchers)
+}
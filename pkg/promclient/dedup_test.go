@@ -0,0 +1,67 @@
+package promclient
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// countingAPI counts the Query calls made to it
+type countingAPI struct {
+	API
+	calls int32
+}
+
+func (c *countingAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return c.API.Query(ctx, query, ts)
+}
+
+func TestDedupAPI(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{{Metric: model.Metric{model.MetricNameLabel: "testmetric"}, Value: 1}}
+		},
+	}
+	downstream := &countingAPI{API: stub}
+	other := &countingAPI{API: stub}
+
+	registry := NewDedupRegistry()
+	dedup := func(a API, key string) API {
+		registry.Register(key)
+		return &DedupAPI{API: a, DedupKey: key, Registry: registry}
+	}
+
+	// The same downstream in 2 servergroups along with another downstream
+	a := &DedupScopeAPI{NewMultiAPI([]API{
+		NewMultiAPI([]API{dedup(downstream, "a")}, model.Time(0), nil, 1),
+		NewMultiAPI([]API{dedup(downstream, "a"), dedup(other, "b")}, model.Time(0), nil, 1),
+	}, model.Time(0), nil, 2)}
+
+	for i := 1; i <= 2; i++ {
+		v, _, err := a.Query(context.TODO(), "testmetric", time.Now())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(v.(model.Vector)) != 1 {
+			t.Fatalf("expected 1 series got %v", v)
+		}
+		// The duplicate downstream is called once per request
+		if calls := atomic.LoadInt32(&downstream.calls); int(calls) != i {
+			t.Fatalf("expected %d calls to the duplicate downstream got %d", i, calls)
+		}
+		if calls := atomic.LoadInt32(&other.calls); int(calls) != i {
+			t.Fatalf("expected %d calls to the other downstream got %d", i, calls)
+		}
+	}
+
+	// Without a dedup scope every call is made
+	a.API.Query(context.TODO(), "testmetric", time.Now())
+	if calls := atomic.LoadInt32(&downstream.calls); calls != 4 {
+		t.Fatalf("expected 4 calls to the duplicate downstream got %d", calls)
+	}
+}
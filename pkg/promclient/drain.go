@@ -0,0 +1,177 @@
+package promclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// DrainAPI tracks the requests in-flight through the API so that its resources
+// (e.g. the servergroups of a previous config) are only released once it is drained
+type DrainAPI struct {
+	API
+
+	l        sync.Mutex
+	inflight int
+	drained  chan struct{}
+}
+
+// Hold marks a request as in-flight until the returned func is called, this is used
+// to keep the API from being drained between the calls of a single query
+func (api *DrainAPI) Hold() func() {
+	api.l.Lock()
+	api.inflight++
+	api.l.Unlock()
+
+	var once sync.Once
+	return func() { once.Do(api.release) }
+}
+
+func (api *DrainAPI) release() {
+	api.l.Lock()
+	defer api.l.Unlock()
+	api.inflight--
+	if api.inflight == 0 && api.drained != nil {
+		close(api.drained)
+		api.drained = nil
+	}
+}
+
+// Drain blocks until no requests are in-flight or the context is done
+func (api *DrainAPI) Drain(ctx context.Context) error {
+	api.l.Lock()
+	if api.inflight == 0 {
+		api.l.Unlock()
+		return nil
+	}
+	if api.drained == nil {
+		api.drained = make(chan struct{})
+	}
+	drained := api.drained
+	api.l.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (api *DrainAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.LabelNames(ctx)
+}
+
+// LabelValues performs a query for the values of the given label.
+func (api *DrainAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.LabelValues(ctx, label, matchers, startTime, endTime)
+}
+
+// Query performs a query for the given time.
+func (api *DrainAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.Query(ctx, query, ts)
+}
+
+// QueryRange performs a query for the given range.
+func (api *DrainAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.QueryRange(ctx, query, r)
+}
+
+// Series finds series by label matchers.
+func (api *DrainAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.Series(ctx, matches, startTime, endTime)
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (api *DrainAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.GetValue(ctx, start, end, matchers)
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (api *DrainAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.Metadata(ctx, metric, limit)
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (api *DrainAPI) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.Targets(ctx)
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (api *DrainAPI) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.Rules(ctx)
+}
+
+// Alerts returns a list of all active alerts.
+func (api *DrainAPI) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.Alerts(ctx)
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+func (api *DrainAPI) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.AlertManagers(ctx)
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (api *DrainAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.QueryExemplars(ctx, query, startTime, endTime)
+}
+
+// TSDB returns the cardinality statistics of the TSDB.
+func (api *DrainAPI) TSDB(ctx context.Context) (TSDBResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.TSDB(ctx)
+}
+
+// Buildinfo returns the build information of each server.
+func (api *DrainAPI) Buildinfo(ctx context.Context) ([]BuildinfoResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.Buildinfo(ctx)
+}
+
+// Runtimeinfo returns the runtime information of each server.
+func (api *DrainAPI) Runtimeinfo(ctx context.Context) ([]RuntimeinfoResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.Runtimeinfo(ctx)
+}
+
+// Config returns the configuration of each server.
+func (api *DrainAPI) Config(ctx context.Context) ([]ConfigResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.Config(ctx)
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+func (api *DrainAPI) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.DeleteSeries(ctx, matches, startTime, endTime)
+}
+
+// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+func (api *DrainAPI) CleanTombstones(ctx context.Context) ([]AdminResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.CleanTombstones(ctx)
+}
+
+// Snapshot creates a snapshot of all current data on each server.
+func (api *DrainAPI) Snapshot(ctx context.Context, skipHead bool) ([]AdminResult, v1.Warnings, error) {
+	defer api.Hold()()
+	return api.API.Snapshot(ctx, skipHead)
+}
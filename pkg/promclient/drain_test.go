@@ -0,0 +1,65 @@
+package promclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestDrainAPI(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	api := &DrainAPI{API: &stubAPI{
+		query: func() model.Value {
+			close(started)
+			<-unblock
+			return model.Vector{}
+		},
+	}}
+
+	// Nothing in-flight, nothing to wait for
+	if err := api.Drain(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		api.Query(context.TODO(), "testmetric", time.Now())
+	}()
+	<-started
+
+	// The in-flight query keeps the api from draining
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	if err := api.Drain(ctx); err == nil {
+		t.Fatalf("expected the drain to time out with a query in-flight")
+	}
+
+	// A hold spans multiple calls
+	release := api.Hold()
+
+	drained := make(chan error)
+	go func() { drained <- api.Drain(context.TODO()) }()
+
+	close(unblock)
+	<-done
+	select {
+	case <-drained:
+		t.Fatalf("drained while held")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	release()
+	release() // releasing more than once is a no-op
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("not drained after the hold was released")
+	}
+}
@@ -0,0 +1,64 @@
+package promclient
+
+import (
+	"sort"
+
+	"github.com/prometheus/common/model"
+)
+
+// Exemplar is a single exemplar of a series
+type Exemplar struct {
+	Labels    model.LabelSet    `json:"labels"`
+	Value     model.SampleValue `json:"value"`
+	Timestamp model.Time        `json:"timestamp"`
+}
+
+// ExemplarQueryResult contains the exemplars of a single series
+type ExemplarQueryResult struct {
+	SeriesLabels model.LabelSet `json:"seriesLabels"`
+	Exemplars    []Exemplar     `json:"exemplars"`
+}
+
+// exemplarKey identifies an exemplar within a series
+type exemplarKey struct {
+	fingerprint model.Fingerprint
+	value       model.SampleValue
+	timestamp   model.Time
+}
+
+// MergeExemplars merges the exemplars from b into a. Exemplars of the same series
+// are merged, only including identical exemplars (e.g. from HA replicas) once.
+// The exemplars of each series are sorted by timestamp.
+func MergeExemplars(a, b []ExemplarQueryResult) []ExemplarQueryResult {
+	series := make(map[model.Fingerprint]int, len(a))
+	for i, result := range a {
+		series[result.SeriesLabels.Fingerprint()] = i
+	}
+
+	for _, result := range b {
+		fp := result.SeriesLabels.Fingerprint()
+		i, ok := series[fp]
+		if !ok {
+			series[fp] = len(a)
+			a = append(a, ExemplarQueryResult{SeriesLabels: result.SeriesLabels})
+			i = len(a) - 1
+		}
+
+		seen := make(map[exemplarKey]struct{}, len(a[i].Exemplars))
+		for _, e := range a[i].Exemplars {
+			seen[exemplarKey{e.Labels.Fingerprint(), e.Value, e.Timestamp}] = struct{}{}
+		}
+		for _, e := range result.Exemplars {
+			key := exemplarKey{e.Labels.Fingerprint(), e.Value, e.Timestamp}
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				a[i].Exemplars = append(a[i].Exemplars, e)
+			}
+		}
+		sort.SliceStable(a[i].Exemplars, func(x, y int) bool {
+			return a[i].Exemplars[x].Timestamp < a[i].Exemplars[y].Timestamp
+		})
+	}
+
+	return a
+}
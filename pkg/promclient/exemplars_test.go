@@ -0,0 +1,118 @@
+package promclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/common/model"
+)
+
+func TestMergeExemplars(t *testing.T) {
+	series := model.LabelSet{model.MetricNameLabel: "request_duration_seconds_bucket"}
+	otherSeries := model.LabelSet{model.MetricNameLabel: "other_bucket"}
+	e1 := Exemplar{Labels: model.LabelSet{"traceID": "1"}, Value: 1, Timestamp: 1000}
+	e2 := Exemplar{Labels: model.LabelSet{"traceID": "2"}, Value: 2, Timestamp: 2000}
+	e3 := Exemplar{Labels: model.LabelSet{"traceID": "3"}, Value: 3, Timestamp: 3000}
+
+	tests := []struct {
+		a      []ExemplarQueryResult
+		b      []ExemplarQueryResult
+		merged []ExemplarQueryResult
+	}{
+		// Distinct series
+		{
+			a:      []ExemplarQueryResult{{SeriesLabels: series, Exemplars: []Exemplar{e1}}},
+			b:      []ExemplarQueryResult{{SeriesLabels: otherSeries, Exemplars: []Exemplar{e2}}},
+			merged: []ExemplarQueryResult{{SeriesLabels: series, Exemplars: []Exemplar{e1}}, {SeriesLabels: otherSeries, Exemplars: []Exemplar{e2}}},
+		},
+		// Same series, duplicates removed and sorted by time
+		{
+			a:      []ExemplarQueryResult{{SeriesLabels: series, Exemplars: []Exemplar{e1, e3}}},
+			b:      []ExemplarQueryResult{{SeriesLabels: series, Exemplars: []Exemplar{e2, e3}}},
+			merged: []ExemplarQueryResult{{SeriesLabels: series, Exemplars: []Exemplar{e1, e2, e3}}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			merged := MergeExemplars(test.a, test.b)
+
+			if !reflect.DeepEqual(merged, test.merged) {
+				t.Fatalf("doesn't match\nexpected=%v\nactual=%v", test.merged, merged)
+			}
+		})
+	}
+}
+
+func TestPromAPIV1QueryExemplars(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query_exemplars" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.FormValue("query")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":[{"seriesLabels":{"__name__":"a"},"exemplars":[{"labels":{"traceID":"1"},"value":"6","timestamp":1600096945.479}]}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClient(api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exemplars, _, err := NewPromAPIV1(client).QueryExemplars(context.TODO(), "a", time.Unix(0, 0), time.Unix(100, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query != "a" {
+		t.Fatalf("query not sent to downstream: %q", query)
+	}
+
+	expected := []ExemplarQueryResult{{
+		SeriesLabels: model.LabelSet{model.MetricNameLabel: "a"},
+		Exemplars:    []Exemplar{{Labels: model.LabelSet{"traceID": "1"}, Value: 6, Timestamp: 1600096945479}},
+	}}
+	if !reflect.DeepEqual(exemplars, expected) {
+		t.Fatalf("doesn't match\nexpected=%v\nactual=%v", expected, exemplars)
+	}
+}
+
+func TestPromAPIV1LabelValues(t *testing.T) {
+	var path string
+	var matchers []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		path = r.URL.Path
+		matchers = r.Form["match[]"]
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":["a","b"]}`))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClient(api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	promAPI := NewPromAPIV1(client)
+
+	for _, m := range [][]string{nil, {"up", `process_start_time_seconds{job="a"}`}} {
+		values, _, err := promAPI.LabelValues(context.TODO(), "job", m, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(values, model.LabelValues{"a", "b"}) {
+			t.Fatalf("unexpected values: %v", values)
+		}
+		if path != "/api/v1/label/job/values" || !reflect.DeepEqual(matchers, m) {
+			t.Fatalf("unexpected request path=%s matchers=%v", path, matchers)
+		}
+	}
+}
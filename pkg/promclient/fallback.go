@@ -0,0 +1,396 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// FallbackAPI only calls the Fallback API if the Primary API returns an error
+// or no data. An example use-case would be a slower long-term-storage backend
+// which should only be queried when the primary downstreams can't answer.
+type FallbackAPI struct {
+	Primary  API
+	Fallback API
+}
+
+// fallback calls the primary and (if required) the fallback api. If the primary
+// failed the result of the fallback is used; if the primary only returned no data
+// an error from the fallback is surfaced as a warning instead of failing the call
+func fallback(primary, fallback func() (empty bool, w v1.Warnings, err error)) (useFallback bool, w v1.Warnings, err error) {
+	empty, w, err := primary()
+	if err == nil && !empty {
+		return false, w, nil
+	}
+
+	fallbackEmpty, fallbackW, fallbackErr := fallback()
+	w = append(w, fallbackW...)
+	if err != nil {
+		if fallbackErr != nil {
+			return false, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), err
+		}
+		return true, append(w, fmt.Sprintf("primary failed, using fallback: %v", err)), nil
+	}
+
+	if fallbackErr != nil {
+		return false, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return !fallbackEmpty, w, nil
+}
+
+// isEmptyValue returns whether the value has no data
+func isEmptyValue(v model.Value) bool {
+	switch vTyped := v.(type) {
+	case nil:
+		return true
+	case model.Vector:
+		return len(vTyped) == 0
+	case model.Matrix:
+		return len(vTyped) == 0
+	}
+	return false
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (f *FallbackAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	var primaryV, fallbackV []string
+	useFallback, w, err := fallback(
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			primaryV, w, err = f.Primary.LabelNames(ctx)
+			return len(primaryV) == 0, w, err
+		},
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			fallbackV, w, err = f.Fallback.LabelNames(ctx)
+			return len(fallbackV) == 0, w, err
+		},
+	)
+	if useFallback {
+		return fallbackV, w, err
+	}
+	return primaryV, w, err
+}
+
+// LabelValues performs a query for the values of the given label.
+func (f *FallbackAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	var primaryV, fallbackV model.LabelValues
+	useFallback, w, err := fallback(
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			primaryV, w, err = f.Primary.LabelValues(ctx, label, matchers, startTime, endTime)
+			return len(primaryV) == 0, w, err
+		},
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			fallbackV, w, err = f.Fallback.LabelValues(ctx, label, matchers, startTime, endTime)
+			return len(fallbackV) == 0, w, err
+		},
+	)
+	if useFallback {
+		return fallbackV, w, err
+	}
+	return primaryV, w, err
+}
+
+// valueFallback calls fallback for apis returning a model.Value
+func valueFallback(primary, fallbackCall func() (model.Value, v1.Warnings, error)) (model.Value, v1.Warnings, error) {
+	var primaryV, fallbackV model.Value
+	useFallback, w, err := fallback(
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			primaryV, w, err = primary()
+			return isEmptyValue(primaryV), w, err
+		},
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			fallbackV, w, err = fallbackCall()
+			return isEmptyValue(fallbackV), w, err
+		},
+	)
+	if useFallback {
+		return fallbackV, w, err
+	}
+	return primaryV, w, err
+}
+
+// Query performs a query for the given time.
+func (f *FallbackAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	return valueFallback(
+		func() (model.Value, v1.Warnings, error) { return f.Primary.Query(ctx, query, ts) },
+		func() (model.Value, v1.Warnings, error) { return f.Fallback.Query(ctx, query, ts) },
+	)
+}
+
+// QueryRange performs a query for the given range.
+func (f *FallbackAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	return valueFallback(
+		func() (model.Value, v1.Warnings, error) { return f.Primary.QueryRange(ctx, query, r) },
+		func() (model.Value, v1.Warnings, error) { return f.Fallback.QueryRange(ctx, query, r) },
+	)
+}
+
+// Series finds series by label matchers.
+func (f *FallbackAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	var primaryV, fallbackV []model.LabelSet
+	useFallback, w, err := fallback(
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			primaryV, w, err = f.Primary.Series(ctx, matches, startTime, endTime)
+			return len(primaryV) == 0, w, err
+		},
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			fallbackV, w, err = f.Fallback.Series(ctx, matches, startTime, endTime)
+			return len(fallbackV) == 0, w, err
+		},
+	)
+	if useFallback {
+		return fallbackV, w, err
+	}
+	return primaryV, w, err
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (f *FallbackAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	return valueFallback(
+		func() (model.Value, v1.Warnings, error) { return f.Primary.GetValue(ctx, start, end, matchers) },
+		func() (model.Value, v1.Warnings, error) { return f.Fallback.GetValue(ctx, start, end, matchers) },
+	)
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (f *FallbackAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	var primaryV, fallbackV map[string][]v1.Metadata
+	useFallback, w, err := fallback(
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			primaryV, w, err = f.Primary.Metadata(ctx, metric, limit)
+			return len(primaryV) == 0, w, err
+		},
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			fallbackV, w, err = f.Fallback.Metadata(ctx, metric, limit)
+			return len(fallbackV) == 0, w, err
+		},
+	)
+	if useFallback {
+		return fallbackV, w, err
+	}
+	return primaryV, w, err
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+// Targets are not data, so the targets of both the primary and fallback are returned.
+func (f *FallbackAPI) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	v, w, err := f.Primary.Targets(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.Targets(ctx)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return MergeTargets(v, fallbackV), w, nil
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+// Rules are not data, so the rules of both the primary and fallback are returned.
+func (f *FallbackAPI) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	v, w, err := f.Primary.Rules(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.Rules(ctx)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return MergeRules(v, fallbackV), w, nil
+}
+
+// Alerts returns a list of all active alerts.
+// Alerts are not data, so the alerts of both the primary and fallback are returned.
+func (f *FallbackAPI) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	v, w, err := f.Primary.Alerts(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.Alerts(ctx)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+
+	v.Alerts = alertValues(MergeAlerts(alertPointers(v.Alerts), alertPointers(fallbackV.Alerts)))
+	return v, w, nil
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+// The alertmanagers of both the primary and fallback are returned.
+func (f *FallbackAPI) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	v, w, err := f.Primary.AlertManagers(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.AlertManagers(ctx)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return MergeAlertManagers(v, fallbackV), w, nil
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (f *FallbackAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	var primaryV, fallbackV []ExemplarQueryResult
+	useFallback, w, err := fallback(
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			primaryV, w, err = f.Primary.QueryExemplars(ctx, query, startTime, endTime)
+			return len(primaryV) == 0, w, err
+		},
+		func() (bool, v1.Warnings, error) {
+			var w v1.Warnings
+			var err error
+			fallbackV, w, err = f.Fallback.QueryExemplars(ctx, query, startTime, endTime)
+			return len(fallbackV) == 0, w, err
+		},
+	)
+	if useFallback {
+		return fallbackV, w, err
+	}
+	return primaryV, w, err
+}
+
+// TSDB returns the cardinality statistics of the TSDB.
+// The statistics of both the primary and fallback are returned.
+func (f *FallbackAPI) TSDB(ctx context.Context) (TSDBResult, v1.Warnings, error) {
+	v, w, err := f.Primary.TSDB(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.TSDB(ctx)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return MergeTSDB(v, fallbackV), w, nil
+}
+
+// Buildinfo returns the build information of each server.
+// The information of both the primary and fallback is returned.
+func (f *FallbackAPI) Buildinfo(ctx context.Context) ([]BuildinfoResult, v1.Warnings, error) {
+	v, w, err := f.Primary.Buildinfo(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.Buildinfo(ctx)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return append(v, fallbackV...), w, nil
+}
+
+// Runtimeinfo returns the runtime information of each server.
+// The information of both the primary and fallback is returned.
+func (f *FallbackAPI) Runtimeinfo(ctx context.Context) ([]RuntimeinfoResult, v1.Warnings, error) {
+	v, w, err := f.Primary.Runtimeinfo(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.Runtimeinfo(ctx)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return append(v, fallbackV...), w, nil
+}
+
+// Config returns the configuration of each server.
+// The configuration of both the primary and fallback is returned.
+func (f *FallbackAPI) Config(ctx context.Context) ([]ConfigResult, v1.Warnings, error) {
+	v, w, err := f.Primary.Config(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.Config(ctx)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return append(v, fallbackV...), w, nil
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+// The deletion is sent to both the primary and fallback.
+func (f *FallbackAPI) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error) {
+	v, w, err := f.Primary.DeleteSeries(ctx, matches, startTime, endTime)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.DeleteSeries(ctx, matches, startTime, endTime)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return append(v, fallbackV...), w, nil
+}
+
+// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+// The tombstones of both the primary and fallback are cleaned.
+func (f *FallbackAPI) CleanTombstones(ctx context.Context) ([]AdminResult, v1.Warnings, error) {
+	v, w, err := f.Primary.CleanTombstones(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.CleanTombstones(ctx)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return append(v, fallbackV...), w, nil
+}
+
+// Snapshot creates a snapshot of all current data on each server.
+// A snapshot is created on both the primary and fallback.
+func (f *FallbackAPI) Snapshot(ctx context.Context, skipHead bool) ([]AdminResult, v1.Warnings, error) {
+	v, w, err := f.Primary.Snapshot(ctx, skipHead)
+	if err != nil {
+		return v, w, err
+	}
+
+	fallbackV, fallbackW, fallbackErr := f.Fallback.Snapshot(ctx, skipHead)
+	w = append(w, fallbackW...)
+	if fallbackErr != nil {
+		return v, append(w, fmt.Sprintf("fallback failed: %v", fallbackErr)), nil
+	}
+	return append(v, fallbackV...), w, nil
+}
@@ -0,0 +1,65 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestFallbackAPI(t *testing.T) {
+	sample := &model.Sample{Metric: model.Metric{model.MetricNameLabel: "testmetric"}, Value: 1}
+	withData := func(name string) API {
+		return &AddLabelClient{&stubAPI{
+			query: func() model.Value { return model.Vector{sample} },
+		}, model.LabelSet{"api": model.LabelValue(name)}}
+	}
+	empty := &stubAPI{
+		query: func() model.Value { return model.Vector{} },
+	}
+	failing := &errorAPI{empty, fmt.Errorf("error")}
+
+	tests := []struct {
+		primary  API
+		fallback API
+		api      model.LabelValue // which api's result we expect, empty for none
+		err      bool
+	}{
+		// primary has data, fallback is never used
+		{primary: withData("primary"), fallback: failing, api: "primary"},
+		// primary has no data
+		{primary: empty, fallback: withData("fallback"), api: "fallback"},
+		// primary fails
+		{primary: failing, fallback: withData("fallback"), api: "fallback"},
+		// primary has no data and the fallback fails; not an error
+		{primary: empty, fallback: failing},
+		// both fail
+		{primary: failing, fallback: failing, err: true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			a := &FallbackAPI{test.primary, test.fallback}
+			v, _, err := a.Query(context.TODO(), "testmetric", time.Now())
+			if (err != nil) != test.err {
+				t.Fatalf("expected err=%v got %v", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+			vector := v.(model.Vector)
+			if test.api == "" {
+				if len(vector) != 0 {
+					t.Fatalf("expected no data got %v", vector)
+				}
+				return
+			}
+			if len(vector) != 1 || vector[0].Metric["api"] != test.api {
+				t.Fatalf("expected result from %s got %v", test.api, vector)
+			}
+		})
+	}
+}
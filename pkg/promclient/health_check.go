@@ -0,0 +1,237 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// UnhealthyError is returned when a call is short-circuited by a failing HealthCheck
+type UnhealthyError struct {
+	URL string
+	Err error
+}
+
+func (e *UnhealthyError) Error() string {
+	return fmt.Sprintf("downstream unhealthy (health check of %s failed: %v)", e.URL, e.Err)
+}
+
+// NewHealthCheck returns a HealthCheck probing the URL with the client every
+// interval, the downstream is considered unhealthy after `unhealthyThreshold`
+// consecutive failed probes (and healthy again after a successful one).
+// stateFunc (if set) is called whenever the health of the downstream changes.
+func NewHealthCheck(url string, client *http.Client, interval, timeout time.Duration, unhealthyThreshold int, stateFunc func(healthy bool)) *HealthCheck {
+	return &HealthCheck{
+		url:                url,
+		client:             client,
+		interval:           interval,
+		timeout:            timeout,
+		unhealthyThreshold: unhealthyThreshold,
+		stateFunc:          stateFunc,
+		healthy:            true,
+	}
+}
+
+// HealthCheck actively probes the health of a downstream
+type HealthCheck struct {
+	url                string
+	client             *http.Client
+	interval           time.Duration
+	timeout            time.Duration
+	unhealthyThreshold int
+	stateFunc          func(healthy bool)
+
+	l                   sync.Mutex
+	healthy             bool
+	consecutiveFailures int
+	lastErr             error
+	cancel              context.CancelFunc
+}
+
+// Start probes the downstream in the background until ctx is done or Stop is called
+func (h *HealthCheck) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	h.l.Lock()
+	h.cancel = cancel
+	h.l.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			h.record(ctx, h.probe(ctx))
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops probing the downstream
+func (h *HealthCheck) Stop() {
+	h.l.Lock()
+	defer h.l.Unlock()
+	if h.cancel != nil {
+		h.cancel()
+	}
+}
+
+// Healthy returns whether the downstream is healthy
+func (h *HealthCheck) Healthy() bool {
+	h.l.Lock()
+	defer h.l.Unlock()
+	return h.healthy
+}
+
+// err returns an error if calls to the downstream should be short-circuited
+func (h *HealthCheck) err() error {
+	h.l.Lock()
+	defer h.l.Unlock()
+	if h.healthy {
+		return nil
+	}
+	return &UnhealthyError{URL: h.url, Err: h.lastErr}
+}
+
+// probe requests the URL, any non-2xx response is an error
+func (h *HealthCheck) probe(ctx context.Context) error {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, h.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// record records the result of a probe
+func (h *HealthCheck) record(ctx context.Context, err error) {
+	// Probes cancelled by Stop say nothing about the downstream
+	if ctx.Err() != nil {
+		return
+	}
+
+	h.l.Lock()
+	defer h.l.Unlock()
+
+	healthy := h.healthy
+	h.lastErr = err
+	if err == nil {
+		h.consecutiveFailures = 0
+		healthy = true
+	} else {
+		h.consecutiveFailures++
+		if h.consecutiveFailures >= h.unhealthyThreshold {
+			healthy = false
+		}
+	}
+
+	if healthy != h.healthy {
+		h.healthy = healthy
+		if h.stateFunc != nil {
+			h.stateFunc(healthy)
+		}
+	}
+}
+
+// HealthCheckAPI short-circuits calls to the API while its HealthCheck is
+// failing, returning errors immediately instead of waiting on a known-bad downstream
+type HealthCheckAPI struct {
+	API
+	Check *HealthCheck
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (h *HealthCheckAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	if err := h.Check.err(); err != nil {
+		return nil, nil, err
+	}
+	return h.API.LabelNames(ctx)
+}
+
+// LabelValues performs a query for the values of the given label.
+func (h *HealthCheckAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	if err := h.Check.err(); err != nil {
+		return nil, nil, err
+	}
+	return h.API.LabelValues(ctx, label, matchers, startTime, endTime)
+}
+
+// Query performs a query for the given time.
+func (h *HealthCheckAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	if err := h.Check.err(); err != nil {
+		return nil, nil, err
+	}
+	return h.API.Query(ctx, query, ts)
+}
+
+// QueryRange performs a query for the given range.
+func (h *HealthCheckAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	if err := h.Check.err(); err != nil {
+		return nil, nil, err
+	}
+	return h.API.QueryRange(ctx, query, r)
+}
+
+// Series finds series by label matchers.
+func (h *HealthCheckAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	if err := h.Check.err(); err != nil {
+		return nil, nil, err
+	}
+	return h.API.Series(ctx, matches, startTime, endTime)
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (h *HealthCheckAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	if err := h.Check.err(); err != nil {
+		return nil, nil, err
+	}
+	return h.API.GetValue(ctx, start, end, matchers)
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (h *HealthCheckAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	if err := h.Check.err(); err != nil {
+		return nil, nil, err
+	}
+	return h.API.Metadata(ctx, metric, limit)
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (h *HealthCheckAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	if err := h.Check.err(); err != nil {
+		return nil, nil, err
+	}
+	return h.API.QueryExemplars(ctx, query, startTime, endTime)
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (h *HealthCheckAPI) Key() model.LabelSet {
+	if apiLabels, ok := h.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package promclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestHealthCheckAPI(t *testing.T) {
+	var ready int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/-/ready" || atomic.LoadInt32(&ready) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	states := make(chan bool, 10)
+	check := NewHealthCheck(srv.URL+"/-/ready", srv.Client(), 5*time.Millisecond, time.Second, 2, func(healthy bool) {
+		states <- healthy
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	check.Start(ctx)
+
+	stub := &stubAPI{query: func() model.Value { return model.Vector{} }}
+	a := &HealthCheckAPI{API: stub, Check: check}
+	if _, _, err := a.Query(context.TODO(), "up", time.Now()); err != nil {
+		t.Fatalf("unexpected error while healthy: %v", err)
+	}
+
+	atomic.StoreInt32(&ready, 0)
+	select {
+	case healthy := <-states:
+		if healthy {
+			t.Fatal("expected the downstream to become unhealthy")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("downstream didn't become unhealthy")
+	}
+	if _, _, err := a.Query(context.TODO(), "up", time.Now()); err == nil {
+		t.Fatal("expected an error while unhealthy")
+	} else if _, ok := err.(*UnhealthyError); !ok {
+		t.Fatalf("expected an UnhealthyError, got %v", err)
+	}
+
+	atomic.StoreInt32(&ready, 1)
+	select {
+	case healthy := <-states:
+		if !healthy {
+			t.Fatal("expected the downstream to recover")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("downstream didn't recover")
+	}
+	if _, _, err := a.Query(context.TODO(), "up", time.Now()); err != nil {
+		t.Fatalf("unexpected error after recovering: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package promclient
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// hedgeLatencyWindow is the number of recent latencies kept to determine the hedge delay
+	hedgeLatencyWindow = 100
+	// hedgeMinSamples is the number of latencies we need before we trust the quantile
+	hedgeMinSamples = 20
+)
+
+// NewHedgeTracker returns a HedgeTracker with the hedge delay `delay` (which must be
+// positive), or if quantile is set that quantile of the recent latency of each call
+// (with delay being used until enough latency has been observed)
+func NewHedgeTracker(delay time.Duration, quantile float64) *HedgeTracker {
+	return &HedgeTracker{
+		delay:     delay,
+		quantile:  quantile,
+		latencies: make(map[string]*latencyWindow),
+	}
+}
+
+// HedgeTracker keeps a window of recent request latencies per call (e.g. query or
+// series, which have very different latencies) in order to determine how long to
+// wait before sending a hedged (backup) request
+type HedgeTracker struct {
+	delay    time.Duration
+	quantile float64
+
+	l         sync.Mutex
+	latencies map[string]*latencyWindow
+}
+
+// latencyWindow is a ring buffer of the most recent latencies
+type latencyWindow struct {
+	latencies []time.Duration
+	offset    int
+}
+
+// Observe records the latency of a successful request of the call
+func (h *HedgeTracker) Observe(call string, took time.Duration) {
+	if h.quantile <= 0 {
+		return
+	}
+
+	h.l.Lock()
+	defer h.l.Unlock()
+	w, ok := h.latencies[call]
+	if !ok {
+		w = &latencyWindow{latencies: make([]time.Duration, 0, hedgeLatencyWindow)}
+		h.latencies[call] = w
+	}
+	if len(w.latencies) < hedgeLatencyWindow {
+		w.latencies = append(w.latencies, took)
+	} else {
+		w.latencies[w.offset] = took
+		w.offset = (w.offset + 1) % hedgeLatencyWindow
+	}
+}
+
+// Delay returns how long to wait before sending a hedged request of the call
+func (h *HedgeTracker) Delay(call string) time.Duration {
+	if h.quantile <= 0 {
+		return h.delay
+	}
+
+	h.l.Lock()
+	w, ok := h.latencies[call]
+	if !ok || len(w.latencies) < hedgeMinSamples {
+		h.l.Unlock()
+		return h.delay
+	}
+	sorted := make([]time.Duration, len(w.latencies))
+	copy(sorted, w.latencies)
+	h.l.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(h.quantile * float64(len(sorted)-1))
+	if d := sorted[idx]; d > 0 {
+		return d
+	}
+	return h.delay
+}
@@ -11,44 +11,129 @@ import (
 
 // IgnoreErrorAPI simply swallows all errors from the given API. This allows the API to
 // be used with all the regular error merging logic and effectively have its errors
-// not considered
+// not considered. The errors are returned as warnings instead.
 type IgnoreErrorAPI struct {
 	API
 }
 
+// ignoreError adds the error (if any) to the warnings
+func ignoreError(w v1.Warnings, err error) v1.Warnings {
+	if err != nil {
+		return append(w, "ignored error: "+err.Error())
+	}
+	return w
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (n *IgnoreErrorAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	v, w, err := n.API.LabelNames(ctx)
+
+	return v, ignoreError(w, err), nil
+}
+
 // LabelValues performs a query for the values of the given label.
-func (n *IgnoreErrorAPI) LabelValues(ctx context.Context, label string) (model.LabelValues, v1.Warnings, error) {
-	v, w, _ := n.API.LabelValues(ctx, label)
+func (n *IgnoreErrorAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	v, w, err := n.API.LabelValues(ctx, label, matchers, startTime, endTime)
 
-	return v, w, nil
+	return v, ignoreError(w, err), nil
 }
 
 // Query performs a query for the given time.
 func (n *IgnoreErrorAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
-	v, w, _ := n.API.Query(ctx, query, ts)
+	v, w, err := n.API.Query(ctx, query, ts)
 
-	return v, w, nil
+	return v, ignoreError(w, err), nil
 }
 
 // QueryRange performs a query for the given range.
 func (n *IgnoreErrorAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
-	v, w, _ := n.API.QueryRange(ctx, query, r)
+	v, w, err := n.API.QueryRange(ctx, query, r)
 
-	return v, w, nil
+	return v, ignoreError(w, err), nil
 }
 
 // Series finds series by label matchers.
 func (n *IgnoreErrorAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
-	v, w, _ := n.API.Series(ctx, matches, startTime, endTime)
+	v, w, err := n.API.Series(ctx, matches, startTime, endTime)
 
-	return v, w, nil
+	return v, ignoreError(w, err), nil
 }
 
 // GetValue loads the raw data for a given set of matchers in the time range
 func (n *IgnoreErrorAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
-	v, w, _ := n.API.GetValue(ctx, start, end, matchers)
+	v, w, err := n.API.GetValue(ctx, start, end, matchers)
+
+	return v, ignoreError(w, err), nil
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (n *IgnoreErrorAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	v, w, err := n.API.Metadata(ctx, metric, limit)
+
+	return v, ignoreError(w, err), nil
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (n *IgnoreErrorAPI) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	v, w, err := n.API.Targets(ctx)
+
+	return v, ignoreError(w, err), nil
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (n *IgnoreErrorAPI) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	v, w, err := n.API.Rules(ctx)
+
+	return v, ignoreError(w, err), nil
+}
+
+// Alerts returns a list of all active alerts.
+func (n *IgnoreErrorAPI) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	v, w, err := n.API.Alerts(ctx)
+
+	return v, ignoreError(w, err), nil
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+func (n *IgnoreErrorAPI) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	v, w, err := n.API.AlertManagers(ctx)
+
+	return v, ignoreError(w, err), nil
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (n *IgnoreErrorAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	v, w, err := n.API.QueryExemplars(ctx, query, startTime, endTime)
+
+	return v, ignoreError(w, err), nil
+}
+
+// TSDB returns the cardinality statistics of the TSDB.
+func (n *IgnoreErrorAPI) TSDB(ctx context.Context) (TSDBResult, v1.Warnings, error) {
+	v, w, err := n.API.TSDB(ctx)
+
+	return v, ignoreError(w, err), nil
+}
+
+// Buildinfo returns the build information of each server.
+func (n *IgnoreErrorAPI) Buildinfo(ctx context.Context) ([]BuildinfoResult, v1.Warnings, error) {
+	v, w, err := n.API.Buildinfo(ctx)
+
+	return v, ignoreError(w, err), nil
+}
+
+// Runtimeinfo returns the runtime information of each server.
+func (n *IgnoreErrorAPI) Runtimeinfo(ctx context.Context) ([]RuntimeinfoResult, v1.Warnings, error) {
+	v, w, err := n.API.Runtimeinfo(ctx)
+
+	return v, ignoreError(w, err), nil
+}
+
+// Config returns the configuration of each server.
+func (n *IgnoreErrorAPI) Config(ctx context.Context) ([]ConfigResult, v1.Warnings, error) {
+	v, w, err := n.API.Config(ctx)
 
-	return v, w, nil
+	return v, ignoreError(w, err), nil
 }
 
 // Key returns a labelset used to determine other api clients that are the "same"
@@ -0,0 +1,30 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestIgnoreErrorAPI(t *testing.T) {
+	stub := &stubAPI{query: func() model.Value { return model.Vector{} }}
+
+	v, w, err := (&IgnoreErrorAPI{&errorAPI{stub, fmt.Errorf("unavailable")}}).Query(context.TODO(), "up", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != nil {
+		t.Fatalf("unexpected value: %v", v)
+	}
+	if len(w) != 1 || w[0] != "ignored error: unavailable" {
+		t.Fatalf("the error wasn't returned as a warning: %v", w)
+	}
+
+	// Without an error nothing is added
+	if _, w, _ := (&IgnoreErrorAPI{stub}).Query(context.TODO(), "up", time.Now()); len(w) != 0 {
+		t.Fatalf("unexpected warnings: %v", w)
+	}
+}
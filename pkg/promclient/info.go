@@ -0,0 +1,37 @@
+package promclient
+
+import (
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// BuildinfoResult contains the build information of a single server
+type BuildinfoResult struct {
+	// Server identifies the downstream server the information came from
+	Server    string `json:"server,omitempty"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildUser string `json:"buildUser"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	// Error is set if the information couldn't be fetched from the server
+	Error string `json:"error,omitempty"`
+}
+
+// ConfigResult contains the (YAML) configuration of a single server
+type ConfigResult struct {
+	// Server identifies the downstream server the configuration came from
+	Server string `json:"server,omitempty"`
+	YAML   string `json:"yaml"`
+	// Error is set if the configuration couldn't be fetched from the server
+	Error string `json:"error,omitempty"`
+}
+
+// RuntimeinfoResult contains the runtime information of a single server
+type RuntimeinfoResult struct {
+	// Server identifies the downstream server the information came from
+	Server string `json:"server,omitempty"`
+	// Error is set if the information couldn't be fetched from the server
+	Error string `json:"error,omitempty"`
+	v1.RuntimeinfoResult
+}
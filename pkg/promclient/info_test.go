@@ -0,0 +1,125 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+func TestMultiAPIBuildinfo(t *testing.T) {
+	stub := func(server, version string) API {
+		return &stubAPI{
+			buildinfo: func() []BuildinfoResult {
+				return []BuildinfoResult{{Server: server, Version: version}}
+			},
+		}
+	}
+
+	// The inner MultiAPI attributes results to its targets, the outer one
+	// (like the one over the servergroups) must keep that attribution
+	inner := NewMultiAPI([]API{
+		&AddLabelClient{stub("", "2.24.1"), model.LabelSet{"host": "a"}},
+		&AddLabelClient{stub("", "2.26.0"), model.LabelSet{"host": "b"}},
+	}, model.Time(0), nil, 1, WithAPINames([]string{"a:9090", "b:9090"}))
+	api := NewMultiAPI([]API{
+		&AddLabelClient{inner, model.LabelSet{"sg": "1"}},
+		&AddLabelClient{stub("c:9090", "2.26.0"), model.LabelSet{"sg": "2"}},
+	}, model.Time(0), nil, 1)
+
+	infos, _, err := api.Buildinfo(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []BuildinfoResult{
+		{Server: "a:9090", Version: "2.24.1"},
+		{Server: "b:9090", Version: "2.26.0"},
+		{Server: "c:9090", Version: "2.26.0"},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Fatalf("mismatch in buildinfo expected=%v actual=%v", expected, infos)
+	}
+}
+
+func TestMultiAPIInfoErrors(t *testing.T) {
+	stub := &stubAPI{
+		buildinfo: func() []BuildinfoResult {
+			return []BuildinfoResult{{Version: "2.26.0"}}
+		},
+		runtimeinfo: func() []RuntimeinfoResult {
+			return []RuntimeinfoResult{{RuntimeinfoResult: v1.RuntimeinfoResult{StorageRetention: "15d"}}}
+		},
+	}
+
+	// The info is fetched from all of the apis (not just a quorum of them, as
+	// with hedging), those which fail are reported in their results
+	api := NewMultiAPI([]API{
+		&AddLabelClient{stub, model.LabelSet{"sg": "1"}},
+		&AddLabelClient{stub, model.LabelSet{"sg": "1"}},
+		&AddLabelClient{&errorAPI{stub, fmt.Errorf("unavailable")}, model.LabelSet{"sg": "1"}},
+	}, model.Time(0), nil, 1,
+		WithAPINames([]string{"a:9090", "b:9090", "c:9090"}),
+		WithHedging(NewHedgeTracker(time.Minute, 0)),
+	)
+
+	infos, _, err := api.Buildinfo(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []BuildinfoResult{
+		{Server: "a:9090", Version: "2.26.0"},
+		{Server: "b:9090", Version: "2.26.0"},
+		{Server: "c:9090", Error: "unavailable"},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Fatalf("mismatch in buildinfo expected=%v actual=%v", expected, infos)
+	}
+
+	runtimeinfos, _, err := api.Runtimeinfo(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedRuntimeinfos := []RuntimeinfoResult{
+		{Server: "a:9090", RuntimeinfoResult: v1.RuntimeinfoResult{StorageRetention: "15d"}},
+		{Server: "b:9090", RuntimeinfoResult: v1.RuntimeinfoResult{StorageRetention: "15d"}},
+		{Server: "c:9090", Error: "unavailable"},
+	}
+	if !reflect.DeepEqual(runtimeinfos, expectedRuntimeinfos) {
+		t.Fatalf("mismatch in runtimeinfo expected=%v actual=%v", expectedRuntimeinfos, runtimeinfos)
+	}
+}
+
+func TestMultiAPIConfig(t *testing.T) {
+	stub := &stubAPI{
+		config: func() []ConfigResult {
+			return []ConfigResult{{YAML: "global: {}"}}
+		},
+	}
+
+	api := NewMultiAPI([]API{
+		&AddLabelClient{stub, model.LabelSet{"sg": "1"}},
+		&AddLabelClient{stub, model.LabelSet{"sg": "1"}},
+		&AddLabelClient{&errorAPI{stub, fmt.Errorf("unavailable")}, model.LabelSet{"sg": "1"}},
+	}, model.Time(0), nil, 1,
+		WithAPINames([]string{"a:9090", "b:9090", "c:9090"}),
+		WithHedging(NewHedgeTracker(time.Minute, 0)),
+	)
+
+	configs, _, err := api.Config(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []ConfigResult{
+		{Server: "a:9090", YAML: "global: {}"},
+		{Server: "b:9090", YAML: "global: {}"},
+		{Server: "c:9090", Error: "unavailable"},
+	}
+	if !reflect.DeepEqual(configs, expected) {
+		t.Fatalf("mismatch in config expected=%v actual=%v", expected, configs)
+	}
+}
@@ -13,8 +13,9 @@ import (
 type API interface {
 	// LabelNames returns all the unique label names present in the block in sorted order.
 	LabelNames(ctx context.Context) ([]string, v1.Warnings, error)
-	// LabelValues performs a query for the values of the given label.
-	LabelValues(ctx context.Context, label string) (model.LabelValues, v1.Warnings, error)
+	// LabelValues performs a query for the values of the given label, optionally limited to
+	// the series matching the matchers in the time range (zero times are unbounded).
+	LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error)
 	// Query performs a query for the given time.
 	Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error)
 	// QueryRange performs a query for the given range.
@@ -23,6 +24,32 @@ type API interface {
 	Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error)
 	// GetValue loads the raw data for a given set of matchers in the time range
 	GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error)
+	// Metadata returns metadata about metrics currently scraped by the metric name.
+	Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error)
+	// Targets returns an overview of the current state of the Prometheus target discovery.
+	Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error)
+	// Rules returns a list of alerting and recording rules that are currently loaded.
+	Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error)
+	// Alerts returns a list of all active alerts.
+	Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error)
+	// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+	AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error)
+	// QueryExemplars performs a query for exemplars by the given query and time range.
+	QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error)
+	// TSDB returns the cardinality statistics of the TSDB.
+	TSDB(ctx context.Context) (TSDBResult, v1.Warnings, error)
+	// Buildinfo returns the build information of each server.
+	Buildinfo(ctx context.Context) ([]BuildinfoResult, v1.Warnings, error)
+	// Runtimeinfo returns the runtime information of each server.
+	Runtimeinfo(ctx context.Context) ([]RuntimeinfoResult, v1.Warnings, error)
+	// Config returns the configuration of each server.
+	Config(ctx context.Context) ([]ConfigResult, v1.Warnings, error)
+	// DeleteSeries deletes data for a selection of series in a time range.
+	DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error)
+	// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+	CleanTombstones(ctx context.Context) ([]AdminResult, v1.Warnings, error)
+	// Snapshot creates a snapshot of all current data on each server.
+	Snapshot(ctx context.Context, skipHead bool) ([]AdminResult, v1.Warnings, error)
 }
 
 // APILabels includes a Key() mechanism to differentiate which APIs are "the same"
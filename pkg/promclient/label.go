@@ -28,6 +28,26 @@ func MergeLabelValues(a, b []model.LabelValue) []model.LabelValue {
 	return a
 }
 
+// MergeLabelNames merges the label names from b into a
+func MergeLabelNames(a, b []string) []string {
+	names := make(map[string]struct{}, len(a))
+	ret := a[:0]
+	for _, item := range a {
+		if _, ok := names[item]; !ok {
+			ret = append(ret, item)
+			names[item] = struct{}{}
+		}
+	}
+
+	for _, item := range b {
+		if _, ok := names[item]; !ok {
+			ret = append(ret, item)
+			names[item] = struct{}{}
+		}
+	}
+	return ret
+}
+
 // MergeLabelSets merges the labelset b into a
 func MergeLabelSets(a, b []model.LabelSet) []model.LabelSet {
 	added := make(map[model.Fingerprint]struct{})
@@ -46,7 +66,10 @@ func MergeLabelSets(a, b []model.LabelSet) []model.LabelSet {
 	return a
 }
 
-// AddLabelClient proxies a client and adds the given labels to all results
+// AddLabelClient proxies a client and adds the given labels to all results.
+// Matchers on those labels are evaluated by the client and stripped from the
+// queries sent downstream, so the downstream doesn't need to know about them;
+// if they don't match the downstream isn't queried at all.
 type AddLabelClient struct {
 	API
 	Labels model.LabelSet
@@ -80,8 +103,20 @@ func (c *AddLabelClient) LabelNames(ctx context.Context) ([]string, v1.Warnings,
 }
 
 // LabelValues performs a query for the values of the given label.
-func (c *AddLabelClient) LabelValues(ctx context.Context, label string) (model.LabelValues, v1.Warnings, error) {
-	val, w, err := c.API.LabelValues(ctx, label)
+func (c *AddLabelClient) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	if len(matchers) > 0 {
+		filteredMatchers, err := c.filterMatches(ctx, matchers)
+		if err != nil {
+			return nil, nil, err
+		}
+		// If no matchers remain, then we don't have anything -- so skip
+		if len(filteredMatchers) == 0 {
+			return nil, nil, nil
+		}
+		matchers = filteredMatchers
+	}
+
+	val, w, err := c.API.LabelValues(ctx, label, matchers, startTime, endTime)
 	if err != nil {
 		return nil, w, err
 	}
@@ -147,22 +182,21 @@ func (c *AddLabelClient) QueryRange(ctx context.Context, query string, r v1.Rang
 	return val, w, nil
 }
 
-// Series finds series by label matchers.
-func (c *AddLabelClient) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
-	// Now we need to filter the matches sent to us for the labels associated with this
-	// servergroup
+// filterMatches filters the series selectors for the labels of this client, returning
+// the selectors which may match (with the matchers on our labels removed)
+func (c *AddLabelClient) filterMatches(ctx context.Context, matches []string) ([]string, error) {
 	filteredMatches := make([]string, 0, len(matches))
 	for _, matcher := range matches {
 		// Parse out the promql query into expressions etc.
 		e, err := parser.ParseExpr(matcher)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		// Walk the expression, to filter out any LabelMatchers that match etc.
 		filterVisitor := &LabelFilterVisitor{c.Labels, true}
 		if _, err := parser.Walk(ctx, filterVisitor, &parser.EvalStmt{Expr: e}, e, nil, nil); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		// If we didn't match, lets skip
 		if !filterVisitor.filterMatch {
@@ -171,6 +205,17 @@ func (c *AddLabelClient) Series(ctx context.Context, matches []string, startTime
 		// if we did match, lets assign the filtered version of the matcher
 		filteredMatches = append(filteredMatches, e.String())
 	}
+	return filteredMatches, nil
+}
+
+// Series finds series by label matchers.
+func (c *AddLabelClient) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	// Now we need to filter the matches sent to us for the labels associated with this
+	// servergroup
+	filteredMatches, err := c.filterMatches(ctx, matches)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// If no matchers remain, then we don't have anything -- so skip
 	if len(filteredMatches) == 0 {
@@ -192,6 +237,22 @@ func (c *AddLabelClient) Series(ctx context.Context, matches []string, startTime
 	return v, w, nil
 }
 
+// DeleteSeries deletes data for a selection of series in a time range. The
+// deletion is only sent if the matchers may match the labels of this client.
+func (c *AddLabelClient) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error) {
+	filteredMatches, err := c.filterMatches(ctx, matches)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// If no matchers remain, then we don't have anything to delete -- so skip
+	if len(filteredMatches) == 0 {
+		return nil, nil, nil
+	}
+
+	return c.API.DeleteSeries(ctx, filteredMatches, startTime, endTime)
+}
+
 // GetValue loads the raw data for a given set of matchers in the time range
 func (c *AddLabelClient) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
 	filteredMatchers, ok := FilterMatchers(c.Labels, matchers)
@@ -209,3 +270,93 @@ func (c *AddLabelClient) GetValue(ctx context.Context, start, end time.Time, mat
 
 	return val, w, nil
 }
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (c *AddLabelClient) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	v, w, err := c.API.Targets(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	// annotate the targets with the labels of the servergroup they came from
+	for i, t := range v.Active {
+		v.Active[i].Labels = t.Labels.Merge(c.Labels)
+	}
+
+	return v, w, nil
+}
+
+// addAlertsLabels returns a copy of the alerts with the labels added
+func addAlertsLabels(alerts []*v1.Alert, l model.LabelSet) []*v1.Alert {
+	ret := make([]*v1.Alert, len(alerts))
+	for i, alert := range alerts {
+		tmp := *alert
+		tmp.Labels = alert.Labels.Merge(l)
+		ret[i] = &tmp
+	}
+	return ret
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (c *AddLabelClient) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	v, w, err := c.API.Rules(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	// annotate the rules (and their alerts) with the labels of the servergroup they came from
+	for _, group := range v.Groups {
+		for i, rule := range group.Rules {
+			switch r := rule.(type) {
+			case v1.AlertingRule:
+				r.Labels = r.Labels.Merge(c.Labels)
+				r.Alerts = addAlertsLabels(r.Alerts, c.Labels)
+				group.Rules[i] = r
+			case v1.RecordingRule:
+				r.Labels = r.Labels.Merge(c.Labels)
+				group.Rules[i] = r
+			}
+		}
+	}
+
+	return v, w, nil
+}
+
+// Alerts returns a list of all active alerts.
+func (c *AddLabelClient) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	v, w, err := c.API.Alerts(ctx)
+	if err != nil {
+		return v, w, err
+	}
+
+	v.Alerts = alertValues(addAlertsLabels(alertPointers(v.Alerts), c.Labels))
+	return v, w, nil
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (c *AddLabelClient) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	// Parse out the promql query into expressions etc.
+	e, err := parser.ParseExpr(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Walk the expression, to filter out any LabelMatchers that match etc.
+	filterVisitor := &LabelFilterVisitor{c.Labels, true}
+	if _, err := parser.Walk(ctx, filterVisitor, &parser.EvalStmt{Expr: e}, e, nil, nil); err != nil {
+		return nil, nil, err
+	}
+	if !filterVisitor.filterMatch {
+		return nil, nil, nil
+	}
+
+	v, w, err := c.API.QueryExemplars(ctx, e.String(), startTime, endTime)
+	if err != nil {
+		return nil, w, err
+	}
+
+	for i, result := range v {
+		v[i].SeriesLabels = result.SeriesLabels.Merge(c.Labels)
+	}
+	return v, w, nil
+}
@@ -1,10 +1,13 @@
 package promclient
 
 import (
+	"context"
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	model "github.com/prometheus/common/model"
 )
 
@@ -85,3 +88,57 @@ func TestMergeLabelSets(t *testing.T) {
 		})
 	}
 }
+
+// labelValuesAPI records the matchers it was called with
+type labelValuesAPI struct {
+	API
+	matchers []string
+}
+
+func (l *labelValuesAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	l.matchers = matchers
+	return model.LabelValues{"a"}, nil, nil
+}
+
+func TestAddLabelClientLabelValues(t *testing.T) {
+	tests := []struct {
+		label    string
+		matchers []string
+		called   bool
+		sent     []string
+		values   model.LabelValues
+	}{
+		// No matchers
+		{label: "job", called: true, values: model.LabelValues{"a"}},
+		// Our own label is added to the values
+		{label: "sg", called: true, values: model.LabelValues{"a", "1"}},
+		// Matchers on our labels are removed
+		{
+			label:    "job",
+			matchers: []string{`up{sg="1"}`},
+			called:   true,
+			sent:     []string{"up"},
+			values:   model.LabelValues{"a"},
+		},
+		// Matchers which don't match our labels mean we have no values
+		{label: "job", matchers: []string{`up{sg="2"}`}},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			api := &labelValuesAPI{}
+			client := &AddLabelClient{api, model.LabelSet{"sg": "1"}}
+
+			values, _, err := client.LabelValues(context.TODO(), test.label, test.matchers, time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(values, test.values) {
+				t.Fatalf("mismatch in values expected=%v actual=%v", test.values, values)
+			}
+			if test.called && !reflect.DeepEqual(api.matchers, test.sent) {
+				t.Fatalf("mismatch in matchers sent expected=%v actual=%v", test.sent, api.matchers)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package promclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/sirupsen/logrus"
+)
+
+// LabelFilterClient skips the calls to the API whose selectors can't match the
+// label values of the API, such that e.g. a query for `cluster="prod-eu"` is only
+// sent to the downstreams which have that cluster. Unlike AddLabelClient the
+// queries and results are passed through unmodified.
+type LabelFilterClient struct {
+	API
+	// StaticInclude maps label names to the only values the API has
+	StaticInclude map[string][]string
+	// StaticExclude maps label names to values the API doesn't have
+	StaticExclude map[string][]string
+	// DynamicLabels are labels whose values are loaded from the API (every
+	// SyncInterval), until they are loaded all calls are sent to the API
+	DynamicLabels []string
+	SyncInterval  time.Duration
+
+	l             sync.Mutex
+	dynamicValues map[string]map[string]struct{}
+	lastSync      time.Time
+	syncing       bool
+}
+
+// dynamic returns the loaded values of the DynamicLabels, starting a sync in
+// the background if they are out of date
+func (c *LabelFilterClient) dynamic() map[string]map[string]struct{} {
+	if len(c.DynamicLabels) == 0 {
+		return nil
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+	if !c.syncing && time.Since(c.lastSync) >= c.SyncInterval {
+		c.syncing = true
+		go c.sync()
+	}
+	return c.dynamicValues
+}
+
+// sync loads the values of the DynamicLabels from the API
+func (c *LabelFilterClient) sync() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dynamicValues := make(map[string]map[string]struct{}, len(c.DynamicLabels))
+	for _, label := range c.DynamicLabels {
+		values, _, err := c.API.LabelValues(ctx, label, nil, time.Time{}, time.Time{})
+		if err != nil {
+			// Labels which failed to load don't filter anything
+			logrus.Warnf("Error loading label_filter values of %s: %v", label, err)
+			continue
+		}
+		valueSet := make(map[string]struct{}, len(values))
+		for _, v := range values {
+			valueSet[string(v)] = struct{}{}
+		}
+		dynamicValues[label] = valueSet
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.dynamicValues = dynamicValues
+	c.lastSync = time.Now()
+	c.syncing = false
+}
+
+// matchersMatch returns whether the matchers may select any series of the API
+func (c *LabelFilterClient) matchersMatch(matchers []*labels.Matcher, dynamic map[string]map[string]struct{}) bool {
+	for _, m := range matchers {
+		if values, ok := c.StaticInclude[m.Name]; ok {
+			match := false
+			for _, v := range values {
+				if m.Matches(v) {
+					match = true
+					break
+				}
+			}
+			if !match {
+				return false
+			}
+		}
+
+		if values, ok := c.StaticExclude[m.Name]; ok && m.Type == labels.MatchEqual {
+			for _, v := range values {
+				if m.Value == v {
+					return false
+				}
+			}
+		}
+
+		// Series without the label may match (e.g. `cluster!="a"`)
+		if values, ok := dynamic[m.Name]; ok && !m.Matches("") {
+			match := false
+			for v := range values {
+				if m.Matches(v) {
+					match = true
+					break
+				}
+			}
+			if !match {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// queryMatches returns whether any of the selectors in the query may select
+// series of the API, queries without selectors always match
+func (c *LabelFilterClient) queryMatches(ctx context.Context, query string) (bool, error) {
+	e, err := parser.ParseExpr(query)
+	if err != nil {
+		return false, err
+	}
+
+	dynamic := c.dynamic()
+	// The children of a node may be inspected concurrently
+	var l sync.Mutex
+	hasSelectors := false
+	match := false
+	_, err = parser.Inspect(ctx, &parser.EvalStmt{Expr: e}, func(node parser.Node, _ []parser.Node) error {
+		if n, ok := node.(*parser.VectorSelector); ok {
+			nodeMatch := c.matchersMatch(n.LabelMatchers, dynamic)
+			l.Lock()
+			hasSelectors = true
+			match = match || nodeMatch
+			l.Unlock()
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	return match || !hasSelectors, nil
+}
+
+// selectorsMatch returns whether any of the series selectors may select series
+// of the API, no selectors always match
+func (c *LabelFilterClient) selectorsMatch(selectors []string) (bool, error) {
+	if len(selectors) == 0 {
+		return true, nil
+	}
+	dynamic := c.dynamic()
+	for _, selector := range selectors {
+		matchers, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			return false, err
+		}
+		if c.matchersMatch(matchers, dynamic) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LabelValues performs a query for the values of the given label.
+func (c *LabelFilterClient) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	if match, err := c.selectorsMatch(matchers); err != nil || !match {
+		return nil, nil, err
+	}
+	return c.API.LabelValues(ctx, label, matchers, startTime, endTime)
+}
+
+// Query performs a query for the given time.
+func (c *LabelFilterClient) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	if match, err := c.queryMatches(ctx, query); err != nil || !match {
+		return nil, nil, err
+	}
+	return c.API.Query(ctx, query, ts)
+}
+
+// QueryRange performs a query for the given range.
+func (c *LabelFilterClient) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	if match, err := c.queryMatches(ctx, query); err != nil || !match {
+		return nil, nil, err
+	}
+	return c.API.QueryRange(ctx, query, r)
+}
+
+// Series finds series by label matchers.
+func (c *LabelFilterClient) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	if match, err := c.selectorsMatch(matches); err != nil || !match {
+		return nil, nil, err
+	}
+	return c.API.Series(ctx, matches, startTime, endTime)
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (c *LabelFilterClient) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	if !c.matchersMatch(matchers, c.dynamic()) {
+		return nil, nil, nil
+	}
+	return c.API.GetValue(ctx, start, end, matchers)
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (c *LabelFilterClient) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	if match, err := c.queryMatches(ctx, query); err != nil || !match {
+		return nil, nil, err
+	}
+	return c.API.QueryExemplars(ctx, query, startTime, endTime)
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (c *LabelFilterClient) Key() model.LabelSet {
+	if apiLabels, ok := c.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package promclient
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestLabelFilterClientStatic(t *testing.T) {
+	tests := []struct {
+		query  string
+		called bool
+	}{
+		// Queries without matchers on the filtered labels are sent
+		{query: `up`, called: true},
+		{query: `1 + 1`, called: true},
+		{query: `up{cluster="prod-eu"}`, called: true},
+		{query: `up{cluster=~"prod-.*"}`, called: true},
+		{query: `up{cluster="prod-us"}`, called: false},
+		{query: `up{cluster!="prod-eu"}`, called: false},
+		{query: `rate(up{cluster="prod-us"}[5m])`, called: false},
+		// Any selector matching sends the query
+		{query: `up{cluster="prod-us"} or up{cluster="prod-eu"}`, called: true},
+		{query: `up{env="dev"}`, called: false},
+		{query: `up{env="prod"}`, called: true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			downstream := &countingAPI{API: &stubAPI{query: func() model.Value { return model.Vector{} }}}
+			c := &LabelFilterClient{
+				API:           downstream,
+				StaticInclude: map[string][]string{"cluster": {"prod-eu"}},
+				StaticExclude: map[string][]string{"env": {"dev"}},
+			}
+			if _, _, err := c.Query(context.TODO(), test.query, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if called := atomic.LoadInt32(&downstream.calls) > 0; called != test.called {
+				t.Fatalf("mismatch in called expected=%v actual=%v", test.called, called)
+			}
+		})
+	}
+}
+
+func TestLabelFilterClientDynamic(t *testing.T) {
+	downstream := &countingAPI{API: &stubAPI{
+		query:       func() model.Value { return model.Vector{} },
+		labelValues: func() model.LabelValues { return model.LabelValues{"prod-eu"} },
+	}}
+	c := &LabelFilterClient{API: downstream, DynamicLabels: []string{"cluster"}, SyncInterval: time.Hour}
+
+	// Until the values are loaded all queries are sent
+	if _, _, err := c.Query(context.TODO(), `up{cluster="prod-us"}`, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&downstream.calls) != 1 {
+		t.Fatal("query wasn't sent before the label values were loaded")
+	}
+
+	for i := 0; ; i++ {
+		c.l.Lock()
+		loaded := c.dynamicValues != nil
+		c.l.Unlock()
+		if loaded {
+			break
+		}
+		if i > 100 {
+			t.Fatal("label values were not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, query := range []string{`up{cluster="prod-us"}`, `up{cluster="prod-eu"}`, `up{cluster!="prod-us"}`} {
+		if _, _, err := c.Query(context.TODO(), query, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The values don't include prod-us, series without the cluster label may match !=
+	if calls := atomic.LoadInt32(&downstream.calls); calls != 3 {
+		t.Fatalf("expected 3 queries to be sent, got %d", calls)
+	}
+}
@@ -0,0 +1,147 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// LimitExceededError is returned when a result exceeds the limits of a LimitAPI
+type LimitExceededError struct {
+	// Scope is the scope of the limited result (e.g. downstream)
+	Scope string
+	// What is the name of the exceeded limit (series or samples)
+	What  string
+	Limit int
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s result exceeded the limit of %d %s", e.Scope, e.Limit, e.What)
+}
+
+// LimitAPI limits the number of series and samples returned by the API, such that
+// a runaway selector can't exhaust promxy's memory. Results over the limit fail
+// with a LimitExceededError, or if Truncate is set are truncated with a warning.
+// A zero limit means no limit.
+type LimitAPI struct {
+	API
+	MaxSeries  int
+	MaxSamples int
+	Truncate   bool
+	// Scope is the scope of the limited results in the errors (downstream if empty)
+	Scope string
+}
+
+// exceeded returns the error for an exceeded limit, or if Truncate is set a warning instead
+func (l *LimitAPI) exceeded(err *LimitExceededError, w v1.Warnings) (v1.Warnings, error) {
+	if err == nil {
+		return w, nil
+	}
+	err.Scope = l.Scope
+	if err.Scope == "" {
+		err.Scope = "downstream"
+	}
+	if !l.Truncate {
+		return w, err
+	}
+	return append(w, "result truncated: "+err.Error()), nil
+}
+
+// limitValue applies the limits to the given value, only whole series are returned
+func (l *LimitAPI) limitValue(v model.Value, w v1.Warnings) (model.Value, v1.Warnings, error) {
+	var limitErr *LimitExceededError
+	switch vTyped := v.(type) {
+	case model.Vector:
+		n := len(vTyped)
+		if l.MaxSeries > 0 && n > l.MaxSeries {
+			n = l.MaxSeries
+			limitErr = &LimitExceededError{What: "series", Limit: l.MaxSeries}
+		}
+		if l.MaxSamples > 0 && n > l.MaxSamples {
+			n = l.MaxSamples
+			limitErr = &LimitExceededError{What: "samples", Limit: l.MaxSamples}
+		}
+		v = vTyped[:n]
+
+	case model.Matrix:
+		n := len(vTyped)
+		if l.MaxSeries > 0 && n > l.MaxSeries {
+			n = l.MaxSeries
+			limitErr = &LimitExceededError{What: "series", Limit: l.MaxSeries}
+		}
+		if l.MaxSamples > 0 {
+			samples := 0
+			for i, stream := range vTyped[:n] {
+				samples += len(stream.Values)
+				if samples > l.MaxSamples {
+					n = i
+					limitErr = &LimitExceededError{What: "samples", Limit: l.MaxSamples}
+					break
+				}
+			}
+		}
+		v = vTyped[:n]
+	}
+
+	w, err := l.exceeded(limitErr, w)
+	if err != nil {
+		return nil, w, err
+	}
+	return v, w, nil
+}
+
+// Query performs a query for the given time.
+func (l *LimitAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	v, w, err := l.API.Query(ctx, query, ts)
+	if err != nil {
+		return v, w, err
+	}
+	return l.limitValue(v, w)
+}
+
+// QueryRange performs a query for the given range.
+func (l *LimitAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	v, w, err := l.API.QueryRange(ctx, query, r)
+	if err != nil {
+		return v, w, err
+	}
+	return l.limitValue(v, w)
+}
+
+// Series finds series by label matchers.
+func (l *LimitAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	v, w, err := l.API.Series(ctx, matches, startTime, endTime)
+	if err != nil {
+		return v, w, err
+	}
+
+	if l.MaxSeries > 0 && len(v) > l.MaxSeries {
+		w, err = l.exceeded(&LimitExceededError{What: "series", Limit: l.MaxSeries}, w)
+		if err != nil {
+			return nil, w, err
+		}
+		v = v[:l.MaxSeries]
+	}
+	return v, w, nil
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (l *LimitAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	v, w, err := l.API.GetValue(ctx, start, end, matchers)
+	if err != nil {
+		return v, w, err
+	}
+	return l.limitValue(v, w)
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (l *LimitAPI) Key() model.LabelSet {
+	if apiLabels, ok := l.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
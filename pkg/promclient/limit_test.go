@@ -0,0 +1,90 @@
+package promclient
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+func TestLimitAPI(t *testing.T) {
+	stream := func(name string, samples int) *model.SampleStream {
+		s := &model.SampleStream{Metric: model.Metric{"__name__": model.LabelValue(name)}}
+		for i := 0; i < samples; i++ {
+			s.Values = append(s.Values, model.SamplePair{Timestamp: model.Time(i), Value: 1})
+		}
+		return s
+	}
+	matrix := model.Matrix{stream("a", 3), stream("b", 3), stream("c", 3)}
+
+	tests := []struct {
+		api      *LimitAPI
+		series   int
+		err      bool
+		warnings int
+	}{
+		// No limits
+		{api: &LimitAPI{}, series: 3},
+		{api: &LimitAPI{MaxSeries: 3, MaxSamples: 9}, series: 3},
+		{api: &LimitAPI{MaxSeries: 2}, err: true},
+		{api: &LimitAPI{MaxSamples: 8}, err: true},
+		// Only whole series are returned when truncating
+		{api: &LimitAPI{MaxSeries: 2, Truncate: true}, series: 2, warnings: 1},
+		{api: &LimitAPI{MaxSamples: 8, Truncate: true}, series: 2, warnings: 1},
+		{api: &LimitAPI{MaxSamples: 2, Truncate: true}, series: 0, warnings: 1},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			test.api.API = &stubAPI{
+				queryRange: func() model.Value { return matrix },
+			}
+
+			v, w, err := test.api.QueryRange(context.TODO(), "up", v1.Range{})
+			if test.err {
+				if _, ok := err.(*LimitExceededError); !ok {
+					t.Fatalf("expected LimitExceededError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(v.(model.Matrix)) != test.series {
+				t.Fatalf("expected %d series, got %v", test.series, v)
+			}
+			if len(w) != test.warnings {
+				t.Fatalf("expected %d warnings, got %v", test.warnings, w)
+			}
+		})
+	}
+}
+
+func TestLimitAPISeries(t *testing.T) {
+	a := &LimitAPI{
+		API: &stubAPI{
+			series: func() []model.LabelSet {
+				return []model.LabelSet{{"a": "1"}, {"a": "2"}}
+			},
+		},
+		MaxSeries: 1,
+	}
+
+	if _, _, err := a.Series(context.TODO(), []string{"up"}, time.Time{}, time.Time{}); err == nil {
+		t.Fatalf("missing expected error")
+	} else if err.Error() != "downstream result exceeded the limit of 1 series" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	a.Truncate = true
+	v, w, err := a.Series(context.TODO(), []string{"up"}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(v) != 1 || len(w) != 1 {
+		t.Fatalf("expected the series to be truncated with a warning, got %v %v", v, w)
+	}
+}
@@ -0,0 +1,29 @@
+package promclient
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// weightedShuffle orders the api indexes randomly, such that apis with a higher
+// weight are more likely to be first (a weighted random sample without replacement).
+// Apis without a weight have a weight of 1, apis with a weight of 0 are always last.
+func weightedShuffle(indexes []int, weights []float64) {
+	keys := make(map[int]float64, len(indexes))
+	for _, i := range indexes {
+		weight := 1.0
+		if i < len(weights) {
+			weight = weights[i]
+		}
+		if weight <= 0 {
+			keys[i] = -1
+			continue
+		}
+		// Each api is keyed by u^(1/weight), the highest keys are the weighted sample
+		keys[i] = math.Pow(rand.Float64(), 1/weight)
+	}
+	sort.SliceStable(indexes, func(x, y int) bool {
+		return keys[indexes[x]] > keys[indexes[y]]
+	})
+}
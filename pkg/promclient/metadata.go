@@ -0,0 +1,56 @@
+package promclient
+
+import (
+	"sort"
+	"strconv"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// MergeMetadata merges the metric metadata from b into a. Metadata for the same
+// metric is merged such that each distinct (type, help, unit) only exists once,
+// conflicting metadata (e.g. different help text between versions of an exporter)
+// is kept -- as prometheus itself does when targets disagree.
+func MergeMetadata(a, b map[string][]v1.Metadata) map[string][]v1.Metadata {
+	if a == nil {
+		a = make(map[string][]v1.Metadata, len(b))
+	}
+
+	for metric, items := range b {
+	ITEMS:
+		for _, item := range items {
+			for _, existing := range a[metric] {
+				if existing == item {
+					continue ITEMS
+				}
+			}
+			a[metric] = append(a[metric], item)
+		}
+	}
+
+	return a
+}
+
+// LimitMetadata limits the metadata to `limit` metrics (the first ones by name),
+// an empty or non-positive limit returns all metadata
+func LimitMetadata(metadata map[string][]v1.Metadata, limit string) map[string][]v1.Metadata {
+	if limit == "" {
+		return metadata
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 || len(metadata) <= n {
+		return metadata
+	}
+
+	metrics := make([]string, 0, len(metadata))
+	for metric := range metadata {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	ret := make(map[string][]v1.Metadata, n)
+	for _, metric := range metrics[:n] {
+		ret[metric] = metadata[metric]
+	}
+	return ret
+}
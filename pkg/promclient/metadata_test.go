@@ -0,0 +1,88 @@
+package promclient
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+func TestMergeMetadata(t *testing.T) {
+	counter := v1.Metadata{Type: v1.MetricTypeCounter, Help: "Total requests", Unit: ""}
+	counterOld := v1.Metadata{Type: v1.MetricTypeCounter, Help: "Requests", Unit: ""}
+	gauge := v1.Metadata{Type: v1.MetricTypeGauge, Help: "Temperature", Unit: "celsius"}
+
+	tests := []struct {
+		a      map[string][]v1.Metadata
+		b      map[string][]v1.Metadata
+		merged map[string][]v1.Metadata
+	}{
+		// Distinct metrics
+		{
+			a:      map[string][]v1.Metadata{"requests_total": {counter}},
+			b:      map[string][]v1.Metadata{"temperature": {gauge}},
+			merged: map[string][]v1.Metadata{"requests_total": {counter}, "temperature": {gauge}},
+		},
+		// Identical metadata is only kept once
+		{
+			a:      map[string][]v1.Metadata{"requests_total": {counter}},
+			b:      map[string][]v1.Metadata{"requests_total": {counter}},
+			merged: map[string][]v1.Metadata{"requests_total": {counter}},
+		},
+		// Conflicting metadata is kept in order
+		{
+			a:      map[string][]v1.Metadata{"requests_total": {counter}},
+			b:      map[string][]v1.Metadata{"requests_total": {counterOld, counter}},
+			merged: map[string][]v1.Metadata{"requests_total": {counter, counterOld}},
+		},
+		// Nil base
+		{
+			a:      nil,
+			b:      map[string][]v1.Metadata{"temperature": {gauge}},
+			merged: map[string][]v1.Metadata{"temperature": {gauge}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			merged := MergeMetadata(test.a, test.b)
+
+			if !reflect.DeepEqual(merged, test.merged) {
+				t.Fatalf("doesn't match\nexpected=%v\nactual=%v", test.merged, merged)
+			}
+		})
+	}
+}
+
+func TestLimitMetadata(t *testing.T) {
+	metadata := map[string][]v1.Metadata{
+		"c": {{Type: v1.MetricTypeGauge}},
+		"a": {{Type: v1.MetricTypeCounter}},
+		"b": {{Type: v1.MetricTypeSummary}},
+	}
+
+	tests := []struct {
+		limit   string
+		metrics []string
+	}{
+		{limit: "", metrics: []string{"a", "b", "c"}},
+		{limit: "0", metrics: []string{"a", "b", "c"}},
+		{limit: "5", metrics: []string{"a", "b", "c"}},
+		{limit: "2", metrics: []string{"a", "b"}},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			limited := LimitMetadata(metadata, test.limit)
+			if len(limited) != len(test.metrics) {
+				t.Fatalf("wrong number of metrics expected=%v actual=%v", test.metrics, limited)
+			}
+			for _, metric := range test.metrics {
+				if _, ok := limited[metric]; !ok {
+					t.Fatalf("missing metric %s in %v", metric, limited)
+				}
+			}
+		})
+	}
+}
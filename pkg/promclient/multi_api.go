@@ -3,8 +3,11 @@ package promclient
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -58,526 +61,1073 @@ func NormalizePromError(err error) error {
 
 // MultiAPIMetricFunc defines a method where a client can record metrics about
 // the specific API calls made through this multi client
-type MultiAPIMetricFunc func(i int, api, status string, took float64)
+type MultiAPIMetricFunc func(i int, api, status string, took float64, info MultiAPICallInfo)
+
+// MultiAPICallInfo describes the downstream of an API call and the size of its response
+type MultiAPICallInfo struct {
+	// Name is the name of the downstream (as set by WithAPINames)
+	Name string
+	// Labels are the labels of the downstream (as defined by APILabels)
+	Labels model.LabelSet
+	// Series and Samples are the size of the decoded response (for calls returning series)
+	Series  int
+	Samples int
+}
+
+// responseSize returns the number of series and samples in a response
+func responseSize(v interface{}) (series, samples int) {
+	switch vTyped := v.(type) {
+	case model.Vector:
+		return len(vTyped), len(vTyped)
+	case model.Matrix:
+		for _, stream := range vTyped {
+			samples += len(stream.Values)
+		}
+		return len(vTyped), samples
+	case *model.Scalar, *model.String:
+		return 1, 1
+	case []model.LabelSet:
+		return len(vTyped), 0
+	}
+	return 0, 0
+}
+
+// MultiAPIOption configures optional behavior of a MultiAPI
+type MultiAPIOption func(*MultiAPI)
+
+// WithHedging enables hedged requests. Instead of sending every request to all
+// apis with the same key (replicas) only `requiredCount` are sent initially. If
+// those haven't responded within the hedge delay a backup request is sent to
+// another replica, and whichever responds first is used. The delay is determined
+// by the tracker (see HedgeTracker), which is kept across service discovery updates.
+func WithHedging(tracker *HedgeTracker) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.hedge = tracker
+	}
+}
+
+// WithAPITimeout sets a timeout for each call to a downstream API. Calls that
+// take longer are cancelled and treated as errors, so a single slow downstream
+// can't hold the whole request until the parent context expires.
+func WithAPITimeout(timeout time.Duration) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.apiTimeout = timeout
+	}
+}
+
+// WithMaxFailures fails requests if more than `maxFailures` apis return an error,
+// even if the quorum for each key was met
+func WithMaxFailures(maxFailures int) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.maxFailures = maxFailures
+	}
+}
+
+// WithMaxFailureRatio fails requests if more than the given ratio (0-1) of the
+// apis return an error, even if the quorum for each key was met
+func WithMaxFailureRatio(ratio float64) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.maxFailureRatio = ratio
+	}
+}
+
+// WithRequiredAPIs marks the apis at the given indexes as required; if any of
+// them return an error the request fails
+func WithRequiredAPIs(indexes ...int) MultiAPIOption {
+	return func(m *MultiAPI) {
+		for _, i := range indexes {
+			if i >= 0 && i < len(m.required) {
+				m.required[i] = true
+			}
+		}
+	}
+}
+
+// WithAPINames sets names (e.g. the target address) for the apis, these are used
+// to identify downstreams in the warnings returned on partial failures
+func WithAPINames(names []string) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.apiNames = names
+	}
+}
+
+// WithSemaphores limits the number of concurrent requests to the apis. Each
+// request acquires the semaphores (in the order given) before being sent; this
+// allows for both a per-MultiAPI and a shared global limit.
+func WithSemaphores(semaphores ...*Semaphore) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.semaphores = append(m.semaphores, semaphores...)
+	}
+}
+
+// WithFirstSuccess returns as soon as `requiredCount` apis for each key have
+// responded successfully and cancels the rest. This is useful when the apis for
+// a key are identical replicas, such that merging every response is wasted work.
+func WithFirstSuccess() MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.firstSuccess = true
+	}
+}
+
+// WithLoadBalancing sends each request to a weighted-random subset of `subsetSize`
+// apis for each key (replicas) instead of all of them, failing over to the other
+// apis of the key on error. weights (if set) are the relative weight of each api,
+// apis with a weight of 0 are only used for failover.
+func WithLoadBalancing(subsetSize int, weights []float64) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.subsetSize = subsetSize
+		m.weights = weights
+	}
+}
+
+// WithShards sets the hashmod shard (0 to modulus-1) of each api, for apis which
+// each hold a shard of the series. The apis of each shard are required separately
+// (as if they had different keys), such that results missing a shard fail the
+// request instead of being silently incomplete.
+func WithShards(shards []int, modulus int) MultiAPIOption {
+	return func(m *MultiAPI) {
+		present := make(map[int]struct{}, modulus)
+		for i, shard := range shards {
+			if i < len(m.apiFingerprints) {
+				m.apiFingerprints[i] = m.apiLabelSets[i].Merge(model.LabelSet{shardLabel: model.LabelValue(strconv.Itoa(shard))}).FastFingerprint()
+			}
+			present[shard] = struct{}{}
+		}
+		for shard := 0; shard < modulus; shard++ {
+			if _, ok := present[shard]; !ok {
+				m.missingShards = append(m.missingShards, shard)
+			}
+		}
+	}
+}
+
+// WithMergeStrategy sets the strategy resolving the conflicting points of the series
+// returned by multiple apis (e.g. replicas), see promhttputil.MergeStrategy
+func WithMergeStrategy(strategy promhttputil.MergeStrategy) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.mergeStrategy = strategy
+	}
+}
+
+// WithDedupTolerance treats nearly-equal points of the series returned by multiple
+// apis as duplicates, see promhttputil.DedupTolerance
+func WithDedupTolerance(tolerance *promhttputil.DedupTolerance) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.dedupTolerance = tolerance
+	}
+}
+
+// WithAntiAffinityTracker derives the anti-affinity from the spacing of the raw samples
+// returned by the apis (see AntiAffinityTracker), instead of the static anti-affinity
+func WithAntiAffinityTracker(tracker *AntiAffinityTracker) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.antiAffinityTracker = tracker
+	}
+}
+
+// WithAntiAffinityLabel overrides the anti-affinity of the series with the label by its
+// value (a duration), see promhttputil.ValueMerger
+func WithAntiAffinityLabel(label model.LabelName) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.antiAffinityLabel = label
+	}
+}
+
+// WithGapFill fills the short gaps of the merged series with the points of the
+// other apis, see promhttputil.ValueMerger
+func WithGapFill() MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.gapFill = true
+	}
+}
+
+// WithMergeLimits caps the size of the merged values, the series over the limits
+// are truncated with a warning identifying them
+func WithMergeLimits(limits promhttputil.MergeLimits) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.mergeLimits = limits
+	}
+}
+
+// WithZones sets the zone (e.g. availability zone) of each api. Requests fail if
+// more than `maxZoneFailures` zones have no successful response, such that e.g.
+// with 0 at least one api in every zone must respond.
+func WithZones(zones []string, maxZoneFailures int) MultiAPIOption {
+	return func(m *MultiAPI) {
+		m.zones = zones
+		m.maxZoneFailures = maxZoneFailures
+		zoneSet := make(map[string]struct{}, len(zones))
+		for _, zone := range zones {
+			zoneSet[zone] = struct{}{}
+		}
+		m.zoneCount = len(zoneSet)
+	}
+}
 
 // NewMultiAPI returns a MultiAPI
-func NewMultiAPI(apis []API, antiAffinity model.Time, metricFunc MultiAPIMetricFunc, requiredCount int) *MultiAPI {
-	fingerprintCounts := make(map[model.Fingerprint]int)
+func NewMultiAPI(apis []API, antiAffinity model.Time, metricFunc MultiAPIMetricFunc, requiredCount int, opts ...MultiAPIOption) *MultiAPI {
 	apiFingerprints := make([]model.Fingerprint, len(apis))
+	apiLabelSets := make([]model.LabelSet, len(apis))
 	for i, api := range apis {
 		var fingerprint model.Fingerprint
 		if apiLabels, ok := api.(APILabels); ok {
 			if keys := apiLabels.Key(); keys != nil {
 				fingerprint = keys.FastFingerprint()
+				apiLabelSets[i] = keys
 			}
 		}
 		apiFingerprints[i] = fingerprint
-		fingerprintCounts[fingerprint]++
 	}
 
-	for _, v := range fingerprintCounts {
-		if v < requiredCount {
-			// TODO: return an error
-			panic("not possible")
-		}
-	}
-
-	return &MultiAPI{
+	m := &MultiAPI{
 		apis:            apis,
 		apiFingerprints: apiFingerprints,
+		apiLabelSets:    apiLabelSets,
 		antiAffinity:    antiAffinity,
 		metricFunc:      metricFunc,
 		requiredCount:   requiredCount,
+		maxFailures:     -1,
+		required:        make([]bool, len(apis)),
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // MultiAPI implements the API interface while merging the results from the apis it wraps
 type MultiAPI struct {
 	apis            []API
 	apiFingerprints []model.Fingerprint
+	apiLabelSets    []model.LabelSet
+	apiNames        []string
 	antiAffinity    model.Time
+	mergeStrategy   promhttputil.MergeStrategy
+	dedupTolerance  *promhttputil.DedupTolerance
 	metricFunc      MultiAPIMetricFunc
 	requiredCount   int // number "per key" that we require to respond
+
+	hedge        *HedgeTracker
+	firstSuccess bool          // return once the quorum is met for all keys
+	apiTimeout   time.Duration // timeout for each downstream call, 0 for none
+
+	// Load balancing
+	subsetSize int       // number of apis per key each request is sent to, 0 for all
+	weights    []float64 // weight of each api, nil for equal weights
+
+	// Partial failure policy
+	maxFailures     int     // max number of apis that may error, -1 for no limit
+	maxFailureRatio float64 // max ratio of apis that may error, 0 for no limit
+	required        []bool  // apis which must not error
+
+	// Zone awareness
+	zones           []string // zone of each api, nil if not zone-aware
+	zoneCount       int      // number of distinct zones
+	maxZoneFailures int      // max number of zones without a successful response
+
+	missingShards []int // shards without any apis, if sharded
+
+	semaphores []*Semaphore // limits on concurrent requests to the apis
+
+	antiAffinityTracker *AntiAffinityTracker // derives the anti-affinity (if set) instead of antiAffinity
+	antiAffinityLabel   model.LabelName      // label overriding the anti-affinity of series, if set
+	gapFill             bool                 // fill the short gaps of merged series
+	mergeLimits         promhttputil.MergeLimits
 }
 
-func (m *MultiAPI) recordMetric(i int, api, status string, took float64) {
+// apiName returns the name of the api at index i for use in warnings
+func (m *MultiAPI) apiName(i int) string {
+	if i < len(m.apiNames) {
+		return m.apiNames[i]
+	}
+	return strconv.Itoa(i)
+}
+
+func (m *MultiAPI) recordMetric(i int, api, status string, took float64, result interface{}) {
 	if m.metricFunc != nil {
-		m.metricFunc(i, api, status, took)
+		info := MultiAPICallInfo{Name: m.apiName(i), Labels: m.apiLabelSets[i]}
+		info.Series, info.Samples = responseSize(result)
+		m.metricFunc(i, api, status, took, info)
 	}
 }
 
-// LabelValues performs a query for the values of the given label.
-func (m *MultiAPI) LabelValues(ctx context.Context, label string) (model.LabelValues, v1.Warnings, error) {
+// multiAPICall is a single call to a downstream API made by the MultiAPI
+type multiAPICall func(ctx context.Context, api API) (interface{}, v1.Warnings, error)
+
+// multiAPIMerge merges the result from the api at index i into the caller's
+// accumulated result
+type multiAPIMerge func(i int, v interface{}) error
+
+// fanout calls `call` on the apis and merges each result with `merge` as it
+// arrives, such that results can be released as soon as they are merged.
+// Results are required from `requiredCount` apis for each key (as defined by
+// APILabels); if that quorum can't be met for any key the call will error.
+func (m *MultiAPI) fanout(ctx context.Context, apiName string, call multiAPICall, merge multiAPIMerge) (v1.Warnings, error) {
+	if len(m.missingShards) > 0 {
+		return nil, &ShardError{Missing: m.missingShards}
+	}
+
 	childContext, childContextCancel := context.WithCancel(ctx)
 	defer childContextCancel()
 
 	type chanResult struct {
-		v        model.LabelValues
+		i        int
+		v        interface{}
 		warnings v1.Warnings
 		err      error
-		ls       model.Fingerprint
 	}
 
-	resultChans := make([]chan chanResult, len(m.apis))
+	// Required apis are ordered first so they are always sent
+	pendingRequests := make(map[model.Fingerprint][]int) // fingerprint -> api indexes not yet called
+	requiredCounts := make(map[model.Fingerprint]int)    // fingerprint -> number of required apis
+	for i, fingerprint := range m.apiFingerprints {
+		if m.required[i] {
+			pendingRequests[fingerprint] = append([]int{i}, pendingRequests[fingerprint]...)
+			requiredCounts[fingerprint]++
+		} else {
+			pendingRequests[fingerprint] = append(pendingRequests[fingerprint], i)
+		}
+	}
+
+	// When load balancing the apis of each key are tried in a weighted-random order
+	if m.subsetSize > 0 {
+		for fingerprint, pending := range pendingRequests {
+			required := requiredCounts[fingerprint]
+			weightedShuffle(pending[required:], m.weights)
+		}
+	}
+
+	// If any key doesn't have enough apis to meet the quorum there is no
+	// reason to even send the requests
+	for k, pending := range pendingRequests {
+		if len(pending) < m.requiredCount {
+			return nil, &QuorumError{Key: k, Required: m.requiredCount, Available: len(pending)}
+		}
+	}
+
+	resultChan := make(chan chanResult, len(m.apis))
 	outstandingRequests := make(map[model.Fingerprint]int) // fingerprint -> outstanding
+	totalOutstanding := 0
+	requiredOutstanding := 0
+
+	// sendRequest sends a request to the next pending api for the given key
+	sendRequest := func(fingerprint model.Fingerprint) {
+		i := pendingRequests[fingerprint][0]
+		pendingRequests[fingerprint] = pendingRequests[fingerprint][1:]
+		outstandingRequests[fingerprint]++
+		totalOutstanding++
+		if m.required[i] {
+			requiredOutstanding++
+		}
+		go func(i int, api API) {
+			for x, sem := range m.semaphores {
+				if err := sem.Acquire(childContext); err != nil {
+					for _, acquired := range m.semaphores[:x] {
+						acquired.Release()
+					}
+					resultChan <- chanResult{i: i, err: err}
+					return
+				}
+			}
+			defer func() {
+				for _, sem := range m.semaphores {
+					sem.Release()
+				}
+			}()
 
-	for i, api := range m.apis {
-		resultChans[i] = make(chan chanResult, 1)
-		outstandingRequests[m.apiFingerprints[i]]++
-		go func(i int, retChan chan chanResult, api API, label string) {
+			ctx := childContext
+			if m.apiTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, m.apiTimeout)
+				defer cancel()
+			}
 			start := time.Now()
-			result, w, err := api.LabelValues(childContext, label)
+			result, w, err := call(ctx, api)
 			took := time.Since(start)
 			if err != nil {
-				m.recordMetric(i, "label_values", "error", took.Seconds())
+				m.recordMetric(i, apiName, "error", took.Seconds(), nil)
 			} else {
-				m.recordMetric(i, "label_values", "success", took.Seconds())
+				m.recordMetric(i, apiName, "success", took.Seconds(), result)
+				if m.hedge != nil {
+					m.hedge.Observe(apiName, took)
+				}
 			}
-			retChan <- chanResult{
+			resultChan <- chanResult{
+				i:        i,
 				v:        result,
 				warnings: w,
 				err:      NormalizePromError(err),
-				ls:       m.apiFingerprints[i],
 			}
-		}(i, resultChans[i], api, label)
+		}(i, m.apis[i])
+	}
+
+	// Scatter out the requests; when hedging (or load balancing) we only send the
+	// minimum required (or the subset) and hold the rest back as backups
+	for fingerprint, pending := range pendingRequests {
+		toSend := len(pending)
+		if m.hedge != nil || m.subsetSize > 0 {
+			toSend = m.requiredCount
+			if m.subsetSize > toSend {
+				toSend = m.subsetSize
+			}
+			if requiredCounts[fingerprint] > toSend {
+				toSend = requiredCounts[fingerprint]
+			}
+			if len(pending) < toSend {
+				toSend = len(pending)
+			}
+		}
+		for x := 0; x < toSend; x++ {
+			sendRequest(fingerprint)
+		}
+	}
+
+	var hedgeC <-chan time.Time
+	if m.hedge != nil {
+		hedgeTicker := time.NewTicker(m.hedge.Delay(apiName))
+		defer hedgeTicker.Stop()
+		hedgeC = hedgeTicker.C
+	}
+
+	// When hedging (or in first-success mode) we are done as soon as the quorum
+	// is met for all keys, the rest of the responses are redundant
+	earlyExit := m.hedge != nil || m.firstSuccess
+
+	zoneSuccesses := make(map[string]struct{}) // zones with a successful response
+	zonesSatisfied := func() bool {
+		return m.zones == nil || len(zoneSuccesses) >= m.zoneCount-m.maxZoneFailures
 	}
 
 	// Wait for results as we get them
-	var result []model.LabelValue
 	warnings := make(promhttputil.WarningSet)
 	var lastError error
 	successMap := make(map[model.Fingerprint]int) // fingerprint -> success
-	for i := 0; i < len(m.apis); i++ {
+	satisfied := 0                                // number of keys that have met the quorum
+	failures := 0
+	for totalOutstanding > 0 && (!earlyExit || satisfied < len(pendingRequests) || requiredOutstanding > 0 || !zonesSatisfied()) {
 		select {
 		case <-ctx.Done():
-			return nil, warnings.Warnings(), ctx.Err()
+			return warnings.Warnings(), ctx.Err()
 
-		case ret := <-resultChans[i]:
-			warnings.AddWarnings(ret.warnings)
-			outstandingRequests[ret.ls]--
+		// The hedge delay has passed, send a backup request for any key still waiting
+		case <-hedgeC:
+			for fingerprint, pending := range pendingRequests {
+				if (successMap[fingerprint] < m.requiredCount || !zonesSatisfied()) && len(pending) > 0 {
+					sendRequest(fingerprint)
+				}
+			}
+
+		case ret := <-resultChan:
+			fingerprint := m.apiFingerprints[ret.i]
+			outstandingRequests[fingerprint]--
+			totalOutstanding--
+			if m.required[ret.i] {
+				requiredOutstanding--
+			}
 			if ret.err != nil {
+				failures++
+				// If the request still succeeds the result may be incomplete, so we
+				// add a warning noting which downstream failed
+				warnings.AddWarnings(ret.warnings)
+				warnings.AddWarning(fmt.Sprintf("downstream %s failed: %v", m.apiName(ret.i), ret.err))
+				if m.required[ret.i] {
+					return warnings.Warnings(), errors.Wrap(ret.err, "required downstream failed")
+				}
+				if (m.maxFailures >= 0 && failures > m.maxFailures) || (m.maxFailureRatio > 0 && float64(failures)/float64(len(m.apis)) > m.maxFailureRatio) {
+					return warnings.Warnings(), errors.Wrapf(ret.err, "too many downstream failures (%d of %d)", failures, len(m.apis))
+				}
+				// When hedging (or load balancing), immediately fail over to a backup
+				if (m.hedge != nil || m.subsetSize > 0) && len(pendingRequests[fingerprint]) > 0 {
+					sendRequest(fingerprint)
+				}
 				// If there aren't enough outstanding requests to possibly succeed, no reason to wait
-				if (outstandingRequests[ret.ls] + successMap[ret.ls]) < m.requiredCount {
-					return nil, warnings.Warnings(), ret.err
+				if (outstandingRequests[fingerprint] + len(pendingRequests[fingerprint]) + successMap[fingerprint]) < m.requiredCount {
+					return warnings.Warnings(), ret.err
 				}
 				lastError = ret.err
 			} else {
-				successMap[ret.ls]++
-				if result == nil {
-					result = ret.v
-				} else {
-					result = MergeLabelValues(result, ret.v)
+				if ret.i < len(m.zones) {
+					zoneSuccesses[m.zones[ret.i]] = struct{}{}
+				}
+				// Any responses after the quorum is met are redundant
+				if !earlyExit || successMap[fingerprint] < m.requiredCount {
+					warnings.AddWarnings(ret.warnings)
+					successMap[fingerprint]++
+					if successMap[fingerprint] == m.requiredCount {
+						satisfied++
+					}
+					if err := merge(ret.i, ret.v); err != nil {
+						return warnings.Warnings(), err
+					}
+				}
+			}
+			// Nothing left in flight but a zone is still missing, send the held back requests
+			if totalOutstanding == 0 && !zonesSatisfied() {
+				for fingerprint, pending := range pendingRequests {
+					if len(pending) > 0 {
+						sendRequest(fingerprint)
+					}
 				}
 			}
 		}
 	}
 
 	// Verify that we hit the requiredCount for all of the buckets
-	for k := range outstandingRequests {
+	for k := range pendingRequests {
 		if successMap[k] < m.requiredCount {
-			return nil, warnings.Warnings(), errors.Wrap(lastError, "Unable to fetch from downstream servers")
+			if lastError == nil {
+				return warnings.Warnings(), &QuorumError{Key: k, Required: m.requiredCount, Available: successMap[k]}
+			}
+			return warnings.Warnings(), errors.Wrap(lastError, "Unable to fetch from downstream servers")
 		}
 	}
 
-	sort.Sort(model.LabelValues(result))
+	if !zonesSatisfied() {
+		return warnings.Warnings(), &ZoneQuorumError{Zones: m.zoneCount, Available: len(zoneSuccesses), MaxZoneFailures: m.maxZoneFailures}
+	}
 
-	return result, warnings.Warnings(), nil
+	return warnings.Warnings(), nil
 }
 
-// LabelNames returns all the unique label names present in the block in sorted order.
-func (m *MultiAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
-	childContext, childContextCancel := context.WithCancel(ctx)
-	defer childContextCancel()
-
-	type chanResult struct {
-		v        []string
-		warnings v1.Warnings
-		err      error
-		ls       model.Fingerprint
-	}
-
-	resultChans := make([]chan chanResult, len(m.apis))
-	outstandingRequests := make(map[model.Fingerprint]int) // fingerprint -> outstanding
+// broadcast calls `call` on all of the apis (regardless of hedging, quorum or
+// failure policies) for calls which return a result per server. The result (or
+// error) of each api is passed to `result` with the name of the api, such that
+// failures are reported in the results of the failed api instead of failing the call.
+func (m *MultiAPI) broadcast(ctx context.Context, apiName string, call multiAPICall, result func(i int, server string, v interface{}, err error)) v1.Warnings {
+	apiWarnings := make([]v1.Warnings, len(m.apis))
 
+	var wg sync.WaitGroup
 	for i, api := range m.apis {
-		resultChans[i] = make(chan chanResult, 1)
-		outstandingRequests[m.apiFingerprints[i]]++
-		go func(i int, retChan chan chanResult, api API) {
+		wg.Add(1)
+		go func(i int, api API) {
+			defer wg.Done()
+			ctx := ctx
+			if m.apiTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, m.apiTimeout)
+				defer cancel()
+			}
+
 			start := time.Now()
-			result, w, err := api.LabelNames(childContext)
-			took := time.Since(start)
+			v, w, err := call(ctx, api)
+			apiWarnings[i] = w
 			if err != nil {
-				m.recordMetric(i, "label_names", "error", took.Seconds())
+				m.recordMetric(i, apiName, "error", time.Since(start).Seconds(), nil)
+				err = NormalizePromError(err)
 			} else {
-				m.recordMetric(i, "label_names", "success", took.Seconds())
+				m.recordMetric(i, apiName, "success", time.Since(start).Seconds(), nil)
 			}
-			retChan <- chanResult{
-				v:        result,
-				warnings: w,
-				err:      NormalizePromError(err),
-				ls:       m.apiFingerprints[i],
-			}
-		}(i, resultChans[i], api)
+			result(i, m.apiName(i), v, err)
+		}(i, api)
 	}
+	wg.Wait()
 
-	// Wait for results as we get them
-	result := make(map[string]struct{})
 	warnings := make(promhttputil.WarningSet)
-	var lastError error
-	successMap := make(map[model.Fingerprint]int) // fingerprint -> success
-	for i := 0; i < len(m.apis); i++ {
-		select {
-		case <-ctx.Done():
-			return nil, warnings.Warnings(), ctx.Err()
+	for _, w := range apiWarnings {
+		warnings.AddWarnings(w)
+	}
+	return warnings.Warnings()
+}
 
-		case ret := <-resultChans[i]:
-			warnings.AddWarnings(ret.warnings)
-			outstandingRequests[ret.ls]--
-			if ret.err != nil {
-				// If there aren't enough outstanding requests to possibly succeed, no reason to wait
-				if (outstandingRequests[ret.ls] + successMap[ret.ls]) < m.requiredCount {
-					return nil, warnings.Warnings(), ret.err
-				}
-				lastError = ret.err
+// broadcastAdmin broadcasts the admin call to all of the apis, returning the results of all of them
+func (m *MultiAPI) broadcastAdmin(ctx context.Context, apiName string, call func(ctx context.Context, api API) ([]AdminResult, v1.Warnings, error)) ([]AdminResult, v1.Warnings, error) {
+	results := make([][]AdminResult, len(m.apis))
+	w := m.broadcast(ctx, apiName,
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return call(ctx, api)
+		},
+		func(i int, server string, v interface{}, err error) {
+			if err != nil {
+				results[i] = []AdminResult{{Error: err.Error()}}
 			} else {
-				successMap[ret.ls]++
-				for _, v := range ret.v {
-					result[v] = struct{}{}
+				results[i], _ = v.([]AdminResult)
+			}
+			for j := range results[i] {
+				if results[i][j].Server == "" {
+					results[i][j].Server = server
 				}
 			}
-		}
+		},
+	)
+
+	ret := make([]AdminResult, 0, len(m.apis))
+	for _, result := range results {
+		ret = append(ret, result...)
 	}
+	return ret, w, nil
+}
 
-	// Verify that we hit the requiredCount for all of the buckets
-	for k := range outstandingRequests {
-		if successMap[k] < m.requiredCount {
-			return nil, warnings.Warnings(), errors.Wrap(lastError, "Unable to fetch from downstream servers")
-		}
+// QuorumError is returned when not enough downstream APIs are available
+// to meet the requiredCount of the MultiAPI
+type QuorumError struct {
+	Key       model.Fingerprint
+	Required  int
+	Available int
+}
+
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("unable to meet quorum for downstream %s: required=%d available=%d", e.Key, e.Required, e.Available)
+}
+
+// ZoneQuorumError is returned when too many zones have no successful response
+type ZoneQuorumError struct {
+	Zones           int
+	Available       int
+	MaxZoneFailures int
+}
+
+func (e *ZoneQuorumError) Error() string {
+	return fmt.Sprintf("unable to meet zone quorum: %d of %d zones responded, at most %d may fail", e.Available, e.Zones, e.MaxZoneFailures)
+}
+
+// ShardError is returned when some shards have no downstreams
+type ShardError struct {
+	Missing []int
+}
+
+func (e *ShardError) Error() string {
+	return fmt.Sprintf("no downstreams for shards %v", e.Missing)
+}
+
+// LabelValues performs a query for the values of the given label.
+func (m *MultiAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	var values model.LabelValues
+	w, err := m.fanout(ctx, "label_values",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.LabelValues(ctx, label, matchers, startTime, endTime)
+		},
+		func(_ int, v interface{}) error {
+			labelValues, _ := v.(model.LabelValues)
+			values = MergeLabelValues(values, labelValues)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, w, err
 	}
 
-	stringResult := make([]string, 0, len(result))
-	for k := range result {
-		stringResult = append(stringResult, k)
+	sort.Sort(values)
+
+	return values, w, nil
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (m *MultiAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	var names []string
+	w, err := m.fanout(ctx, "label_names",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.LabelNames(ctx)
+		},
+		func(_ int, v interface{}) error {
+			labelNames, _ := v.([]string)
+			names = MergeLabelNames(names, labelNames)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, w, err
 	}
 
-	sort.Strings(stringResult)
+	sort.Strings(names)
+
+	return names, w, nil
+}
+
+// mergeValues calls `call` on the apis, merging the resulting values with a ValueMerger
+func (m *MultiAPI) mergeValues(ctx context.Context, apiName string, call multiAPICall) (model.Value, v1.Warnings, error) {
+	antiAffinity := m.antiAffinity
+	if m.antiAffinityTracker != nil {
+		antiAffinity = m.antiAffinityTracker.AntiAffinity()
+	}
+	merger := promhttputil.NewValueMerger(antiAffinity)
+	merger.Strategy = m.mergeStrategy
+	merger.Tolerance = m.dedupTolerance
+	merger.AntiAffinityLabel = m.antiAffinityLabel
+	merger.GapFill = m.gapFill
+	merger.Limits = m.mergeLimits
+	w, err := m.fanout(ctx, apiName, call, func(i int, v interface{}) error {
+		value, _ := v.(model.Value)
+		return merger.Add(value, i)
+	})
+	if err != nil {
+		return nil, w, err
+	}
+	if truncation := merger.Truncation(); truncation != nil {
+		w = append(w, truncation.String())
+	}
 
-	return stringResult, warnings.Warnings(), nil
+	return merger.Value(), w, nil
 }
 
 // Query performs a query for the given time.
 func (m *MultiAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
-	childContext, childContextCancel := context.WithCancel(ctx)
-	defer childContextCancel()
+	return m.mergeValues(ctx, "query", func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+		return api.Query(ctx, query, ts)
+	})
+}
 
-	type chanResult struct {
-		v        model.Value
-		warnings v1.Warnings
-		err      error
-		ls       model.Fingerprint
+// QueryRange performs a query for the given range. The results are aligned onto the steps
+// of the range before they are merged, as the downstreams may sample at different timestamps.
+func (m *MultiAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	start := model.TimeFromUnixNano(r.Start.UnixNano())
+	step := model.Time(r.Step / time.Millisecond)
+	return m.mergeValues(ctx, "query_range", func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+		v, w, err := api.QueryRange(ctx, query, r)
+		if err != nil {
+			return v, w, err
+		}
+		return promhttputil.AlignValue(v, start, step), w, nil
+	})
+}
+
+// Series finds series by label matchers.
+func (m *MultiAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	// Results are merged as they arrive, so we keep them by api index
+	// and merge them in order at the end for a stable result
+	results := make([][]model.LabelSet, len(m.apis))
+	w, err := m.fanout(ctx, "series",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.Series(ctx, matches, startTime, endTime)
+		},
+		func(i int, v interface{}) error {
+			results[i], _ = v.([]model.LabelSet)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, w, err
 	}
 
-	resultChans := make([]chan chanResult, len(m.apis))
-	outstandingRequests := make(map[model.Fingerprint]int) // fingerprint -> outstanding
+	var series []model.LabelSet
+	for _, labelSets := range results {
+		if labelSets != nil {
+			series = MergeLabelSets(series, labelSets)
+		}
+	}
 
-	for i, api := range m.apis {
-		resultChans[i] = make(chan chanResult, 1)
-		outstandingRequests[m.apiFingerprints[i]]++
-		go func(i int, retChan chan chanResult, api API, query string, ts time.Time) {
-			start := time.Now()
-			result, w, err := api.Query(childContext, query, ts)
-			took := time.Since(start)
-			if err != nil {
-				m.recordMetric(i, "query", "error", took.Seconds())
-			} else {
-				m.recordMetric(i, "query", "success", took.Seconds())
-			}
-			retChan <- chanResult{
-				v:        result,
-				warnings: w,
-				err:      NormalizePromError(err),
-				ls:       m.apiFingerprints[i],
-			}
-		}(i, resultChans[i], api, query, ts)
+	return series, w, nil
+}
+
+// GetValue fetches a `model.Value` which represents the actual collected data
+func (m *MultiAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	return m.mergeValues(ctx, "get_value", func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+		v, w, err := api.GetValue(ctx, start, end, matchers)
+		// The raw samples are spaced by the scrape interval
+		if err == nil && m.antiAffinityTracker != nil {
+			m.antiAffinityTracker.Observe(v)
+		}
+		return v, w, err
+	})
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (m *MultiAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	// Results are merged in order at the end such that conflicting metadata is stable
+	results := make([]map[string][]v1.Metadata, len(m.apis))
+	w, err := m.fanout(ctx, "metadata",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.Metadata(ctx, metric, limit)
+		},
+		func(i int, v interface{}) error {
+			results[i], _ = v.(map[string][]v1.Metadata)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, w, err
 	}
 
-	// Wait for results as we get them
-	var result model.Value
-	warnings := make(promhttputil.WarningSet)
-	var lastError error
-	successMap := make(map[model.Fingerprint]int) // fingerprint -> success
-	for i := 0; i < len(m.apis); i++ {
-		select {
-		case <-ctx.Done():
-			return nil, warnings.Warnings(), ctx.Err()
+	metadata := make(map[string][]v1.Metadata)
+	for _, result := range results {
+		metadata = MergeMetadata(metadata, result)
+	}
 
-		case ret := <-resultChans[i]:
-			warnings.AddWarnings(ret.warnings)
-			outstandingRequests[ret.ls]--
-			if ret.err != nil {
-				// If there aren't enough outstanding requests to possibly succeed, no reason to wait
-				if (outstandingRequests[ret.ls] + successMap[ret.ls]) < m.requiredCount {
-					return nil, warnings.Warnings(), ret.err
-				}
-				lastError = ret.err
-			} else {
-				successMap[ret.ls]++
-				if result == nil {
-					result = ret.v
-				} else {
-					var err error
-					result, err = promhttputil.MergeValues(m.antiAffinity, result, ret.v)
-					if err != nil {
-						return nil, warnings.Warnings(), err
-					}
-				}
+	return LimitMetadata(metadata, limit), w, nil
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (m *MultiAPI) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	results := make([]*v1.TargetsResult, len(m.apis))
+	w, err := m.fanout(ctx, "targets",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.Targets(ctx)
+		},
+		func(i int, v interface{}) error {
+			if targets, ok := v.(v1.TargetsResult); ok {
+				results[i] = &targets
 			}
-		}
+			return nil
+		},
+	)
+	if err != nil {
+		return v1.TargetsResult{}, w, err
 	}
 
-	// Verify that we hit the requiredCount for all of the buckets
-	for k := range outstandingRequests {
-		if successMap[k] < m.requiredCount {
-			return nil, warnings.Warnings(), errors.Wrap(lastError, "Unable to fetch from downstream servers")
+	targets := v1.TargetsResult{Active: []v1.ActiveTarget{}, Dropped: []v1.DroppedTarget{}}
+	for _, result := range results {
+		if result != nil {
+			targets = MergeTargets(targets, *result)
 		}
 	}
 
-	return result, warnings.Warnings(), nil
+	return targets, w, nil
 }
 
-// QueryRange performs a query for the given range.
-func (m *MultiAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
-	childContext, childContextCancel := context.WithCancel(ctx)
-	defer childContextCancel()
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (m *MultiAPI) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	results := make([]*v1.RulesResult, len(m.apis))
+	w, err := m.fanout(ctx, "rules",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.Rules(ctx)
+		},
+		func(i int, v interface{}) error {
+			if rules, ok := v.(v1.RulesResult); ok {
+				results[i] = &rules
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return v1.RulesResult{}, w, err
+	}
 
-	type chanResult struct {
-		v        model.Value
-		warnings v1.Warnings
-		err      error
-		ls       model.Fingerprint
+	rules := v1.RulesResult{Groups: []v1.RuleGroup{}}
+	for _, result := range results {
+		if result != nil {
+			rules = MergeRules(rules, *result)
+		}
 	}
 
-	resultChans := make([]chan chanResult, len(m.apis))
-	outstandingRequests := make(map[model.Fingerprint]int) // fingerprint -> outstanding
+	return rules, w, nil
+}
 
-	for i, api := range m.apis {
-		resultChans[i] = make(chan chanResult, 1)
-		outstandingRequests[m.apiFingerprints[i]]++
-		go func(i int, retChan chan chanResult, api API, query string, r v1.Range) {
-			start := time.Now()
-			result, w, err := api.QueryRange(childContext, query, r)
-			took := time.Since(start)
-			if err != nil {
-				m.recordMetric(i, "query_range", "error", took.Seconds())
-			} else {
-				m.recordMetric(i, "query_range", "success", took.Seconds())
-			}
-			retChan <- chanResult{
-				v:        result,
-				warnings: w,
-				err:      NormalizePromError(err),
-				ls:       m.apiFingerprints[i],
+// Alerts returns a list of all active alerts. Alerts with the same labels (e.g.
+// firing on HA replicas which share the same labels) are only returned once.
+func (m *MultiAPI) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	results := make([][]v1.Alert, len(m.apis))
+	w, err := m.fanout(ctx, "alerts",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.Alerts(ctx)
+		},
+		func(i int, v interface{}) error {
+			if alerts, ok := v.(v1.AlertsResult); ok {
+				results[i] = alerts.Alerts
 			}
-		}(i, resultChans[i], api, query, r)
+			return nil
+		},
+	)
+	if err != nil {
+		return v1.AlertsResult{}, w, err
 	}
 
-	// Wait for results as we get them
-	var result model.Value
-	warnings := make(promhttputil.WarningSet)
-	var lastError error
-	successMap := make(map[model.Fingerprint]int) // fingerprint -> success
-	for i := 0; i < len(m.apis); i++ {
-		select {
-		case <-ctx.Done():
-			return nil, warnings.Warnings(), ctx.Err()
+	var alerts []*v1.Alert
+	for _, result := range results {
+		alerts = MergeAlerts(alerts, alertPointers(result))
+	}
 
-		case ret := <-resultChans[i]:
-			warnings.AddWarnings(ret.warnings)
-			outstandingRequests[ret.ls]--
-			if ret.err != nil {
-				// If there aren't enough outstanding requests to possibly succeed, no reason to wait
-				if (outstandingRequests[ret.ls] + successMap[ret.ls]) < m.requiredCount {
-					return nil, warnings.Warnings(), ret.err
-				}
-				lastError = ret.err
-			} else {
-				successMap[ret.ls]++
-				if result == nil {
-					result = ret.v
-				} else {
-					var err error
-					result, err = promhttputil.MergeValues(m.antiAffinity, result, ret.v)
-					if err != nil {
-						return nil, warnings.Warnings(), err
-					}
-				}
+	return v1.AlertsResult{Alerts: alertValues(alerts)}, w, nil
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+func (m *MultiAPI) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	results := make([]*v1.AlertManagersResult, len(m.apis))
+	w, err := m.fanout(ctx, "alertmanagers",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.AlertManagers(ctx)
+		},
+		func(i int, v interface{}) error {
+			if alertManagers, ok := v.(v1.AlertManagersResult); ok {
+				results[i] = &alertManagers
 			}
-		}
+			return nil
+		},
+	)
+	if err != nil {
+		return v1.AlertManagersResult{}, w, err
 	}
 
-	// Verify that we hit the requiredCount for all of the buckets
-	for k := range outstandingRequests {
-		if successMap[k] < m.requiredCount {
-			return nil, warnings.Warnings(), errors.Wrap(lastError, "Unable to fetch from downstream servers")
+	alertManagers := v1.AlertManagersResult{Active: []v1.AlertManager{}, Dropped: []v1.AlertManager{}}
+	for _, result := range results {
+		if result != nil {
+			alertManagers = MergeAlertManagers(alertManagers, *result)
 		}
 	}
 
-	return result, warnings.Warnings(), nil
+	return alertManagers, w, nil
 }
 
-// Series finds series by label matchers.
-func (m *MultiAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
-	childContext, childContextCancel := context.WithCancel(ctx)
-	defer childContextCancel()
-
-	type chanResult struct {
-		v        []model.LabelSet
-		warnings v1.Warnings
-		err      error
-		ls       model.Fingerprint
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (m *MultiAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	results := make([][]ExemplarQueryResult, len(m.apis))
+	w, err := m.fanout(ctx, "query_exemplars",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.QueryExemplars(ctx, query, startTime, endTime)
+		},
+		func(i int, v interface{}) error {
+			results[i], _ = v.([]ExemplarQueryResult)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, w, err
 	}
 
-	resultChans := make([]chan chanResult, len(m.apis))
-	outstandingRequests := make(map[model.Fingerprint]int) // fingerprint -> outstanding
-
-	for i, api := range m.apis {
-		resultChans[i] = make(chan chanResult, 1)
-		outstandingRequests[m.apiFingerprints[i]]++
-		go func(i int, retChan chan chanResult, api API) {
-			start := time.Now()
-			result, w, err := api.Series(childContext, matches, startTime, endTime)
-			took := time.Since(start)
-			if err != nil {
-				m.recordMetric(i, "series", "error", took.Seconds())
-			} else {
-				m.recordMetric(i, "series", "success", took.Seconds())
-			}
-			retChan <- chanResult{
-				v:        result,
-				warnings: w,
-				err:      NormalizePromError(err),
-				ls:       m.apiFingerprints[i],
+	exemplars := []ExemplarQueryResult{}
+	for _, result := range results {
+		// The anti-affinity label is removed from the series when merging, so from their exemplars too
+		if m.antiAffinityLabel != "" {
+			for _, item := range result {
+				delete(item.SeriesLabels, m.antiAffinityLabel)
 			}
-		}(i, resultChans[i], api)
+		}
+		exemplars = MergeExemplars(exemplars, result)
 	}
 
-	// Wait for results as we get them
-	var result []model.LabelSet
-	warnings := make(promhttputil.WarningSet)
-	var lastError error
-	successMap := make(map[model.Fingerprint]int) // fingerprint -> success
-	for i := 0; i < len(m.apis); i++ {
-		select {
-		case <-ctx.Done():
-			return nil, warnings.Warnings(), ctx.Err()
+	return exemplars, w, nil
+}
 
-		case ret := <-resultChans[i]:
-			warnings.AddWarnings(ret.warnings)
-			outstandingRequests[ret.ls]--
-			if ret.err != nil {
-				// If there aren't enough outstanding requests to possibly succeed, no reason to wait
-				if (outstandingRequests[ret.ls] + successMap[ret.ls]) < m.requiredCount {
-					return nil, warnings.Warnings(), ret.err
-				}
-				lastError = ret.err
-			} else {
-				successMap[ret.ls]++
-				if result == nil {
-					result = ret.v
-				} else {
-					result = MergeLabelSets(result, ret.v)
+// TSDB returns the cardinality statistics of the TSDB. The statistics of
+// all apis are summed, attributing each stat to the api it came from.
+func (m *MultiAPI) TSDB(ctx context.Context) (TSDBResult, v1.Warnings, error) {
+	results := make([]*TSDBResult, len(m.apis))
+	w, err := m.fanout(ctx, "tsdb",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.TSDB(ctx)
+		},
+		func(i int, v interface{}) error {
+			if tsdb, ok := v.(TSDBResult); ok {
+				if i < len(m.apiNames) {
+					tsdb = attributeTSDBStats(tsdb, m.apiNames[i])
 				}
+				results[i] = &tsdb
 			}
-		}
+			return nil
+		},
+	)
+	if err != nil {
+		return TSDBResult{}, w, err
 	}
 
-	// Verify that we hit the requiredCount for all of the buckets
-	for k := range outstandingRequests {
-		if successMap[k] < m.requiredCount {
-			return nil, warnings.Warnings(), errors.Wrap(lastError, "Unable to fetch from downstream servers")
+	var tsdb TSDBResult
+	for _, result := range results {
+		if result != nil {
+			tsdb = MergeTSDB(tsdb, *result)
 		}
 	}
 
-	return result, warnings.Warnings(), nil
+	return tsdb, w, nil
 }
 
-// GetValue fetches a `model.Value` which represents the actual collected data
-func (m *MultiAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
-	childContext, childContextCancel := context.WithCancel(ctx)
-	defer childContextCancel()
+// Buildinfo returns the build information of each server. Results which don't
+// identify their server are attributed to the api they came from, as are the errors.
+func (m *MultiAPI) Buildinfo(ctx context.Context) ([]BuildinfoResult, v1.Warnings, error) {
+	results := make([][]BuildinfoResult, len(m.apis))
+	w := m.broadcast(ctx, "buildinfo",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.Buildinfo(ctx)
+		},
+		func(i int, server string, v interface{}, err error) {
+			if err != nil {
+				results[i] = []BuildinfoResult{{Error: err.Error()}}
+			} else {
+				results[i], _ = v.([]BuildinfoResult)
+			}
+			for j := range results[i] {
+				if results[i][j].Server == "" {
+					results[i][j].Server = server
+				}
+			}
+		},
+	)
 
-	type chanResult struct {
-		v        model.Value
-		warnings v1.Warnings
-		err      error
-		ls       model.Fingerprint
+	infos := []BuildinfoResult{}
+	for _, result := range results {
+		infos = append(infos, result...)
 	}
 
-	resultChans := make([]chan chanResult, len(m.apis))
-	outstandingRequests := make(map[model.Fingerprint]int) // fingerprint -> outstanding
+	return infos, w, nil
+}
 
-	// Scatter out all the queries
-	for i, api := range m.apis {
-		resultChans[i] = make(chan chanResult, 1)
-		outstandingRequests[m.apiFingerprints[i]]++
-		go func(i int, retChan chan chanResult, api API) {
-			queryStart := time.Now()
-			result, w, err := api.GetValue(childContext, start, end, matchers)
-			took := time.Since(queryStart)
+// Runtimeinfo returns the runtime information of each server. Results which don't
+// identify their server are attributed to the api they came from, as are the errors.
+func (m *MultiAPI) Runtimeinfo(ctx context.Context) ([]RuntimeinfoResult, v1.Warnings, error) {
+	results := make([][]RuntimeinfoResult, len(m.apis))
+	w := m.broadcast(ctx, "runtimeinfo",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.Runtimeinfo(ctx)
+		},
+		func(i int, server string, v interface{}, err error) {
 			if err != nil {
-				m.recordMetric(i, "get_value", "error", took.Seconds())
+				results[i] = []RuntimeinfoResult{{Error: err.Error()}}
 			} else {
-				m.recordMetric(i, "get_value", "success", took.Seconds())
+				results[i], _ = v.([]RuntimeinfoResult)
 			}
-			retChan <- chanResult{
-				v:        result,
-				warnings: w,
-				err:      NormalizePromError(err),
-				ls:       m.apiFingerprints[i],
+			for j := range results[i] {
+				if results[i][j].Server == "" {
+					results[i][j].Server = server
+				}
 			}
-		}(i, resultChans[i], api)
+		},
+	)
+
+	infos := []RuntimeinfoResult{}
+	for _, result := range results {
+		infos = append(infos, result...)
 	}
 
-	// Wait for results as we get them
-	var result model.Value
-	warnings := make(promhttputil.WarningSet)
-	var lastError error
-	successMap := make(map[model.Fingerprint]int) // fingerprint -> success
-	for i := 0; i < len(m.apis); i++ {
-		select {
-		case <-ctx.Done():
-			return nil, warnings.Warnings(), ctx.Err()
+	return infos, w, nil
+}
 
-		case ret := <-resultChans[i]:
-			warnings.AddWarnings(ret.warnings)
-			outstandingRequests[ret.ls]--
-			if ret.err != nil {
-				// If there aren't enough outstanding requests to possibly succeed, no reason to wait
-				if (outstandingRequests[ret.ls] + successMap[ret.ls]) < m.requiredCount {
-					return nil, warnings.Warnings(), ret.err
-				}
-				lastError = ret.err
+// Config returns the configuration of each server. Results which don't
+// identify their server are attributed to the api they came from, as are the errors.
+func (m *MultiAPI) Config(ctx context.Context) ([]ConfigResult, v1.Warnings, error) {
+	results := make([][]ConfigResult, len(m.apis))
+	w := m.broadcast(ctx, "config",
+		func(ctx context.Context, api API) (interface{}, v1.Warnings, error) {
+			return api.Config(ctx)
+		},
+		func(i int, server string, v interface{}, err error) {
+			if err != nil {
+				results[i] = []ConfigResult{{Error: err.Error()}}
 			} else {
-				successMap[ret.ls]++
-				if result == nil {
-					result = ret.v
-				} else {
-					var err error
-					result, err = promhttputil.MergeValues(m.antiAffinity, result, ret.v)
-					if err != nil {
-						return nil, warnings.Warnings(), err
-					}
+				results[i], _ = v.([]ConfigResult)
+			}
+			for j := range results[i] {
+				if results[i][j].Server == "" {
+					results[i][j].Server = server
 				}
 			}
-		}
-	}
+		},
+	)
 
-	// Verify that we hit the requiredCount for all of the buckets
-	for k := range outstandingRequests {
-		if successMap[k] < m.requiredCount {
-			return nil, warnings.Warnings(), errors.Wrap(lastError, "Unable to fetch from downstream servers")
-		}
+	configs := []ConfigResult{}
+	for _, result := range results {
+		configs = append(configs, result...)
 	}
 
-	return result, warnings.Warnings(), nil
+	return configs, w, nil
+}
+
+// DeleteSeries deletes data for a selection of series in a time range. The
+// deletion is sent to all apis, the result of each is returned.
+func (m *MultiAPI) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error) {
+	return m.broadcastAdmin(ctx, "delete_series", func(ctx context.Context, api API) ([]AdminResult, v1.Warnings, error) {
+		return api.DeleteSeries(ctx, matches, startTime, endTime)
+	})
+}
+
+// CleanTombstones removes the deleted data from disk and cleans up the existing
+// tombstones. This is sent to all apis, the result of each is returned.
+func (m *MultiAPI) CleanTombstones(ctx context.Context) ([]AdminResult, v1.Warnings, error) {
+	return m.broadcastAdmin(ctx, "clean_tombstones", func(ctx context.Context, api API) ([]AdminResult, v1.Warnings, error) {
+		return api.CleanTombstones(ctx)
+	})
+}
+
+// Snapshot creates a snapshot of all current data on each server. The snapshot
+// is sent to all apis, the result of each is returned.
+func (m *MultiAPI) Snapshot(ctx context.Context, skipHead bool) ([]AdminResult, v1.Warnings, error) {
+	return m.broadcastAdmin(ctx, "snapshot", func(ctx context.Context, api API) ([]AdminResult, v1.Warnings, error) {
+		return api.Snapshot(ctx, skipHead)
+	})
 }
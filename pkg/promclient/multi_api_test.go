@@ -3,22 +3,39 @@ package promclient
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/jacksontj/promxy/pkg/promhttputil"
 )
 
 type stubAPI struct {
-	labelNames  func() []string
-	labelValues func() model.LabelValues
-	query       func() model.Value
-	queryRange  func() model.Value
-	series      func() []model.LabelSet
-	getValue    func() model.Value
+	labelNames    func() []string
+	labelValues   func() model.LabelValues
+	query         func() model.Value
+	queryRange    func() model.Value
+	series        func() []model.LabelSet
+	getValue      func() model.Value
+	metadata      func() map[string][]v1.Metadata
+	targets       func() v1.TargetsResult
+	rules         func() v1.RulesResult
+	alerts        func() v1.AlertsResult
+	alertManagers func() v1.AlertManagersResult
+	exemplars     func() []ExemplarQueryResult
+	tsdb          func() TSDBResult
+	buildinfo     func() []BuildinfoResult
+	runtimeinfo   func() []RuntimeinfoResult
+	config        func() []ConfigResult
+	deleteSeries  func(matches []string) []AdminResult
+	admin         func() []AdminResult
 }
 
 // LabelNames returns all the unique label names present in the block in sorted order.
@@ -27,7 +44,7 @@ func (s *stubAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error)
 }
 
 // LabelValues performs a query for the values of the given label.
-func (s *stubAPI) LabelValues(ctx context.Context, label string) (model.LabelValues, v1.Warnings, error) {
+func (s *stubAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
 	return s.labelValues(), nil, nil
 }
 
@@ -51,6 +68,71 @@ func (s *stubAPI) GetValue(ctx context.Context, start, end time.Time, matchers [
 	return s.getValue(), nil, nil
 }
 
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (s *stubAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	return s.metadata(), nil, nil
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (s *stubAPI) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	return s.targets(), nil, nil
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (s *stubAPI) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	return s.rules(), nil, nil
+}
+
+// Alerts returns a list of all active alerts.
+func (s *stubAPI) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	return s.alerts(), nil, nil
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+func (s *stubAPI) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	return s.alertManagers(), nil, nil
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (s *stubAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	return s.exemplars(), nil, nil
+}
+
+// TSDB returns the cardinality statistics of the TSDB.
+func (s *stubAPI) TSDB(ctx context.Context) (TSDBResult, v1.Warnings, error) {
+	return s.tsdb(), nil, nil
+}
+
+// Buildinfo returns the build information of each server.
+func (s *stubAPI) Buildinfo(ctx context.Context) ([]BuildinfoResult, v1.Warnings, error) {
+	return s.buildinfo(), nil, nil
+}
+
+// Runtimeinfo returns the runtime information of each server.
+func (s *stubAPI) Runtimeinfo(ctx context.Context) ([]RuntimeinfoResult, v1.Warnings, error) {
+	return s.runtimeinfo(), nil, nil
+}
+
+// Config returns the configuration of each server.
+func (s *stubAPI) Config(ctx context.Context) ([]ConfigResult, v1.Warnings, error) {
+	return s.config(), nil, nil
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+func (s *stubAPI) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error) {
+	return s.deleteSeries(matches), nil, nil
+}
+
+// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+func (s *stubAPI) CleanTombstones(ctx context.Context) ([]AdminResult, v1.Warnings, error) {
+	return s.admin(), nil, nil
+}
+
+// Snapshot creates a snapshot of all current data on each server.
+func (s *stubAPI) Snapshot(ctx context.Context, skipHead bool) ([]AdminResult, v1.Warnings, error) {
+	return s.admin(), nil, nil
+}
+
 type errorAPI struct {
 	API
 	err error
@@ -63,19 +145,20 @@ func (s *errorAPI) Key() model.LabelSet {
 	return nil
 }
 
+// LabelNames returns all the unique label names present in the block in sorted order.
 func (s *errorAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
 	if s.err != nil {
 		return nil, nil, s.err
 	}
-	return s.LabelNames(ctx)
+	return s.API.LabelNames(ctx)
 }
 
 // LabelValues performs a query for the values of the given label.
-func (s *errorAPI) LabelValues(ctx context.Context, label string) (model.LabelValues, v1.Warnings, error) {
+func (s *errorAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
 	if s.err != nil {
 		return nil, nil, s.err
 	}
-	return s.LabelValues(ctx, label)
+	return s.API.LabelValues(ctx, label, matchers, startTime, endTime)
 }
 
 // Query performs a query for the given time.
@@ -83,7 +166,7 @@ func (s *errorAPI) Query(ctx context.Context, query string, ts time.Time) (model
 	if s.err != nil {
 		return nil, nil, s.err
 	}
-	return s.Query(ctx, query, ts)
+	return s.API.Query(ctx, query, ts)
 }
 
 // QueryRange performs a query for the given range.
@@ -91,7 +174,7 @@ func (s *errorAPI) QueryRange(ctx context.Context, query string, r v1.Range) (mo
 	if s.err != nil {
 		return nil, nil, s.err
 	}
-	return s.QueryRange(ctx, query, r)
+	return s.API.QueryRange(ctx, query, r)
 }
 
 // Series finds series by label matchers.
@@ -99,7 +182,7 @@ func (s *errorAPI) Series(ctx context.Context, matches []string, startTime time.
 	if s.err != nil {
 		return nil, nil, s.err
 	}
-	return s.Series(ctx, matches, startTime, endTime)
+	return s.API.Series(ctx, matches, startTime, endTime)
 }
 
 // GetValue loads the raw data for a given set of matchers in the time range
@@ -107,7 +190,47 @@ func (s *errorAPI) GetValue(ctx context.Context, start, end time.Time, matchers
 	if s.err != nil {
 		return nil, nil, s.err
 	}
-	return s.GetValue(ctx, start, end, matchers)
+	return s.API.GetValue(ctx, start, end, matchers)
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+func (s *errorAPI) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error) {
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	return s.API.DeleteSeries(ctx, matches, startTime, endTime)
+}
+
+// Snapshot creates a snapshot of all current data on each server.
+func (s *errorAPI) Snapshot(ctx context.Context, skipHead bool) ([]AdminResult, v1.Warnings, error) {
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	return s.API.Snapshot(ctx, skipHead)
+}
+
+// Buildinfo returns the build information of each server.
+func (s *errorAPI) Buildinfo(ctx context.Context) ([]BuildinfoResult, v1.Warnings, error) {
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	return s.API.Buildinfo(ctx)
+}
+
+// Runtimeinfo returns the runtime information of each server.
+func (s *errorAPI) Runtimeinfo(ctx context.Context) ([]RuntimeinfoResult, v1.Warnings, error) {
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	return s.API.Runtimeinfo(ctx)
+}
+
+// Config returns the configuration of each server.
+func (s *errorAPI) Config(ctx context.Context) ([]ConfigResult, v1.Warnings, error) {
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	return s.API.Config(ctx)
 }
 
 func TestMultiAPIMerging(t *testing.T) {
@@ -345,6 +468,21 @@ func TestMultiAPIMerging(t *testing.T) {
 				{model.MetricNameLabel: "testmetric", "a": "2"},
 			},
 		},
+		// Errors from an IgnoreErrorAPI shouldn't fail the request
+		{
+			a: NewMultiAPI([]API{
+				stub,
+				&IgnoreErrorAPI{&errorAPI{stub, fmt.Errorf("error")}},
+			}, model.Time(0), nil, 1),
+			labelNames:  []string{"a"},
+			labelValues: []model.LabelValue{},
+			v: model.Vector{
+				getSample(model.LabelSet{model.MetricNameLabel: "testmetric"}),
+			},
+			series: []model.LabelSet{
+				{model.MetricNameLabel: "testmetric"},
+			},
+		},
 	}
 
 	for i, test := range tests {
@@ -376,7 +514,7 @@ func TestMultiAPIMerging(t *testing.T) {
 			})
 
 			t.Run("LabelValues", func(t *testing.T) {
-				v, _, err := test.a.LabelValues(context.TODO(), "a")
+				v, _, err := test.a.LabelValues(context.TODO(), "a", nil, time.Time{}, time.Time{})
 				if err != nil != test.err {
 					if test.err {
 						t.Fatalf("missing expected err")
@@ -493,3 +631,592 @@ func TestMultiAPIMerging(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiAPIQuorum(t *testing.T) {
+	stub := &stubAPI{
+		labelValues: func() model.LabelValues {
+			return model.LabelValues{"a"}
+		},
+		query: func() model.Value {
+			return model.Vector{}
+		},
+		queryRange: func() model.Value {
+			return model.Matrix{}
+		},
+		series: func() []model.LabelSet {
+			return []model.LabelSet{{model.MetricNameLabel: "testmetric"}}
+		},
+	}
+
+	replica := func(err error) API {
+		a := &AddLabelClient{stub, model.LabelSet{"replica": "set"}}
+		if err != nil {
+			return &errorAPI{a, err}
+		}
+		return a
+	}
+
+	tests := []struct {
+		apis   []API
+		quorum int
+		err    bool
+	}{
+		// All replicas respond
+		{
+			apis:   []API{replica(nil), replica(nil), replica(nil)},
+			quorum: 2,
+		},
+		// 2 of 3 replicas respond
+		{
+			apis:   []API{replica(nil), replica(fmt.Errorf("error")), replica(nil)},
+			quorum: 2,
+		},
+		// only 1 of 3 replicas respond
+		{
+			apis:   []API{replica(fmt.Errorf("error")), replica(fmt.Errorf("error")), replica(nil)},
+			quorum: 2,
+			err:    true,
+		},
+		// not enough replicas to ever meet the quorum
+		{
+			apis:   []API{replica(nil)},
+			quorum: 2,
+			err:    true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			a := NewMultiAPI(test.apis, model.Time(0), nil, test.quorum)
+
+			if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); (err != nil) != test.err {
+				t.Fatalf("Query: expected err=%v got %v", test.err, err)
+			}
+			if _, _, err := a.QueryRange(context.TODO(), "testmetric", v1.Range{}); (err != nil) != test.err {
+				t.Fatalf("QueryRange: expected err=%v got %v", test.err, err)
+			}
+			if _, _, err := a.Series(context.TODO(), []string{"testmetric"}, time.Now(), time.Now()); (err != nil) != test.err {
+				t.Fatalf("Series: expected err=%v got %v", test.err, err)
+			}
+			if _, _, err := a.LabelValues(context.TODO(), "a", nil, time.Time{}, time.Time{}); (err != nil) != test.err {
+				t.Fatalf("LabelValues: expected err=%v got %v", test.err, err)
+			}
+		})
+	}
+}
+
+// slowAPI delays Query responses until the delay passes or the context is done
+type slowAPI struct {
+	API
+	delay time.Duration
+}
+
+func (s *slowAPI) Key() model.LabelSet {
+	if apiLabels, ok := s.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
+
+func (s *slowAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	return s.API.Query(ctx, query, ts)
+}
+
+func TestMultiAPIHedging(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{}
+		},
+	}
+	replica := func() API {
+		return &AddLabelClient{stub, model.LabelSet{"replica": "set"}}
+	}
+
+	tests := []struct {
+		apis []API
+		err  bool
+	}{
+		// first replica is slow, the hedged request should answer
+		{
+			apis: []API{&slowAPI{replica(), time.Minute}, replica()},
+		},
+		// first replica errors, we should fail over to the second
+		{
+			apis: []API{&errorAPI{replica(), fmt.Errorf("error")}, &slowAPI{replica(), time.Minute}, replica()},
+		},
+		// all replicas error
+		{
+			apis: []API{&errorAPI{replica(), fmt.Errorf("error")}, &errorAPI{replica(), fmt.Errorf("error")}},
+			err:  true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			a := NewMultiAPI(test.apis, model.Time(0), nil, 1, WithHedging(NewHedgeTracker(10*time.Millisecond, 0)))
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+			defer cancel()
+			if _, _, err := a.Query(ctx, "testmetric", time.Now()); (err != nil) != test.err {
+				t.Fatalf("expected err=%v got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestHedgeTrackerDelay(t *testing.T) {
+	h := NewHedgeTracker(time.Second, 0.9)
+	if d := h.Delay("query"); d != time.Second {
+		t.Fatalf("expected the configured delay without samples, got %v", d)
+	}
+	for i := 1; i <= hedgeLatencyWindow; i++ {
+		h.Observe("query", time.Duration(i)*time.Millisecond)
+	}
+	if d := h.Delay("query"); d != 90*time.Millisecond {
+		t.Fatalf("expected p90 delay of 90ms, got %v", d)
+	}
+	// The latency of each call is tracked separately
+	if d := h.Delay("series"); d != time.Second {
+		t.Fatalf("expected the configured delay for a call without samples, got %v", d)
+	}
+}
+
+func TestMultiAPITimeout(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{}
+		},
+	}
+	replica := func() API {
+		return &AddLabelClient{stub, model.LabelSet{"replica": "set"}}
+	}
+
+	// A slow replica should be cut off and the fast replica's result used
+	a := NewMultiAPI([]API{&slowAPI{replica(), time.Minute}, replica()}, model.Time(0), nil, 1, WithAPITimeout(10*time.Millisecond))
+	if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// If the only host is slow we should error instead of waiting on it
+	a = NewMultiAPI([]API{&slowAPI{replica(), time.Minute}}, model.Time(0), nil, 1, WithAPITimeout(10*time.Millisecond))
+	if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err == nil {
+		t.Fatalf("missing expected error")
+	}
+}
+
+func TestMultiAPIResultTypeMismatch(t *testing.T) {
+	metric := func() model.Metric {
+		return model.Metric{model.MetricNameLabel: "testmetric"}
+	}
+	vectorAPI := &AddLabelClient{&stubAPI{
+		query: func() model.Value { return model.Vector{{Metric: metric(), Value: 1, Timestamp: 100}} },
+	}, model.LabelSet{"a": "1"}}
+	matrixAPI := &AddLabelClient{&stubAPI{
+		query: func() model.Value {
+			return model.Matrix{{Metric: metric(), Values: []model.SamplePair{{Timestamp: 100, Value: 1}}}}
+		},
+	}, model.LabelSet{"a": "2"}}
+	emptyMatrixAPI := &AddLabelClient{&stubAPI{
+		query: func() model.Value { return model.Matrix{} },
+	}, model.LabelSet{"a": "3"}}
+
+	a := NewMultiAPI([]API{vectorAPI, matrixAPI}, model.Time(0), nil, 1)
+	_, _, err := a.Query(context.TODO(), "testmetric", time.Now())
+	if _, ok := err.(*promhttputil.ResultTypeMismatchError); !ok {
+		t.Fatalf("expected ResultTypeMismatchError got %v", err)
+	}
+
+	a = NewMultiAPI([]API{vectorAPI, emptyMatrixAPI}, model.Time(0), nil, 1)
+	v, _, err := a.Query(context.TODO(), "testmetric", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.Type() != model.ValVector {
+		t.Fatalf("expected vector result got %v", v.Type())
+	}
+}
+
+func TestMultiAPIMismatchedSteps(t *testing.T) {
+	metric := func() model.Metric {
+		return model.Metric{model.MetricNameLabel: "testmetric"}
+	}
+	matrix := func(ts ...model.Time) func() model.Value {
+		return func() model.Value {
+			stream := &model.SampleStream{Metric: metric()}
+			for _, t := range ts {
+				stream.Values = append(stream.Values, model.SamplePair{Timestamp: t, Value: 1})
+			}
+			return model.Matrix{stream}
+		}
+	}
+	// b evaluates the steps 4s later than a, and has the point a is missing
+	a := &AddLabelClient{&stubAPI{queryRange: matrix(10000, 20000, 40000)}, model.LabelSet{"replica": "set"}}
+	b := &AddLabelClient{&stubAPI{queryRange: matrix(14000, 24000, 34000, 44000)}, model.LabelSet{"replica": "set"}}
+
+	m := NewMultiAPI([]API{a, b}, model.Time(0), nil, 1)
+	v, _, err := m.QueryRange(context.TODO(), "testmetric", v1.Range{Start: time.Unix(10, 0), End: time.Unix(40, 0), Step: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := matrix(10000, 20000, 30000, 40000)().(model.Matrix)
+	promhttputil.ValueAddLabelSet(expected, model.LabelSet{"replica": "set"})
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch\nexpected=%v\nactual=%v", expected, v)
+	}
+}
+
+func TestMultiAPIExemplarsAntiAffinityLabel(t *testing.T) {
+	replica := func(antiAffinity model.LabelValue) API {
+		return &AddLabelClient{&stubAPI{exemplars: func() []ExemplarQueryResult {
+			return []ExemplarQueryResult{{
+				SeriesLabels: model.LabelSet{"__name__": "pushed", "__anti_affinity__": antiAffinity},
+				Exemplars:    []Exemplar{{Value: 1, Timestamp: 10}},
+			}}
+		}}, model.LabelSet{"replica": "set"}}
+	}
+
+	// The label is removed from the series of the exemplars as from the series, so they are merged
+	m := NewMultiAPI([]API{replica("5m"), replica("10m")}, 0, nil, 1, WithAntiAffinityLabel("__anti_affinity__"))
+	v, _, err := m.QueryExemplars(context.TODO(), "pushed", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ExemplarQueryResult{{
+		SeriesLabels: model.LabelSet{"__name__": "pushed", "replica": "set"},
+		Exemplars:    []Exemplar{{Value: 1, Timestamp: 10}},
+	}}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch\nexpected=%v\nactual=%v", expected, v)
+	}
+}
+
+func TestMultiAPIMergeLimits(t *testing.T) {
+	stub := &stubAPI{queryRange: func() model.Value {
+		return model.Matrix{
+			{Metric: model.Metric{"a": "1"}, Values: []model.SamplePair{{Timestamp: 10, Value: 1}, {Timestamp: 20, Value: 1}}},
+			{Metric: model.Metric{"a": "2"}, Values: []model.SamplePair{{Timestamp: 10, Value: 1}, {Timestamp: 20, Value: 1}}},
+		}
+	}}
+
+	// The truncated series are identified in the warnings
+	m := NewMultiAPI([]API{stub}, 0, nil, 1, WithMergeLimits(promhttputil.MergeLimits{MaxSamples: 3}))
+	v, w, err := m.QueryRange(context.TODO(), "testmetric", v1.Range{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples := len(v.(model.Matrix)[0].Values) + len(v.(model.Matrix)[1].Values); samples != 3 {
+		t.Fatalf("expected the result to be truncated to 3 samples, got %v", v)
+	}
+	expected := v1.Warnings{`merged result truncated at the limit of 3 samples, 1 series truncated: {a="2"}`}
+	if !reflect.DeepEqual(w, expected) {
+		t.Fatalf("mismatch in warnings expected=%v actual=%v", expected, w)
+	}
+}
+
+func TestMultiAPIFailurePolicy(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{}
+		},
+	}
+	replica := func(err error) API {
+		a := &AddLabelClient{stub, model.LabelSet{"replica": "set"}}
+		if err != nil {
+			return &errorAPI{a, err}
+		}
+		return a
+	}
+	failing := fmt.Errorf("error")
+
+	tests := []struct {
+		apis []API
+		opts []MultiAPIOption
+		err  bool
+	}{
+		// partial failures are tolerated by default
+		{
+			apis: []API{replica(failing), replica(failing), replica(nil)},
+		},
+		// within the max failures
+		{
+			apis: []API{replica(failing), replica(nil), replica(nil)},
+			opts: []MultiAPIOption{WithMaxFailures(1)},
+		},
+		// more than the max failures
+		{
+			apis: []API{replica(failing), replica(failing), replica(nil)},
+			opts: []MultiAPIOption{WithMaxFailures(1)},
+			err:  true,
+		},
+		// within the max failure ratio
+		{
+			apis: []API{replica(failing), replica(nil), replica(nil), replica(nil)},
+			opts: []MultiAPIOption{WithMaxFailureRatio(0.25)},
+		},
+		// more than the max failure ratio
+		{
+			apis: []API{replica(failing), replica(failing), replica(nil), replica(nil)},
+			opts: []MultiAPIOption{WithMaxFailureRatio(0.25)},
+			err:  true,
+		},
+		// a non-required api fails
+		{
+			apis: []API{replica(failing), replica(nil)},
+			opts: []MultiAPIOption{WithRequiredAPIs(1)},
+		},
+		// a required api fails
+		{
+			apis: []API{replica(nil), replica(failing)},
+			opts: []MultiAPIOption{WithRequiredAPIs(1)},
+			err:  true,
+		},
+		// a required api fails while hedging, it must still be called
+		{
+			apis: []API{replica(nil), replica(failing)},
+			opts: []MultiAPIOption{WithRequiredAPIs(1), WithHedging(NewHedgeTracker(time.Minute, 0))},
+			err:  true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			a := NewMultiAPI(test.apis, model.Time(0), nil, 1, test.opts...)
+			if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); (err != nil) != test.err {
+				t.Fatalf("expected err=%v got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestMultiAPIWarnings(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{}
+		},
+	}
+	warnAPI := &warningAPI{stub, v1.Warnings{"downstream warning"}}
+	replica := func(a API) API {
+		return &AddLabelClient{a, model.LabelSet{"replica": "set"}}
+	}
+
+	a := NewMultiAPI([]API{
+		replica(warnAPI),
+		replica(warnAPI),
+		&errorAPI{replica(stub), fmt.Errorf("error")},
+	}, model.Time(0), nil, 1, WithAPINames([]string{"a", "b", "c"}))
+
+	_, w, err := a.Query(context.TODO(), "testmetric", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(w)
+	expected := v1.Warnings{"downstream c failed: error", "downstream warning"}
+	if fmt.Sprint(w) != fmt.Sprint(expected) {
+		t.Fatalf("mismatch in warnings \nexpected=%v\nactual=%v", expected, w)
+	}
+}
+
+// warningAPI adds warnings to all Query responses
+type warningAPI struct {
+	API
+	warnings v1.Warnings
+}
+
+func (s *warningAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	v, w, err := s.API.Query(ctx, query, ts)
+	return v, append(w, s.warnings...), err
+}
+
+func TestMultiAPIFirstSuccess(t *testing.T) {
+	sample := func(v string) *model.Sample {
+		return &model.Sample{Metric: model.Metric{model.MetricNameLabel: "testmetric", "host": model.LabelValue(v)}, Value: 1}
+	}
+	replica := func(v string) API {
+		return &AddLabelClient{&stubAPI{
+			query: func() model.Value { return model.Vector{sample(v)} },
+		}, model.LabelSet{"replica": "set"}}
+	}
+
+	// The slow replica's result should never be merged in
+	a := NewMultiAPI([]API{&slowAPI{replica("slow"), time.Minute}, replica("fast")}, model.Time(0), nil, 1, WithFirstSuccess())
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+	v, _, err := a.Query(ctx, "testmetric", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	vector := v.(model.Vector)
+	if len(vector) != 1 || vector[0].Metric["host"] != "fast" {
+		t.Fatalf("expected only the fast replica's result, got %v", vector)
+	}
+}
+
+func TestMultiAPIZones(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{}
+		},
+	}
+	replica := func(err error) API {
+		a := &AddLabelClient{stub, model.LabelSet{"replica": "set"}}
+		if err != nil {
+			return &errorAPI{a, err}
+		}
+		return a
+	}
+	failing := fmt.Errorf("error")
+	zones := []string{"a", "a", "b", "b"}
+
+	tests := []struct {
+		apis []API
+		opts []MultiAPIOption
+		err  bool
+	}{
+		// a replica in each zone responded
+		{
+			apis: []API{replica(failing), replica(nil), replica(nil), replica(failing)},
+			opts: []MultiAPIOption{WithZones(zones, 0)},
+		},
+		// zone b failed entirely
+		{
+			apis: []API{replica(nil), replica(nil), replica(failing), replica(failing)},
+			opts: []MultiAPIOption{WithZones(zones, 0)},
+			err:  true,
+		},
+		// a whole zone failure is tolerated
+		{
+			apis: []API{replica(nil), replica(nil), replica(failing), replica(failing)},
+			opts: []MultiAPIOption{WithZones(zones, 1)},
+		},
+		// the first success must not stop us from waiting on the other zone
+		{
+			apis: []API{replica(nil), replica(nil), &slowAPI{replica(nil), 10 * time.Millisecond}, replica(failing)},
+			opts: []MultiAPIOption{WithZones(zones, 0), WithFirstSuccess()},
+		},
+		// while hedging, backup requests are sent to reach the other zone
+		{
+			apis: []API{replica(nil), replica(nil), replica(failing), replica(nil)},
+			opts: []MultiAPIOption{WithZones(zones, 0), WithHedging(NewHedgeTracker(time.Millisecond, 0))},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			a := NewMultiAPI(test.apis, model.Time(0), nil, 1, test.opts...)
+			_, _, err := a.Query(context.TODO(), "testmetric", time.Now())
+			if (err != nil) != test.err {
+				t.Fatalf("expected err=%v got %v", test.err, err)
+			}
+			if test.err {
+				if _, ok := err.(*ZoneQuorumError); !ok {
+					t.Fatalf("expected ZoneQuorumError, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiAPILoadBalancing(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{}
+		},
+	}
+	replicas := func(errs ...error) ([]API, []*countingAPI) {
+		apis := make([]API, len(errs))
+		counters := make([]*countingAPI, len(errs))
+		for i, err := range errs {
+			counters[i] = &countingAPI{API: stub}
+			apis[i] = &AddLabelClient{counters[i], model.LabelSet{"replica": "set"}}
+			if err != nil {
+				apis[i] = &errorAPI{apis[i], err}
+			}
+		}
+		return apis, counters
+	}
+	failing := fmt.Errorf("error")
+
+	// Each query is only sent to a single replica
+	apis, counters := replicas(nil, nil, nil)
+	a := NewMultiAPI(apis, model.Time(0), nil, 1, WithLoadBalancing(1, nil))
+	for x := 0; x < 10; x++ {
+		if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var calls int32
+	for _, c := range counters {
+		calls += c.calls
+	}
+	if calls != 10 {
+		t.Fatalf("expected 10 calls, got %d", calls)
+	}
+
+	// Replicas with a weight of 0 are only used for failover
+	apis, counters = replicas(nil, nil, nil)
+	a = NewMultiAPI(apis, model.Time(0), nil, 1, WithLoadBalancing(1, []float64{0, 0, 1}))
+	for x := 0; x < 10; x++ {
+		if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if counters[2].calls != 10 {
+		t.Fatalf("expected all calls to the weighted replica, got %d", counters[2].calls)
+	}
+
+	// Errors fail over to the other replicas
+	apis, counters = replicas(failing, failing, nil)
+	a = NewMultiAPI(apis, model.Time(0), nil, 1, WithLoadBalancing(1, []float64{2, 1, 0}))
+	if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if counters[2].calls != 1 {
+		t.Fatalf("expected a failover to the last replica, got %d calls", counters[2].calls)
+	}
+
+	apis, _ = replicas(failing, failing)
+	a = NewMultiAPI(apis, model.Time(0), nil, 1, WithLoadBalancing(1, nil))
+	if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err == nil {
+		t.Fatal("expected an error when all replicas fail")
+	}
+}
+
+func TestMultiAPIMetricFunc(t *testing.T) {
+	stub := &stubAPI{
+		queryRange: func() model.Value {
+			return model.Matrix{
+				{Metric: model.Metric{"a": "1"}, Values: []model.SamplePair{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 2}}},
+				{Metric: model.Metric{"a": "2"}, Values: []model.SamplePair{{Timestamp: 1, Value: 1}}},
+			}
+		},
+	}
+
+	var mu sync.Mutex
+	infos := make(map[string]MultiAPICallInfo)
+	metricFunc := func(i int, api, status string, took float64, info MultiAPICallInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		infos[status+"/"+info.Name] = info
+	}
+
+	a := NewMultiAPI([]API{
+		&AddLabelClient{stub, model.LabelSet{"replica": "set"}},
+		&errorAPI{&AddLabelClient{stub, model.LabelSet{"replica": "set"}}, fmt.Errorf("error")},
+	}, model.Time(0), metricFunc, 1, WithAPINames([]string{"a:9090", "b:9090"}))
+	if _, _, err := a.QueryRange(context.TODO(), "testmetric", v1.Range{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]MultiAPICallInfo{
+		"success/a:9090": {Name: "a:9090", Labels: model.LabelSet{"replica": "set"}, Series: 2, Samples: 3},
+		"error/b:9090":   {Name: "b:9090", Labels: model.LabelSet{"replica": "set"}},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Fatalf("mismatch in call info expected=%v actual=%v", expected, infos)
+	}
+}
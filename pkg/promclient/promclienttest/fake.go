@@ -0,0 +1,304 @@
+// Package promclienttest provides a programmable fake promclient.API for
+// testing code built on promxy's client types without real prometheus servers.
+package promclienttest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+// Call names as used by FakeAPI.Errors and FakeAPI.Calls, these match the
+// names the promclient.MultiAPI passes to its metric func
+const (
+	CallLabelNames      = "label_names"
+	CallLabelValues     = "label_values"
+	CallQuery           = "query"
+	CallQueryRange      = "query_range"
+	CallSeries          = "series"
+	CallGetValue        = "get_value"
+	CallMetadata        = "metadata"
+	CallTargets         = "targets"
+	CallRules           = "rules"
+	CallAlerts          = "alerts"
+	CallAlertManagers   = "alertmanagers"
+	CallQueryExemplars  = "query_exemplars"
+	CallTSDB            = "tsdb"
+	CallBuildinfo       = "buildinfo"
+	CallRuntimeinfo     = "runtimeinfo"
+	CallConfig          = "config"
+	CallDeleteSeries    = "delete_series"
+	CallCleanTombstones = "clean_tombstones"
+	CallSnapshot        = "snapshot"
+)
+
+// FakeAPI is a promclient.API returning canned results. Every call waits for
+// Latency (or until the context is done) and then returns the error for the
+// call from Errors (falling back to Err) or the canned result and Warnings.
+// The fields should not be changed while the FakeAPI is in use.
+type FakeAPI struct {
+	// Labels is returned by Key, apis with the same labels are replicas to a MultiAPI
+	Labels model.LabelSet
+
+	Latency  time.Duration
+	Err      error
+	Errors   map[string]error // call name -> error
+	Warnings v1.Warnings
+
+	LabelNamesResult     []string
+	LabelValuesResult    model.LabelValues
+	QueryResult          model.Value
+	QueryRangeResult     model.Value
+	SeriesResult         []model.LabelSet
+	GetValueResult       model.Value
+	MetadataResult       map[string][]v1.Metadata
+	TargetsResult        v1.TargetsResult
+	RulesResult          v1.RulesResult
+	AlertsResult         v1.AlertsResult
+	AlertManagersResult  v1.AlertManagersResult
+	QueryExemplarsResult []promclient.ExemplarQueryResult
+	TSDBResult           promclient.TSDBResult
+	BuildinfoResult      []promclient.BuildinfoResult
+	RuntimeinfoResult    []promclient.RuntimeinfoResult
+	ConfigResult         []promclient.ConfigResult
+	AdminResult          []promclient.AdminResult
+	QueryResultFunc      func(query string, ts time.Time) model.Value
+	QueryRangeResultFunc func(query string, r v1.Range) model.Value
+	GetValueResultFunc   func(start, end time.Time, matchers []*labels.Matcher) model.Value
+
+	l     sync.Mutex
+	calls []string
+}
+
+// Key returns the Labels of the FakeAPI
+func (f *FakeAPI) Key() model.LabelSet {
+	return f.Labels
+}
+
+// Calls returns the names of the calls made so far, in order
+func (f *FakeAPI) Calls() []string {
+	f.l.Lock()
+	defer f.l.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// CallCount returns the number of calls made so far with the given name
+func (f *FakeAPI) CallCount(name string) int {
+	f.l.Lock()
+	defer f.l.Unlock()
+	count := 0
+	for _, call := range f.calls {
+		if call == name {
+			count++
+		}
+	}
+	return count
+}
+
+// call records the call, waits for the latency and returns the warnings and error for it
+func (f *FakeAPI) call(ctx context.Context, name string) (v1.Warnings, error) {
+	f.l.Lock()
+	f.calls = append(f.calls, name)
+	f.l.Unlock()
+
+	if f.Latency > 0 {
+		t := time.NewTimer(f.Latency)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	if err, ok := f.Errors[name]; ok {
+		return f.Warnings, err
+	}
+	return f.Warnings, f.Err
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (f *FakeAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	w, err := f.call(ctx, CallLabelNames)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.LabelNamesResult, w, nil
+}
+
+// LabelValues performs a query for the values of the given label.
+func (f *FakeAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	w, err := f.call(ctx, CallLabelValues)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.LabelValuesResult, w, nil
+}
+
+// Query performs a query for the given time.
+func (f *FakeAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	w, err := f.call(ctx, CallQuery)
+	if err != nil {
+		return nil, w, err
+	}
+	if f.QueryResultFunc != nil {
+		return f.QueryResultFunc(query, ts), w, nil
+	}
+	return f.QueryResult, w, nil
+}
+
+// QueryRange performs a query for the given range.
+func (f *FakeAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	w, err := f.call(ctx, CallQueryRange)
+	if err != nil {
+		return nil, w, err
+	}
+	if f.QueryRangeResultFunc != nil {
+		return f.QueryRangeResultFunc(query, r), w, nil
+	}
+	return f.QueryRangeResult, w, nil
+}
+
+// Series finds series by label matchers.
+func (f *FakeAPI) Series(ctx context.Context, matches []string, startTime, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	w, err := f.call(ctx, CallSeries)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.SeriesResult, w, nil
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (f *FakeAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	w, err := f.call(ctx, CallGetValue)
+	if err != nil {
+		return nil, w, err
+	}
+	if f.GetValueResultFunc != nil {
+		return f.GetValueResultFunc(start, end, matchers), w, nil
+	}
+	return f.GetValueResult, w, nil
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (f *FakeAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	w, err := f.call(ctx, CallMetadata)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.MetadataResult, w, nil
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (f *FakeAPI) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallTargets)
+	if err != nil {
+		return v1.TargetsResult{}, w, err
+	}
+	return f.TargetsResult, w, nil
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (f *FakeAPI) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallRules)
+	if err != nil {
+		return v1.RulesResult{}, w, err
+	}
+	return f.RulesResult, w, nil
+}
+
+// Alerts returns a list of all active alerts.
+func (f *FakeAPI) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallAlerts)
+	if err != nil {
+		return v1.AlertsResult{}, w, err
+	}
+	return f.AlertsResult, w, nil
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+func (f *FakeAPI) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallAlertManagers)
+	if err != nil {
+		return v1.AlertManagersResult{}, w, err
+	}
+	return f.AlertManagersResult, w, nil
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (f *FakeAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]promclient.ExemplarQueryResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallQueryExemplars)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.QueryExemplarsResult, w, nil
+}
+
+// TSDB returns the cardinality statistics of the TSDB.
+func (f *FakeAPI) TSDB(ctx context.Context) (promclient.TSDBResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallTSDB)
+	if err != nil {
+		return promclient.TSDBResult{}, w, err
+	}
+	return f.TSDBResult, w, nil
+}
+
+// Buildinfo returns the build information of each server.
+func (f *FakeAPI) Buildinfo(ctx context.Context) ([]promclient.BuildinfoResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallBuildinfo)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.BuildinfoResult, w, nil
+}
+
+// Runtimeinfo returns the runtime information of each server.
+func (f *FakeAPI) Runtimeinfo(ctx context.Context) ([]promclient.RuntimeinfoResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallRuntimeinfo)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.RuntimeinfoResult, w, nil
+}
+
+// Config returns the configuration of each server.
+func (f *FakeAPI) Config(ctx context.Context) ([]promclient.ConfigResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallConfig)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.ConfigResult, w, nil
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+func (f *FakeAPI) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]promclient.AdminResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallDeleteSeries)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.AdminResult, w, nil
+}
+
+// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+func (f *FakeAPI) CleanTombstones(ctx context.Context) ([]promclient.AdminResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallCleanTombstones)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.AdminResult, w, nil
+}
+
+// Snapshot creates a snapshot of all current data on each server.
+func (f *FakeAPI) Snapshot(ctx context.Context, skipHead bool) ([]promclient.AdminResult, v1.Warnings, error) {
+	w, err := f.call(ctx, CallSnapshot)
+	if err != nil {
+		return nil, w, err
+	}
+	return f.AdminResult, w, nil
+}
@@ -0,0 +1,44 @@
+package promclienttest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+var _ promclient.APILabels = &FakeAPI{}
+
+func TestFakeAPIMultiAPI(t *testing.T) {
+	sample := &model.Sample{Metric: model.Metric{"__name__": "up"}, Value: 1}
+	ok := &FakeAPI{Labels: model.LabelSet{"replica": "set"}, QueryResult: model.Vector{sample}}
+	failing := &FakeAPI{Labels: model.LabelSet{"replica": "set"}, Errors: map[string]error{CallQuery: fmt.Errorf("unavailable")}}
+	slow := &FakeAPI{Labels: model.LabelSet{"replica": "set"}, Latency: time.Minute}
+
+	api := promclient.NewMultiAPI([]promclient.API{ok, failing, slow}, model.Time(0), nil, 1, promclient.WithAPITimeout(10*time.Millisecond))
+	v, _, err := api.Query(context.TODO(), "up", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vector, ok := v.(model.Vector); !ok || len(vector) != 1 {
+		t.Fatalf("unexpected result: %v", v)
+	}
+
+	for _, f := range []*FakeAPI{ok, failing, slow} {
+		if count := f.CallCount(CallQuery); count != 1 {
+			t.Fatalf("expected 1 query call, got %d", count)
+		}
+	}
+
+	// Calls without an error set in Errors succeed
+	if _, _, err := failing.LabelNames(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if calls := failing.Calls(); len(calls) != 2 || calls[1] != CallLabelNames {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
@@ -0,0 +1,146 @@
+package promclienttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+// NotRecordedError is returned by a ReplayAPI for a call which wasn't recorded
+type NotRecordedError struct {
+	Call string
+	Args promclient.RecordArgs
+}
+
+func (e *NotRecordedError) Error() string {
+	return fmt.Sprintf("no recorded %s call with args %+v", e.Call, e.Args)
+}
+
+// ReplayAPI replays the calls recorded by a promclient.RecordAPI. Calls are
+// matched by their arguments; if the same call was recorded more than once the
+// responses are replayed in order (repeating the last). Calls which aren't
+// recorded by a RecordAPI are answered by the embedded FakeAPI.
+type ReplayAPI struct {
+	FakeAPI
+
+	l       sync.Mutex
+	records map[string][]*promclient.Record
+}
+
+// NewReplayAPI returns a ReplayAPI replaying the records for the given server
+// (as set in the RecordAPI), or all of the records if server is empty
+func NewReplayAPI(records []*promclient.Record, server string) *ReplayAPI {
+	r := &ReplayAPI{records: make(map[string][]*promclient.Record)}
+	for _, record := range records {
+		if server != "" && record.Server != server {
+			continue
+		}
+		key := replayKey(record.Call, record.Args)
+		r.records[key] = append(r.records[key], record)
+	}
+	return r
+}
+
+func replayKey(call string, args promclient.RecordArgs) string {
+	b, _ := json.Marshal(args)
+	return call + string(b)
+}
+
+// replay returns the next record for the call
+func (r *ReplayAPI) replay(ctx context.Context, call string, args promclient.RecordArgs) (*promclient.Record, error) {
+	if _, err := r.call(ctx, call); err != nil {
+		return nil, err
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	key := replayKey(call, args)
+	records := r.records[key]
+	if len(records) == 0 {
+		return nil, &NotRecordedError{Call: call, Args: args}
+	}
+	if len(records) > 1 {
+		r.records[key] = records[1:]
+	}
+	record := records[0]
+	if record.Error != "" {
+		return record, errors.New(record.Error)
+	}
+	return record, nil
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (r *ReplayAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	record, err := r.replay(ctx, CallLabelNames, promclient.RecordArgs{})
+	if err != nil {
+		return nil, nil, err
+	}
+	var v []string
+	err = json.Unmarshal(record.Result, &v)
+	return v, record.Warnings, err
+}
+
+// LabelValues performs a query for the values of the given label.
+func (r *ReplayAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	record, err := r.replay(ctx, CallLabelValues, promclient.RecordArgs{Label: label, Matchers: matchers, Start: startTime.UTC(), End: endTime.UTC()})
+	if err != nil {
+		return nil, nil, err
+	}
+	var v model.LabelValues
+	err = json.Unmarshal(record.Result, &v)
+	return v, record.Warnings, err
+}
+
+// Query performs a query for the given time.
+func (r *ReplayAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	record, err := r.replay(ctx, CallQuery, promclient.RecordArgs{Query: query, Time: ts.UTC()})
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := record.Value()
+	return v, record.Warnings, err
+}
+
+// QueryRange performs a query for the given range.
+func (r *ReplayAPI) QueryRange(ctx context.Context, query string, rng v1.Range) (model.Value, v1.Warnings, error) {
+	record, err := r.replay(ctx, CallQueryRange, promclient.RecordArgs{Query: query, Start: rng.Start.UTC(), End: rng.End.UTC(), Step: rng.Step})
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := record.Value()
+	return v, record.Warnings, err
+}
+
+// Series finds series by label matchers.
+func (r *ReplayAPI) Series(ctx context.Context, matches []string, startTime, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	record, err := r.replay(ctx, CallSeries, promclient.RecordArgs{Matchers: matches, Start: startTime.UTC(), End: endTime.UTC()})
+	if err != nil {
+		return nil, nil, err
+	}
+	var v []model.LabelSet
+	err = json.Unmarshal(record.Result, &v)
+	return v, record.Warnings, err
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (r *ReplayAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	matcherStrings := make([]string, len(matchers))
+	for i, m := range matchers {
+		matcherStrings[i] = m.String()
+	}
+	record, err := r.replay(ctx, CallGetValue, promclient.RecordArgs{Matchers: matcherStrings, Start: start.UTC(), End: end.UTC()})
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := record.Value()
+	return v, record.Warnings, err
+}
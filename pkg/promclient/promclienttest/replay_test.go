@@ -0,0 +1,97 @@
+package promclienttest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+func TestRecordReplay(t *testing.T) {
+	matrix := model.Matrix{
+		{Metric: model.Metric{"__name__": "up", "secret": "a"}, Values: []model.SamplePair{{Timestamp: 1000, Value: 1}}},
+	}
+	fake := &FakeAPI{
+		QueryRangeResult: matrix,
+		SeriesResult:     []model.LabelSet{{"__name__": "up", "secret": "a"}},
+		Errors:           map[string]error{CallQuery: fmt.Errorf("unavailable")},
+		Warnings:         v1.Warnings{"warning"},
+	}
+
+	buf := &bytes.Buffer{}
+	recorder := &promclient.RecordAPI{API: fake, Recorder: promclient.NewRecorder(buf, []string{"secret"}), Server: "a:9090"}
+
+	ctx := context.TODO()
+	rng := v1.Range{Start: time.Unix(0, 0), End: time.Unix(100, 0), Step: time.Second}
+	v, _, err := recorder.QueryRange(ctx, "up", rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The result returned to the caller must not be redacted
+	if !reflect.DeepEqual(v, matrix) {
+		t.Fatalf("result was modified by the recorder: %v", v)
+	}
+	if _, _, err := recorder.Series(ctx, []string{"up"}, rng.Start, rng.End); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := recorder.Query(ctx, "up", rng.End); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	records, err := promclient.DecodeRecords(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+
+	replay := NewReplayAPI(records, "a:9090")
+
+	// Times in other locations match the recorded times
+	rng.Start = rng.Start.In(time.FixedZone("test", 3600))
+	v, w, err := replay.QueryRange(ctx, "up", rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := model.Matrix{
+		{Metric: model.Metric{"__name__": "up", "secret": promclient.RedactedValue}, Values: []model.SamplePair{{Timestamp: 1000, Value: 1}}},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch in replayed result expected=%v actual=%v", expected, v)
+	}
+	if !reflect.DeepEqual(w, fake.Warnings) {
+		t.Fatalf("mismatch in replayed warnings expected=%v actual=%v", fake.Warnings, w)
+	}
+
+	series, _, err := replay.Series(ctx, []string{"up"}, rng.Start, rng.End)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || series[0]["secret"] != promclient.RedactedValue {
+		t.Fatalf("unexpected replayed series: %v", series)
+	}
+
+	if _, _, err := replay.Query(ctx, "up", rng.End); err == nil || err.Error() != "unavailable" {
+		t.Fatalf("expected the recorded error, got %v", err)
+	}
+
+	if _, _, err := replay.GetValue(ctx, rng.Start, rng.End, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")}); err == nil {
+		t.Fatal("expected an error for a call which wasn't recorded")
+	} else if _, ok := err.(*NotRecordedError); !ok {
+		t.Fatalf("expected NotRecordedError, got %v", err)
+	}
+
+	// Records for other servers are ignored
+	if _, _, err := NewReplayAPI(records, "b:9090").QueryRange(ctx, "up", rng); err == nil {
+		t.Fatal("expected an error for another server")
+	}
+}
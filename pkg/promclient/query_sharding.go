@@ -0,0 +1,273 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// DefaultQueryShardLabel is the label of the shard matchers (as supported by Mimir)
+const DefaultQueryShardLabel = "__query_shard__"
+
+// unshardableFuncs are functions whose result depends on all of the series (not each of them)
+var unshardableFuncs = map[string]struct{}{
+	"absent":           {},
+	"absent_over_time": {},
+	"scalar":           {},
+	"vector":           {},
+}
+
+// QueryShardingAPI shards queries of composable aggregations (sum, min, max, count and group)
+// over the series into Shards queries, by adding a matcher on the shard label to all selectors
+// (e.g. `__query_shard__="1_of_16"`, which the API must support), which are evaluated concurrently
+// and the partial aggregations are combined. Other queries are sent as-is.
+type QueryShardingAPI struct {
+	API
+	Shards int
+	// Label is the label of the shard matchers (DefaultQueryShardLabel if unset)
+	Label string
+}
+
+// shardable returns the aggregation of the query if the query can be sharded
+func (s *QueryShardingAPI) shardable(ctx context.Context, query string) (*parser.AggregateExpr, bool) {
+	if s.Shards <= 1 {
+		return nil, false
+	}
+	e, err := parser.ParseExpr(query)
+	if err != nil {
+		return nil, false
+	}
+	for {
+		paren, ok := e.(*parser.ParenExpr)
+		if !ok {
+			break
+		}
+		e = paren.Expr
+	}
+	agg, ok := e.(*parser.AggregateExpr)
+	if !ok {
+		return nil, false
+	}
+	switch agg.Op {
+	case parser.SUM, parser.MIN, parser.MAX, parser.COUNT, parser.GROUP:
+	default:
+		return nil, false
+	}
+
+	// The series of each shard must be aggregated independently of the other shards,
+	// so the inner expression can't aggregate or match series (e.g. `a / b`)
+	var l sync.Mutex
+	selectors := 0
+	shardable := true
+	parser.Inspect(ctx, &parser.EvalStmt{Expr: agg.Expr}, func(node parser.Node, _ []parser.Node) error {
+		l.Lock()
+		defer l.Unlock()
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			selectors++
+		case *parser.AggregateExpr:
+			shardable = false
+		case *parser.BinaryExpr:
+			if n.LHS.Type() == parser.ValueTypeVector && n.RHS.Type() == parser.ValueTypeVector {
+				shardable = false
+			}
+		case *parser.Call:
+			if _, ok := unshardableFuncs[n.Func.Name]; ok {
+				shardable = false
+			}
+		}
+		return nil
+	}, nil)
+	return agg, shardable && selectors > 0
+}
+
+// shardQuery returns the query with the matcher of the shard (0 to Shards-1) added to all selectors
+func (s *QueryShardingAPI) shardQuery(ctx context.Context, agg *parser.AggregateExpr, shard int) (string, error) {
+	e, err := parser.ParseExpr(agg.String())
+	if err != nil {
+		return "", err
+	}
+	label := s.Label
+	if label == "" {
+		label = DefaultQueryShardLabel
+	}
+	matcher, err := labels.NewMatcher(labels.MatchEqual, label, fmt.Sprintf("%d_of_%d", shard+1, s.Shards))
+	if err != nil {
+		return "", err
+	}
+	parser.Inspect(ctx, &parser.EvalStmt{Expr: e}, func(node parser.Node, _ []parser.Node) error {
+		if n, ok := node.(*parser.VectorSelector); ok {
+			n.LabelMatchers = append(n.LabelMatchers, matcher)
+		}
+		return nil
+	}, nil)
+	return e.String(), nil
+}
+
+// shard sends the shards of the aggregation concurrently and combines their results
+func (s *QueryShardingAPI) shard(ctx context.Context, agg *parser.AggregateExpr, f func(context.Context, string) (model.Value, v1.Warnings, error)) (model.Value, v1.Warnings, error) {
+	childContext, childContextCancel := context.WithCancel(ctx)
+	defer childContextCancel()
+
+	results := make([]model.Value, s.Shards)
+	warnings := make([]v1.Warnings, s.Shards)
+	errs := make([]error, s.Shards)
+	wg := sync.WaitGroup{}
+	for i := 0; i < s.Shards; i++ {
+		query, err := s.shardQuery(ctx, agg, i)
+		if err != nil {
+			return nil, nil, err
+		}
+		wg.Add(1)
+		go func(i int, query string) {
+			defer wg.Done()
+			results[i], warnings[i], errs[i] = f(childContext, query)
+			if errs[i] != nil {
+				// If any shard fails the query fails, so the others can be cancelled
+				childContextCancel()
+			}
+		}(i, query)
+	}
+	wg.Wait()
+
+	warningSet := make(promhttputil.WarningSet)
+	for _, w := range warnings {
+		warningSet.AddWarnings(w)
+	}
+	for _, err := range errs {
+		if err != nil && err != context.Canceled {
+			return nil, warningSet.Warnings(), err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, warningSet.Warnings(), err
+	}
+
+	var ret model.Value
+	for _, result := range results {
+		var err error
+		if ret, err = combineShards(agg.Op, ret, result); err != nil {
+			return nil, warningSet.Warnings(), err
+		}
+	}
+	return ret, warningSet.Warnings(), nil
+}
+
+// Query performs a query for the given time.
+func (s *QueryShardingAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	agg, ok := s.shardable(ctx, query)
+	if !ok {
+		return s.API.Query(ctx, query, ts)
+	}
+	return s.shard(ctx, agg, func(ctx context.Context, query string) (model.Value, v1.Warnings, error) {
+		return s.API.Query(ctx, query, ts)
+	})
+}
+
+// QueryRange performs a query for the given range.
+func (s *QueryShardingAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	agg, ok := s.shardable(ctx, query)
+	if !ok {
+		return s.API.QueryRange(ctx, query, r)
+	}
+	return s.shard(ctx, agg, func(ctx context.Context, query string) (model.Value, v1.Warnings, error) {
+		return s.API.QueryRange(ctx, query, r)
+	})
+}
+
+// combineShardValues combines the values of a series of 2 shards with the aggregation op
+func combineShardValues(op parser.ItemType, a, b model.SampleValue) model.SampleValue {
+	switch op {
+	case parser.SUM, parser.COUNT:
+		return a + b
+	case parser.MIN:
+		if b < a || math.IsNaN(float64(a)) {
+			return b
+		}
+	case parser.MAX:
+		if b > a || math.IsNaN(float64(a)) {
+			return b
+		}
+	}
+	return a
+}
+
+// combineShards combines the results of 2 shards with the aggregation op
+func combineShards(op parser.ItemType, a, b model.Value) (model.Value, error) {
+	if a == nil {
+		return b, nil
+	}
+	if b == nil {
+		return a, nil
+	}
+
+	switch aTyped := a.(type) {
+	case model.Vector:
+		bTyped, ok := b.(model.Vector)
+		if !ok {
+			return nil, &promhttputil.ResultTypeMismatchError{A: a.Type(), B: b.Type()}
+		}
+		samples := make(map[model.Fingerprint]*model.Sample, len(aTyped))
+		for _, sample := range aTyped {
+			samples[sample.Metric.Fingerprint()] = sample
+		}
+		for _, sample := range bTyped {
+			if existing, ok := samples[sample.Metric.Fingerprint()]; ok {
+				existing.Value = combineShardValues(op, existing.Value, sample.Value)
+				continue
+			}
+			aTyped = append(aTyped, sample)
+		}
+		return aTyped, nil
+
+	case model.Matrix:
+		bTyped, ok := b.(model.Matrix)
+		if !ok {
+			return nil, &promhttputil.ResultTypeMismatchError{A: a.Type(), B: b.Type()}
+		}
+		streams := make(map[model.Fingerprint]*model.SampleStream, len(aTyped))
+		for _, stream := range aTyped {
+			streams[stream.Metric.Fingerprint()] = stream
+		}
+		for _, stream := range bTyped {
+			existing, ok := streams[stream.Metric.Fingerprint()]
+			if !ok {
+				aTyped = append(aTyped, stream)
+				continue
+			}
+			// Merge the (sorted) values by timestamp
+			values := make([]model.SamplePair, 0, len(existing.Values))
+			i, j := 0, 0
+			for i < len(existing.Values) || j < len(stream.Values) {
+				switch {
+				case j == len(stream.Values) || (i < len(existing.Values) && existing.Values[i].Timestamp < stream.Values[j].Timestamp):
+					values = append(values, existing.Values[i])
+					i++
+				case i == len(existing.Values) || stream.Values[j].Timestamp < existing.Values[i].Timestamp:
+					values = append(values, stream.Values[j])
+					j++
+				default:
+					values = append(values, model.SamplePair{
+						Timestamp: existing.Values[i].Timestamp,
+						Value:     combineShardValues(op, existing.Values[i].Value, stream.Values[j].Value),
+					})
+					i++
+					j++
+				}
+			}
+			existing.Values = values
+		}
+		return aTyped, nil
+	}
+
+	return nil, fmt.Errorf("unexpected result type for a sharded query: %v", a.Type())
+}
@@ -0,0 +1,86 @@
+package promclient
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// shardedAPI returns a sample per shard (with the shard number as the value)
+type shardedAPI struct {
+	API
+	l       sync.Mutex
+	queries []string
+}
+
+func (s *shardedAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	s.l.Lock()
+	s.queries = append(s.queries, query)
+	s.l.Unlock()
+	for i, shard := range []string{"1_of_2", "2_of_2"} {
+		if strings.Contains(query, `__query_shard__="`+shard+`"`) {
+			return model.Vector{{Metric: model.Metric{"job": "a"}, Value: model.SampleValue(i + 1)}}, nil, nil
+		}
+	}
+	return model.Vector{{Metric: model.Metric{"job": "a"}, Value: 10}}, nil, nil
+}
+
+func TestQueryShardingAPI(t *testing.T) {
+	tests := []struct {
+		query    string
+		shards   int
+		expected model.SampleValue
+	}{
+		{query: `sum by (job) (rate(foo[5m]))`, shards: 2, expected: 3},
+		{query: `(count(foo * 2))`, shards: 2, expected: 3},
+		{query: `max(foo)`, shards: 2, expected: 2},
+		{query: `min(foo)`, shards: 2, expected: 1},
+		// Unshardable queries are sent as-is
+		{query: `avg(foo)`, shards: 1, expected: 10},
+		{query: `sum(foo / bar)`, shards: 1, expected: 10},
+		{query: `sum(sum by (job) (foo))`, shards: 1, expected: 10},
+		{query: `sum(absent(foo))`, shards: 1, expected: 10},
+		{query: `rate(foo[5m])`, shards: 1, expected: 10},
+	}
+
+	for _, test := range tests {
+		api := &shardedAPI{}
+		v, _, err := (&QueryShardingAPI{API: api, Shards: 2}).Query(context.TODO(), test.query, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(api.queries) != test.shards {
+			t.Fatalf("%s: expected %d queries, got %v", test.query, test.shards, api.queries)
+		}
+		expected := model.Vector{{Metric: model.Metric{"job": "a"}, Value: test.expected}}
+		if !reflect.DeepEqual(v, expected) {
+			t.Fatalf("%s: mismatch expected=%v actual=%v", test.query, expected, v)
+		}
+	}
+}
+
+func TestCombineShardsMatrix(t *testing.T) {
+	a := model.Matrix{{Metric: model.Metric{"job": "a"}, Values: []model.SamplePair{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 1}}}}
+	b := model.Matrix{
+		{Metric: model.Metric{"job": "a"}, Values: []model.SamplePair{{Timestamp: 2, Value: 2}, {Timestamp: 3, Value: 2}}},
+		{Metric: model.Metric{"job": "b"}, Values: []model.SamplePair{{Timestamp: 1, Value: 2}}},
+	}
+	v, err := combineShards(parser.SUM, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := model.Matrix{
+		{Metric: model.Metric{"job": "a"}, Values: []model.SamplePair{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 3}, {Timestamp: 3, Value: 2}}},
+		{Metric: model.Metric{"job": "b"}, Values: []model.SamplePair{{Timestamp: 1, Value: 2}}},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch expected=%v actual=%v", expected, v)
+	}
+}
@@ -0,0 +1,179 @@
+package promclient
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// ThrottleRate is the reason given to the throttle func for requests waiting on the request rate
+	ThrottleRate = "rate"
+	// ThrottleInflight is the reason given to the throttle func for requests waiting on the max inflight requests
+	ThrottleInflight = "inflight"
+)
+
+// NewRateLimiter returns a RateLimiter allowing `requestsPerSecond` requests (with
+// bursts of up to `burst`) and at most `maxInflight` concurrent requests; zero
+// disables the respective limit. throttleFunc (if set) is called with the reason
+// (ThrottleRate or ThrottleInflight) whenever a request has to wait on a limit.
+func NewRateLimiter(requestsPerSecond float64, burst, maxInflight int, throttleFunc func(reason string)) *RateLimiter {
+	r := &RateLimiter{throttleFunc: throttleFunc}
+	if requestsPerSecond > 0 {
+		if burst < 1 {
+			burst = 1
+		}
+		r.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
+	}
+	if maxInflight > 0 {
+		r.inflight = make(chan struct{}, maxInflight)
+	}
+	return r
+}
+
+// RateLimiter limits the rate of (and concurrent) requests to a downstream
+type RateLimiter struct {
+	limiter      *rate.Limiter
+	inflight     chan struct{}
+	throttleFunc func(reason string)
+}
+
+func (r *RateLimiter) throttled(reason string) {
+	if r.throttleFunc != nil {
+		r.throttleFunc(reason)
+	}
+}
+
+// acquire blocks until the request is allowed by both limits or the context is done
+func (r *RateLimiter) acquire(ctx context.Context) error {
+	if r.limiter != nil {
+		reservation := r.limiter.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			r.throttled(ThrottleRate)
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				reservation.Cancel()
+				return ctx.Err()
+			}
+		}
+	}
+
+	if r.inflight != nil {
+		select {
+		case r.inflight <- struct{}{}:
+		default:
+			r.throttled(ThrottleInflight)
+			select {
+			case r.inflight <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// do calls f once the request is allowed by the limits
+func (r *RateLimiter) do(ctx context.Context, f func() error) error {
+	if err := r.acquire(ctx); err != nil {
+		return err
+	}
+	if r.inflight != nil {
+		defer func() { <-r.inflight }()
+	}
+	return f()
+}
+
+// RateLimitAPI limits the rate of (and concurrent) requests to the API, such
+// that a burst of queries through promxy can't overwhelm a small downstream
+type RateLimitAPI struct {
+	API
+	Limiter *RateLimiter
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (r *RateLimitAPI) LabelNames(ctx context.Context) (v []string, w v1.Warnings, err error) {
+	err = r.Limiter.do(ctx, func() error {
+		v, w, err = r.API.LabelNames(ctx)
+		return err
+	})
+	return v, w, err
+}
+
+// LabelValues performs a query for the values of the given label.
+func (r *RateLimitAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (v model.LabelValues, w v1.Warnings, err error) {
+	err = r.Limiter.do(ctx, func() error {
+		v, w, err = r.API.LabelValues(ctx, label, matchers, startTime, endTime)
+		return err
+	})
+	return v, w, err
+}
+
+// Query performs a query for the given time.
+func (r *RateLimitAPI) Query(ctx context.Context, query string, ts time.Time) (v model.Value, w v1.Warnings, err error) {
+	err = r.Limiter.do(ctx, func() error {
+		v, w, err = r.API.Query(ctx, query, ts)
+		return err
+	})
+	return v, w, err
+}
+
+// QueryRange performs a query for the given range.
+func (r *RateLimitAPI) QueryRange(ctx context.Context, query string, rng v1.Range) (v model.Value, w v1.Warnings, err error) {
+	err = r.Limiter.do(ctx, func() error {
+		v, w, err = r.API.QueryRange(ctx, query, rng)
+		return err
+	})
+	return v, w, err
+}
+
+// Series finds series by label matchers.
+func (r *RateLimitAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) (v []model.LabelSet, w v1.Warnings, err error) {
+	err = r.Limiter.do(ctx, func() error {
+		v, w, err = r.API.Series(ctx, matches, startTime, endTime)
+		return err
+	})
+	return v, w, err
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (r *RateLimitAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (v model.Value, w v1.Warnings, err error) {
+	err = r.Limiter.do(ctx, func() error {
+		v, w, err = r.API.GetValue(ctx, start, end, matchers)
+		return err
+	})
+	return v, w, err
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (r *RateLimitAPI) Metadata(ctx context.Context, metric, limit string) (v map[string][]v1.Metadata, w v1.Warnings, err error) {
+	err = r.Limiter.do(ctx, func() error {
+		v, w, err = r.API.Metadata(ctx, metric, limit)
+		return err
+	})
+	return v, w, err
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (r *RateLimitAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) (v []ExemplarQueryResult, w v1.Warnings, err error) {
+	err = r.Limiter.do(ctx, func() error {
+		v, w, err = r.API.QueryExemplars(ctx, query, startTime, endTime)
+		return err
+	})
+	return v, w, err
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (r *RateLimitAPI) Key() model.LabelSet {
+	if apiLabels, ok := r.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package promclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestRateLimitAPIRate(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value { return model.Vector{} },
+	}
+
+	var throttled []string
+	a := &RateLimitAPI{stub, NewRateLimiter(10, 1, 0, func(reason string) {
+		throttled = append(throttled, reason)
+	})}
+
+	// The first request uses the burst, the second has to wait for a token
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if took := time.Since(start); took < 50*time.Millisecond {
+		t.Fatalf("expected the second request to be throttled, took %s", took)
+	}
+	if len(throttled) != 1 || throttled[0] != ThrottleRate {
+		t.Fatalf("unexpected throttles: %v", throttled)
+	}
+
+	// Requests waiting on the limit give up with the context
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	a.Query(context.TODO(), "testmetric", time.Now())
+	if _, _, err := a.Query(ctx, "testmetric", time.Now()); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRateLimitAPIInflight(t *testing.T) {
+	release := make(chan struct{})
+	stub := &stubAPI{
+		query: func() model.Value {
+			<-release
+			return model.Vector{}
+		},
+	}
+
+	var l sync.Mutex
+	var throttled []string
+	a := &RateLimitAPI{stub, NewRateLimiter(0, 0, 1, func(reason string) {
+		l.Lock()
+		defer l.Unlock()
+		throttled = append(throttled, reason)
+	})}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+
+	// Only one request is let through at a time
+	time.Sleep(20 * time.Millisecond)
+	release <- struct{}{}
+	release <- struct{}{}
+	wg.Wait()
+
+	l.Lock()
+	defer l.Unlock()
+	if len(throttled) != 1 || throttled[0] != ThrottleInflight {
+		t.Fatalf("unexpected throttles: %v", throttled)
+	}
+}
@@ -0,0 +1,250 @@
+package promclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/sirupsen/logrus"
+)
+
+// RedactedValue replaces the values of redacted labels in recorded results
+const RedactedValue = "<redacted>"
+
+// Record is a single request/response pair to a downstream recorded by a RecordAPI
+type Record struct {
+	Server string     `json:"server,omitempty"`
+	Call   string     `json:"call"`
+	Args   RecordArgs `json:"args"`
+
+	ResultType string          `json:"resultType,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Warnings   v1.Warnings     `json:"warnings,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// RecordArgs are the arguments of a recorded call, times are in UTC
+type RecordArgs struct {
+	Query    string        `json:"query,omitempty"`
+	Label    string        `json:"label,omitempty"`
+	Matchers []string      `json:"matchers,omitempty"`
+	Time     time.Time     `json:"time,omitempty"`
+	Start    time.Time     `json:"start,omitempty"`
+	End      time.Time     `json:"end,omitempty"`
+	Step     time.Duration `json:"step,omitempty"`
+}
+
+// Value decodes the result of a Query, QueryRange or GetValue record
+func (r *Record) Value() (model.Value, error) {
+	var v model.Value
+	switch r.ResultType {
+	case "":
+		return nil, nil
+	case model.ValVector.String():
+		v = &model.Vector{}
+	case model.ValMatrix.String():
+		v = &model.Matrix{}
+	case model.ValScalar.String():
+		v = &model.Scalar{}
+	case model.ValString.String():
+		v = &model.String{}
+	default:
+		return nil, fmt.Errorf("unknown result type %q", r.ResultType)
+	}
+	if err := json.Unmarshal(r.Result, v); err != nil {
+		return nil, err
+	}
+	switch vTyped := v.(type) {
+	case *model.Vector:
+		return *vTyped, nil
+	case *model.Matrix:
+		return *vTyped, nil
+	}
+	return v, nil
+}
+
+// DecodeRecords reads the records written by a Recorder
+func DecodeRecords(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	decoder := json.NewDecoder(r)
+	for decoder.More() {
+		record := &Record{}
+		if err := decoder.Decode(record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Recorder writes records as JSON lines to a writer, the values of the
+// RedactLabels are replaced with RedactedValue in the recorded results
+type Recorder struct {
+	w            io.Writer
+	redactLabels map[model.LabelName]struct{}
+	l            sync.Mutex
+}
+
+// NewRecorder returns a Recorder writing to w
+func NewRecorder(w io.Writer, redactLabels []string) *Recorder {
+	r := &Recorder{
+		w:            w,
+		redactLabels: make(map[model.LabelName]struct{}, len(redactLabels)),
+	}
+	for _, l := range redactLabels {
+		r.redactLabels[model.LabelName(l)] = struct{}{}
+	}
+	return r
+}
+
+// redactMetric returns a copy of the metric with the redacted labels replaced
+func (r *Recorder) redactMetric(m model.Metric) model.Metric {
+	ret := make(model.Metric, len(m))
+	for k, v := range m {
+		if _, ok := r.redactLabels[k]; ok {
+			v = RedactedValue
+		}
+		ret[k] = v
+	}
+	return ret
+}
+
+// redact returns a copy of the result with the redacted labels replaced, the
+// result itself is returned to the caller so it must not be modified
+func (r *Recorder) redact(v interface{}) interface{} {
+	if len(r.redactLabels) == 0 {
+		return v
+	}
+	switch vTyped := v.(type) {
+	case model.Vector:
+		ret := make(model.Vector, len(vTyped))
+		for i, sample := range vTyped {
+			ret[i] = &model.Sample{Metric: r.redactMetric(sample.Metric), Value: sample.Value, Timestamp: sample.Timestamp}
+		}
+		return ret
+	case model.Matrix:
+		ret := make(model.Matrix, len(vTyped))
+		for i, stream := range vTyped {
+			ret[i] = &model.SampleStream{Metric: r.redactMetric(stream.Metric), Values: stream.Values}
+		}
+		return ret
+	case []model.LabelSet:
+		ret := make([]model.LabelSet, len(vTyped))
+		for i, lset := range vTyped {
+			ret[i] = model.LabelSet(r.redactMetric(model.Metric(lset)))
+		}
+		return ret
+	}
+	return v
+}
+
+// Record writes the record with the given result and error
+func (r *Recorder) Record(record *Record, v interface{}, err error) error {
+	if err != nil {
+		record.Error = err.Error()
+	} else if v != nil {
+		if value, ok := v.(model.Value); ok {
+			record.ResultType = value.Type().String()
+		}
+		if record.Call == "label_values" {
+			if _, ok := r.redactLabels[model.LabelName(record.Args.Label)]; ok {
+				v = model.LabelValues{RedactedValue}
+			}
+		}
+		b, err := json.Marshal(r.redact(v))
+		if err != nil {
+			return err
+		}
+		record.Result = b
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	r.l.Lock()
+	defer r.l.Unlock()
+	_, err = r.w.Write(append(b, '\n'))
+	return err
+}
+
+// RecordAPI records the LabelNames, LabelValues, Query, QueryRange, Series and
+// GetValue calls (and their responses) to the API with the Recorder, such that
+// they can be replayed (e.g. with promclienttest.ReplayAPI) to debug merging.
+type RecordAPI struct {
+	API
+	Recorder *Recorder
+	// Server is the name of the downstream in the records
+	Server string
+}
+
+func (r *RecordAPI) record(call string, args RecordArgs, v interface{}, w v1.Warnings, err error) {
+	if recordErr := r.Recorder.Record(&Record{Server: r.Server, Call: call, Args: args, Warnings: w}, v, err); recordErr != nil {
+		logrus.Errorf("Error recording %s call to %s: %v", call, r.Server, recordErr)
+	}
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (r *RecordAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	v, w, err := r.API.LabelNames(ctx)
+	r.record("label_names", RecordArgs{}, v, w, err)
+	return v, w, err
+}
+
+// LabelValues performs a query for the values of the given label.
+func (r *RecordAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	v, w, err := r.API.LabelValues(ctx, label, matchers, startTime, endTime)
+	r.record("label_values", RecordArgs{Label: label, Matchers: matchers, Start: startTime.UTC(), End: endTime.UTC()}, v, w, err)
+	return v, w, err
+}
+
+// Query performs a query for the given time.
+func (r *RecordAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	v, w, err := r.API.Query(ctx, query, ts)
+	r.record("query", RecordArgs{Query: query, Time: ts.UTC()}, v, w, err)
+	return v, w, err
+}
+
+// QueryRange performs a query for the given range.
+func (r *RecordAPI) QueryRange(ctx context.Context, query string, rng v1.Range) (model.Value, v1.Warnings, error) {
+	v, w, err := r.API.QueryRange(ctx, query, rng)
+	r.record("query_range", RecordArgs{Query: query, Start: rng.Start.UTC(), End: rng.End.UTC(), Step: rng.Step}, v, w, err)
+	return v, w, err
+}
+
+// Series finds series by label matchers.
+func (r *RecordAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	v, w, err := r.API.Series(ctx, matches, startTime, endTime)
+	r.record("series", RecordArgs{Matchers: matches, Start: startTime.UTC(), End: endTime.UTC()}, v, w, err)
+	return v, w, err
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (r *RecordAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	v, w, err := r.API.GetValue(ctx, start, end, matchers)
+	r.record("get_value", RecordArgs{Matchers: matcherStrings(matchers), Start: start.UTC(), End: end.UTC()}, v, w, err)
+	return v, w, err
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (r *RecordAPI) Key() model.LabelSet {
+	if apiLabels, ok := r.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
+
+// matcherStrings returns the string representation of the matchers
+func matcherStrings(matchers []*labels.Matcher) []string {
+	ret := make([]string, len(matchers))
+	for i, m := range matchers {
+		ret[i] = m.String()
+	}
+	return ret
+}
@@ -13,14 +13,24 @@ import (
 // this is used for testing
 type recoverAPI struct{ API }
 
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (api *recoverAPI) LabelNames(ctx context.Context) (v []string, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.LabelNames(ctx)
+}
+
 // LabelValues performs a query for the values of the given label.
-func (api *recoverAPI) LabelValues(ctx context.Context, label string) (v model.LabelValues, w v1.Warnings, err error) {
+func (api *recoverAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (v model.LabelValues, w v1.Warnings, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = r.(error)
 		}
 	}()
-	return api.API.LabelValues(ctx, label)
+	return api.API.LabelValues(ctx, label, matchers, startTime, endTime)
 }
 
 // Query performs a query for the given time.
@@ -62,3 +72,133 @@ func (api *recoverAPI) GetValue(ctx context.Context, start, end time.Time, match
 	}()
 	return api.API.GetValue(ctx, start, end, matchers)
 }
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (api *recoverAPI) Metadata(ctx context.Context, metric, limit string) (v map[string][]v1.Metadata, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.Metadata(ctx, metric, limit)
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (api *recoverAPI) Targets(ctx context.Context) (v v1.TargetsResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.Targets(ctx)
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (api *recoverAPI) Rules(ctx context.Context) (v v1.RulesResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.Rules(ctx)
+}
+
+// Alerts returns a list of all active alerts.
+func (api *recoverAPI) Alerts(ctx context.Context) (v v1.AlertsResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.Alerts(ctx)
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+func (api *recoverAPI) AlertManagers(ctx context.Context) (v v1.AlertManagersResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.AlertManagers(ctx)
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (api *recoverAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) (v []ExemplarQueryResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.QueryExemplars(ctx, query, startTime, endTime)
+}
+
+// TSDB returns the cardinality statistics of the TSDB.
+func (api *recoverAPI) TSDB(ctx context.Context) (v TSDBResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.TSDB(ctx)
+}
+
+// Buildinfo returns the build information of each server.
+func (api *recoverAPI) Buildinfo(ctx context.Context) (v []BuildinfoResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.Buildinfo(ctx)
+}
+
+// Runtimeinfo returns the runtime information of each server.
+func (api *recoverAPI) Runtimeinfo(ctx context.Context) (v []RuntimeinfoResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.Runtimeinfo(ctx)
+}
+
+// Config returns the configuration of each server.
+func (api *recoverAPI) Config(ctx context.Context) (v []ConfigResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.Config(ctx)
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+func (api *recoverAPI) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) (v []AdminResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.DeleteSeries(ctx, matches, startTime, endTime)
+}
+
+// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+func (api *recoverAPI) CleanTombstones(ctx context.Context) (v []AdminResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.CleanTombstones(ctx)
+}
+
+// Snapshot creates a snapshot of all current data on each server.
+func (api *recoverAPI) Snapshot(ctx context.Context, skipHead bool) (v []AdminResult, w v1.Warnings, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return api.API.Snapshot(ctx, skipHead)
+}
@@ -0,0 +1,142 @@
+package promclient
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// RelabelAPI applies relabel configs to the series returned by the API (the same
+// as prometheus' metric_relabel_configs, but at read time). Series which are
+// dropped are removed from the results. Note that the queries sent to the API
+// are not rewritten, so selectors match the labels as the downstream has them.
+type RelabelAPI struct {
+	API
+	RelabelConfigs []*relabel.Config
+}
+
+// relabelMetric returns the relabeled metric, or nil if the metric was dropped
+func (r *RelabelAPI) relabelMetric(m model.Metric) model.Metric {
+	lbls := make(labels.Labels, 0, len(m))
+	for k, v := range m {
+		lbls = append(lbls, labels.Label{Name: string(k), Value: string(v)})
+	}
+	lbls = relabel.Process(labels.New(lbls...), r.RelabelConfigs...)
+	if lbls == nil {
+		return nil
+	}
+
+	ret := make(model.Metric, len(lbls))
+	for _, l := range lbls {
+		ret[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	return ret
+}
+
+// relabelValue relabels the series in the value, merging any series which
+// end up with the same labels
+func (r *RelabelAPI) relabelValue(v model.Value) (model.Value, error) {
+	switch vTyped := v.(type) {
+	case model.Vector:
+		ret := make(model.Vector, 0, len(vTyped))
+		for _, sample := range vTyped {
+			if sample.Metric = r.relabelMetric(sample.Metric); sample.Metric != nil {
+				ret = append(ret, sample)
+			}
+		}
+		// Merging into an empty value deduplicates the series
+		return promhttputil.MergeValues(0, model.Vector{}, ret)
+
+	case model.Matrix:
+		ret := make(model.Matrix, 0, len(vTyped))
+		for _, stream := range vTyped {
+			if stream.Metric = r.relabelMetric(stream.Metric); stream.Metric != nil {
+				ret = append(ret, stream)
+			}
+		}
+		// Merging into an empty value deduplicates the series
+		return promhttputil.MergeValues(0, model.Matrix{}, ret)
+	}
+	return v, nil
+}
+
+// Query performs a query for the given time.
+func (r *RelabelAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	v, w, err := r.API.Query(ctx, query, ts)
+	if err != nil {
+		return v, w, err
+	}
+	v, err = r.relabelValue(v)
+	return v, w, err
+}
+
+// QueryRange performs a query for the given range.
+func (r *RelabelAPI) QueryRange(ctx context.Context, query string, rng v1.Range) (model.Value, v1.Warnings, error) {
+	v, w, err := r.API.QueryRange(ctx, query, rng)
+	if err != nil {
+		return v, w, err
+	}
+	v, err = r.relabelValue(v)
+	return v, w, err
+}
+
+// Series finds series by label matchers.
+func (r *RelabelAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	v, w, err := r.API.Series(ctx, matches, startTime, endTime)
+	if err != nil {
+		return v, w, err
+	}
+
+	ret := make([]model.LabelSet, 0, len(v))
+	for _, lset := range v {
+		if m := r.relabelMetric(model.Metric(lset)); m != nil {
+			ret = append(ret, model.LabelSet(m))
+		}
+	}
+	// Merging into an empty list deduplicates the series
+	return MergeLabelSets([]model.LabelSet{}, ret), w, nil
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (r *RelabelAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	v, w, err := r.API.GetValue(ctx, start, end, matchers)
+	if err != nil {
+		return v, w, err
+	}
+	v, err = r.relabelValue(v)
+	return v, w, err
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+// The labels of the series are relabeled as the series returned by the queries are,
+// such that the exemplars remain linked to them.
+func (r *RelabelAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	v, w, err := r.API.QueryExemplars(ctx, query, startTime, endTime)
+	if err != nil {
+		return v, w, err
+	}
+
+	ret := make([]ExemplarQueryResult, 0, len(v))
+	for _, result := range v {
+		if m := r.relabelMetric(model.Metric(result.SeriesLabels)); m != nil {
+			result.SeriesLabels = model.LabelSet(m)
+			ret = append(ret, result)
+		}
+	}
+	// Merging into an empty list merges the exemplars of the series with the same labels
+	return MergeExemplars([]ExemplarQueryResult{}, ret), w, nil
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (r *RelabelAPI) Key() model.LabelSet {
+	if apiLabels, ok := r.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package promclient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/relabel"
+)
+
+func TestRelabelAPI(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{
+				{Metric: model.Metric{"__name__": "up", "kubernetes_namespace": "a"}, Value: 1},
+				{Metric: model.Metric{"__name__": "up", "kubernetes_namespace": "b", "debug": "true"}, Value: 1},
+				{Metric: model.Metric{"__name__": "up", "kubernetes_namespace": "c"}, Value: 1},
+			}
+		},
+		series: func() []model.LabelSet {
+			return []model.LabelSet{
+				{"__name__": "up", "kubernetes_namespace": "a"},
+				{"__name__": "up", "namespace": "a"},
+			}
+		},
+	}
+
+	a := &RelabelAPI{stub, []*relabel.Config{
+		// Rename kubernetes_namespace to namespace
+		{
+			SourceLabels: model.LabelNames{"kubernetes_namespace"},
+			Regex:        relabel.MustNewRegexp("(.+)"),
+			TargetLabel:  "namespace",
+			Replacement:  "$1",
+			Action:       relabel.Replace,
+		},
+		{Regex: relabel.MustNewRegexp("kubernetes_namespace"), Action: relabel.LabelDrop},
+		// Drop debug series
+		{
+			SourceLabels: model.LabelNames{"debug"},
+			Regex:        relabel.MustNewRegexp("true"),
+			Action:       relabel.Drop,
+		},
+	}}
+
+	v, _, err := a.Query(context.TODO(), "up", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := model.Vector{
+		{Metric: model.Metric{"__name__": "up", "namespace": "a"}, Value: 1},
+		{Metric: model.Metric{"__name__": "up", "namespace": "c"}, Value: 1},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch in query result expected=%v actual=%v", expected, v)
+	}
+
+	// Series which end up with the same labels are deduplicated
+	series, _, err := a.Series(context.TODO(), []string{"up"}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedSeries := []model.LabelSet{{"__name__": "up", "namespace": "a"}}
+	if !reflect.DeepEqual(series, expectedSeries) {
+		t.Fatalf("mismatch in series expected=%v actual=%v", expectedSeries, series)
+	}
+}
+
+// ensure the query range results are relabeled as well
+func TestRelabelAPIQueryRange(t *testing.T) {
+	stub := &stubAPI{
+		queryRange: func() model.Value {
+			return model.Matrix{
+				{Metric: model.Metric{"__name__": "up", "env": "prod"}, Values: []model.SamplePair{{Timestamp: 1000, Value: 1}}},
+			}
+		},
+	}
+	a := &RelabelAPI{stub, []*relabel.Config{
+		{
+			SourceLabels: model.LabelNames{"env"},
+			Regex:        relabel.MustNewRegexp("prod"),
+			TargetLabel:  "env",
+			Replacement:  "production",
+			Action:       relabel.Replace,
+		},
+	}}
+
+	v, _, err := a.QueryRange(context.TODO(), "up", v1.Range{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m := v.(model.Matrix)[0].Metric; m["env"] != "production" {
+		t.Fatalf("expected env to be relabeled, got %v", m)
+	}
+}
+
+// ensure the series of exemplars are relabeled as well, such that they match the relabeled series
+func TestRelabelAPIExemplars(t *testing.T) {
+	exemplar := func(traceID model.LabelValue, ts model.Time) Exemplar {
+		return Exemplar{Labels: model.LabelSet{"trace_id": traceID}, Value: 1, Timestamp: ts}
+	}
+	stub := &stubAPI{
+		exemplars: func() []ExemplarQueryResult {
+			return []ExemplarQueryResult{
+				{SeriesLabels: model.LabelSet{"__name__": "requests", "kubernetes_namespace": "a"}, Exemplars: []Exemplar{exemplar("1", 20)}},
+				{SeriesLabels: model.LabelSet{"__name__": "requests", "namespace": "a"}, Exemplars: []Exemplar{exemplar("2", 10)}},
+				{SeriesLabels: model.LabelSet{"__name__": "requests", "debug": "true"}, Exemplars: []Exemplar{exemplar("3", 10)}},
+			}
+		},
+	}
+	a := &RelabelAPI{stub, []*relabel.Config{
+		{
+			SourceLabels: model.LabelNames{"kubernetes_namespace"},
+			Regex:        relabel.MustNewRegexp("(.+)"),
+			TargetLabel:  "namespace",
+			Replacement:  "$1",
+			Action:       relabel.Replace,
+		},
+		{Regex: relabel.MustNewRegexp("kubernetes_namespace"), Action: relabel.LabelDrop},
+		{
+			SourceLabels: model.LabelNames{"debug"},
+			Regex:        relabel.MustNewRegexp("true"),
+			Action:       relabel.Drop,
+		},
+	}}
+
+	v, _, err := a.QueryExemplars(context.TODO(), "requests", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The exemplars of the series which end up with the same labels are merged
+	expected := []ExemplarQueryResult{
+		{SeriesLabels: model.LabelSet{"__name__": "requests", "namespace": "a"}, Exemplars: []Exemplar{exemplar("2", 10), exemplar("1", 20)}},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch expected=%v actual=%v", expected, v)
+	}
+}
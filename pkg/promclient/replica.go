@@ -0,0 +1,148 @@
+package promclient
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ReplicaLabelAPI drops the replica labels (e.g. `replica`) from the series returned
+// by the API, such that the series of HA replicas which only differ by them are merged.
+// The external labels of the downstream are loaded from its config (every SyncInterval)
+// and only the replica labels which are external labels are dropped, such that series
+// with a label of the same name are returned as-is. Until the external labels are
+// loaded (or if they can't be) all of the replica labels are dropped.
+type ReplicaLabelAPI struct {
+	API
+	ReplicaLabels []string
+	SyncInterval  time.Duration
+
+	l              sync.Mutex
+	externalLabels model.LabelSet
+	lastSync       time.Time
+	syncing        bool
+}
+
+// external returns the loaded external labels (nil if not loaded), starting a sync
+// in the background if they are out of date
+func (r *ReplicaLabelAPI) external() model.LabelSet {
+	r.l.Lock()
+	defer r.l.Unlock()
+	if !r.syncing && time.Since(r.lastSync) >= r.SyncInterval {
+		r.syncing = true
+		go r.sync()
+	}
+	return r.externalLabels
+}
+
+// sync loads the external labels from the config of the API
+func (r *ReplicaLabelAPI) sync() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var externalLabels model.LabelSet
+	configs, _, err := r.API.Config(ctx)
+	if err == nil && len(configs) > 0 {
+		var cfg struct {
+			Global struct {
+				ExternalLabels model.LabelSet `yaml:"external_labels"`
+			} `yaml:"global"`
+		}
+		if err = yaml.Unmarshal([]byte(configs[0].YAML), &cfg); err == nil {
+			externalLabels = cfg.Global.ExternalLabels
+			if externalLabels == nil {
+				externalLabels = model.LabelSet{}
+			}
+		}
+	}
+	if err != nil {
+		logrus.Warnf("Error loading external labels for replica_labels: %v", err)
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	if externalLabels != nil {
+		r.externalLabels = externalLabels
+	}
+	r.lastSync = time.Now()
+	r.syncing = false
+}
+
+// relabelAPI returns a RelabelAPI dropping the replica labels, or nil if there are none to drop
+func (r *ReplicaLabelAPI) relabelAPI() *RelabelAPI {
+	externalLabels := r.external()
+	names := make([]string, 0, len(r.ReplicaLabels))
+	for _, name := range r.ReplicaLabels {
+		if _, ok := externalLabels[model.LabelName(name)]; ok || externalLabels == nil {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	return &RelabelAPI{
+		API: r.API,
+		RelabelConfigs: []*relabel.Config{{
+			Action: relabel.LabelDrop,
+			Regex:  relabel.MustNewRegexp(strings.Join(names, "|")),
+		}},
+	}
+}
+
+// Query performs a query for the given time.
+func (r *ReplicaLabelAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	if relabelAPI := r.relabelAPI(); relabelAPI != nil {
+		return relabelAPI.Query(ctx, query, ts)
+	}
+	return r.API.Query(ctx, query, ts)
+}
+
+// QueryRange performs a query for the given range.
+func (r *ReplicaLabelAPI) QueryRange(ctx context.Context, query string, rng v1.Range) (model.Value, v1.Warnings, error) {
+	if relabelAPI := r.relabelAPI(); relabelAPI != nil {
+		return relabelAPI.QueryRange(ctx, query, rng)
+	}
+	return r.API.QueryRange(ctx, query, rng)
+}
+
+// Series finds series by label matchers.
+func (r *ReplicaLabelAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	if relabelAPI := r.relabelAPI(); relabelAPI != nil {
+		return relabelAPI.Series(ctx, matches, startTime, endTime)
+	}
+	return r.API.Series(ctx, matches, startTime, endTime)
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (r *ReplicaLabelAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	if relabelAPI := r.relabelAPI(); relabelAPI != nil {
+		return relabelAPI.GetValue(ctx, start, end, matchers)
+	}
+	return r.API.GetValue(ctx, start, end, matchers)
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (r *ReplicaLabelAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	if relabelAPI := r.relabelAPI(); relabelAPI != nil {
+		return relabelAPI.QueryExemplars(ctx, query, startTime, endTime)
+	}
+	return r.API.QueryExemplars(ctx, query, startTime, endTime)
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (r *ReplicaLabelAPI) Key() model.LabelSet {
+	if apiLabels, ok := r.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
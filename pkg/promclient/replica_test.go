@@ -0,0 +1,62 @@
+package promclient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestReplicaLabelAPI(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{
+				{Metric: model.Metric{"__name__": "up", "replica": "a", "prometheus_replica": "x"}, Value: 1},
+				{Metric: model.Metric{"__name__": "up", "replica": "b", "prometheus_replica": "x"}, Value: 1},
+			}
+		},
+		exemplars: func() []ExemplarQueryResult {
+			return []ExemplarQueryResult{
+				{SeriesLabels: model.LabelSet{"__name__": "up", "replica": "a"}, Exemplars: []Exemplar{{Value: 1, Timestamp: 10}}},
+			}
+		},
+		config: func() []ConfigResult {
+			return []ConfigResult{{YAML: "global:\n  external_labels:\n    replica: a\n    cluster: prod\n"}}
+		},
+	}
+	a := &ReplicaLabelAPI{API: stub, ReplicaLabels: []string{"replica", "prometheus_replica"}, SyncInterval: time.Hour}
+
+	// Until the external labels are loaded all of the replica labels are dropped
+	a.lastSync = time.Now()
+	v, _, err := a.Query(context.TODO(), "up", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := model.Vector{{Metric: model.Metric{"__name__": "up"}, Value: 1}}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch expected=%v actual=%v", expected, v)
+	}
+
+	// Once loaded only the replica labels which are external labels are dropped
+	a.sync()
+	v, _, err = a.Query(context.TODO(), "up", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = model.Vector{{Metric: model.Metric{"__name__": "up", "prometheus_replica": "x"}, Value: 1}}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch expected=%v actual=%v", expected, v)
+	}
+
+	// The replica labels are dropped from the series of the exemplars as well
+	exemplars, _, err := a.QueryExemplars(context.TODO(), "up", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedExemplars := []ExemplarQueryResult{{SeriesLabels: model.LabelSet{"__name__": "up"}, Exemplars: []Exemplar{{Value: 1, Timestamp: 10}}}}
+	if !reflect.DeepEqual(exemplars, expectedExemplars) {
+		t.Fatalf("mismatch expected=%v actual=%v", expectedExemplars, exemplars)
+	}
+}
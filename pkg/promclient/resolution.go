@@ -0,0 +1,43 @@
+package promclient
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// ResolutionAPI selects the resolution of the data used by range queries to downstreams
+// which keep downsampled data (e.g. Thanos' 5m and 1h resolutions). The coarsest resolution
+// which still has StepFactor samples per step is sent as the max resolution param of the
+// query, such that raw data is only requested for the steps which need it. The param is
+// added to the requests by a ContextArgsClient.
+type ResolutionAPI struct {
+	API
+	// Resolutions are the resolutions of the downsampled data, in ascending order
+	Resolutions []time.Duration
+	// StepFactor is the minimum number of samples per step of the selected resolution
+	StepFactor int
+	// Param is the query param with the max resolution (e.g. max_source_resolution)
+	Param string
+}
+
+// resolution returns the coarsest resolution for the step (0 for the raw data)
+func (r *ResolutionAPI) resolution(step time.Duration) time.Duration {
+	var ret time.Duration
+	for _, res := range r.Resolutions {
+		if res*time.Duration(r.StepFactor) > step {
+			break
+		}
+		ret = res
+	}
+	return ret
+}
+
+// QueryRange performs a query for the given range.
+func (r *ResolutionAPI) QueryRange(ctx context.Context, query string, rng v1.Range) (model.Value, v1.Warnings, error) {
+	res := r.resolution(rng.Step)
+	ctx = WithQueryArgs(ctx, map[string]string{r.Param: model.Duration(res).String()})
+	return r.API.QueryRange(ctx, query, rng)
+}
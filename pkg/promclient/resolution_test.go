@@ -0,0 +1,66 @@
+package promclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+func TestResolutionAPI(t *testing.T) {
+	var resolution string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resolution = r.FormValue("max_source_resolution")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClient(api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &ResolutionAPI{
+		API:         NewPromAPIV1(NewContextArgsClient(client)),
+		Resolutions: []time.Duration{5 * time.Minute, time.Hour},
+		StepFactor:  5,
+		Param:       "max_source_resolution",
+	}
+
+	tests := []struct {
+		step       time.Duration
+		resolution string
+	}{
+		// Short steps need the raw data
+		{step: 15 * time.Second, resolution: "0s"},
+		{step: 20 * time.Minute, resolution: "0s"},
+		{step: 25 * time.Minute, resolution: "5m"},
+		{step: 4 * time.Hour, resolution: "5m"},
+		{step: 5 * time.Hour, resolution: "1h"},
+		{step: 24 * time.Hour, resolution: "1h"},
+	}
+
+	end := time.Now()
+	for _, test := range tests {
+		resolution = ""
+		if _, _, err := a.QueryRange(context.TODO(), "up", v1.Range{Start: end.Add(-30 * 24 * time.Hour), End: end, Step: test.step}); err != nil {
+			t.Fatal(err)
+		}
+		if resolution != test.resolution {
+			t.Fatalf("step %v: expected resolution %s, got %s", test.step, test.resolution, resolution)
+		}
+	}
+
+	// Other requests use the default resolution of the downstream
+	resolution = ""
+	if _, _, err := a.Query(context.TODO(), "up", end); err != nil {
+		t.Fatal(err)
+	}
+	if resolution != "" {
+		t.Fatalf("unexpected resolution of the instant query: %s", resolution)
+	}
+}
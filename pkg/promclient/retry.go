@@ -0,0 +1,159 @@
+package promclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// IsRetryableError returns whether the given error is likely transient such
+// that retrying the request may succeed (e.g. 5xx or connection errors)
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *v1.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Type == v1.ErrServer
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// Other transport errors (e.g. TLS or DNS errors) won't go away on a retry, only timeouts may
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// RetryAPI retries calls to the API which fail with a retryable error
+type RetryAPI struct {
+	API
+	// Retries is the maximum number of retries for a single call
+	Retries int
+	// Backoff is how long to wait before the first retry, this is doubled for each subsequent retry
+	Backoff time.Duration
+	// MaxBackoff, if non-zero, caps the time waited between retries
+	MaxBackoff time.Duration
+	// Retryable determines if an error is retryable, defaults to IsRetryableError
+	Retryable func(error) bool
+}
+
+// retry calls f until it succeeds, returns a non-retryable error or we run out of retries
+func (r *RetryAPI) retry(ctx context.Context, f func() error) error {
+	retryable := r.Retryable
+	if retryable == nil {
+		retryable = IsRetryableError
+	}
+
+	backoff := r.Backoff
+	for i := 0; ; i++ {
+		err := f()
+		if err == nil || i >= r.Retries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if r.MaxBackoff > 0 && backoff > r.MaxBackoff {
+			backoff = r.MaxBackoff
+		}
+	}
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (r *RetryAPI) LabelNames(ctx context.Context) (v []string, w v1.Warnings, err error) {
+	err = r.retry(ctx, func() error {
+		v, w, err = r.API.LabelNames(ctx)
+		return err
+	})
+	return v, w, err
+}
+
+// LabelValues performs a query for the values of the given label.
+func (r *RetryAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (v model.LabelValues, w v1.Warnings, err error) {
+	err = r.retry(ctx, func() error {
+		v, w, err = r.API.LabelValues(ctx, label, matchers, startTime, endTime)
+		return err
+	})
+	return v, w, err
+}
+
+// Query performs a query for the given time.
+func (r *RetryAPI) Query(ctx context.Context, query string, ts time.Time) (v model.Value, w v1.Warnings, err error) {
+	err = r.retry(ctx, func() error {
+		v, w, err = r.API.Query(ctx, query, ts)
+		return err
+	})
+	return v, w, err
+}
+
+// QueryRange performs a query for the given range.
+func (r *RetryAPI) QueryRange(ctx context.Context, query string, rng v1.Range) (v model.Value, w v1.Warnings, err error) {
+	err = r.retry(ctx, func() error {
+		v, w, err = r.API.QueryRange(ctx, query, rng)
+		return err
+	})
+	return v, w, err
+}
+
+// Series finds series by label matchers.
+func (r *RetryAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) (v []model.LabelSet, w v1.Warnings, err error) {
+	err = r.retry(ctx, func() error {
+		v, w, err = r.API.Series(ctx, matches, startTime, endTime)
+		return err
+	})
+	return v, w, err
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (r *RetryAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (v model.Value, w v1.Warnings, err error) {
+	err = r.retry(ctx, func() error {
+		v, w, err = r.API.GetValue(ctx, start, end, matchers)
+		return err
+	})
+	return v, w, err
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (r *RetryAPI) Metadata(ctx context.Context, metric, limit string) (v map[string][]v1.Metadata, w v1.Warnings, err error) {
+	err = r.retry(ctx, func() error {
+		v, w, err = r.API.Metadata(ctx, metric, limit)
+		return err
+	})
+	return v, w, err
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (r *RetryAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) (v []ExemplarQueryResult, w v1.Warnings, err error) {
+	err = r.retry(ctx, func() error {
+		v, w, err = r.API.QueryExemplars(ctx, query, startTime, endTime)
+		return err
+	})
+	return v, w, err
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (r *RetryAPI) Key() model.LabelSet {
+	if apiLabels, ok := r.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// flakyAPI returns the given errors (in order) before succeeding
+type flakyAPI struct {
+	API
+	errs  []error
+	calls int
+}
+
+func (f *flakyAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	f.calls++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return nil, nil, err
+	}
+	return f.API.Query(ctx, query, ts)
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{&v1.Error{Type: v1.ErrServer}, true},
+		{&v1.Error{Type: v1.ErrClient}, false},
+		{&v1.Error{Type: v1.ErrBadData}, false},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{&url.Error{Op: "Post", URL: "http://localhost:9090", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, true},
+		{&url.Error{Op: "Post", URL: "http://localhost:9090", Err: &net.DNSError{IsTimeout: true}}, true},
+		{&url.Error{Op: "Post", URL: "http://localhost:9090", Err: &net.DNSError{IsNotFound: true}}, false},
+		{&url.Error{Op: "Post", URL: "http://localhost:9090", Err: fmt.Errorf("x509: certificate signed by unknown authority")}, false},
+		{fmt.Errorf("some error"), false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if retryable := IsRetryableError(test.err); retryable != test.retryable {
+				t.Fatalf("expected retryable=%v for %v", test.retryable, test.err)
+			}
+		})
+	}
+}
+
+func TestRetryAPI(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{}
+		},
+	}
+	serverErr := &v1.Error{Type: v1.ErrServer}
+
+	tests := []struct {
+		errs          []error
+		retries       int
+		expectedCalls int
+		err           bool
+	}{
+		// success on first try
+		{retries: 2, expectedCalls: 1},
+		// transient errors are retried
+		{errs: []error{serverErr, serverErr}, retries: 2, expectedCalls: 3},
+		// we give up after the configured retries
+		{errs: []error{serverErr, serverErr, serverErr}, retries: 2, expectedCalls: 3, err: true},
+		// non-retryable errors are returned immediately
+		{errs: []error{&v1.Error{Type: v1.ErrBadData}}, retries: 2, expectedCalls: 1, err: true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			flaky := &flakyAPI{API: stub, errs: test.errs}
+			a := &RetryAPI{API: flaky, Retries: test.retries, Backoff: time.Millisecond}
+			if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); (err != nil) != test.err {
+				t.Fatalf("expected err=%v got %v", test.err, err)
+			}
+			if flaky.calls != test.expectedCalls {
+				t.Fatalf("expected %d calls got %d", test.expectedCalls, flaky.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package promclient
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// MatcherRewriteAPI renames labels in the queries sent to the API, such that a
+// downstream with a different labeling scheme can be queried with the same
+// labels as the rest (e.g. `namespace` -> `kubernetes_namespace`). Label matchers
+// and grouping/matching labels are renamed, the results are returned as-is.
+type MatcherRewriteAPI struct {
+	API
+	// Rewrites maps the label names as queried to the label names of the downstream
+	Rewrites map[string]string
+}
+
+// rewriteName returns the name of the label in the downstream
+func (m *MatcherRewriteAPI) rewriteName(name string) string {
+	if rewritten, ok := m.Rewrites[name]; ok {
+		return rewritten
+	}
+	return name
+}
+
+// rewriteNames renames the given label names
+func (m *MatcherRewriteAPI) rewriteNames(names []string) []string {
+	ret := make([]string, len(names))
+	for i, name := range names {
+		ret[i] = m.rewriteName(name)
+	}
+	return ret
+}
+
+// rewriteMatchers renames the labels of the given matchers
+func (m *MatcherRewriteAPI) rewriteMatchers(matchers []*labels.Matcher) []*labels.Matcher {
+	ret := make([]*labels.Matcher, len(matchers))
+	for i, matcher := range matchers {
+		ret[i] = matcher
+		if name := m.rewriteName(matcher.Name); name != matcher.Name {
+			rewritten := *matcher
+			rewritten.Name = name
+			ret[i] = &rewritten
+		}
+	}
+	return ret
+}
+
+// rewriteQuery renames the labels in the given promql query
+func (m *MatcherRewriteAPI) rewriteQuery(ctx context.Context, query string) (string, error) {
+	e, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = parser.Inspect(ctx, &parser.EvalStmt{Expr: e}, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			n.LabelMatchers = m.rewriteMatchers(n.LabelMatchers)
+		case *parser.AggregateExpr:
+			n.Grouping = m.rewriteNames(n.Grouping)
+		case *parser.BinaryExpr:
+			if n.VectorMatching != nil {
+				n.VectorMatching.MatchingLabels = m.rewriteNames(n.VectorMatching.MatchingLabels)
+				n.VectorMatching.Include = m.rewriteNames(n.VectorMatching.Include)
+			}
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return e.String(), nil
+}
+
+// rewriteSelectors renames the labels in the given series selectors
+func (m *MatcherRewriteAPI) rewriteSelectors(ctx context.Context, selectors []string) ([]string, error) {
+	ret := make([]string, len(selectors))
+	for i, selector := range selectors {
+		rewritten, err := m.rewriteQuery(ctx, selector)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = rewritten
+	}
+	return ret, nil
+}
+
+// LabelValues performs a query for the values of the given label.
+func (m *MatcherRewriteAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	matchers, err := m.rewriteSelectors(ctx, matchers)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.API.LabelValues(ctx, m.rewriteName(label), matchers, startTime, endTime)
+}
+
+// Query performs a query for the given time.
+func (m *MatcherRewriteAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	query, err := m.rewriteQuery(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.API.Query(ctx, query, ts)
+}
+
+// QueryRange performs a query for the given range.
+func (m *MatcherRewriteAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	query, err := m.rewriteQuery(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.API.QueryRange(ctx, query, r)
+}
+
+// Series finds series by label matchers.
+func (m *MatcherRewriteAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	matches, err := m.rewriteSelectors(ctx, matches)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.API.Series(ctx, matches, startTime, endTime)
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (m *MatcherRewriteAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	return m.API.GetValue(ctx, start, end, m.rewriteMatchers(matchers))
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (m *MatcherRewriteAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	query, err := m.rewriteQuery(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.API.QueryExemplars(ctx, query, startTime, endTime)
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+func (m *MatcherRewriteAPI) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error) {
+	matches, err := m.rewriteSelectors(ctx, matches)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.API.DeleteSeries(ctx, matches, startTime, endTime)
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (m *MatcherRewriteAPI) Key() model.LabelSet {
+	if apiLabels, ok := m.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
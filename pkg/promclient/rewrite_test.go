@@ -0,0 +1,107 @@
+package promclient
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// queryRecorderAPI records the queries and matchers sent to it
+type queryRecorderAPI struct {
+	API
+	query    string
+	matches  []string
+	label    string
+	matchers []*labels.Matcher
+}
+
+func (q *queryRecorderAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	q.query = query
+	return nil, nil, nil
+}
+
+func (q *queryRecorderAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	q.label = label
+	q.matches = matchers
+	return nil, nil, nil
+}
+
+func (q *queryRecorderAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	q.matchers = matchers
+	return nil, nil, nil
+}
+
+func TestMatcherRewriteAPIQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			query:    `up{namespace="a"}`,
+			expected: `up{kubernetes_namespace="a"}`,
+		},
+		{
+			query:    `rate(http_requests_total{namespace=~"a|b",job="api"}[5m])`,
+			expected: `rate(http_requests_total{job="api",kubernetes_namespace=~"a|b"}[5m])`,
+		},
+		{
+			query:    `sum by(namespace) (up)`,
+			expected: `sum by(kubernetes_namespace) (up)`,
+		},
+		{
+			query:    `up * on(namespace) group_left(pod) kube_pod_info`,
+			expected: `up * on(kubernetes_namespace) group_left(kubernetes_pod_name) kube_pod_info`,
+		},
+		// Other labels are left alone
+		{
+			query:    `up{job="a"}`,
+			expected: `up{job="a"}`,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			recorder := &queryRecorderAPI{}
+			a := &MatcherRewriteAPI{recorder, map[string]string{
+				"namespace": "kubernetes_namespace",
+				"pod":       "kubernetes_pod_name",
+			}}
+
+			if _, _, err := a.Query(context.TODO(), test.query, time.Now()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if recorder.query != test.expected {
+				t.Fatalf("mismatch in query expected=%s actual=%s", test.expected, recorder.query)
+			}
+		})
+	}
+}
+
+func TestMatcherRewriteAPILabels(t *testing.T) {
+	recorder := &queryRecorderAPI{}
+	a := &MatcherRewriteAPI{recorder, map[string]string{"namespace": "kubernetes_namespace"}}
+
+	if _, _, err := a.LabelValues(context.TODO(), "namespace", []string{`up{namespace!=""}`}, time.Time{}, time.Time{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recorder.label != "kubernetes_namespace" || len(recorder.matches) != 1 || recorder.matches[0] != `up{kubernetes_namespace!=""}` {
+		t.Fatalf("unexpected label values call: %s %v", recorder.label, recorder.matches)
+	}
+
+	matcher := labels.MustNewMatcher(labels.MatchRegexp, "namespace", "a.*")
+	if _, _, err := a.GetValue(context.TODO(), time.Time{}, time.Time{}, []*labels.Matcher{matcher}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m := recorder.matchers[0]; m.Name != "kubernetes_namespace" || !m.Matches("abc") {
+		t.Fatalf("unexpected matcher: %v", m)
+	}
+	// The callers matcher must not be modified
+	if matcher.Name != "namespace" {
+		t.Fatalf("matcher was modified: %v", matcher)
+	}
+}
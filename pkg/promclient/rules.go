@@ -0,0 +1,106 @@
+package promclient
+
+import (
+	"fmt"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// ruleKey returns a key identifying a rule within a rule group
+func ruleKey(rule interface{}) string {
+	switch r := rule.(type) {
+	case v1.AlertingRule:
+		return "alerting|" + r.Name + "|" + r.Query + "|" + r.Labels.String()
+	case v1.RecordingRule:
+		return "recording|" + r.Name + "|" + r.Query + "|" + r.Labels.String()
+	}
+	return fmt.Sprintf("%v", rule)
+}
+
+// alertPointers returns pointers to the alerts
+func alertPointers(alerts []v1.Alert) []*v1.Alert {
+	ret := make([]*v1.Alert, len(alerts))
+	for i := range alerts {
+		ret[i] = &alerts[i]
+	}
+	return ret
+}
+
+// alertValues returns the alerts the pointers point to
+func alertValues(alerts []*v1.Alert) []v1.Alert {
+	ret := make([]v1.Alert, len(alerts))
+	for i, alert := range alerts {
+		ret[i] = *alert
+	}
+	return ret
+}
+
+// MergeAlerts merges the alerts from b into a. Alerts with the same labels
+// (e.g. firing on both HA replicas) are only included once, using the one
+// which has been active the longest.
+func MergeAlerts(a, b []*v1.Alert) []*v1.Alert {
+	alerts := make(map[model.Fingerprint]int, len(a))
+	for i, alert := range a {
+		alerts[alert.Labels.Fingerprint()] = i
+	}
+
+	for _, alert := range b {
+		fp := alert.Labels.Fingerprint()
+		if i, ok := alerts[fp]; ok {
+			if alert.ActiveAt.Before(a[i].ActiveAt) {
+				a[i] = alert
+			}
+			continue
+		}
+		alerts[fp] = len(a)
+		a = append(a, alert)
+	}
+	return a
+}
+
+// mergeRuleGroup merges the rules of group b into a
+func mergeRuleGroup(a, b v1.RuleGroup) v1.RuleGroup {
+	rules := make(map[string]int, len(a.Rules))
+	for i, rule := range a.Rules {
+		rules[ruleKey(rule)] = i
+	}
+
+	for _, rule := range b.Rules {
+		key := ruleKey(rule)
+		i, ok := rules[key]
+		if !ok {
+			rules[key] = len(a.Rules)
+			a.Rules = append(a.Rules, rule)
+			continue
+		}
+
+		// The same alerting rule may have different alerts active on each downstream
+		if bAlerting, ok := rule.(v1.AlertingRule); ok {
+			aAlerting := a.Rules[i].(v1.AlertingRule)
+			aAlerting.Alerts = MergeAlerts(aAlerting.Alerts, bAlerting.Alerts)
+			a.Rules[i] = aAlerting
+		}
+	}
+	return a
+}
+
+// MergeRules merges the rule groups from b into a. Groups with the same name
+// and file (e.g. from HA replicas) are merged into a single group.
+func MergeRules(a, b v1.RulesResult) v1.RulesResult {
+	groups := make(map[string]int, len(a.Groups))
+	for i, group := range a.Groups {
+		groups[group.File+"|"+group.Name] = i
+	}
+
+	for _, group := range b.Groups {
+		key := group.File + "|" + group.Name
+		if i, ok := groups[key]; ok {
+			a.Groups[i] = mergeRuleGroup(a.Groups[i], group)
+			continue
+		}
+		groups[key] = len(a.Groups)
+		a.Groups = append(a.Groups, group)
+	}
+	return a
+}
@@ -0,0 +1,129 @@
+package promclient
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+func TestMergeRules(t *testing.T) {
+	now := time.Now()
+	recording := v1.RecordingRule{Name: "job:up:sum", Query: "sum(up) by (job)"}
+	alertA := &v1.Alert{Labels: model.LabelSet{"alertname": "Down", "job": "a"}, State: v1.AlertStateFiring, ActiveAt: now}
+	alertAEarlier := &v1.Alert{Labels: model.LabelSet{"alertname": "Down", "job": "a"}, State: v1.AlertStateFiring, ActiveAt: now.Add(-time.Minute)}
+	alertB := &v1.Alert{Labels: model.LabelSet{"alertname": "Down", "job": "b"}, State: v1.AlertStatePending, ActiveAt: now}
+	alerting := func(alerts ...*v1.Alert) v1.AlertingRule {
+		return v1.AlertingRule{Name: "Down", Query: "up == 0", Alerts: alerts}
+	}
+
+	tests := []struct {
+		a      v1.RulesResult
+		b      v1.RulesResult
+		merged v1.RulesResult
+	}{
+		// Distinct groups
+		{
+			a: v1.RulesResult{Groups: []v1.RuleGroup{{Name: "a", File: "a.rules", Rules: v1.Rules{recording}}}},
+			b: v1.RulesResult{Groups: []v1.RuleGroup{{Name: "b", File: "b.rules", Rules: v1.Rules{recording}}}},
+			merged: v1.RulesResult{Groups: []v1.RuleGroup{
+				{Name: "a", File: "a.rules", Rules: v1.Rules{recording}},
+				{Name: "b", File: "b.rules", Rules: v1.Rules{recording}},
+			}},
+		},
+		// Same group (e.g. HA replicas), alerts are merged
+		{
+			a: v1.RulesResult{Groups: []v1.RuleGroup{{Name: "a", File: "a.rules", Rules: v1.Rules{recording, alerting(alertA)}}}},
+			b: v1.RulesResult{Groups: []v1.RuleGroup{{Name: "a", File: "a.rules", Rules: v1.Rules{recording, alerting(alertAEarlier, alertB)}}}},
+			merged: v1.RulesResult{Groups: []v1.RuleGroup{
+				{Name: "a", File: "a.rules", Rules: v1.Rules{recording, alerting(alertAEarlier, alertB)}},
+			}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			merged := MergeRules(test.a, test.b)
+
+			if !reflect.DeepEqual(merged, test.merged) {
+				t.Fatalf("doesn't match\nexpected=%v\nactual=%v", test.merged, merged)
+			}
+		})
+	}
+}
+
+func TestAddLabelClientRules(t *testing.T) {
+	client := &AddLabelClient{
+		API: &stubAPI{
+			rules: func() v1.RulesResult {
+				return v1.RulesResult{Groups: []v1.RuleGroup{{
+					Name: "a",
+					Rules: v1.Rules{
+						v1.RecordingRule{Name: "job:up:sum", Labels: model.LabelSet{"a": "b"}},
+						v1.AlertingRule{Name: "Down", Alerts: []*v1.Alert{{Labels: model.LabelSet{"alertname": "Down"}}}},
+					},
+				}}}
+			},
+		},
+		Labels: model.LabelSet{"sg": "1"},
+	}
+
+	rules, _, err := client.Rules(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recording := rules.Groups[0].Rules[0].(v1.RecordingRule)
+	if !recording.Labels.Equal(model.LabelSet{"a": "b", "sg": "1"}) {
+		t.Fatalf("recording rule missing servergroup labels: %v", recording.Labels)
+	}
+	alerting := rules.Groups[0].Rules[1].(v1.AlertingRule)
+	if !alerting.Labels.Equal(model.LabelSet{"sg": "1"}) {
+		t.Fatalf("alerting rule missing servergroup labels: %v", alerting.Labels)
+	}
+	if !alerting.Alerts[0].Labels.Equal(model.LabelSet{"alertname": "Down", "sg": "1"}) {
+		t.Fatalf("alert missing servergroup labels: %v", alerting.Alerts[0].Labels)
+	}
+}
+
+func TestMultiAPIAlerts(t *testing.T) {
+	stub := func(alerts ...v1.Alert) API {
+		return &stubAPI{
+			alerts: func() v1.AlertsResult {
+				return v1.AlertsResult{Alerts: alerts}
+			},
+		}
+	}
+	down := v1.Alert{Labels: model.LabelSet{"alertname": "Down"}, State: v1.AlertStateFiring}
+	high := v1.Alert{Labels: model.LabelSet{"alertname": "HighLatency"}, State: v1.AlertStatePending}
+
+	// HA replicas (same labels) firing the same alerts, and another servergroup
+	api := NewMultiAPI([]API{
+		&AddLabelClient{stub(down, high), model.LabelSet{"sg": "1"}},
+		&AddLabelClient{stub(down, high), model.LabelSet{"sg": "1"}},
+		&AddLabelClient{stub(down), model.LabelSet{"sg": "2"}},
+	}, model.Time(0), nil, 1)
+
+	alerts, _, err := api.Alerts(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []model.LabelSet{
+		{"alertname": "Down", "sg": "1"},
+		{"alertname": "HighLatency", "sg": "1"},
+		{"alertname": "Down", "sg": "2"},
+	}
+	if len(alerts.Alerts) != len(expected) {
+		t.Fatalf("wrong number of alerts expected=%d actual=%d: %v", len(expected), len(alerts.Alerts), alerts.Alerts)
+	}
+	for i, alert := range alerts.Alerts {
+		if !alert.Labels.Equal(expected[i]) {
+			t.Fatalf("mismatch in alert labels expected=%v actual=%v", expected[i], alert.Labels)
+		}
+	}
+}
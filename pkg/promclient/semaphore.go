@@ -0,0 +1,57 @@
+package promclient
+
+import (
+	"context"
+	"time"
+)
+
+// NewSemaphore returns a Semaphore allowing `limit` concurrent holders. The
+// optional queuedFunc is called with +1/-1 as callers start/stop waiting and
+// waitFunc with how long (in seconds) each caller waited.
+func NewSemaphore(limit int, queuedFunc func(delta float64), waitFunc func(took float64)) *Semaphore {
+	return &Semaphore{
+		ch:         make(chan struct{}, limit),
+		queuedFunc: queuedFunc,
+		waitFunc:   waitFunc,
+	}
+}
+
+// Semaphore limits the number of concurrent requests
+type Semaphore struct {
+	ch         chan struct{}
+	queuedFunc func(delta float64)
+	waitFunc   func(took float64)
+}
+
+// Acquire blocks until a slot is available or the context is done
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	// Fast path, no need to queue
+	select {
+	case s.ch <- struct{}{}:
+		if s.waitFunc != nil {
+			s.waitFunc(0)
+		}
+		return nil
+	default:
+	}
+
+	if s.queuedFunc != nil {
+		s.queuedFunc(1)
+		defer s.queuedFunc(-1)
+	}
+	start := time.Now()
+	select {
+	case s.ch <- struct{}{}:
+		if s.waitFunc != nil {
+			s.waitFunc(time.Since(start).Seconds())
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release releases a slot acquired with Acquire
+func (s *Semaphore) Release() {
+	<-s.ch
+}
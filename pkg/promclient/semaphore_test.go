@@ -0,0 +1,81 @@
+package promclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// concurrencyAPI records the max number of concurrent Query calls
+type concurrencyAPI struct {
+	API
+
+	l       sync.Mutex
+	current int
+	max     int
+}
+
+func (c *concurrencyAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	c.l.Lock()
+	c.current++
+	if c.current > c.max {
+		c.max = c.current
+	}
+	c.l.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	c.l.Lock()
+	c.current--
+	c.l.Unlock()
+	return c.API.Query(ctx, query, ts)
+}
+
+func TestMultiAPISemaphore(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{}
+		},
+	}
+	api := &concurrencyAPI{API: stub}
+
+	var queued, maxQueued float64
+	var l sync.Mutex
+	sem := NewSemaphore(2, func(delta float64) {
+		l.Lock()
+		defer l.Unlock()
+		queued += delta
+		if queued > maxQueued {
+			maxQueued = queued
+		}
+	}, nil)
+
+	a := NewMultiAPI([]API{api, api, api, api, api}, model.Time(0), nil, 1, WithSemaphores(sem))
+	if _, _, err := a.Query(context.TODO(), "testmetric", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if api.max > 2 {
+		t.Fatalf("expected at most 2 concurrent requests, got %d", api.max)
+	}
+	if maxQueued == 0 {
+		t.Fatalf("expected requests to be queued")
+	}
+	if queued != 0 {
+		t.Fatalf("expected no requests to be queued after completion, got %v", queued)
+	}
+
+	// If the context is done while waiting we should get an error
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	for i := 0; i < 2; i++ {
+		sem.Acquire(context.TODO())
+	}
+	if err := sem.Acquire(ctx); err == nil {
+		t.Fatalf("missing expected error")
+	}
+}
@@ -0,0 +1,275 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/sirupsen/logrus"
+)
+
+// Results of comparing the response of the shadow API to the primary
+const (
+	ShadowMatch    = "match"
+	ShadowMismatch = "mismatch"
+	ShadowError    = "error"
+)
+
+// ShadowAPI sends the LabelNames, LabelValues, Query, QueryRange, Series and
+// GetValue calls to both the API and a Shadow API. The response of the API is
+// always returned, the response of the Shadow is only compared to it such that
+// e.g. a new downstream can be validated before it is relied upon. The Shadow
+// is called in the background so it doesn't slow down the responses.
+type ShadowAPI struct {
+	API
+	Shadow API
+	// Timeout is the maximum time to wait on the Shadow (0 for no timeout)
+	Timeout time.Duration
+	// ResultFunc (if set) is called with the result of every comparison
+	ResultFunc func(call, result string)
+}
+
+// shadow calls the shadow in the background, once the primary is done `compare`
+// is called with the results of both and returns any difference
+func (s *ShadowAPI) shadow(call string, shadowCall func(ctx context.Context) (interface{}, error)) func(primary interface{}, primaryErr error) {
+	type result struct {
+		v   interface{}
+		err error
+	}
+	resultChan := make(chan result, 1)
+	go func() {
+		// The shadow must not be cancelled when the primary returns
+		ctx := context.Background()
+		if s.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+			defer cancel()
+		}
+		v, err := shadowCall(ctx)
+		resultChan <- result{v, err}
+	}()
+
+	return func(primary interface{}, primaryErr error) {
+		// Callers may modify the result once returned, so we compare a copy
+		primary = copyResult(primary)
+		go func() {
+			shadowResult := <-resultChan
+			var status string
+			switch {
+			case (primaryErr != nil) != (shadowResult.err != nil):
+				status = ShadowError
+				logrus.Warnf("Shadow %s call diverged: primary error=%v shadow error=%v", call, primaryErr, shadowResult.err)
+			case primaryErr != nil:
+				status = ShadowMatch
+			default:
+				if diff := diffResults(primary, shadowResult.v); diff != "" {
+					status = ShadowMismatch
+					logrus.Warnf("Shadow %s call diverged: %s", call, diff)
+				} else {
+					status = ShadowMatch
+				}
+			}
+			if s.ResultFunc != nil {
+				s.ResultFunc(call, status)
+			}
+		}()
+	}
+}
+
+// copyResult returns a copy of the series in the result
+func copyResult(v interface{}) interface{} {
+	switch vTyped := v.(type) {
+	case model.Vector:
+		ret := make(model.Vector, len(vTyped))
+		for i, sample := range vTyped {
+			ret[i] = &model.Sample{Metric: sample.Metric.Clone(), Value: sample.Value, Timestamp: sample.Timestamp}
+		}
+		return ret
+	case model.Matrix:
+		ret := make(model.Matrix, len(vTyped))
+		for i, stream := range vTyped {
+			ret[i] = &model.SampleStream{Metric: stream.Metric.Clone(), Values: append([]model.SamplePair(nil), stream.Values...)}
+		}
+		return ret
+	case []model.LabelSet:
+		ret := make([]model.LabelSet, len(vTyped))
+		for i, lset := range vTyped {
+			ret[i] = lset.Clone()
+		}
+		return ret
+	case []string:
+		return append([]string(nil), vTyped...)
+	case model.LabelValues:
+		return append(model.LabelValues(nil), vTyped...)
+	}
+	return v
+}
+
+// diffResults returns a description of the difference between the results of
+// the primary and shadow, or an empty string if they are the same (regardless
+// of the order of the series)
+func diffResults(primary, shadow interface{}) string {
+	switch primaryTyped := primary.(type) {
+	case model.Vector:
+		shadowTyped, ok := shadow.(model.Vector)
+		if !ok {
+			return fmt.Sprintf("result type %T != %T", primary, shadow)
+		}
+		if len(primaryTyped) != len(shadowTyped) {
+			return fmt.Sprintf("series count %d != %d", len(primaryTyped), len(shadowTyped))
+		}
+		shadowSamples := make(map[model.Fingerprint]*model.Sample, len(shadowTyped))
+		for _, sample := range shadowTyped {
+			shadowSamples[sample.Metric.Fingerprint()] = sample
+		}
+		for _, sample := range primaryTyped {
+			shadowSample, ok := shadowSamples[sample.Metric.Fingerprint()]
+			if !ok {
+				return fmt.Sprintf("series %v missing in shadow", sample.Metric)
+			}
+			if !sample.Equal(shadowSample) {
+				return fmt.Sprintf("series %v value %v != %v", sample.Metric, sample, shadowSample)
+			}
+		}
+
+	case model.Matrix:
+		shadowTyped, ok := shadow.(model.Matrix)
+		if !ok {
+			return fmt.Sprintf("result type %T != %T", primary, shadow)
+		}
+		if len(primaryTyped) != len(shadowTyped) {
+			return fmt.Sprintf("series count %d != %d", len(primaryTyped), len(shadowTyped))
+		}
+		shadowStreams := make(map[model.Fingerprint]*model.SampleStream, len(shadowTyped))
+		for _, stream := range shadowTyped {
+			shadowStreams[stream.Metric.Fingerprint()] = stream
+		}
+		for _, stream := range primaryTyped {
+			shadowStream, ok := shadowStreams[stream.Metric.Fingerprint()]
+			if !ok {
+				return fmt.Sprintf("series %v missing in shadow", stream.Metric)
+			}
+			if len(stream.Values) != len(shadowStream.Values) {
+				return fmt.Sprintf("series %v sample count %d != %d", stream.Metric, len(stream.Values), len(shadowStream.Values))
+			}
+			for i, pair := range stream.Values {
+				if !pair.Equal(&shadowStream.Values[i]) {
+					return fmt.Sprintf("series %v sample %v != %v", stream.Metric, pair, shadowStream.Values[i])
+				}
+			}
+		}
+
+	case []model.LabelSet:
+		shadowTyped, ok := shadow.([]model.LabelSet)
+		if !ok {
+			return fmt.Sprintf("result type %T != %T", primary, shadow)
+		}
+		if len(primaryTyped) != len(shadowTyped) {
+			return fmt.Sprintf("series count %d != %d", len(primaryTyped), len(shadowTyped))
+		}
+		shadowSeries := make(map[model.Fingerprint]struct{}, len(shadowTyped))
+		for _, lset := range shadowTyped {
+			shadowSeries[lset.Fingerprint()] = struct{}{}
+		}
+		for _, lset := range primaryTyped {
+			if _, ok := shadowSeries[lset.Fingerprint()]; !ok {
+				return fmt.Sprintf("series %v missing in shadow", lset)
+			}
+		}
+
+	case []string:
+		shadowTyped, _ := shadow.([]string)
+		shadowTyped = append([]string(nil), shadowTyped...)
+		sort.Strings(primaryTyped)
+		sort.Strings(shadowTyped)
+		if !reflect.DeepEqual(primaryTyped, shadowTyped) && (len(primaryTyped) > 0 || len(shadowTyped) > 0) {
+			return fmt.Sprintf("values %v != %v", primaryTyped, shadowTyped)
+		}
+
+	case model.LabelValues:
+		shadowTyped, _ := shadow.(model.LabelValues)
+		shadowTyped = append(model.LabelValues(nil), shadowTyped...)
+		sort.Sort(primaryTyped)
+		sort.Sort(shadowTyped)
+		if !reflect.DeepEqual(primaryTyped, shadowTyped) && (len(primaryTyped) > 0 || len(shadowTyped) > 0) {
+			return fmt.Sprintf("values %v != %v", primaryTyped, shadowTyped)
+		}
+
+	default:
+		if !reflect.DeepEqual(primary, shadow) {
+			return fmt.Sprintf("result %v != %v", primary, shadow)
+		}
+	}
+	return ""
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (s *ShadowAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	compare := s.shadow("label_names", func(ctx context.Context) (interface{}, error) {
+		v, _, err := s.Shadow.LabelNames(ctx)
+		return v, err
+	})
+	v, w, err := s.API.LabelNames(ctx)
+	compare(v, err)
+	return v, w, err
+}
+
+// LabelValues performs a query for the values of the given label.
+func (s *ShadowAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	compare := s.shadow("label_values", func(ctx context.Context) (interface{}, error) {
+		v, _, err := s.Shadow.LabelValues(ctx, label, matchers, startTime, endTime)
+		return v, err
+	})
+	v, w, err := s.API.LabelValues(ctx, label, matchers, startTime, endTime)
+	compare(v, err)
+	return v, w, err
+}
+
+// Query performs a query for the given time.
+func (s *ShadowAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	compare := s.shadow("query", func(ctx context.Context) (interface{}, error) {
+		v, _, err := s.Shadow.Query(ctx, query, ts)
+		return v, err
+	})
+	v, w, err := s.API.Query(ctx, query, ts)
+	compare(v, err)
+	return v, w, err
+}
+
+// QueryRange performs a query for the given range.
+func (s *ShadowAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	compare := s.shadow("query_range", func(ctx context.Context) (interface{}, error) {
+		v, _, err := s.Shadow.QueryRange(ctx, query, r)
+		return v, err
+	})
+	v, w, err := s.API.QueryRange(ctx, query, r)
+	compare(v, err)
+	return v, w, err
+}
+
+// Series finds series by label matchers.
+func (s *ShadowAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	compare := s.shadow("series", func(ctx context.Context) (interface{}, error) {
+		v, _, err := s.Shadow.Series(ctx, matches, startTime, endTime)
+		return v, err
+	})
+	v, w, err := s.API.Series(ctx, matches, startTime, endTime)
+	compare(v, err)
+	return v, w, err
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (s *ShadowAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	compare := s.shadow("get_value", func(ctx context.Context) (interface{}, error) {
+		v, _, err := s.Shadow.GetValue(ctx, start, end, matchers)
+		return v, err
+	})
+	v, w, err := s.API.GetValue(ctx, start, end, matchers)
+	compare(v, err)
+	return v, w, err
+}
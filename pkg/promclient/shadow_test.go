@@ -0,0 +1,80 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestShadowAPI(t *testing.T) {
+	vector := func(values ...model.SampleValue) func() model.Value {
+		return func() model.Value {
+			ret := make(model.Vector, len(values))
+			for i, v := range values {
+				ret[i] = &model.Sample{Metric: model.Metric{"i": model.LabelValue(strconv.Itoa(i))}, Value: v}
+			}
+			return ret
+		}
+	}
+
+	tests := []struct {
+		primary API
+		shadow  API
+		result  string
+	}{
+		{
+			primary: &stubAPI{query: vector(1, 2)},
+			shadow:  &stubAPI{query: vector(1, 2)},
+			result:  ShadowMatch,
+		},
+		{
+			primary: &stubAPI{query: vector(1, 2)},
+			shadow:  &stubAPI{query: vector(1, 3)},
+			result:  ShadowMismatch,
+		},
+		{
+			primary: &stubAPI{query: vector(1, 2)},
+			shadow:  &stubAPI{query: vector(1)},
+			result:  ShadowMismatch,
+		},
+		{
+			primary: &stubAPI{query: vector(1, 2)},
+			shadow:  &errorAPI{&stubAPI{query: vector(1, 2)}, fmt.Errorf("error")},
+			result:  ShadowError,
+		},
+		// A slow shadow doesn't slow down the primary
+		{
+			primary: &stubAPI{query: vector(1, 2)},
+			shadow:  &slowAPI{&stubAPI{query: vector(1, 2)}, time.Minute},
+			result:  ShadowError,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			results := make(chan string, 1)
+			api := &ShadowAPI{
+				API:     test.primary,
+				Shadow:  test.shadow,
+				Timeout: 10 * time.Millisecond,
+				ResultFunc: func(call, result string) {
+					results <- result
+				},
+			}
+			v, _, err := api.Query(context.TODO(), "testmetric", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The caller modifying the result doesn't affect the comparison
+			v.(model.Vector)[0].Value = 100
+
+			if result := <-results; result != test.result {
+				t.Fatalf("expected %s got %s", test.result, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package promclient
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// shardLabel is the (temporary) label the hashmod of the selectors is computed into
+const shardLabel = "__shard__"
+
+// ShardFilterClient skips the calls to the API, which holds a hashmod shard of the series,
+// whose selectors can only select series of other shards. The shard of a selector is the
+// hashmod of its equality matchers on the SourceLabels (the same as prometheus' hashmod
+// relabeling), selectors without equality matchers on all SourceLabels are always sent.
+type ShardFilterClient struct {
+	API
+	Shard        uint64
+	Modulus      uint64
+	SourceLabels []string
+	// Separator is the separator of the SourceLabels values (";" if unset)
+	Separator string
+}
+
+// matchersMatch returns whether the matchers may select any series of the shard
+func (c *ShardFilterClient) matchersMatch(matchers []*labels.Matcher) bool {
+	lbls := make(labels.Labels, 0, len(c.SourceLabels))
+	sourceLabels := make(model.LabelNames, 0, len(c.SourceLabels))
+	for _, name := range c.SourceLabels {
+		found := false
+		for _, m := range matchers {
+			if m.Name == name && m.Type == labels.MatchEqual {
+				lbls = append(lbls, labels.Label{Name: name, Value: m.Value})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return true
+		}
+		sourceLabels = append(sourceLabels, model.LabelName(name))
+	}
+
+	separator := c.Separator
+	if separator == "" {
+		separator = relabel.DefaultRelabelConfig.Separator
+	}
+	lbls = relabel.Process(labels.New(lbls...), &relabel.Config{
+		SourceLabels: sourceLabels,
+		Separator:    separator,
+		Modulus:      c.Modulus,
+		TargetLabel:  shardLabel,
+		Action:       relabel.HashMod,
+	})
+	return lbls.Get(shardLabel) == strconv.FormatUint(c.Shard, 10)
+}
+
+// queryMatches returns whether any of the selectors in the query may select
+// series of the shard, queries without selectors always match
+func (c *ShardFilterClient) queryMatches(ctx context.Context, query string) (bool, error) {
+	e, err := parser.ParseExpr(query)
+	if err != nil {
+		return false, err
+	}
+
+	// The children of a node may be inspected concurrently
+	var l sync.Mutex
+	hasSelectors := false
+	match := false
+	_, err = parser.Inspect(ctx, &parser.EvalStmt{Expr: e}, func(node parser.Node, _ []parser.Node) error {
+		if n, ok := node.(*parser.VectorSelector); ok {
+			nodeMatch := c.matchersMatch(n.LabelMatchers)
+			l.Lock()
+			hasSelectors = true
+			match = match || nodeMatch
+			l.Unlock()
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	return match || !hasSelectors, nil
+}
+
+// selectorsMatch returns whether any of the series selectors may select series
+// of the shard, no selectors always match
+func (c *ShardFilterClient) selectorsMatch(selectors []string) (bool, error) {
+	if len(selectors) == 0 {
+		return true, nil
+	}
+	for _, selector := range selectors {
+		matchers, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			return false, err
+		}
+		if c.matchersMatch(matchers) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LabelValues performs a query for the values of the given label.
+func (c *ShardFilterClient) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	if match, err := c.selectorsMatch(matchers); err != nil || !match {
+		return nil, nil, err
+	}
+	return c.API.LabelValues(ctx, label, matchers, startTime, endTime)
+}
+
+// Query performs a query for the given time.
+func (c *ShardFilterClient) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	if match, err := c.queryMatches(ctx, query); err != nil || !match {
+		return nil, nil, err
+	}
+	return c.API.Query(ctx, query, ts)
+}
+
+// QueryRange performs a query for the given range.
+func (c *ShardFilterClient) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	if match, err := c.queryMatches(ctx, query); err != nil || !match {
+		return nil, nil, err
+	}
+	return c.API.QueryRange(ctx, query, r)
+}
+
+// Series finds series by label matchers.
+func (c *ShardFilterClient) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	if match, err := c.selectorsMatch(matches); err != nil || !match {
+		return nil, nil, err
+	}
+	return c.API.Series(ctx, matches, startTime, endTime)
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (c *ShardFilterClient) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	if !c.matchersMatch(matchers) {
+		return nil, nil, nil
+	}
+	return c.API.GetValue(ctx, start, end, matchers)
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (c *ShardFilterClient) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	if match, err := c.queryMatches(ctx, query); err != nil || !match {
+		return nil, nil, err
+	}
+	return c.API.QueryExemplars(ctx, query, startTime, endTime)
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (c *ShardFilterClient) Key() model.LabelSet {
+	if apiLabels, ok := c.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
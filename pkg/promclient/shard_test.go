@@ -0,0 +1,114 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+func TestShardFilterClient(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{}
+		},
+		getValue: func() model.Value {
+			return model.Matrix{}
+		},
+	}
+
+	const modulus = 4
+	counters := make([]*countingAPI, modulus)
+	clients := make([]*ShardFilterClient, modulus)
+	for i := range clients {
+		counters[i] = &countingAPI{API: stub}
+		clients[i] = &ShardFilterClient{API: counters[i], Shard: uint64(i), Modulus: modulus, SourceLabels: []string{"instance"}}
+	}
+
+	calls := func() (total int32) {
+		for _, c := range counters {
+			total += c.calls
+			c.calls = 0
+		}
+		return total
+	}
+
+	tests := []struct {
+		query    string
+		min, max int32 // number of shards queried
+	}{
+		// An equality matcher on the source label selects a single shard
+		{query: `up{instance="host:9090"}`, min: 1, max: 1},
+		// Other matchers may select series of any shard
+		{query: `up{instance=~"host.*"}`, min: modulus, max: modulus},
+		{query: `up`, min: modulus, max: modulus},
+		// The selectors may be in the same shard or in two different ones
+		{query: `up{instance="host:9090"} + up{instance="other:9090"}`, min: 1, max: 2},
+		{query: `1`, min: modulus, max: modulus},
+	}
+
+	for _, test := range tests {
+		for _, client := range clients {
+			if _, _, err := client.Query(context.TODO(), test.query, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if actual := calls(); actual < test.min || actual > test.max {
+			t.Fatalf("%s: expected %d-%d shards to be queried, got %d", test.query, test.min, test.max, actual)
+		}
+	}
+
+	// GetValue is only sent to the matching shard
+	matched := 0
+	for _, client := range clients {
+		v, _, err := client.GetValue(context.TODO(), time.Now(), time.Now(), []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "instance", "host:9090")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != nil {
+			matched++
+		}
+	}
+	if matched != 1 {
+		t.Fatalf("expected a single shard to be queried, got %d", matched)
+	}
+}
+
+func TestMultiAPIShards(t *testing.T) {
+	stub := &stubAPI{
+		query: func() model.Value {
+			return model.Vector{}
+		},
+	}
+	shard := func(err error) API {
+		a := &AddLabelClient{stub, model.LabelSet{"replica": "set"}}
+		if err != nil {
+			return &errorAPI{a, err}
+		}
+		return a
+	}
+	failing := fmt.Errorf("error")
+
+	// Replicas of each shard are interchangeable
+	a := NewMultiAPI([]API{shard(nil), shard(failing), shard(nil)}, model.Time(0), nil, 1, WithShards([]int{0, 0, 1}, 2))
+	if _, _, err := a.Query(context.TODO(), "up", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed shard fails the request, even though the apis have the same labels
+	a = NewMultiAPI([]API{shard(nil), shard(failing)}, model.Time(0), nil, 1, WithShards([]int{0, 1}, 2))
+	if _, _, err := a.Query(context.TODO(), "up", time.Now()); err == nil {
+		t.Fatal("expected an error for a failed shard")
+	}
+
+	// A shard without apis fails the request
+	a = NewMultiAPI([]API{shard(nil), shard(nil)}, model.Time(0), nil, 1, WithShards([]int{0, 0}, 2))
+	if _, _, err := a.Query(context.TODO(), "up", time.Now()); err == nil {
+		t.Fatal("expected an error for a missing shard")
+	} else if _, ok := err.(*ShardError); !ok {
+		t.Fatalf("expected a ShardError, got %v", err)
+	}
+}
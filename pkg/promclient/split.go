@@ -0,0 +1,138 @@
+package promclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// SplitRangeAPI splits range queries longer than Interval into sub-ranges aligned to
+// multiples of Interval (e.g. days), which are sent to the API in parallel (at most
+// MaxConcurrency at a time, if set) and stitched back together. This bounds the size
+// of each of the responses and spreads the work of long range queries.
+type SplitRangeAPI struct {
+	API
+	Interval       time.Duration
+	MaxConcurrency int
+}
+
+// splitRange returns the sub-ranges of r, the steps of each sub-range are within the
+// same Interval (the steps of r are kept, such that the sub-ranges don't overlap)
+func (s *SplitRangeAPI) splitRange(r v1.Range) []v1.Range {
+	if s.Interval <= 0 || r.Step <= 0 || !r.End.After(r.Start) {
+		return []v1.Range{r}
+	}
+
+	var ranges []v1.Range
+	for start := r.Start; !start.After(r.End); {
+		boundary := start.Truncate(s.Interval).Add(s.Interval)
+		// The last step before the boundary
+		end := start.Add((boundary.Sub(start) - 1) / r.Step * r.Step)
+		if end.After(r.End) {
+			end = r.End
+		}
+		ranges = append(ranges, v1.Range{Start: start, End: end, Step: r.Step})
+		start = end.Add(r.Step)
+	}
+	return ranges
+}
+
+// QueryRange performs a query for the given range.
+func (s *SplitRangeAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	ranges := s.splitRange(r)
+	if len(ranges) == 1 {
+		return s.API.QueryRange(ctx, query, r)
+	}
+
+	childContext, childContextCancel := context.WithCancel(ctx)
+	defer childContextCancel()
+
+	var sem chan struct{}
+	if s.MaxConcurrency > 0 {
+		sem = make(chan struct{}, s.MaxConcurrency)
+	}
+
+	results := make([]model.Value, len(ranges))
+	warnings := make([]v1.Warnings, len(ranges))
+	errs := make([]error, len(ranges))
+	wg := sync.WaitGroup{}
+	for i, subRange := range ranges {
+		wg.Add(1)
+		go func(i int, subRange v1.Range) {
+			defer wg.Done()
+			if sem != nil {
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+				case <-childContext.Done():
+					errs[i] = childContext.Err()
+					return
+				}
+			}
+			results[i], warnings[i], errs[i] = s.API.QueryRange(childContext, query, subRange)
+			if errs[i] != nil {
+				// If any sub-range fails the query fails, so the others can be cancelled
+				childContextCancel()
+			}
+		}(i, subRange)
+	}
+	wg.Wait()
+
+	warningSet := make(promhttputil.WarningSet)
+	for _, w := range warnings {
+		warningSet.AddWarnings(w)
+	}
+	// The other sub-ranges are cancelled once one fails, so the first error which isn't
+	// a cancellation is the cause (the cancellation may be wrapped, e.g. in a url.Error)
+	var canceledErr error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.Canceled) {
+			return nil, warningSet.Warnings(), err
+		}
+		if canceledErr == nil {
+			canceledErr = err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, warningSet.Warnings(), err
+	}
+	if canceledErr != nil {
+		return nil, warningSet.Warnings(), canceledErr
+	}
+
+	// Stitch the series of the sub-ranges together (in order, as they don't overlap)
+	var ret model.Matrix
+	streams := make(map[model.Fingerprint]*model.SampleStream)
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		matrix, ok := result.(model.Matrix)
+		if !ok {
+			return nil, warningSet.Warnings(), fmt.Errorf("unexpected result type for range query: %v", result.Type())
+		}
+		for _, stream := range matrix {
+			fingerprint := stream.Metric.Fingerprint()
+			if existing, ok := streams[fingerprint]; ok {
+				existing.Values = append(existing.Values, stream.Values...)
+				continue
+			}
+			streams[fingerprint] = stream
+			ret = append(ret, stream)
+		}
+	}
+	if ret == nil {
+		ret = model.Matrix{}
+	}
+	return ret, warningSet.Warnings(), nil
+}
@@ -0,0 +1,98 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// rangeAPI returns a series with a sample at each step of the range
+type rangeAPI struct {
+	API
+	calls int32
+}
+
+func (r *rangeAPI) QueryRange(ctx context.Context, query string, rng v1.Range) (model.Value, v1.Warnings, error) {
+	atomic.AddInt32(&r.calls, 1)
+	stream := &model.SampleStream{Metric: model.Metric{"__name__": "up"}}
+	for ts := rng.Start; !ts.After(rng.End); ts = ts.Add(rng.Step) {
+		stream.Values = append(stream.Values, model.SamplePair{Timestamp: model.TimeFromUnixNano(ts.UnixNano()), Value: 1})
+	}
+	return model.Matrix{stream}, nil, nil
+}
+
+func TestSplitRangeAPI(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		r      v1.Range
+		splits int32
+	}{
+		// Within a single interval the query isn't split
+		{r: v1.Range{Start: start, End: start.Add(time.Hour), Step: time.Minute}, splits: 1},
+		// The sub-ranges are aligned to the interval
+		{r: v1.Range{Start: start, End: start.Add(24 * time.Hour), Step: time.Minute}, splits: 2},
+		{r: v1.Range{Start: start, End: start.Add(72 * time.Hour), Step: 7 * time.Minute}, splits: 4},
+		// Steps on the boundary start the next sub-range
+		{r: v1.Range{Start: start, End: start.Add(12 * time.Hour), Step: time.Hour}, splits: 2},
+	}
+
+	for _, test := range tests {
+		api := &rangeAPI{}
+		s := &SplitRangeAPI{API: api, Interval: 24 * time.Hour, MaxConcurrency: 2}
+		v, _, err := s.QueryRange(context.TODO(), "up", test.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if api.calls != test.splits {
+			t.Fatalf("expected %d sub-ranges, got %d", test.splits, api.calls)
+		}
+
+		// The stitched series has all of the steps of the range, in order
+		expected, _, _ := (&rangeAPI{}).QueryRange(context.TODO(), "up", test.r)
+		if v.String() != expected.String() {
+			t.Fatalf("mismatch expected=%v actual=%v", expected, v)
+		}
+	}
+}
+
+// failingRangeAPI fails the sub-range starting at failAt, the other sub-ranges return
+// the (wrapped) cancellation once they are cancelled
+type failingRangeAPI struct {
+	API
+	failAt time.Time
+	err    error
+}
+
+func (f *failingRangeAPI) QueryRange(ctx context.Context, query string, rng v1.Range) (model.Value, v1.Warnings, error) {
+	if rng.Start.Equal(f.failAt) {
+		return nil, nil, f.err
+	}
+	<-ctx.Done()
+	return nil, nil, &url.Error{Op: "Post", URL: "http://localhost:9090/api/v1/query_range", Err: ctx.Err()}
+}
+
+func TestSplitRangeAPIError(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := v1.Range{Start: start, End: start.Add(72 * time.Hour), Step: time.Hour}
+
+	// The error of the failed sub-range is returned rather than the cancellation of
+	// the sub-ranges before it
+	failErr := fmt.Errorf("sub-range failed")
+	s := &SplitRangeAPI{API: &failingRangeAPI{failAt: start.Add(60 * time.Hour), err: failErr}, Interval: 24 * time.Hour}
+	if _, _, err := s.QueryRange(context.TODO(), "up", r); err != failErr {
+		t.Fatalf("expected the error of the failed sub-range, got %v", err)
+	}
+
+	// A sub-range failing with a cancellation fails the query rather than returning
+	// the query without it
+	s = &SplitRangeAPI{API: &failingRangeAPI{failAt: start.Add(60 * time.Hour), err: context.Canceled}, Interval: 24 * time.Hour}
+	if _, _, err := s.QueryRange(context.TODO(), "up", r); err == nil {
+		t.Fatalf("missing expected error")
+	}
+}
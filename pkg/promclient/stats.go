@@ -0,0 +1,162 @@
+package promclient
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+)
+
+type queryStatsKey struct{}
+
+// WithQueryStats returns a context in which the stats of the downstream requests are collected in s
+func WithQueryStats(ctx context.Context, s *QueryStats) context.Context {
+	return context.WithValue(ctx, queryStatsKey{}, s)
+}
+
+// QueryStatsFromContext returns the QueryStats of the context (nil if there are none)
+func QueryStatsFromContext(ctx context.Context) *QueryStats {
+	s, _ := ctx.Value(queryStatsKey{}).(*QueryStats)
+	return s
+}
+
+// DownstreamStats are the stats of a single request to a downstream
+type DownstreamStats struct {
+	Server string `json:"server"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	// ExecTime is the time (in seconds) promxy waited for the response (so far, if in flight)
+	ExecTime float64 `json:"execTime"`
+	InFlight bool    `json:"inFlight,omitempty"`
+	// Stats are the stats of the query returned by the downstream (if any)
+	Stats json.RawMessage `json:"stats,omitempty"`
+
+	start time.Time
+}
+
+// QueryStats collects the stats of the downstream requests made for a query
+type QueryStats struct {
+	// Param is the value of the stats parameter sent with the downstream queries (e.g. "all"),
+	// if empty the stats of the requests are collected without the downstreams' stats
+	Param string
+
+	l           sync.Mutex
+	downstreams []*DownstreamStats
+}
+
+// Add adds the stats of a downstream request
+func (s *QueryStats) Add(d DownstreamStats) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.downstreams = append(s.downstreams, &d)
+}
+
+// begin adds the in-flight downstream request, it is completed with end
+func (s *QueryStats) begin(d *DownstreamStats) {
+	d.InFlight = true
+	d.start = time.Now()
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.downstreams = append(s.downstreams, d)
+}
+
+// end completes the in-flight downstream request with the stats it returned
+func (s *QueryStats) end(d *DownstreamStats, stats json.RawMessage) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	d.InFlight = false
+	d.ExecTime = time.Since(d.start).Seconds()
+	d.Stats = stats
+}
+
+// Downstreams returns the stats of the downstream requests
+func (s *QueryStats) Downstreams() []DownstreamStats {
+	s.l.Lock()
+	defer s.l.Unlock()
+	ret := make([]DownstreamStats, len(s.downstreams))
+	for i, d := range s.downstreams {
+		ret[i] = *d
+		if d.InFlight {
+			ret[i].ExecTime = time.Since(d.start).Seconds()
+		}
+	}
+	return ret
+}
+
+// NewStatsClient returns a client which records the stats of the requests made with
+// a QueryStats in their context
+func NewStatsClient(client api.Client) *StatsClient {
+	return &StatsClient{client}
+}
+
+// StatsClient wraps the prom API client to record the stats of the requests in the
+// QueryStats of their context. The stats parameter is added to the queries, such that
+// the downstreams return the stats of their execution.
+type StatsClient struct {
+	api.Client
+}
+
+// Do makes the request, recording its stats
+func (c *StatsClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	s := QueryStatsFromContext(ctx)
+	if s == nil {
+		return c.Client.Do(ctx, req)
+	}
+
+	isQuery := strings.HasSuffix(req.URL.Path, "/api/v1/query") || strings.HasSuffix(req.URL.Path, "/api/v1/query_range")
+	if isQuery && s.Param != "" {
+		q := req.URL.Query()
+		q.Set("stats", s.Param)
+		req.URL.RawQuery = q.Encode()
+	}
+
+	d := &DownstreamStats{
+		Server: req.URL.Scheme + "://" + req.URL.Host,
+		Path:   req.URL.Path,
+		Query:  requestQuery(req),
+	}
+	s.begin(d)
+	resp, body, err := c.Client.Do(ctx, req)
+
+	var result struct {
+		Data struct {
+			Stats json.RawMessage `json:"stats"`
+		} `json:"data"`
+	}
+	if isQuery && s.Param != "" && err == nil {
+		json.Unmarshal(body, &result)
+	}
+	s.end(d, result.Data.Stats)
+
+	return resp, body, err
+}
+
+// requestQuery returns the query parameter of the request (from the URL or the form body)
+func requestQuery(req *http.Request) string {
+	if query := req.URL.Query().Get("query"); query != "" {
+		return query
+	}
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return ""
+	}
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return ""
+	}
+	return values.Get("query")
+}
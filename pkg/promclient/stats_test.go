@@ -0,0 +1,54 @@
+package promclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+)
+
+func TestStatsClient(t *testing.T) {
+	var statsParam string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statsParam = r.FormValue("stats")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[],"stats":{"samples":{"totalQueryableSamples":10}}}}`))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClient(api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	promAPI := NewPromAPIV1(NewStatsClient(client))
+
+	// Without QueryStats in the context nothing is recorded
+	if _, _, err := promAPI.Query(context.TODO(), "up", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if statsParam != "" {
+		t.Fatalf("unexpected stats param: %s", statsParam)
+	}
+
+	s := &QueryStats{Param: "all"}
+	if _, _, err := promAPI.Query(WithQueryStats(context.TODO(), s), "up", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if statsParam != "all" {
+		t.Fatalf("unexpected stats param: %s", statsParam)
+	}
+	downstreams := s.Downstreams()
+	if len(downstreams) != 1 {
+		t.Fatalf("unexpected downstream stats: %v", downstreams)
+	}
+	d := downstreams[0]
+	if d.Server != srv.URL || d.Path != "/api/v1/query" || d.Query != "up" {
+		t.Fatalf("unexpected downstream stats: %+v", d)
+	}
+	if string(d.Stats) != `{"samples":{"totalQueryableSamples":10}}` {
+		t.Fatalf("unexpected downstream query stats: %s", d.Stats)
+	}
+}
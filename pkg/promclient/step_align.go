@@ -0,0 +1,38 @@
+package promclient
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// StepAlignAPI aligns the start and end of range queries to multiples of their step,
+// such that the same timestamps are evaluated by range queries over different (e.g.
+// sliding) ranges, which avoids artifacts when the results are compared or cached.
+type StepAlignAPI struct {
+	API
+}
+
+// alignTime returns the time truncated to a multiple of the step (since the epoch)
+func alignTime(t time.Time, step time.Duration) time.Time {
+	ns := t.UnixNano()
+	aligned := ns - ns%int64(step)
+	if ns < 0 && aligned != ns {
+		aligned -= int64(step)
+	}
+	return time.Unix(0, aligned).UTC()
+}
+
+// QueryRange performs a query for the given range.
+func (s *StepAlignAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	if r.Step > 0 {
+		r = v1.Range{
+			Start: alignTime(r.Start, r.Step),
+			End:   alignTime(r.End, r.Step),
+			Step:  r.Step,
+		}
+	}
+	return s.API.QueryRange(ctx, query, r)
+}
@@ -0,0 +1,27 @@
+package promclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+func TestStepAlignAPI(t *testing.T) {
+	a := &StepAlignAPI{API: &rangeAPI{}}
+
+	v, _, err := a.QueryRange(context.TODO(), "up", v1.Range{
+		Start: time.Unix(1005, 0),
+		End:   time.Unix(1295, 0),
+		Step:  time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := v.(model.Matrix)[0].Values
+	if len(values) != 6 || values[0].Timestamp != model.TimeFromUnix(960) || values[5].Timestamp != model.TimeFromUnix(1260) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+}
@@ -0,0 +1,257 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// StorageAPI implements our internal API interface over a local storage (e.g. the
+// TSDB promxy's recording rules are written to), such that its series are merged
+// with the downstreams'. Queries are evaluated locally on the data of the storage.
+// The endpoints without a storage equivalent (metadata, targets, rules, ...)
+// return empty results.
+type StorageAPI struct {
+	Queryable storage.Queryable
+}
+
+// selectSeries calls f with each of the series matching the matchers in the time range
+func (s *StorageAPI) selectSeries(ctx context.Context, start, end time.Time, matchers []*labels.Matcher, f func(storage.Series) error) (v1.Warnings, error) {
+	if start.IsZero() {
+		start = minTime
+	}
+	if end.IsZero() {
+		end = maxTime
+	}
+	mint, maxt := timestamp.FromTime(start), timestamp.FromTime(end)
+	q, err := s.Queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+
+	set := q.Select(false, &storage.SelectHints{Start: mint, End: maxt}, matchers...)
+	for set.Next() {
+		if err := f(set.At()); err != nil {
+			return nil, err
+		}
+	}
+	var warnings v1.Warnings
+	for _, w := range set.Warnings() {
+		warnings = append(warnings, w.Error())
+	}
+	return warnings, set.Err()
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (s *StorageAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	q, err := s.Queryable.Querier(ctx, timestamp.FromTime(minTime), timestamp.FromTime(maxTime))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer q.Close()
+
+	names, warnings, err := q.LabelNames()
+	return names, toV1Warnings(warnings), err
+}
+
+// LabelValues performs a query for the values of the given label.
+func (s *StorageAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	// Without matchers all values are returned (as the storage's LabelValues doesn't take a time range)
+	if len(matchers) == 0 {
+		q, err := s.Queryable.Querier(ctx, timestamp.FromTime(minTime), timestamp.FromTime(maxTime))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer q.Close()
+
+		values, warnings, err := q.LabelValues(label)
+		if err != nil {
+			return nil, toV1Warnings(warnings), err
+		}
+		ret := make(model.LabelValues, len(values))
+		for i, v := range values {
+			ret[i] = model.LabelValue(v)
+		}
+		return ret, toV1Warnings(warnings), nil
+	}
+
+	seen := make(map[string]struct{})
+	var values model.LabelValues
+	var warnings v1.Warnings
+	for _, matcher := range matchers {
+		parsed, err := parser.ParseMetricSelector(matcher)
+		if err != nil {
+			return nil, warnings, err
+		}
+		w, err := s.selectSeries(ctx, startTime, endTime, parsed, func(series storage.Series) error {
+			if v := series.Labels().Get(label); v != "" {
+				if _, ok := seen[v]; !ok {
+					seen[v] = struct{}{}
+					values = append(values, model.LabelValue(v))
+				}
+			}
+			return nil
+		})
+		warnings = append(warnings, w...)
+		if err != nil {
+			return nil, warnings, err
+		}
+	}
+	sort.Sort(values)
+	return values, warnings, nil
+}
+
+// Query performs a query for the given time.
+func (s *StorageAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	q, err := localEngine.NewInstantQuery(s.Queryable, query, ts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return execLocalQuery(ctx, q)
+}
+
+// QueryRange performs a query for the given range.
+func (s *StorageAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	q, err := localEngine.NewRangeQuery(s.Queryable, query, r.Start, r.End, r.Step)
+	if err != nil {
+		return nil, nil, err
+	}
+	return execLocalQuery(ctx, q)
+}
+
+// Series finds series by label matchers.
+func (s *StorageAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	seen := make(map[model.Fingerprint]struct{})
+	var labelSets []model.LabelSet
+	var warnings v1.Warnings
+	for _, match := range matches {
+		matchers, err := parser.ParseMetricSelector(match)
+		if err != nil {
+			return nil, warnings, err
+		}
+		w, err := s.selectSeries(ctx, startTime, endTime, matchers, func(series storage.Series) error {
+			labelSet := model.LabelSet(labelsToMetric(series.Labels()))
+			if _, ok := seen[labelSet.Fingerprint()]; !ok {
+				seen[labelSet.Fingerprint()] = struct{}{}
+				labelSets = append(labelSets, labelSet)
+			}
+			return nil
+		})
+		warnings = append(warnings, w...)
+		if err != nil {
+			return nil, warnings, err
+		}
+	}
+	return labelSets, warnings, nil
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (s *StorageAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	mint, maxt := timestamp.FromTime(start), timestamp.FromTime(end)
+	matrix := model.Matrix{}
+	warnings, err := s.selectSeries(ctx, start, end, matchers, func(series storage.Series) error {
+		var values []model.SamplePair
+		it := series.Iterator()
+		for ok := it.Seek(mint); ok; ok = it.Next() {
+			t, v := it.At()
+			if t > maxt {
+				break
+			}
+			values = append(values, model.SamplePair{Timestamp: model.Time(t), Value: model.SampleValue(v)})
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		if len(values) > 0 {
+			matrix = append(matrix, &model.SampleStream{Metric: labelsToMetric(series.Labels()), Values: values})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, warnings, err
+	}
+	return matrix, warnings, nil
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (s *StorageAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	return map[string][]v1.Metadata{}, nil, nil
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (s *StorageAPI) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	return v1.TargetsResult{}, nil, nil
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (s *StorageAPI) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	return v1.RulesResult{}, nil, nil
+}
+
+// Alerts returns a list of all active alerts.
+func (s *StorageAPI) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	return v1.AlertsResult{}, nil, nil
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+func (s *StorageAPI) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	return v1.AlertManagersResult{}, nil, nil
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (s *StorageAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	return nil, nil, nil
+}
+
+// TSDB returns the cardinality statistics of the TSDB.
+func (s *StorageAPI) TSDB(ctx context.Context) (TSDBResult, v1.Warnings, error) {
+	return TSDBResult{}, nil, nil
+}
+
+// Buildinfo returns the build information of each server.
+func (s *StorageAPI) Buildinfo(ctx context.Context) ([]BuildinfoResult, v1.Warnings, error) {
+	return nil, nil, nil
+}
+
+// Runtimeinfo returns the runtime information of each server.
+func (s *StorageAPI) Runtimeinfo(ctx context.Context) ([]RuntimeinfoResult, v1.Warnings, error) {
+	return nil, nil, nil
+}
+
+// Config returns the configuration of each server.
+func (s *StorageAPI) Config(ctx context.Context) ([]ConfigResult, v1.Warnings, error) {
+	return nil, nil, nil
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+func (s *StorageAPI) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error) {
+	return nil, nil, fmt.Errorf("delete_series not supported by the local storage")
+}
+
+// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+func (s *StorageAPI) CleanTombstones(ctx context.Context) ([]AdminResult, v1.Warnings, error) {
+	return nil, nil, fmt.Errorf("clean_tombstones not supported by the local storage")
+}
+
+// Snapshot creates a snapshot of all current data on each server.
+func (s *StorageAPI) Snapshot(ctx context.Context, skipHead bool) ([]AdminResult, v1.Warnings, error) {
+	return nil, nil, fmt.Errorf("snapshot not supported by the local storage")
+}
+
+// toV1Warnings converts the storage warnings to the API's
+func toV1Warnings(warnings storage.Warnings) v1.Warnings {
+	var ret v1.Warnings
+	for _, w := range warnings {
+		ret = append(ret, w.Error())
+	}
+	return ret
+}
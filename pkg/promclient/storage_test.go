@@ -0,0 +1,80 @@
+package promclient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/util/teststorage"
+)
+
+func TestStorageAPI(t *testing.T) {
+	s := teststorage.New(t)
+	defer s.Close()
+
+	app := s.Appender(context.TODO())
+	for _, lbls := range []labels.Labels{
+		labels.FromStrings("__name__", "job:up:sum", "job", "a"),
+		labels.FromStrings("__name__", "job:up:sum", "job", "b"),
+	} {
+		for ts := int64(0); ts <= 60000; ts += 15000 {
+			if _, err := app.Add(lbls, ts, float64(ts/15000)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &StorageAPI{Queryable: s}
+	ctx := context.TODO()
+
+	v, _, err := a.Query(ctx, `sum(job:up:sum)`, time.Unix(60, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (model.Vector{{Metric: model.Metric{}, Value: 8, Timestamp: 60000}}); !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch expected=%v actual=%v", expected, v)
+	}
+
+	v, _, err = a.QueryRange(ctx, `job:up:sum{job="a"}`, v1.Range{Start: time.Unix(0, 0), End: time.Unix(60, 0), Step: 30 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matrix := v.(model.Matrix); len(matrix) != 1 || len(matrix[0].Values) != 3 {
+		t.Fatalf("unexpected range query result: %v", v)
+	}
+
+	v, _, err = a.GetValue(ctx, time.Unix(15, 0), time.Unix(30, 0), []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := model.Matrix{{
+		Metric: model.Metric{"__name__": "job:up:sum", "job": "b"},
+		Values: []model.SamplePair{{Timestamp: 15000, Value: 1}, {Timestamp: 30000, Value: 2}},
+	}}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch expected=%v actual=%v", expected, v)
+	}
+
+	values, _, err := a.LabelValues(ctx, "job", []string{`{job="a"}`}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, model.LabelValues{"a"}) {
+		t.Fatalf("unexpected label values: %v", values)
+	}
+
+	series, _, err := a.Series(ctx, []string{`job:up:sum`}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 2 {
+		t.Fatalf("unexpected series: %v", series)
+	}
+}
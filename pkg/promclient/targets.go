@@ -0,0 +1,51 @@
+package promclient
+
+import (
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// activeTargetKey returns a key identifying an active target
+func activeTargetKey(t v1.ActiveTarget) string {
+	return t.ScrapeURL + "|" + t.Labels.String()
+}
+
+// droppedTargetKey returns a key identifying a dropped target
+func droppedTargetKey(t v1.DroppedTarget) uint64 {
+	return model.LabelsToSignature(t.DiscoveredLabels)
+}
+
+// MergeTargets merges the targets from b into a. Targets scraped by multiple
+// downstreams (e.g. HA replicas) are only included once, preferring the most
+// recently scraped one.
+func MergeTargets(a, b v1.TargetsResult) v1.TargetsResult {
+	active := make(map[string]int, len(a.Active))
+	for i, t := range a.Active {
+		active[activeTargetKey(t)] = i
+	}
+	for _, t := range b.Active {
+		key := activeTargetKey(t)
+		if i, ok := active[key]; ok {
+			if t.LastScrape.After(a.Active[i].LastScrape) {
+				a.Active[i] = t
+			}
+			continue
+		}
+		active[key] = len(a.Active)
+		a.Active = append(a.Active, t)
+	}
+
+	dropped := make(map[uint64]struct{}, len(a.Dropped))
+	for _, t := range a.Dropped {
+		dropped[droppedTargetKey(t)] = struct{}{}
+	}
+	for _, t := range b.Dropped {
+		key := droppedTargetKey(t)
+		if _, ok := dropped[key]; !ok {
+			dropped[key] = struct{}{}
+			a.Dropped = append(a.Dropped, t)
+		}
+	}
+
+	return a
+}
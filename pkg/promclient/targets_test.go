@@ -0,0 +1,108 @@
+package promclient
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+func TestMergeTargets(t *testing.T) {
+	now := time.Now()
+	targetA := v1.ActiveTarget{
+		Labels:     model.LabelSet{"job": "a"},
+		ScrapeURL:  "http://a/metrics",
+		LastScrape: now.Add(-time.Minute),
+		Health:     v1.HealthBad,
+	}
+	targetARecent := targetA
+	targetARecent.LastScrape = now
+	targetARecent.Health = v1.HealthGood
+	targetB := v1.ActiveTarget{
+		Labels:     model.LabelSet{"job": "b"},
+		ScrapeURL:  "http://b/metrics",
+		LastScrape: now,
+		Health:     v1.HealthGood,
+	}
+	droppedA := v1.DroppedTarget{DiscoveredLabels: map[string]string{"__address__": "a"}}
+	droppedB := v1.DroppedTarget{DiscoveredLabels: map[string]string{"__address__": "b"}}
+
+	tests := []struct {
+		a      v1.TargetsResult
+		b      v1.TargetsResult
+		merged v1.TargetsResult
+	}{
+		// Distinct targets
+		{
+			a:      v1.TargetsResult{Active: []v1.ActiveTarget{targetA}, Dropped: []v1.DroppedTarget{droppedA}},
+			b:      v1.TargetsResult{Active: []v1.ActiveTarget{targetB}, Dropped: []v1.DroppedTarget{droppedB}},
+			merged: v1.TargetsResult{Active: []v1.ActiveTarget{targetA, targetB}, Dropped: []v1.DroppedTarget{droppedA, droppedB}},
+		},
+		// Same targets (e.g. HA replicas), the most recent scrape is used
+		{
+			a:      v1.TargetsResult{Active: []v1.ActiveTarget{targetA}, Dropped: []v1.DroppedTarget{droppedA}},
+			b:      v1.TargetsResult{Active: []v1.ActiveTarget{targetARecent}, Dropped: []v1.DroppedTarget{droppedA}},
+			merged: v1.TargetsResult{Active: []v1.ActiveTarget{targetARecent}, Dropped: []v1.DroppedTarget{droppedA}},
+		},
+		{
+			a:      v1.TargetsResult{Active: []v1.ActiveTarget{targetARecent}},
+			b:      v1.TargetsResult{Active: []v1.ActiveTarget{targetA}},
+			merged: v1.TargetsResult{Active: []v1.ActiveTarget{targetARecent}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			merged := MergeTargets(test.a, test.b)
+
+			if !reflect.DeepEqual(merged, test.merged) {
+				t.Fatalf("doesn't match\nexpected=%v\nactual=%v", test.merged, merged)
+			}
+		})
+	}
+}
+
+func TestMultiAPITargets(t *testing.T) {
+	stub := func(job string) API {
+		return &stubAPI{
+			targets: func() v1.TargetsResult {
+				return v1.TargetsResult{
+					Active: []v1.ActiveTarget{{
+						Labels:    model.LabelSet{"job": model.LabelValue(job)},
+						ScrapeURL: "http://" + job + "/metrics",
+					}},
+				}
+			},
+		}
+	}
+
+	// 2 servergroups, the first one with HA replicas scraping the same target
+	api := NewMultiAPI([]API{
+		&AddLabelClient{stub("a"), model.LabelSet{"sg": "1", "replica": "a"}},
+		&AddLabelClient{stub("a"), model.LabelSet{"sg": "1", "replica": "b"}},
+		&AddLabelClient{stub("b"), model.LabelSet{"sg": "2"}},
+	}, model.Time(0), nil, 1)
+
+	targets, _, err := api.Targets(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []model.LabelSet{
+		{"job": "a", "sg": "1", "replica": "a"},
+		{"job": "a", "sg": "1", "replica": "b"},
+		{"job": "b", "sg": "2"},
+	}
+	if len(targets.Active) != len(expected) {
+		t.Fatalf("wrong number of targets expected=%d actual=%d: %v", len(expected), len(targets.Active), targets.Active)
+	}
+	for i, target := range targets.Active {
+		if !target.Labels.Equal(expected[i]) {
+			t.Fatalf("mismatch in target labels expected=%v actual=%v", expected[i], target.Labels)
+		}
+	}
+}
@@ -0,0 +1,531 @@
+package promclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// localEngine evaluates the queries of the APIs which only serve raw data (e.g. ThanosStoreAPIs)
+var localEngine = promql.NewEngine(promql.EngineOpts{
+	MaxSamples: 50000000,
+	// The timeout of the query is set by the caller's context
+	Timeout: 24 * time.Hour,
+	NoStepSubqueryIntervalFn: func(int64) int64 {
+		return int64(time.Minute / time.Millisecond)
+	},
+})
+
+// NewThanosStoreAPI returns a ThanosStoreAPI for the StoreAPI at the address
+// (host:port), using TLS if tlsConfig is set. The connection is closed when
+// ctx is done (or Close is called).
+func NewThanosStoreAPI(ctx context.Context, address string, tlsConfig *tls.Config) (*ThanosStoreAPI, error) {
+	opts := []grpc.DialOption{
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32)),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	conn, err := grpc.Dial(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	return &ThanosStoreAPI{conn: conn}, nil
+}
+
+// ThanosStoreAPI implements our internal API interface using the gRPC StoreAPI
+// of Thanos components (sidecars, stores, queriers, etc.). The StoreAPI only
+// serves raw data, so queries are evaluated locally on the data of the store.
+// The endpoints without a StoreAPI equivalent (metadata, targets, rules, ...)
+// return empty results.
+type ThanosStoreAPI struct {
+	conn *grpc.ClientConn
+}
+
+// Close closes the connection to the store
+func (t *ThanosStoreAPI) Close() error {
+	return t.conn.Close()
+}
+
+// toThanosMatchers converts the matchers to their StoreAPI equivalent
+func toThanosMatchers(matchers []*labels.Matcher) ([]*thanosLabelMatcher, error) {
+	thanosMatchers := make([]*thanosLabelMatcher, len(matchers))
+	for i, m := range matchers {
+		var matchType int32
+		switch m.Type {
+		case labels.MatchEqual:
+			matchType = thanosMatchEQ
+		case labels.MatchNotEqual:
+			matchType = thanosMatchNEQ
+		case labels.MatchRegexp:
+			matchType = thanosMatchRE
+		case labels.MatchNotRegexp:
+			matchType = thanosMatchNRE
+		default:
+			return nil, fmt.Errorf("unknown matcher type %v", m.Type)
+		}
+		thanosMatchers[i] = &thanosLabelMatcher{Type: matchType, Name: m.Name, Value: m.Value}
+	}
+	return thanosMatchers, nil
+}
+
+// thanosTimeRange returns the time range in milliseconds, zero times are unbounded
+func thanosTimeRange(start, end time.Time) (int64, int64) {
+	if start.IsZero() {
+		start = minTime
+	}
+	if end.IsZero() {
+		end = maxTime
+	}
+	return timestamp.FromTime(start), timestamp.FromTime(end)
+}
+
+// series loads the series (with their raw chunks unless skipChunks is set)
+// matching the matchers in the time range
+func (t *ThanosStoreAPI) series(ctx context.Context, mint, maxt int64, matchers []*labels.Matcher, skipChunks bool) ([]*thanosSeries, v1.Warnings, error) {
+	thanosMatchers, err := toThanosMatchers(matchers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := t.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, thanosStoreSeriesMethod)
+	if err != nil {
+		return nil, nil, err
+	}
+	req := &thanosSeriesRequest{
+		MinTime:                 mint,
+		MaxTime:                 maxt,
+		Matchers:                thanosMatchers,
+		Aggregates:              []int32{thanosAggrRaw},
+		PartialResponseDisabled: true,
+		SkipChunks:              skipChunks,
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, nil, err
+	}
+
+	var series []*thanosSeries
+	var warnings v1.Warnings
+	for {
+		resp := &thanosSeriesResponse{}
+		if err := stream.RecvMsg(resp); err == io.EOF {
+			return series, warnings, nil
+		} else if err != nil {
+			return nil, warnings, err
+		}
+		switch r := resp.Result.(type) {
+		case *thanosSeriesResponseSeries:
+			series = append(series, r.Series)
+		case *thanosSeriesResponseWarning:
+			warnings = append(warnings, r.Warning)
+		}
+	}
+}
+
+// thanosLabels returns the labels of the series
+func thanosLabels(s *thanosSeries) labels.Labels {
+	lbls := make(labels.Labels, len(s.Labels))
+	for i, l := range s.Labels {
+		lbls[i] = labels.Label{Name: l.Name, Value: l.Value}
+	}
+	sort.Sort(lbls)
+	return lbls
+}
+
+// thanosSamples decodes the samples of the series in the time range, the
+// chunks of a series may overlap (e.g. from different blocks) so duplicate
+// timestamps are removed
+func thanosSamples(s *thanosSeries, mint, maxt int64) ([]model.SamplePair, error) {
+	var samples []model.SamplePair
+	for _, chk := range s.Chunks {
+		if chk.Raw == nil || chk.MaxTime < mint || chk.MinTime > maxt {
+			continue
+		}
+		if chk.Raw.Type != thanosChunkXOR {
+			return nil, fmt.Errorf("unsupported chunk encoding %d", chk.Raw.Type)
+		}
+		c, err := chunkenc.FromData(chunkenc.EncXOR, chk.Raw.Data)
+		if err != nil {
+			return nil, err
+		}
+		it := c.Iterator(nil)
+		for it.Next() {
+			ts, v := it.At()
+			if ts >= mint && ts <= maxt {
+				samples = append(samples, model.SamplePair{Timestamp: model.Time(ts), Value: model.SampleValue(v)})
+			}
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Timestamp < samples[j].Timestamp })
+	deduped := samples[:0]
+	for i, sample := range samples {
+		if i == 0 || sample.Timestamp != samples[i-1].Timestamp {
+			deduped = append(deduped, sample)
+		}
+	}
+	return deduped, nil
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (t *ThanosStoreAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	start, end := thanosTimeRange(time.Time{}, time.Time{})
+	resp := &thanosLabelNamesResponse{}
+	req := &thanosLabelNamesRequest{PartialResponseDisabled: true, Start: start, End: end}
+	if err := t.conn.Invoke(ctx, thanosStoreLabelNamesMethod, req, resp); err != nil {
+		return nil, nil, err
+	}
+	return resp.Names, resp.Warnings, nil
+}
+
+// LabelValues performs a query for the values of the given label.
+func (t *ThanosStoreAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	start, end := thanosTimeRange(startTime, endTime)
+	// The StoreAPI only takes a single set of matchers
+	selectors := [][]*thanosLabelMatcher{nil}
+	if len(matchers) > 0 {
+		selectors = selectors[:0]
+		for _, matcher := range matchers {
+			parsed, err := parser.ParseMetricSelector(matcher)
+			if err != nil {
+				return nil, nil, err
+			}
+			thanosMatchers, err := toThanosMatchers(parsed)
+			if err != nil {
+				return nil, nil, err
+			}
+			selectors = append(selectors, thanosMatchers)
+		}
+	}
+
+	seen := make(map[string]struct{})
+	var values model.LabelValues
+	var warnings v1.Warnings
+	for _, selector := range selectors {
+		resp := &thanosLabelValuesResponse{}
+		req := &thanosLabelValuesRequest{Label: label, PartialResponseDisabled: true, Start: start, End: end, Matchers: selector}
+		if err := t.conn.Invoke(ctx, thanosStoreLabelValuesMethod, req, resp); err != nil {
+			return nil, warnings, err
+		}
+		warnings = append(warnings, resp.Warnings...)
+		for _, v := range resp.Values {
+			if _, ok := seen[v]; !ok {
+				seen[v] = struct{}{}
+				values = append(values, model.LabelValue(v))
+			}
+		}
+	}
+	sort.Sort(values)
+	return values, warnings, nil
+}
+
+// Query performs a query for the given time.
+func (t *ThanosStoreAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	q, err := localEngine.NewInstantQuery(&thanosQueryable{api: t}, query, ts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return execLocalQuery(ctx, q)
+}
+
+// QueryRange performs a query for the given range.
+func (t *ThanosStoreAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	q, err := localEngine.NewRangeQuery(&thanosQueryable{api: t}, query, r.Start, r.End, r.Step)
+	if err != nil {
+		return nil, nil, err
+	}
+	return execLocalQuery(ctx, q)
+}
+
+// Series finds series by label matchers.
+func (t *ThanosStoreAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	start, end := thanosTimeRange(startTime, endTime)
+	seen := make(map[model.Fingerprint]struct{})
+	var labelSets []model.LabelSet
+	var warnings v1.Warnings
+	for _, match := range matches {
+		matchers, err := parser.ParseMetricSelector(match)
+		if err != nil {
+			return nil, warnings, err
+		}
+		series, w, err := t.series(ctx, start, end, matchers, true)
+		warnings = append(warnings, w...)
+		if err != nil {
+			return nil, warnings, err
+		}
+		for _, s := range series {
+			labelSet := make(model.LabelSet, len(s.Labels))
+			for _, l := range s.Labels {
+				labelSet[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+			}
+			if _, ok := seen[labelSet.Fingerprint()]; !ok {
+				seen[labelSet.Fingerprint()] = struct{}{}
+				labelSets = append(labelSets, labelSet)
+			}
+		}
+	}
+	return labelSets, warnings, nil
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (t *ThanosStoreAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	mint, maxt := timestamp.FromTime(start), timestamp.FromTime(end)
+	series, warnings, err := t.series(ctx, mint, maxt, matchers, false)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	matrix := make(model.Matrix, 0, len(series))
+	for _, s := range series {
+		samples, err := thanosSamples(s, mint, maxt)
+		if err != nil {
+			return nil, warnings, err
+		}
+		metric := make(model.Metric, len(s.Labels))
+		for _, l := range s.Labels {
+			metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+		}
+		matrix = append(matrix, &model.SampleStream{Metric: metric, Values: samples})
+	}
+	return matrix, warnings, nil
+}
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (t *ThanosStoreAPI) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	return map[string][]v1.Metadata{}, nil, nil
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (t *ThanosStoreAPI) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	return v1.TargetsResult{}, nil, nil
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (t *ThanosStoreAPI) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	return v1.RulesResult{}, nil, nil
+}
+
+// Alerts returns a list of all active alerts.
+func (t *ThanosStoreAPI) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	return v1.AlertsResult{}, nil, nil
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+func (t *ThanosStoreAPI) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	return v1.AlertManagersResult{}, nil, nil
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (t *ThanosStoreAPI) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	return nil, nil, nil
+}
+
+// TSDB returns the cardinality statistics of the TSDB.
+func (t *ThanosStoreAPI) TSDB(ctx context.Context) (TSDBResult, v1.Warnings, error) {
+	return TSDBResult{}, nil, nil
+}
+
+// Buildinfo returns the build information of each server.
+func (t *ThanosStoreAPI) Buildinfo(ctx context.Context) ([]BuildinfoResult, v1.Warnings, error) {
+	return nil, nil, nil
+}
+
+// Runtimeinfo returns the runtime information of each server.
+func (t *ThanosStoreAPI) Runtimeinfo(ctx context.Context) ([]RuntimeinfoResult, v1.Warnings, error) {
+	return nil, nil, nil
+}
+
+// Config returns the configuration of each server.
+func (t *ThanosStoreAPI) Config(ctx context.Context) ([]ConfigResult, v1.Warnings, error) {
+	return nil, nil, nil
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+func (t *ThanosStoreAPI) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]AdminResult, v1.Warnings, error) {
+	return nil, nil, fmt.Errorf("delete_series not supported by the Thanos StoreAPI")
+}
+
+// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+func (t *ThanosStoreAPI) CleanTombstones(ctx context.Context) ([]AdminResult, v1.Warnings, error) {
+	return nil, nil, fmt.Errorf("clean_tombstones not supported by the Thanos StoreAPI")
+}
+
+// Snapshot creates a snapshot of all current data on each server.
+func (t *ThanosStoreAPI) Snapshot(ctx context.Context, skipHead bool) ([]AdminResult, v1.Warnings, error) {
+	return nil, nil, fmt.Errorf("snapshot not supported by the Thanos StoreAPI")
+}
+
+// execLocalQuery executes the query, converting the result to the model types
+func execLocalQuery(ctx context.Context, q promql.Query) (model.Value, v1.Warnings, error) {
+	defer q.Close()
+	res := q.Exec(ctx)
+	var warnings v1.Warnings
+	for _, w := range res.Warnings {
+		warnings = append(warnings, w.Error())
+	}
+	if res.Err != nil {
+		return nil, warnings, res.Err
+	}
+
+	switch v := res.Value.(type) {
+	case promql.Vector:
+		vector := make(model.Vector, len(v))
+		for i, s := range v {
+			vector[i] = &model.Sample{Metric: labelsToMetric(s.Metric), Value: model.SampleValue(s.V), Timestamp: model.Time(s.T)}
+		}
+		return vector, warnings, nil
+	case promql.Matrix:
+		matrix := make(model.Matrix, len(v))
+		for i, s := range v {
+			values := make([]model.SamplePair, len(s.Points))
+			for j, p := range s.Points {
+				values[j] = model.SamplePair{Timestamp: model.Time(p.T), Value: model.SampleValue(p.V)}
+			}
+			matrix[i] = &model.SampleStream{Metric: labelsToMetric(s.Metric), Values: values}
+		}
+		return matrix, warnings, nil
+	case promql.Scalar:
+		return &model.Scalar{Value: model.SampleValue(v.V), Timestamp: model.Time(v.T)}, warnings, nil
+	case promql.String:
+		return &model.String{Value: v.V, Timestamp: model.Time(v.T)}, warnings, nil
+	}
+	return nil, warnings, fmt.Errorf("unknown result type %T", res.Value)
+}
+
+// labelsToMetric converts the labels to a model.Metric
+func labelsToMetric(lbls labels.Labels) model.Metric {
+	metric := make(model.Metric, len(lbls))
+	for _, l := range lbls {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	return metric
+}
+
+// thanosQueryable is the storage the queries to a ThanosStoreAPI are evaluated on
+type thanosQueryable struct {
+	api *ThanosStoreAPI
+}
+
+func (q *thanosQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	return &thanosQuerier{api: q.api, ctx: ctx, mint: mint, maxt: maxt}, nil
+}
+
+type thanosQuerier struct {
+	api        *ThanosStoreAPI
+	ctx        context.Context
+	mint, maxt int64
+}
+
+// Select returns the series of the store matching the matchers
+func (q *thanosQuerier) Select(sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	mint, maxt := q.mint, q.maxt
+	if hints != nil {
+		mint, maxt = hints.Start, hints.End
+	}
+
+	series, warnings, err := q.api.series(q.ctx, mint, maxt, matchers, false)
+	set := &thanosSeriesSet{i: -1, err: err, warnings: toStorageWarnings(warnings)}
+	if err != nil {
+		return set
+	}
+
+	for _, s := range series {
+		samples, err := thanosSamples(s, mint, maxt)
+		if err != nil {
+			set.err = err
+			return set
+		}
+		tsdbSamples := make([]tsdbutil.Sample, len(samples))
+		for i, sample := range samples {
+			tsdbSamples[i] = thanosSample(sample)
+		}
+		set.series = append(set.series, storage.NewListSeries(thanosLabels(s), tsdbSamples))
+	}
+	if sortSeries {
+		sort.Slice(set.series, func(i, j int) bool {
+			return labels.Compare(set.series[i].Labels(), set.series[j].Labels()) < 0
+		})
+	}
+	return set
+}
+
+func (q *thanosQuerier) LabelValues(name string) ([]string, storage.Warnings, error) {
+	values, warnings, err := q.api.LabelValues(q.ctx, name, nil, timestamp.Time(q.mint), timestamp.Time(q.maxt))
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = string(v)
+	}
+	return strs, toStorageWarnings(warnings), err
+}
+
+func (q *thanosQuerier) LabelNames() ([]string, storage.Warnings, error) {
+	names, warnings, err := q.api.LabelNames(q.ctx)
+	return names, toStorageWarnings(warnings), err
+}
+
+func (q *thanosQuerier) Close() error { return nil }
+
+// toStorageWarnings converts the API warnings to storage warnings
+func toStorageWarnings(warnings v1.Warnings) storage.Warnings {
+	var storageWarnings storage.Warnings
+	for _, w := range warnings {
+		storageWarnings = append(storageWarnings, fmt.Errorf("%s", w))
+	}
+	return storageWarnings
+}
+
+// thanosSample implements tsdbutil.Sample
+type thanosSample model.SamplePair
+
+func (s thanosSample) T() int64   { return int64(s.Timestamp) }
+func (s thanosSample) V() float64 { return float64(s.Value) }
+
+type thanosSeriesSet struct {
+	series   []storage.Series
+	i        int
+	err      error
+	warnings storage.Warnings
+}
+
+func (s *thanosSeriesSet) Next() bool {
+	if s.err != nil || s.i+1 >= len(s.series) {
+		return false
+	}
+	s.i++
+	return true
+}
+
+func (s *thanosSeriesSet) At() storage.Series         { return s.series[s.i] }
+func (s *thanosSeriesSet) Err() error                 { return s.err }
+func (s *thanosSeriesSet) Warnings() storage.Warnings { return s.warnings }
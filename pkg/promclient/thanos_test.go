@@ -0,0 +1,181 @@
+package promclient
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"google.golang.org/grpc"
+)
+
+// stubThanosStore serves the given series over the StoreAPI
+type stubThanosStore struct {
+	series []*thanosSeries
+	values []string
+	// matchers are the matchers of the last Series request
+	matchers []*thanosLabelMatcher
+}
+
+// serve starts serving the store, returning a client to it and a func to stop it
+func (s *stubThanosStore) serve(t *testing.T) (*ThanosStoreAPI, func()) {
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "thanos.Store",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "LabelValues",
+				Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+					req := &thanosLabelValuesRequest{}
+					if err := dec(req); err != nil {
+						return nil, err
+					}
+					return &thanosLabelValuesResponse{Values: s.values}, nil
+				},
+			},
+		},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "Series",
+				ServerStreams: true,
+				Handler: func(_ interface{}, stream grpc.ServerStream) error {
+					req := &thanosSeriesRequest{}
+					if err := stream.RecvMsg(req); err != nil {
+						return err
+					}
+					s.matchers = req.Matchers
+					if err := stream.SendMsg(&thanosSeriesResponse{Result: &thanosSeriesResponseWarning{Warning: "partial data"}}); err != nil {
+						return err
+					}
+					for _, series := range s.series {
+						if req.SkipChunks {
+							series = &thanosSeries{Labels: series.Labels}
+						}
+						if err := stream.SendMsg(&thanosSeriesResponse{Result: &thanosSeriesResponseSeries{Series: series}}); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+		},
+	}, nil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	api, err := NewThanosStoreAPI(ctx, l.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api, func() {
+		cancel()
+		srv.Stop()
+	}
+}
+
+// thanosXORChunk encodes the samples (timestamp, value pairs) as a raw chunk
+func thanosXORChunk(t *testing.T, samples ...int64) *thanosAggrChunk {
+	c := chunkenc.NewXORChunk()
+	app, err := c.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(samples); i += 2 {
+		app.Append(samples[i], float64(samples[i+1]))
+	}
+	return &thanosAggrChunk{
+		MinTime: samples[0],
+		MaxTime: samples[len(samples)-2],
+		Raw:     &thanosChunk{Type: thanosChunkXOR, Data: c.Bytes()},
+	}
+}
+
+func TestThanosStoreAPI(t *testing.T) {
+	store := &stubThanosStore{
+		series: []*thanosSeries{
+			{
+				Labels: []*thanosLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}},
+				// Overlapping chunks (e.g. from different blocks)
+				Chunks: []*thanosAggrChunk{
+					thanosXORChunk(t, 1000, 1, 2000, 1, 3000, 1),
+					thanosXORChunk(t, 3000, 1, 4000, 0),
+				},
+			},
+			{
+				Labels: []*thanosLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "b"}},
+				Chunks: []*thanosAggrChunk{thanosXORChunk(t, 1000, 1, 4000, 1)},
+			},
+		},
+		values: []string{"b", "a"},
+	}
+	api, stop := store.serve(t)
+	defer stop()
+	ctx := context.TODO()
+
+	value, warnings, err := api.GetValue(ctx, time.Unix(2, 0), time.Unix(4, 0), []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, "__name__", "up"),
+		labels.MustNewMatcher(labels.MatchRegexp, "job", "a"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(warnings, v1.Warnings{"partial data"}) {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+	expectedMatchers := []*thanosLabelMatcher{
+		{Type: thanosMatchEQ, Name: "__name__", Value: "up"},
+		{Type: thanosMatchRE, Name: "job", Value: "a"},
+	}
+	if !reflect.DeepEqual(store.matchers, expectedMatchers) {
+		t.Fatalf("mismatch in matchers expected=%v actual=%v", expectedMatchers, store.matchers)
+	}
+	expected := model.Matrix{
+		{
+			Metric: model.Metric{"__name__": "up", "job": "a"},
+			Values: []model.SamplePair{{Timestamp: 2000, Value: 1}, {Timestamp: 3000, Value: 1}, {Timestamp: 4000, Value: 0}},
+		},
+		{
+			Metric: model.Metric{"__name__": "up", "job": "b"},
+			Values: []model.SamplePair{{Timestamp: 4000, Value: 1}},
+		},
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Fatalf("mismatch in GetValue expected=%v actual=%v", expected, value)
+	}
+
+	// Queries are evaluated on the raw data of the store
+	value, _, err = api.Query(ctx, "sum(up)", time.Unix(4, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vector, ok := value.(model.Vector); !ok || len(vector) != 1 || vector[0].Value != 1 {
+		t.Fatalf("unexpected query result: %v", value)
+	}
+
+	series, _, err := api.Series(ctx, []string{"up", `{job="b"}`}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 2 {
+		t.Fatalf("expected 2 series, got %v", series)
+	}
+
+	values, _, err := api.LabelValues(ctx, "job", nil, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, model.LabelValues{"a", "b"}) {
+		t.Fatalf("unexpected label values: %v", values)
+	}
+}
@@ -0,0 +1,161 @@
+package promclient
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// The messages of the Thanos StoreAPI (thanos.Store in thanos/pkg/store/storepb/rpc.proto),
+// only the fields used by promxy are defined (unknown fields are skipped when decoding)
+
+const (
+	thanosStoreSeriesMethod      = "/thanos.Store/Series"
+	thanosStoreLabelNamesMethod  = "/thanos.Store/LabelNames"
+	thanosStoreLabelValuesMethod = "/thanos.Store/LabelValues"
+)
+
+// Values of thanosLabelMatcher.Type
+const (
+	thanosMatchEQ  int32 = 0
+	thanosMatchNEQ int32 = 1
+	thanosMatchRE  int32 = 2
+	thanosMatchNRE int32 = 3
+)
+
+// thanosAggrRaw is the raw (not downsampled) data in thanosSeriesRequest.Aggregates
+const thanosAggrRaw int32 = 0
+
+// thanosChunkXOR is the (prometheus XOR) encoding of thanosChunk.Type
+const thanosChunkXOR int32 = 0
+
+type thanosLabel struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *thanosLabel) Reset()         { *m = thanosLabel{} }
+func (m *thanosLabel) String() string { return proto.CompactTextString(m) }
+func (*thanosLabel) ProtoMessage()    {}
+
+type thanosLabelMatcher struct {
+	Type  int32  `protobuf:"varint,1,opt,name=type,proto3"`
+	Name  string `protobuf:"bytes,2,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,3,opt,name=value,proto3"`
+}
+
+func (m *thanosLabelMatcher) Reset()         { *m = thanosLabelMatcher{} }
+func (m *thanosLabelMatcher) String() string { return proto.CompactTextString(m) }
+func (*thanosLabelMatcher) ProtoMessage()    {}
+
+type thanosSeriesRequest struct {
+	MinTime                 int64                 `protobuf:"varint,1,opt,name=min_time,json=minTime,proto3"`
+	MaxTime                 int64                 `protobuf:"varint,2,opt,name=max_time,json=maxTime,proto3"`
+	Matchers                []*thanosLabelMatcher `protobuf:"bytes,3,rep,name=matchers,proto3"`
+	MaxResolutionWindow     int64                 `protobuf:"varint,4,opt,name=max_resolution_window,json=maxResolutionWindow,proto3"`
+	Aggregates              []int32               `protobuf:"varint,5,rep,packed,name=aggregates,proto3"`
+	PartialResponseDisabled bool                  `protobuf:"varint,6,opt,name=partial_response_disabled,json=partialResponseDisabled,proto3"`
+	SkipChunks              bool                  `protobuf:"varint,8,opt,name=skip_chunks,json=skipChunks,proto3"`
+}
+
+func (m *thanosSeriesRequest) Reset()         { *m = thanosSeriesRequest{} }
+func (m *thanosSeriesRequest) String() string { return proto.CompactTextString(m) }
+func (*thanosSeriesRequest) ProtoMessage()    {}
+
+type thanosChunk struct {
+	Type int32  `protobuf:"varint,1,opt,name=type,proto3"`
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3"`
+}
+
+func (m *thanosChunk) Reset()         { *m = thanosChunk{} }
+func (m *thanosChunk) String() string { return proto.CompactTextString(m) }
+func (*thanosChunk) ProtoMessage()    {}
+
+type thanosAggrChunk struct {
+	MinTime int64        `protobuf:"varint,1,opt,name=min_time,json=minTime,proto3"`
+	MaxTime int64        `protobuf:"varint,2,opt,name=max_time,json=maxTime,proto3"`
+	Raw     *thanosChunk `protobuf:"bytes,3,opt,name=raw,proto3"`
+}
+
+func (m *thanosAggrChunk) Reset()         { *m = thanosAggrChunk{} }
+func (m *thanosAggrChunk) String() string { return proto.CompactTextString(m) }
+func (*thanosAggrChunk) ProtoMessage()    {}
+
+type thanosSeries struct {
+	Labels []*thanosLabel     `protobuf:"bytes,1,rep,name=labels,proto3"`
+	Chunks []*thanosAggrChunk `protobuf:"bytes,2,rep,name=chunks,proto3"`
+}
+
+func (m *thanosSeries) Reset()         { *m = thanosSeries{} }
+func (m *thanosSeries) String() string { return proto.CompactTextString(m) }
+func (*thanosSeries) ProtoMessage()    {}
+
+type thanosSeriesResponse struct {
+	Result isThanosSeriesResponseResult `protobuf_oneof:"result"`
+}
+
+func (m *thanosSeriesResponse) Reset()         { *m = thanosSeriesResponse{} }
+func (m *thanosSeriesResponse) String() string { return proto.CompactTextString(m) }
+func (*thanosSeriesResponse) ProtoMessage()    {}
+
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*thanosSeriesResponse) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*thanosSeriesResponseSeries)(nil),
+		(*thanosSeriesResponseWarning)(nil),
+	}
+}
+
+type isThanosSeriesResponseResult interface {
+	isThanosSeriesResponseResult()
+}
+
+type thanosSeriesResponseSeries struct {
+	Series *thanosSeries `protobuf:"bytes,1,opt,name=series,proto3,oneof"`
+}
+
+type thanosSeriesResponseWarning struct {
+	Warning string `protobuf:"bytes,2,opt,name=warning,proto3,oneof"`
+}
+
+func (*thanosSeriesResponseSeries) isThanosSeriesResponseResult()  {}
+func (*thanosSeriesResponseWarning) isThanosSeriesResponseResult() {}
+
+type thanosLabelNamesRequest struct {
+	PartialResponseDisabled bool                  `protobuf:"varint,1,opt,name=partial_response_disabled,json=partialResponseDisabled,proto3"`
+	Start                   int64                 `protobuf:"varint,3,opt,name=start,proto3"`
+	End                     int64                 `protobuf:"varint,4,opt,name=end,proto3"`
+	Matchers                []*thanosLabelMatcher `protobuf:"bytes,6,rep,name=matchers,proto3"`
+}
+
+func (m *thanosLabelNamesRequest) Reset()         { *m = thanosLabelNamesRequest{} }
+func (m *thanosLabelNamesRequest) String() string { return proto.CompactTextString(m) }
+func (*thanosLabelNamesRequest) ProtoMessage()    {}
+
+type thanosLabelNamesResponse struct {
+	Names    []string `protobuf:"bytes,1,rep,name=names,proto3"`
+	Warnings []string `protobuf:"bytes,2,rep,name=warnings,proto3"`
+}
+
+func (m *thanosLabelNamesResponse) Reset()         { *m = thanosLabelNamesResponse{} }
+func (m *thanosLabelNamesResponse) String() string { return proto.CompactTextString(m) }
+func (*thanosLabelNamesResponse) ProtoMessage()    {}
+
+type thanosLabelValuesRequest struct {
+	Label                   string                `protobuf:"bytes,1,opt,name=label,proto3"`
+	PartialResponseDisabled bool                  `protobuf:"varint,2,opt,name=partial_response_disabled,json=partialResponseDisabled,proto3"`
+	Start                   int64                 `protobuf:"varint,4,opt,name=start,proto3"`
+	End                     int64                 `protobuf:"varint,5,opt,name=end,proto3"`
+	Matchers                []*thanosLabelMatcher `protobuf:"bytes,7,rep,name=matchers,proto3"`
+}
+
+func (m *thanosLabelValuesRequest) Reset()         { *m = thanosLabelValuesRequest{} }
+func (m *thanosLabelValuesRequest) String() string { return proto.CompactTextString(m) }
+func (*thanosLabelValuesRequest) ProtoMessage()    {}
+
+type thanosLabelValuesResponse struct {
+	Values   []string `protobuf:"bytes,1,rep,name=values,proto3"`
+	Warnings []string `protobuf:"bytes,2,rep,name=warnings,proto3"`
+}
+
+func (m *thanosLabelValuesResponse) Reset()         { *m = thanosLabelValuesResponse{} }
+func (m *thanosLabelValuesResponse) String() string { return proto.CompactTextString(m) }
+func (*thanosLabelValuesResponse) ProtoMessage()    {}
@@ -28,6 +28,11 @@ func (t *TimeTruncate) Query(ctx context.Context, query string, ts time.Time) (m
 	return t.API.Query(ctx, query, ts.Truncate(truncateDuration))
 }
 
+// LabelValues performs a query for the values of the given label.
+func (t *TimeTruncate) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	return t.API.LabelValues(ctx, label, matchers, startTime.Truncate(truncateDuration), endTime.Truncate(truncateDuration))
+}
+
 // QueryRange performs a query for the given range.
 func (t *TimeTruncate) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
 	return t.API.QueryRange(ctx, query, v1.Range{
@@ -35,7 +35,7 @@ func (tf *AbsoluteTimeFilter) QueryRange(ctx context.Context, query string, r v1
 		if r.Start.Before(tf.Start) {
 			r.Start = tf.Start
 		}
-		if r.End.After(tf.End) {
+		if !tf.End.IsZero() && r.End.After(tf.End) {
 			r.End = tf.End
 		}
 	}
@@ -43,6 +43,24 @@ func (tf *AbsoluteTimeFilter) QueryRange(ctx context.Context, query string, r v1
 	return tf.API.QueryRange(ctx, query, r)
 }
 
+// LabelValues performs a query for the values of the given label.
+func (tf *AbsoluteTimeFilter) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	if (!tf.Start.IsZero() && !endTime.IsZero() && endTime.Before(tf.Start)) || (!tf.End.IsZero() && startTime.After(tf.End)) {
+		return nil, nil, nil
+	}
+
+	if tf.Truncate {
+		if startTime.Before(tf.Start) {
+			startTime = tf.Start
+		}
+		if !tf.End.IsZero() && (endTime.IsZero() || endTime.After(tf.End)) {
+			endTime = tf.End
+		}
+	}
+
+	return tf.API.LabelValues(ctx, label, matchers, startTime, endTime)
+}
+
 // Series finds series by label matchers.
 func (tf *AbsoluteTimeFilter) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
 	if (!tf.Start.IsZero() && endTime.Before(tf.Start)) || (!tf.End.IsZero() && startTime.After(tf.End)) {
@@ -53,7 +71,7 @@ func (tf *AbsoluteTimeFilter) Series(ctx context.Context, matches []string, star
 		if startTime.Before(tf.Start) {
 			startTime = tf.Start
 		}
-		if endTime.After(tf.End) {
+		if !tf.End.IsZero() && endTime.After(tf.End) {
 			endTime = tf.End
 		}
 	}
@@ -71,7 +89,7 @@ func (tf *AbsoluteTimeFilter) GetValue(ctx context.Context, start, end time.Time
 		if start.Before(tf.Start) {
 			start = tf.Start
 		}
-		if end.After(tf.End) {
+		if !tf.End.IsZero() && end.After(tf.End) {
 			end = tf.End
 		}
 	}
@@ -79,6 +97,24 @@ func (tf *AbsoluteTimeFilter) GetValue(ctx context.Context, start, end time.Time
 	return tf.API.GetValue(ctx, start, end, matchers)
 }
 
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (tf *AbsoluteTimeFilter) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	if (!tf.Start.IsZero() && endTime.Before(tf.Start)) || (!tf.End.IsZero() && startTime.After(tf.End)) {
+		return nil, nil, nil
+	}
+
+	if tf.Truncate {
+		if startTime.Before(tf.Start) {
+			startTime = tf.Start
+		}
+		if !tf.End.IsZero() && endTime.After(tf.End) {
+			endTime = tf.End
+		}
+	}
+
+	return tf.API.QueryExemplars(ctx, query, startTime, endTime)
+}
+
 // RelativeTimeFilter will filter queries out (return nil,nil) for all queries outside the given durations relative to time.Now()
 type RelativeTimeFilter struct {
 	API
@@ -121,7 +157,7 @@ func (tf *RelativeTimeFilter) QueryRange(ctx context.Context, query string, r v1
 		if r.Start.Before(tfStart) {
 			r.Start = tfStart
 		}
-		if r.End.After(tfEnd) {
+		if !tfEnd.IsZero() && r.End.After(tfEnd) {
 			r.End = tfEnd
 		}
 	}
@@ -129,6 +165,25 @@ func (tf *RelativeTimeFilter) QueryRange(ctx context.Context, query string, r v1
 	return tf.API.QueryRange(ctx, query, r)
 }
 
+// LabelValues performs a query for the values of the given label.
+func (tf *RelativeTimeFilter) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	tfStart, tfEnd := tf.window()
+	if (!tfStart.IsZero() && !endTime.IsZero() && endTime.Before(tfStart)) || (!tfEnd.IsZero() && startTime.After(tfEnd)) {
+		return nil, nil, nil
+	}
+
+	if tf.Truncate {
+		if startTime.Before(tfStart) {
+			startTime = tfStart
+		}
+		if !tfEnd.IsZero() && (endTime.IsZero() || endTime.After(tfEnd)) {
+			endTime = tfEnd
+		}
+	}
+
+	return tf.API.LabelValues(ctx, label, matchers, startTime, endTime)
+}
+
 // Series finds series by label matchers.
 func (tf *RelativeTimeFilter) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
 	tfStart, tfEnd := tf.window()
@@ -140,7 +195,7 @@ func (tf *RelativeTimeFilter) Series(ctx context.Context, matches []string, star
 		if startTime.Before(tfStart) {
 			startTime = tfStart
 		}
-		if endTime.After(tfEnd) {
+		if !tfEnd.IsZero() && endTime.After(tfEnd) {
 			endTime = tfEnd
 		}
 	}
@@ -159,10 +214,29 @@ func (tf *RelativeTimeFilter) GetValue(ctx context.Context, start, end time.Time
 		if start.Before(tfStart) {
 			start = tfStart
 		}
-		if end.After(tfEnd) {
+		if !tfEnd.IsZero() && end.After(tfEnd) {
 			end = tfEnd
 		}
 	}
 
 	return tf.API.GetValue(ctx, start, end, matchers)
 }
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (tf *RelativeTimeFilter) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]ExemplarQueryResult, v1.Warnings, error) {
+	tfStart, tfEnd := tf.window()
+	if (!tfStart.IsZero() && endTime.Before(tfStart)) || (!tfEnd.IsZero() && startTime.After(tfEnd)) {
+		return nil, nil, nil
+	}
+
+	if tf.Truncate {
+		if startTime.Before(tfStart) {
+			startTime = tfStart
+		}
+		if !tfEnd.IsZero() && endTime.After(tfEnd) {
+			endTime = tfEnd
+		}
+	}
+
+	return tf.API.QueryExemplars(ctx, query, startTime, endTime)
+}
@@ -3,10 +3,13 @@ package promclient
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"testing"
 	"time"
 
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
 )
 
 type timeFilterTestCase struct {
@@ -110,6 +113,58 @@ func TestAbsoluteTimeFilter(t *testing.T) {
 	})
 }
 
+// rangeRecorderAPI records the time range of the GetValue calls sent to it
+type rangeRecorderAPI struct {
+	API
+	start, end time.Time
+}
+
+func (r *rangeRecorderAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	r.start, r.end = start, end
+	return nil, nil, nil
+}
+
+func TestAbsoluteTimeFilterTruncate(t *testing.T) {
+	start := time.Unix(1000, 0)
+	end := time.Unix(2000, 0)
+
+	tests := []struct {
+		start, end                 time.Time
+		expectedStart, expectedEnd time.Time
+	}{
+		// Ranges overlapping the window are truncated to it
+		{start: time.Unix(0, 0), end: time.Unix(1500, 0), expectedStart: start, expectedEnd: time.Unix(1500, 0)},
+		{start: time.Unix(1500, 0), end: time.Unix(3000, 0), expectedStart: time.Unix(1500, 0), expectedEnd: end},
+		{start: time.Unix(0, 0), end: time.Unix(3000, 0), expectedStart: start, expectedEnd: end},
+		// Ranges outside of the window aren't sent at all
+		{start: time.Unix(0, 0), end: time.Unix(500, 0)},
+		{start: time.Unix(2500, 0), end: time.Unix(3000, 0)},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			recorder := &rangeRecorderAPI{}
+			api := &AbsoluteTimeFilter{API: recorder, Start: start, End: end, Truncate: true}
+			if _, _, err := api.GetValue(context.TODO(), test.start, test.end, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !recorder.start.Equal(test.expectedStart) || !recorder.end.Equal(test.expectedEnd) {
+				t.Fatalf("mismatch in range expected=%v-%v actual=%v-%v", test.expectedStart, test.expectedEnd, recorder.start, recorder.end)
+			}
+		})
+	}
+
+	// An open ended window only truncates the bound which is set
+	recorder := &rangeRecorderAPI{}
+	api := &AbsoluteTimeFilter{API: recorder, Start: start, Truncate: true}
+	if _, _, err := api.GetValue(context.TODO(), time.Unix(0, 0), time.Unix(3000, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !recorder.start.Equal(start) || !recorder.end.Equal(time.Unix(3000, 0)) {
+		t.Fatalf("mismatch in open ended range actual=%v-%v", recorder.start, recorder.end)
+	}
+}
+
 func TestRelativeTimeFilter(t *testing.T) {
 	now := time.Now()
 
@@ -145,3 +200,37 @@ func TestRelativeTimeFilter(t *testing.T) {
 	})
 
 }
+
+func TestRelativeTimeFilterTruncate(t *testing.T) {
+	retention := time.Hour * -72
+	now := time.Now()
+
+	// A short retention prometheus only has the last 72h
+	recorder := &rangeRecorderAPI{}
+	api := &RelativeTimeFilter{API: recorder, Start: &retention, Truncate: true}
+	if _, _, err := api.GetValue(context.TODO(), now.Add(time.Hour*-100), now, nil); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.start.Before(now.Add(retention)) || !recorder.end.Equal(now) {
+		t.Fatalf("range wasn't truncated to the last 72h: %v-%v", recorder.start, recorder.end)
+	}
+
+	// Long term storage only has data older than 72h
+	recorder = &rangeRecorderAPI{}
+	api = &RelativeTimeFilter{API: recorder, End: &retention, Truncate: true}
+	if _, _, err := api.GetValue(context.TODO(), now.Add(time.Hour*-100), now, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !recorder.start.Equal(now.Add(time.Hour*-100)) || recorder.end.After(time.Now().Add(retention)) {
+		t.Fatalf("range wasn't truncated to before 72h ago: %v-%v", recorder.start, recorder.end)
+	}
+
+	// Ranges it can't answer aren't sent
+	recorder = &rangeRecorderAPI{}
+	if _, _, err := api.GetValue(context.TODO(), now.Add(time.Hour*-1), now, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !recorder.start.IsZero() {
+		t.Fatalf("unexpected call for a range within the last 72h: %v-%v", recorder.start, recorder.end)
+	}
+}
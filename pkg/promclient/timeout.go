@@ -0,0 +1,87 @@
+package promclient
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// TimeoutAPI applies a deadline to calls to the API based on the type of the
+// call, as e.g. range queries legitimately take longer than label lookups.
+// A zero timeout leaves calls of that type without a deadline.
+type TimeoutAPI struct {
+	API
+	// QueryTimeout is the timeout for instant queries
+	QueryTimeout time.Duration
+	// QueryRangeTimeout is the timeout for range queries
+	QueryRangeTimeout time.Duration
+	// SeriesTimeout is the timeout for series lookups
+	SeriesTimeout time.Duration
+	// LabelNamesTimeout is the timeout for label name lookups
+	LabelNamesTimeout time.Duration
+	// LabelValuesTimeout is the timeout for label value lookups
+	LabelValuesTimeout time.Duration
+	// GetValueTimeout is the timeout for loading raw data
+	GetValueTimeout time.Duration
+}
+
+// withTimeout returns a context with the given timeout (if non-zero)
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// LabelNames returns all the unique label names present in the block in sorted order.
+func (t *TimeoutAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	ctx, cancel := withTimeout(ctx, t.LabelNamesTimeout)
+	defer cancel()
+	return t.API.LabelNames(ctx)
+}
+
+// LabelValues performs a query for the values of the given label.
+func (t *TimeoutAPI) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	ctx, cancel := withTimeout(ctx, t.LabelValuesTimeout)
+	defer cancel()
+	return t.API.LabelValues(ctx, label, matchers, startTime, endTime)
+}
+
+// Query performs a query for the given time.
+func (t *TimeoutAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	ctx, cancel := withTimeout(ctx, t.QueryTimeout)
+	defer cancel()
+	return t.API.Query(ctx, query, ts)
+}
+
+// QueryRange performs a query for the given range.
+func (t *TimeoutAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	ctx, cancel := withTimeout(ctx, t.QueryRangeTimeout)
+	defer cancel()
+	return t.API.QueryRange(ctx, query, r)
+}
+
+// Series finds series by label matchers.
+func (t *TimeoutAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	ctx, cancel := withTimeout(ctx, t.SeriesTimeout)
+	defer cancel()
+	return t.API.Series(ctx, matches, startTime, endTime)
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range
+func (t *TimeoutAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	ctx, cancel := withTimeout(ctx, t.GetValueTimeout)
+	defer cancel()
+	return t.API.GetValue(ctx, start, end, matchers)
+}
+
+// Key returns a labelset used to determine other api clients that are the "same"
+func (t *TimeoutAPI) Key() model.LabelSet {
+	if apiLabels, ok := t.API.(APILabels); ok {
+		return apiLabels.Key()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package promclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// deadlineAPI records the deadline of the context of each call
+type deadlineAPI struct {
+	API
+	deadline time.Time
+	ok       bool
+}
+
+func (d *deadlineAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	d.deadline, d.ok = ctx.Deadline()
+	return nil, nil, nil
+}
+
+func (d *deadlineAPI) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	d.deadline, d.ok = ctx.Deadline()
+	return nil, nil, nil
+}
+
+func (d *deadlineAPI) LabelNames(ctx context.Context) ([]string, v1.Warnings, error) {
+	d.deadline, d.ok = ctx.Deadline()
+	return nil, nil, nil
+}
+
+func TestTimeoutAPI(t *testing.T) {
+	stub := &deadlineAPI{}
+	a := &TimeoutAPI{API: stub, QueryTimeout: time.Second, QueryRangeTimeout: time.Minute}
+
+	within := func(d time.Duration) {
+		t.Helper()
+		if !stub.ok {
+			t.Fatalf("expected a deadline")
+		}
+		if remaining := time.Until(stub.deadline); remaining > d || remaining < d-time.Second {
+			t.Fatalf("expected deadline in %s, got %s", d, remaining)
+		}
+	}
+
+	a.Query(context.TODO(), "up", time.Now())
+	within(time.Second)
+
+	a.QueryRange(context.TODO(), "up", v1.Range{})
+	within(time.Minute)
+
+	// Calls without a timeout are passed through as-is
+	a.LabelNames(context.TODO())
+	if stub.ok {
+		t.Fatalf("unexpected deadline for label names")
+	}
+
+	// A shorter deadline of the caller is kept
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	a.QueryRange(ctx, "up", v1.Range{})
+	within(10 * time.Millisecond)
+}
@@ -0,0 +1,110 @@
+package promclient
+
+import (
+	"sort"
+)
+
+// TSDBStatsLimit is the number of entries returned in each of the TSDB cardinality stats
+const TSDBStatsLimit = 10
+
+// TSDBHeadStats contains statistics about the head block of a TSDB
+type TSDBHeadStats struct {
+	NumSeries     uint64 `json:"numSeries"`
+	NumLabelPairs int    `json:"numLabelPairs"`
+	ChunkCount    int64  `json:"chunkCount"`
+	MinTime       int64  `json:"minTime"`
+	MaxTime       int64  `json:"maxTime"`
+}
+
+// TSDBStat is a single cardinality statistic, Servers attributes the value
+// to the downstream servers it was reported by
+type TSDBStat struct {
+	Name    string            `json:"name"`
+	Value   uint64            `json:"value"`
+	Servers map[string]uint64 `json:"servers,omitempty"`
+}
+
+// TSDBResult contains the result from querying the tsdb status endpoint
+type TSDBResult struct {
+	HeadStats                   TSDBHeadStats `json:"headStats"`
+	SeriesCountByMetricName     []TSDBStat    `json:"seriesCountByMetricName"`
+	LabelValueCountByLabelName  []TSDBStat    `json:"labelValueCountByLabelName"`
+	MemoryInBytesByLabelName    []TSDBStat    `json:"memoryInBytesByLabelName"`
+	SeriesCountByLabelValuePair []TSDBStat    `json:"seriesCountByLabelValuePair"`
+}
+
+// attributeTSDBStats attributes all stats without attribution to the given server
+func attributeTSDBStats(r TSDBResult, server string) TSDBResult {
+	attribute := func(stats []TSDBStat) []TSDBStat {
+		ret := make([]TSDBStat, len(stats))
+		for i, stat := range stats {
+			ret[i] = stat
+			if stat.Servers == nil {
+				ret[i].Servers = map[string]uint64{server: stat.Value}
+			}
+		}
+		return ret
+	}
+
+	r.SeriesCountByMetricName = attribute(r.SeriesCountByMetricName)
+	r.LabelValueCountByLabelName = attribute(r.LabelValueCountByLabelName)
+	r.MemoryInBytesByLabelName = attribute(r.MemoryInBytesByLabelName)
+	r.SeriesCountByLabelValuePair = attribute(r.SeriesCountByLabelValuePair)
+	return r
+}
+
+// mergeTSDBStats sums the stats from a and b by name, returning the top TSDBStatsLimit
+func mergeTSDBStats(a, b []TSDBStat) []TSDBStat {
+	stats := make(map[string]int, len(a)+len(b))
+	ret := make([]TSDBStat, 0, len(a)+len(b))
+	for _, items := range [][]TSDBStat{a, b} {
+		for _, stat := range items {
+			i, ok := stats[stat.Name]
+			if !ok {
+				stats[stat.Name] = len(ret)
+				ret = append(ret, TSDBStat{Name: stat.Name})
+				i = len(ret) - 1
+			}
+			ret[i].Value += stat.Value
+			for server, v := range stat.Servers {
+				if ret[i].Servers == nil {
+					ret[i].Servers = make(map[string]uint64)
+				}
+				ret[i].Servers[server] += v
+			}
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Value > ret[j].Value
+	})
+	if len(ret) > TSDBStatsLimit {
+		ret = ret[:TSDBStatsLimit]
+	}
+	return ret
+}
+
+// MergeTSDB merges the TSDB status of b into a. The head stats are summed (the
+// time range is extended to cover both) and the cardinality stats are summed by name.
+func MergeTSDB(a, b TSDBResult) TSDBResult {
+	if a.HeadStats.NumSeries == 0 && a.HeadStats.ChunkCount == 0 {
+		a.HeadStats.MinTime = b.HeadStats.MinTime
+		a.HeadStats.MaxTime = b.HeadStats.MaxTime
+	} else if b.HeadStats.NumSeries != 0 || b.HeadStats.ChunkCount != 0 {
+		if b.HeadStats.MinTime < a.HeadStats.MinTime {
+			a.HeadStats.MinTime = b.HeadStats.MinTime
+		}
+		if b.HeadStats.MaxTime > a.HeadStats.MaxTime {
+			a.HeadStats.MaxTime = b.HeadStats.MaxTime
+		}
+	}
+	a.HeadStats.NumSeries += b.HeadStats.NumSeries
+	a.HeadStats.NumLabelPairs += b.HeadStats.NumLabelPairs
+	a.HeadStats.ChunkCount += b.HeadStats.ChunkCount
+
+	a.SeriesCountByMetricName = mergeTSDBStats(a.SeriesCountByMetricName, b.SeriesCountByMetricName)
+	a.LabelValueCountByLabelName = mergeTSDBStats(a.LabelValueCountByLabelName, b.LabelValueCountByLabelName)
+	a.MemoryInBytesByLabelName = mergeTSDBStats(a.MemoryInBytesByLabelName, b.MemoryInBytesByLabelName)
+	a.SeriesCountByLabelValuePair = mergeTSDBStats(a.SeriesCountByLabelValuePair, b.SeriesCountByLabelValuePair)
+	return a
+}
@@ -0,0 +1,88 @@
+package promclient
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestMergeTSDB(t *testing.T) {
+	a := TSDBResult{
+		HeadStats: TSDBHeadStats{NumSeries: 10, NumLabelPairs: 5, ChunkCount: 20, MinTime: 100, MaxTime: 200},
+		SeriesCountByMetricName: []TSDBStat{
+			{Name: "up", Value: 4, Servers: map[string]uint64{"a": 4}},
+			{Name: "http_requests_total", Value: 6, Servers: map[string]uint64{"a": 6}},
+		},
+	}
+	b := TSDBResult{
+		HeadStats: TSDBHeadStats{NumSeries: 20, NumLabelPairs: 10, ChunkCount: 40, MinTime: 50, MaxTime: 150},
+		SeriesCountByMetricName: []TSDBStat{
+			{Name: "up", Value: 8, Servers: map[string]uint64{"b": 8}},
+		},
+	}
+
+	merged := MergeTSDB(a, b)
+
+	expectedHead := TSDBHeadStats{NumSeries: 30, NumLabelPairs: 15, ChunkCount: 60, MinTime: 50, MaxTime: 200}
+	if merged.HeadStats != expectedHead {
+		t.Fatalf("mismatch in head stats expected=%v actual=%v", expectedHead, merged.HeadStats)
+	}
+
+	expectedStats := []TSDBStat{
+		{Name: "up", Value: 12, Servers: map[string]uint64{"a": 4, "b": 8}},
+		{Name: "http_requests_total", Value: 6, Servers: map[string]uint64{"a": 6}},
+	}
+	if !reflect.DeepEqual(merged.SeriesCountByMetricName, expectedStats) {
+		t.Fatalf("mismatch in stats expected=%v actual=%v", expectedStats, merged.SeriesCountByMetricName)
+	}
+}
+
+func TestMergeTSDBLimit(t *testing.T) {
+	var a TSDBResult
+	for i := 0; i < TSDBStatsLimit*2; i++ {
+		a = MergeTSDB(a, TSDBResult{
+			SeriesCountByMetricName: []TSDBStat{{Name: strconv.Itoa(i), Value: uint64(i)}},
+		})
+	}
+
+	if len(a.SeriesCountByMetricName) != TSDBStatsLimit {
+		t.Fatalf("expected %d stats, got %d", TSDBStatsLimit, len(a.SeriesCountByMetricName))
+	}
+	if a.SeriesCountByMetricName[0].Value != uint64(TSDBStatsLimit*2-1) {
+		t.Fatalf("expected stats to be sorted by value: %v", a.SeriesCountByMetricName)
+	}
+}
+
+func TestMultiAPITSDB(t *testing.T) {
+	stub := func(series uint64) API {
+		return &stubAPI{
+			tsdb: func() TSDBResult {
+				return TSDBResult{
+					HeadStats:               TSDBHeadStats{NumSeries: series},
+					SeriesCountByMetricName: []TSDBStat{{Name: "up", Value: series}},
+				}
+			},
+		}
+	}
+
+	api := NewMultiAPI([]API{
+		&AddLabelClient{stub(1), model.LabelSet{"host": "a"}},
+		&AddLabelClient{stub(2), model.LabelSet{"host": "b"}},
+	}, model.Time(0), nil, 1, WithAPINames([]string{"a:9090", "b:9090"}))
+
+	tsdb, _, err := api.TSDB(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tsdb.HeadStats.NumSeries != 3 {
+		t.Fatalf("expected head series to be summed: %v", tsdb.HeadStats)
+	}
+	expected := []TSDBStat{{Name: "up", Value: 3, Servers: map[string]uint64{"a:9090": 1, "b:9090": 2}}}
+	if !reflect.DeepEqual(tsdb.SeriesCountByMetricName, expected) {
+		t.Fatalf("mismatch in stats expected=%v actual=%v", expected, tsdb.SeriesCountByMetricName)
+	}
+}
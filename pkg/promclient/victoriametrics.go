@@ -0,0 +1,173 @@
+package promclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// NewVictoriaMetricsAPI returns a VictoriaMetricsAPI using the given client
+func NewVictoriaMetricsAPI(client api.Client) *VictoriaMetricsAPI {
+	return &VictoriaMetricsAPI{NewPromAPIV1(&victoriaMetricsClient{client})}
+}
+
+// VictoriaMetricsAPI implements our internal API interface for VictoriaMetrics, which
+// has a prometheus compatible API with a few extensions (e.g. the export API, which
+// is used to load raw data) and small differences in its responses
+type VictoriaMetricsAPI struct {
+	*PromAPIV1
+}
+
+// vmExportLine is a single series of the (JSON line) response of the export API
+type vmExportLine struct {
+	Metric     model.Metric    `json:"metric"`
+	Values     []vmExportValue `json:"values"`
+	Timestamps []int64         `json:"timestamps"`
+}
+
+// vmExportValue is a value of the export API, special values (NaN, Inf) may be quoted
+type vmExportValue float64
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (v *vmExportValue) UnmarshalJSON(b []byte) error {
+	s := string(bytes.Trim(b, `"`))
+	if s == "null" {
+		*v = vmExportValue(math.NaN())
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*v = vmExportValue(f)
+	return nil
+}
+
+// GetValue loads the raw data for a given set of matchers in the time range through the export API
+func (p *VictoriaMetricsAPI) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
+	match, err := promhttputil.MatcherToString(matchers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u := p.client.URL("/api/v1/export", nil)
+	q := u.Query()
+	q.Set("match[]", match)
+	q.Set("start", formatTime(start))
+	q.Set("end", formatTime(end))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, body, err := p.client.Do(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, nil, &v1.Error{Type: vmErrorType(strconv.Itoa(resp.StatusCode)), Msg: fmt.Sprintf("server error: %d", resp.StatusCode), Detail: string(body)}
+	}
+
+	matrix := make(model.Matrix, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var line vmExportLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, nil, &v1.Error{Type: v1.ErrBadResponse, Msg: err.Error()}
+		}
+		if len(line.Values) != len(line.Timestamps) {
+			return nil, nil, &v1.Error{Type: v1.ErrBadResponse, Msg: "mismatched values and timestamps in export response"}
+		}
+
+		samples := make([]model.SamplePair, len(line.Values))
+		for i, v := range line.Values {
+			samples[i] = model.SamplePair{Timestamp: model.Time(line.Timestamps[i]), Value: model.SampleValue(v)}
+		}
+		matrix = append(matrix, &model.SampleStream{Metric: line.Metric, Values: samples})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return matrix, nil, nil
+}
+
+// victoriaMetricsClient wraps the prom API client to convert the responses of
+// VictoriaMetrics to the ones prometheus would return
+type victoriaMetricsClient struct {
+	api.Client
+}
+
+// vmResponse holds the fields of the responses of VictoriaMetrics which differ from prometheus'
+type vmResponse struct {
+	// IsPartial is set if some of the storage nodes didn't respond (cluster version)
+	IsPartial bool     `json:"isPartial"`
+	ErrorType string   `json:"errorType"`
+	Warnings  []string `json:"warnings"`
+}
+
+// vmErrorType returns the prometheus ErrorType for the errorType of VictoriaMetrics, which
+// is the status code of the response (e.g. "422")
+func vmErrorType(errorType string) v1.ErrorType {
+	code, err := strconv.Atoi(errorType)
+	if err != nil {
+		return v1.ErrorType(errorType)
+	}
+	switch code / 100 {
+	case 4:
+		return v1.ErrBadData
+	case 5:
+		return v1.ErrServer
+	}
+	return v1.ErrBadResponse
+}
+
+// Do makes the request, converting partial responses into warnings and the errorType
+// into one of prometheus'
+func (c *victoriaMetricsClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	resp, body, err := c.Client.Do(ctx, req)
+	if err != nil {
+		return resp, body, err
+	}
+
+	// Responses which aren't a single JSON object (e.g. of the export API) are returned as-is
+	var vmResp vmResponse
+	if json.Unmarshal(body, &vmResp) != nil {
+		return resp, body, nil
+	}
+	errorType := vmErrorType(vmResp.ErrorType)
+	if !vmResp.IsPartial && string(errorType) == vmResp.ErrorType {
+		return resp, body, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return resp, body, nil
+	}
+	delete(fields, "isPartial")
+	if vmResp.ErrorType != "" {
+		fields["errorType"], _ = json.Marshal(errorType)
+	}
+	if vmResp.IsPartial {
+		fields["warnings"], _ = json.Marshal(append(vmResp.Warnings, "partial response: some of the VictoriaMetrics storage nodes are unavailable"))
+	}
+	body, err = json.Marshal(fields)
+	return resp, body, err
+}
@@ -0,0 +1,97 @@
+package promclient
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+func newVictoriaMetricsTestAPI(t *testing.T, handler http.HandlerFunc) *VictoriaMetricsAPI {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client, err := api.NewClient(api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewVictoriaMetricsAPI(client)
+}
+
+func TestVictoriaMetricsGetValue(t *testing.T) {
+	var query map[string][]string
+	vmAPI := newVictoriaMetricsTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/export" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		query = r.URL.Query()
+		w.Write([]byte(`{"metric":{"__name__":"up","job":"a"},"values":[1,0],"timestamps":[1000,2000]}
+{"metric":{"__name__":"up","job":"b"},"values":[1,"NaN"],"timestamps":[1000,2000]}
+`))
+	})
+
+	start, end := time.Unix(1, 0), time.Unix(2, 0)
+	v, _, err := vmAPI.GetValue(context.TODO(), start, end, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query["match[]"][0] != `{__name__="up"}` || query["start"][0] != "1" || query["end"][0] != "2" {
+		t.Fatalf("unexpected query: %v", query)
+	}
+
+	matrix := v.(model.Matrix)
+	if len(matrix) != 2 {
+		t.Fatalf("expected 2 series, got %v", matrix)
+	}
+	expected := &model.SampleStream{
+		Metric: model.Metric{"__name__": "up", "job": "a"},
+		Values: []model.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}},
+	}
+	if !reflect.DeepEqual(matrix[0], expected) {
+		t.Fatalf("mismatch expected=%v actual=%v", expected, matrix[0])
+	}
+	if !math.IsNaN(float64(matrix[1].Values[1].Value)) {
+		t.Fatalf("expected NaN, got %v", matrix[1].Values[1].Value)
+	}
+}
+
+func TestVictoriaMetricsPartialResponse(t *testing.T) {
+	vmAPI := newVictoriaMetricsTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","isPartial":true,"data":{"resultType":"vector","result":[]}}`))
+	})
+
+	_, w, err := vmAPI.Query(context.TODO(), "up", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w) != 1 {
+		t.Fatalf("expected a warning for the partial response, got %v", w)
+	}
+}
+
+func TestVictoriaMetricsErrorType(t *testing.T) {
+	vmAPI := newVictoriaMetricsTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"error","errorType":"503","error":"storage unavailable"}`))
+	})
+
+	_, _, err := vmAPI.Query(context.TODO(), "up", time.Now())
+	var apiErr *v1.Error
+	if !errors.As(err, &apiErr) || apiErr.Type != v1.ErrServer {
+		t.Fatalf("expected a server error, got %v", err)
+	}
+	if !IsRetryableError(err) {
+		t.Fatalf("expected the error to be retryable")
+	}
+}
@@ -0,0 +1,87 @@
+package promhttputil
+
+import (
+	"github.com/prometheus/common/model"
+)
+
+// AlignValue aligns the points of a matrix onto the step grid of a range query (the
+// timestamps start + n*step), such that matrices sampled at different timestamps (e.g.
+// by backends aligning the steps differently) are merged point by point instead of
+// being interleaved. Each point is moved to the nearest step, of multiple points on the
+// same step the nearest one is used. Other values (or without a step) are returned as is.
+func AlignValue(v model.Value, start, step model.Time) model.Value {
+	m, ok := v.(model.Matrix)
+	if !ok || step <= 0 {
+		return v
+	}
+
+	var ret model.Matrix
+	for i, stream := range m {
+		values, aligned := alignSamples(stream.Values, start, step)
+		if !aligned {
+			continue
+		}
+		// Copy on the first aligned stream, as the matrix may be shared
+		if ret == nil {
+			ret = append(model.Matrix(nil), m...)
+		}
+		ret[i] = &model.SampleStream{Metric: stream.Metric, Values: values}
+	}
+	if ret == nil {
+		return m
+	}
+	return ret
+}
+
+// alignStep returns the step of the grid nearest to t
+func alignStep(t, start, step model.Time) model.Time {
+	offset := (t - start) % step
+	if offset < 0 {
+		offset += step
+	}
+	if offset*2 >= step {
+		return t - offset + step
+	}
+	return t - offset
+}
+
+// distance returns the absolute difference of the timestamps
+func distance(a, b model.Time) model.Time {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// alignSamples returns the (sorted) points aligned onto the step grid, and whether any point
+// was moved (otherwise the points are returned as is)
+func alignSamples(values []model.SamplePair, start, step model.Time) ([]model.SamplePair, bool) {
+	i := 0
+	for ; i < len(values); i++ {
+		if alignStep(values[i].Timestamp, start, step) != values[i].Timestamp {
+			break
+		}
+	}
+	if i == len(values) {
+		return values, false
+	}
+
+	ret := append(make([]model.SamplePair, 0, len(values)), values[:i]...)
+	// The distance of the last point of ret to its step (before it was moved)
+	var lastDistance model.Time
+	for _, p := range values[i:] {
+		t := alignStep(p.Timestamp, start, step)
+		d := distance(p.Timestamp, t)
+		p.Timestamp = t
+		if len(ret) > 0 && ret[len(ret)-1].Timestamp == t {
+			if d < lastDistance {
+				ret[len(ret)-1] = p
+				lastDistance = d
+			}
+			continue
+		}
+		ret = append(ret, p)
+		lastDistance = d
+	}
+	return ret, true
+}
@@ -0,0 +1,103 @@
+package promhttputil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestAlignValue(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "testmetric"}
+	p := func(t model.Time, v model.SampleValue) model.SamplePair {
+		return model.SamplePair{Timestamp: t, Value: v}
+	}
+	matrix := func(values ...model.SamplePair) model.Matrix {
+		return model.Matrix{{Metric: metric, Values: values}}
+	}
+
+	tests := []struct {
+		name  string
+		v     model.Value
+		start model.Time
+		step  model.Time
+		r     model.Value
+	}{
+		{
+			name:  "aligned",
+			v:     matrix(p(10, 1), p(20, 2), p(30, 3)),
+			start: 10,
+			step:  10,
+			r:     matrix(p(10, 1), p(20, 2), p(30, 3)),
+		},
+		{
+			name:  "nearest",
+			v:     matrix(p(14, 1), p(25, 2), p(33, 3)),
+			start: 10,
+			step:  10,
+			r:     matrix(p(10, 1), p(30, 3)),
+		},
+		{
+			// The grid extends before the start (e.g. for the lookback)
+			name:  "before start",
+			v:     matrix(p(-4, 1), p(6, 2)),
+			start: 10,
+			step:  10,
+			r:     matrix(p(0, 1), p(10, 2)),
+		},
+		{
+			name:  "no step",
+			v:     matrix(p(14, 1)),
+			start: 10,
+			r:     matrix(p(14, 1)),
+		},
+		{
+			name:  "vector",
+			v:     model.Vector{{Metric: metric, Value: 1, Timestamp: 14}},
+			start: 10,
+			step:  10,
+			r:     model.Vector{{Metric: metric, Value: 1, Timestamp: 14}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if r := AlignValue(test.v, test.start, test.step); !reflect.DeepEqual(r, test.r) {
+				t.Fatalf("mismatch\nexpected=%v\nactual=%v", test.r, r)
+			}
+		})
+	}
+}
+
+func TestMergeValuesMismatchedSteps(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "testmetric"}
+	p := func(t model.Time, v model.SampleValue) model.SamplePair {
+		return model.SamplePair{Timestamp: t, Value: v}
+	}
+
+	// a is on the grid of the query, b on a grid offset by 4s (with a hole filled at 40s)
+	a := model.Matrix{{Metric: metric, Values: []model.SamplePair{p(10000, 1), p(20000, 2), p(30000, 3), p(50000, 5)}}}
+	b := model.Matrix{{Metric: metric, Values: []model.SamplePair{p(14000, 1), p(24000, 2), p(34000, 3), p(44000, 4), p(54000, 5)}}}
+
+	// Without the alignment the points are interleaved
+	merged, err := MergeValues(0, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(merged.(model.Matrix)[0].Values); n != 9 {
+		t.Fatalf("expected the points to be interleaved, got %v", merged)
+	}
+
+	merged, err = MergeValues(0, AlignValue(a, 10000, 10000), AlignValue(b, 10000, 10000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := model.Matrix{{Metric: metric, Values: []model.SamplePair{p(10000, 1), p(20000, 2), p(30000, 3), p(40000, 4), p(50000, 5)}}}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("mismatch\nexpected=%v\nactual=%v", expected, merged)
+	}
+	// The values aren't modified
+	if b[0].Values[0].Timestamp != 14000 {
+		t.Fatalf("align modified the value: %v", b)
+	}
+}
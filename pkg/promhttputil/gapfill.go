@@ -0,0 +1,59 @@
+package promhttputil
+
+import (
+	"sort"
+
+	"github.com/prometheus/common/model"
+)
+
+// medianSpacing returns the median spacing of the points (0 if there are less than 2)
+func medianSpacing(values []model.SamplePair) model.Time {
+	if len(values) < 2 {
+		return 0
+	}
+	deltas := make([]model.Time, len(values)-1)
+	for i := 1; i < len(values); i++ {
+		deltas[i-1] = values[i].Timestamp - values[i-1].Timestamp
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i] < deltas[j] })
+	return deltas[len(deltas)/2]
+}
+
+// fillGaps fills the gaps of the merged points with the points of the series, even if they
+// are within the antiAffinityBuffer of the merged points (e.g. a single missed scrape of a
+// replica, which isn't filled when merging). A gap is a spacing longer than 1.5 times the
+// median spacing of the merged points, it is filled with the points at least half the
+// median spacing away from the points around them.
+func fillGaps(values []model.SamplePair, series ...[]model.SamplePair) []model.SamplePair {
+	spacing := medianSpacing(values)
+	if spacing <= 0 {
+		return values
+	}
+
+	ret := values
+	copied := false
+	for _, s := range series {
+		for _, p := range s {
+			if isStale(p.Value) {
+				continue
+			}
+			i := sort.Search(len(ret), func(i int) bool { return ret[i].Timestamp >= p.Timestamp })
+			if i == 0 || i == len(ret) {
+				continue
+			}
+			prev, next := ret[i-1].Timestamp, ret[i].Timestamp
+			if (next-prev)*2 <= spacing*3 || (p.Timestamp-prev)*2 < spacing || (next-p.Timestamp)*2 < spacing {
+				continue
+			}
+			// Copy on the first fill, as the points may be shared
+			if !copied {
+				ret = append(make([]model.SamplePair, 0, len(values)+1), values...)
+				copied = true
+			}
+			ret = append(ret, model.SamplePair{})
+			copy(ret[i+1:], ret[i:])
+			ret[i] = p
+		}
+	}
+	return ret
+}
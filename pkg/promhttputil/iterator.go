@@ -0,0 +1,78 @@
+package promhttputil
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/common/model"
+)
+
+// sampleIterator iterates over the points of a series
+type sampleIterator struct {
+	values []model.SamplePair
+	i      int
+}
+
+// ok returns whether the iterator has a current point
+func (it *sampleIterator) ok() bool { return it.i < len(it.values) }
+
+// at returns the current point
+func (it *sampleIterator) at() model.SamplePair { return it.values[it.i] }
+
+// next advances the iterator to the next point
+func (it *sampleIterator) next() { it.i++ }
+
+// samplePool holds the buffers the points of the merged series are written to, such that
+// only the merged points are allocated (and only if the merge adds any point)
+var samplePool = sync.Pool{
+	New: func() interface{} { return new([]model.SamplePair) },
+}
+
+// getSampleBuffer returns an empty buffer with a capacity of at least n points
+func getSampleBuffer(n int) *[]model.SamplePair {
+	buf := samplePool.Get().(*[]model.SamplePair)
+	if cap(*buf) < n {
+		*buf = make([]model.SamplePair, 0, n)
+	}
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// seriesRef is a series (by its index) of the values being merged with its fingerprint
+type seriesRef struct {
+	fingerprint model.Fingerprint
+	index       int
+}
+
+var seriesRefPool = sync.Pool{
+	New: func() interface{} { return new([]seriesRef) },
+}
+
+// sortedSeries returns the refs of the n series sorted by fingerprint (and index), such that the
+// series with the same fingerprint are consecutive and can be merged as a stream instead of
+// being looked up in a map. The refs must be released with seriesRefPool.Put.
+func sortedSeries(n int, fingerprint func(int) model.Fingerprint) *[]seriesRef {
+	refs := seriesRefPool.Get().(*[]seriesRef)
+	if cap(*refs) < n {
+		*refs = make([]seriesRef, n)
+	}
+	*refs = (*refs)[:n]
+	for i := range *refs {
+		(*refs)[i] = seriesRef{fingerprint(i), i}
+	}
+	sort.Sort(seriesRefs(*refs))
+	return refs
+}
+
+type seriesRefs []seriesRef
+
+func (s seriesRefs) Len() int { return len(s) }
+
+func (s seriesRefs) Less(i, j int) bool {
+	if s[i].fingerprint != s[j].fingerprint {
+		return s[i].fingerprint < s[j].fingerprint
+	}
+	return s[i].index < s[j].index
+}
+
+func (s seriesRefs) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,104 @@
+package promhttputil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// maxTruncatedSeries is the maximum number of truncated series listed in a TruncationWarning
+const maxTruncatedSeries = 10
+
+// sampleBytes is the (estimated) size of a sample in bytes
+const sampleBytes = 16
+
+// MergeLimits cap the size of a merged value, such that a downstream returning an enormous
+// result can't balloon promxy's memory. A zero limit means no limit.
+type MergeLimits struct {
+	// MaxSamples is the maximum number of samples of the merged value
+	MaxSamples int
+	// MaxBytes is the maximum (estimated) size of the samples and labels of the merged value
+	MaxBytes int
+}
+
+// seriesBytes returns the (estimated) size of the labels of a series in bytes
+func seriesBytes(metric model.Metric) int {
+	n := 0
+	for k, v := range metric {
+		n += len(k) + len(v)
+	}
+	return n
+}
+
+// TruncationWarning identifies the series of a merged value truncated by the MergeLimits
+type TruncationWarning struct {
+	// Limit is the exceeded limit (e.g. "1000 samples")
+	Limit string
+	// Series are the series which were truncated (or dropped)
+	Series []model.Metric
+}
+
+func (w *TruncationWarning) String() string {
+	series := make([]string, 0, maxTruncatedSeries)
+	for i, metric := range w.Series {
+		if i == maxTruncatedSeries {
+			break
+		}
+		series = append(series, metric.String())
+	}
+	s := fmt.Sprintf("merged result truncated at the limit of %s, %d series truncated: %s", w.Limit, len(w.Series), strings.Join(series, ", "))
+	if len(w.Series) > maxTruncatedSeries {
+		s += fmt.Sprintf(" (and %d more)", len(w.Series)-maxTruncatedSeries)
+	}
+	return s
+}
+
+// mergeBudget tracks the size of a merged value against the MergeLimits
+type mergeBudget struct {
+	limits   MergeLimits
+	samples  int
+	bytes    int
+	exceeded string // the first exceeded limit
+
+	warning   *TruncationWarning
+	truncated map[model.Fingerprint]struct{}
+}
+
+// fit returns how many of the n samples (of a series with labelBytes of labels) fit within the limits
+func (b *mergeBudget) fit(labelBytes, n int) int {
+	if b.limits.MaxSamples > 0 && b.samples+n > b.limits.MaxSamples {
+		n = b.limits.MaxSamples - b.samples
+		if b.exceeded == "" {
+			b.exceeded = fmt.Sprintf("%d samples", b.limits.MaxSamples)
+		}
+	}
+	if b.limits.MaxBytes > 0 && b.bytes+labelBytes+n*sampleBytes > b.limits.MaxBytes {
+		n = (b.limits.MaxBytes - b.bytes - labelBytes) / sampleBytes
+		if b.exceeded == "" {
+			b.exceeded = fmt.Sprintf("%d bytes", b.limits.MaxBytes)
+		}
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// add adds the samples and labels to the size of the merged value
+func (b *mergeBudget) add(labelBytes, n int) {
+	b.samples += n
+	b.bytes += labelBytes + n*sampleBytes
+}
+
+// truncate records the series as truncated
+func (b *mergeBudget) truncate(metric model.Metric, fingerprint model.Fingerprint) {
+	if b.warning == nil {
+		b.warning = &TruncationWarning{Limit: b.exceeded}
+		b.truncated = make(map[model.Fingerprint]struct{})
+	}
+	if _, ok := b.truncated[fingerprint]; !ok {
+		b.truncated[fingerprint] = struct{}{}
+		b.warning.Series = append(b.warning.Series, metric)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/value"
 	"github.com/prometheus/prometheus/storage"
 )
 
@@ -48,6 +49,10 @@ func ValueAddLabelSet(a model.Value, l model.LabelSet) error {
 	switch aTyped := a.(type) {
 	case model.Vector:
 		for _, item := range aTyped {
+			// If the current metric has no labels, set them
+			if item.Metric == nil {
+				item.Metric = make(model.Metric, len(l))
+			}
 			for k, v := range l {
 				item.Metric[k] = v
 			}
@@ -69,6 +74,32 @@ func ValueAddLabelSet(a model.Value, l model.LabelSet) error {
 
 }
 
+// ResultTypeMismatchError is returned when attempting to merge values of different types
+// (e.g. if one downstream returns a vector and another a matrix for the same query)
+type ResultTypeMismatchError struct {
+	A, B model.ValueType
+}
+
+func (e *ResultTypeMismatchError) Error() string {
+	return fmt.Sprintf("unable to merge results of mismatched types %v and %v", e.A, e.B)
+}
+
+// isEmptyValue returns whether the value is a vector or matrix with no series
+func isEmptyValue(v model.Value) bool {
+	switch vTyped := v.(type) {
+	case model.Vector:
+		return len(vTyped) == 0
+	case model.Matrix:
+		return len(vTyped) == 0
+	}
+	return false
+}
+
+// isStale returns whether the value is a staleness marker
+func isStale(v model.SampleValue) bool {
+	return value.IsStaleNaN(float64(v))
+}
+
 // MergeValues merges values `a` and `b` with the given antiAffinityBuffer
 func MergeValues(antiAffinityBuffer model.Time, a, b model.Value) (model.Value, error) {
 	if a == nil {
@@ -78,7 +109,15 @@ func MergeValues(antiAffinityBuffer model.Time, a, b model.Value) (model.Value,
 		return a, nil
 	}
 	if a.Type() != b.Type() {
-		return nil, fmt.Errorf("mismatch type %v!=%v", a.Type(), b.Type())
+		// An empty vector/matrix carries no data, so it is safe to simply use
+		// the other value (e.g. a downstream with no data for a query)
+		if isEmptyValue(a) {
+			return b, nil
+		}
+		if isEmptyValue(b) {
+			return a, nil
+		}
+		return nil, &ResultTypeMismatchError{A: a.Type(), B: b.Type()}
 	}
 
 	switch aTyped := a.(type) {
@@ -107,60 +146,60 @@ func MergeValues(antiAffinityBuffer model.Time, a, b model.Value) (model.Value,
 	case model.Vector:
 		bTyped := b.(model.Vector)
 
-		newValue := make(model.Vector, 0, len(aTyped)+len(bTyped))
-		fingerPrintMap := make(map[model.Fingerprint]int)
-
-		addItem := func(item *model.Sample) {
-			finger := item.Metric.Fingerprint()
-
-			// If we've seen this fingerPrint before, lets make sure that a value exists
-			if index, ok := fingerPrintMap[finger]; ok {
-				// Only replace if we have no value (which seems reasonable)
-				if newValue[index].Value == model.SampleValue(0) {
-					newValue[index].Value = item.Value
-				}
-			} else {
-				newValue = append(newValue, item)
-				fingerPrintMap[finger] = len(newValue) - 1
+		// The series of both vectors (as one) sorted by fingerprint, each series is put at the
+		// index of its first sample and the value is compacted in order afterwards
+		item := func(i int) *model.Sample {
+			if i < len(aTyped) {
+				return aTyped[i]
 			}
+			return bTyped[i-len(aTyped)]
 		}
-
-		for _, item := range aTyped {
-			addItem(item)
-		}
-
-		for _, item := range bTyped {
-			addItem(item)
+		n := len(aTyped) + len(bTyped)
+		refs := sortedSeries(n, func(i int) model.Fingerprint { return item(i).Metric.Fingerprint() })
+		defer seriesRefPool.Put(refs)
+
+		newValue := make(model.Vector, n)
+		first := 0
+		for i, ref := range *refs {
+			if i == 0 || ref.fingerprint != (*refs)[i-1].fingerprint {
+				first = ref.index
+				newValue[first] = item(first)
+				continue
+			}
+			// Only replace if we have no value (which seems reasonable)
+			if v := item(ref.index).Value; newValue[first].Value == model.SampleValue(0) || (isStale(newValue[first].Value) && !isStale(v)) {
+				newValue[first].Value = v
+			}
 		}
-		return newValue, nil
+		return compactVector(newValue), nil
 
 	case model.Matrix:
 		bTyped := b.(model.Matrix)
 
-		newValue := make(model.Matrix, 0, len(aTyped)+len(bTyped))
-		fingerPrintMap := make(map[model.Fingerprint]int)
-
-		addStream := func(stream *model.SampleStream) {
-			finger := stream.Metric.Fingerprint()
-
-			// If we've seen this fingerPrint before, lets make sure that a value exists
-			if index, ok := fingerPrintMap[finger]; ok {
-				// TODO: check this error? For now the only one is sig collision, which we check
-				newValue[index], _ = MergeSampleStream(antiAffinityBuffer, newValue[index], stream)
-			} else {
-				newValue = append(newValue, stream)
-				fingerPrintMap[finger] = len(newValue) - 1
+		// The series of both matrices (as one) sorted by fingerprint, such that the streams of
+		// each series are merged in order at the index of its first stream
+		stream := func(i int) *model.SampleStream {
+			if i < len(aTyped) {
+				return aTyped[i]
 			}
+			return bTyped[i-len(aTyped)]
 		}
-
-		for _, item := range aTyped {
-			addStream(item)
-		}
-
-		for _, item := range bTyped {
-			addStream(item)
+		n := len(aTyped) + len(bTyped)
+		refs := sortedSeries(n, func(i int) model.Fingerprint { return stream(i).Metric.Fingerprint() })
+		defer seriesRefPool.Put(refs)
+
+		newValue := make(model.Matrix, n)
+		first := 0
+		for i, ref := range *refs {
+			if i == 0 || ref.fingerprint != (*refs)[i-1].fingerprint {
+				first = ref.index
+				newValue[first] = stream(first)
+				continue
+			}
+			// The fingerprints are equal, so there can't be an error
+			newValue[first], _ = mergeSampleStream(antiAffinityBuffer, nil, newValue[first], stream(ref.index))
 		}
-		return newValue, nil
+		return compactMatrix(newValue), nil
 	}
 
 	return nil, fmt.Errorf("unknown type! %v", reflect.TypeOf(a))
@@ -179,7 +218,13 @@ func MergeSampleStream(antiAffinityBuffer model.Time, a, b *model.SampleStream)
 	if a.Metric.Fingerprint() != b.Metric.Fingerprint() {
 		return nil, fmt.Errorf("cannot merge mismatch fingerprints")
 	}
+	return mergeSampleStream(antiAffinityBuffer, nil, a, b)
+}
 
+// mergeSampleStream merges SampleStreams `a` and `b` as MergeSampleStream does (without checking
+// their fingerprints), the points of `b` which are duplicates (by the tolerance) of their
+// neighbors in `a` aren't merged. If no point of `b` is merged `a` is returned as is.
+func mergeSampleStream(antiAffinityBuffer model.Time, tolerance *DedupTolerance, a, b *model.SampleStream) (*model.SampleStream, error) {
 	// if either set of values are empty, return the one with data
 	if len(a.Values) == 0 {
 		return b, nil
@@ -202,25 +247,27 @@ func MergeSampleStream(antiAffinityBuffer model.Time, a, b *model.SampleStream)
 		b = tmp
 	}
 
-	newValues := make([]model.SamplePair, 0, len(a.Values))
+	// The points are merged into a pooled buffer, and only copied out if any point of b is merged
+	buf := getSampleBuffer(len(a.Values) + len(b.Values))
+	defer samplePool.Put(buf)
+	newValues := *buf
+	aValues, merged := replaceStale(antiAffinityBuffer, a.Values, b.Values)
+	appendB := func(p model.SamplePair) {
+		newValues = append(newValues, p)
+		merged = true
+	}
 
-	bOffset := 0
-	aStartBuffered := a.Values[0].Timestamp - antiAffinityBuffer
+	bIter := &sampleIterator{values: b.Values}
+	aStartBuffered := aValues[0].Timestamp - antiAffinityBuffer
 
 	// start by loading b points before a
-	if b.Values[0].Timestamp < aStartBuffered {
-		for i, bValue := range b.Values {
-			bOffset = i
-			if bValue.Timestamp < aStartBuffered {
-				newValues = append(newValues, bValue)
-			} else {
-				break
-			}
+	for ; bIter.ok() && bIter.at().Timestamp < aStartBuffered; bIter.next() {
+		if !tolerance.duplicate(bIter.at(), aValues[0]) {
+			appendB(bIter.at())
 		}
-
 	}
 
-	for _, aValue := range a.Values {
+	for _, aValue := range aValues {
 		// if we have no points, this one by definition is valid
 		if len(newValues) == 0 {
 			newValues = append(newValues, aValue)
@@ -232,13 +279,12 @@ func MergeSampleStream(antiAffinityBuffer model.Time, a, b *model.SampleStream)
 		lastTime := newValues[len(newValues)-1].Timestamp
 		if (aValue.Timestamp - lastTime) > antiAffinityBuffer*2 {
 			// We want to see if we have any datapoints in the window that aren't too close
-			for ; bOffset < len(b.Values); bOffset++ {
-				bValue := b.Values[bOffset]
-				if bValue.Timestamp >= aValue.Timestamp {
-					break
-				}
+			for ; bIter.ok() && bIter.at().Timestamp < aValue.Timestamp; bIter.next() {
+				bValue := bIter.at()
 				if bValue.Timestamp > lastTime+antiAffinityBuffer && bValue.Timestamp < (aValue.Timestamp-antiAffinityBuffer) {
-					newValues = append(newValues, bValue)
+					if !tolerance.duplicate(bValue, newValues[len(newValues)-1]) && !tolerance.duplicate(bValue, aValue) {
+						appendB(bValue)
+					}
 				}
 			}
 		}
@@ -246,15 +292,72 @@ func MergeSampleStream(antiAffinityBuffer model.Time, a, b *model.SampleStream)
 	}
 
 	lastTime := newValues[len(newValues)-1].Timestamp
-	for ; bOffset < len(b.Values); bOffset++ {
-		bValue := b.Values[bOffset]
-		if bValue.Timestamp > lastTime+antiAffinityBuffer {
-			newValues = append(newValues, bValue)
+	for ; bIter.ok(); bIter.next() {
+		bValue := bIter.at()
+		if bValue.Timestamp > lastTime+antiAffinityBuffer && !tolerance.duplicate(bValue, newValues[len(newValues)-1]) {
+			appendB(bValue)
 		}
 	}
+	*buf = newValues
 
+	if !merged {
+		return a, nil
+	}
 	return &model.SampleStream{
 		Metric: a.Metric,
-		Values: newValues,
+		Values: append(make([]model.SamplePair, 0, len(newValues)), newValues...),
 	}, nil
 }
+
+// compactVector removes the nil samples of the vector (in place)
+func compactVector(v model.Vector) model.Vector {
+	ret := v[:0]
+	for _, item := range v {
+		if item != nil {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// compactMatrix removes the nil streams of the matrix (in place)
+func compactMatrix(m model.Matrix) model.Matrix {
+	ret := m[:0]
+	for _, item := range m {
+		if item != nil {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// replaceStale replaces the staleness markers in `a` with the real points of `b` within the
+// antiAffinityBuffer of them, such that a replica which stopped scraping (e.g. restarted)
+// doesn't mark the series as stale while the other replica kept scraping it. It returns whether
+// any marker was replaced.
+func replaceStale(antiAffinityBuffer model.Time, a, b []model.SamplePair) ([]model.SamplePair, bool) {
+	var ret []model.SamplePair
+	j := 0
+	for i, aValue := range a {
+		if !isStale(aValue.Value) {
+			continue
+		}
+		for j < len(b) && b[j].Timestamp < aValue.Timestamp-antiAffinityBuffer {
+			j++
+		}
+		for k := j; k < len(b) && b[k].Timestamp <= aValue.Timestamp+antiAffinityBuffer; k++ {
+			if !isStale(b[k].Value) {
+				// Copy on the first replacement, as the values may be shared
+				if ret == nil {
+					ret = append([]model.SamplePair(nil), a...)
+				}
+				ret[i] = b[k]
+				break
+			}
+		}
+	}
+	if ret == nil {
+		return a, false
+	}
+	return ret, true
+}
@@ -0,0 +1,66 @@
+package promhttputil
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+// benchMatrix returns a matrix of series with points every 15s, offset by the skew (as the
+// replicas of an HA pair scrape at slightly different times), every holeEvery-th point is missing
+func benchMatrix(series, points int, skew model.Time, holeEvery int) model.Matrix {
+	m := make(model.Matrix, series)
+	for i := range m {
+		values := make([]model.SamplePair, 0, points)
+		for j := 0; j < points; j++ {
+			if holeEvery > 0 && j%holeEvery == holeEvery-1 {
+				continue
+			}
+			values = append(values, model.SamplePair{Timestamp: model.Time(j)*15000 + skew, Value: model.SampleValue(j)})
+		}
+		m[i] = &model.SampleStream{
+			Metric: model.Metric{model.MetricNameLabel: "testmetric", "series": model.LabelValue(strconv.Itoa(i))},
+			Values: values,
+		}
+	}
+	return m
+}
+
+func BenchmarkMergeValuesMatrix(b *testing.B) {
+	for _, holeEvery := range []int{0, 10} {
+		b.Run("holes="+strconv.Itoa(holeEvery), func(b *testing.B) {
+			x := benchMatrix(1000, 240, 0, 0)
+			y := benchMatrix(1000, 240, 500, holeEvery)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := MergeValues(model.Time(5000), x, y); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkValueMergerFanIn(b *testing.B) {
+	for _, downstreams := range []int{2, 10} {
+		b.Run("downstreams="+strconv.Itoa(downstreams), func(b *testing.B) {
+			values := make([]model.Matrix, downstreams)
+			for i := range values {
+				values[i] = benchMatrix(1000, 240, model.Time(i*100), i%3*5)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				m := NewValueMerger(model.Time(5000))
+				for i, v := range values {
+					if err := m.Add(v, i); err != nil {
+						b.Fatal(err)
+					}
+				}
+				m.Value()
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package promhttputil
 
 import (
+	"fmt"
+	"math"
 	"reflect"
 	"testing"
 
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/value"
 )
 
 /*
@@ -739,3 +742,127 @@ func TestMergeValues(t *testing.T) {
 	}
 
 }
+
+func TestMergeValuesTypeMismatch(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "testmetric"}
+	values := []model.Value{
+		&model.Scalar{Value: 1, Timestamp: 100},
+		&model.String{Value: "a", Timestamp: 100},
+		model.Vector{{Metric: metric, Value: 1, Timestamp: 100}},
+		model.Matrix{{Metric: metric, Values: []model.SamplePair{{Timestamp: 100, Value: 1}}}},
+	}
+
+	// Merging any two different non-empty types must error
+	for _, a := range values {
+		for _, b := range values {
+			if a.Type() == b.Type() {
+				continue
+			}
+			t.Run(a.Type().String()+"_"+b.Type().String(), func(t *testing.T) {
+				result, err := MergeValues(model.Time(0), a, b)
+				mismatchErr, ok := err.(*ResultTypeMismatchError)
+				if !ok {
+					t.Fatalf("expected ResultTypeMismatchError got %v", err)
+				}
+				if mismatchErr.A != a.Type() || mismatchErr.B != b.Type() {
+					t.Fatalf("mismatch in error types: %v", mismatchErr)
+				}
+				if result != nil {
+					t.Fatalf("expected no result on error, got %v", result)
+				}
+			})
+		}
+	}
+
+	// An empty vector/matrix has no data, so the other value is used
+	for _, empty := range []model.Value{model.Vector{}, model.Matrix{}} {
+		for _, v := range values {
+			if empty.Type() == v.Type() {
+				continue
+			}
+			t.Run("empty_"+empty.Type().String()+"_"+v.Type().String(), func(t *testing.T) {
+				for _, pair := range [][2]model.Value{{empty, v}, {v, empty}} {
+					result, err := MergeValues(model.Time(0), pair[0], pair[1])
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					if !reflect.DeepEqual(result, v) {
+						t.Fatalf("mismatch in result \nexpected=%v\nactual=%v", v, result)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestMergeValuesStale(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "testmetric"}
+	stale := model.SampleValue(math.Float64frombits(value.StaleNaN))
+
+	// a stopped scraping at 20 (while b kept scraping), its marker at 40 has no point of b near it
+	a := model.Matrix{{Metric: metric, Values: []model.SamplePair{{0, 1}, {10, 2}, {20, stale}, {40, stale}}}}
+	b := model.Matrix{{Metric: metric, Values: []model.SamplePair{{1, 1}, {11, 2}, {21, 3}}}}
+	expected := model.Matrix{{Metric: metric, Values: []model.SamplePair{{0, 1}, {10, 2}, {21, 3}, {40, stale}}}}
+
+	// NaNs aren't equal, so the values are compared by their string
+	for _, pair := range [][2]model.Value{{a, b}, {b, a}} {
+		result, err := MergeValues(model.Time(2), pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(result) != fmt.Sprint(expected) {
+			t.Fatalf("mismatch\nexpected=%v\nactual=%v", expected, result)
+		}
+	}
+	// The values of a aren't modified
+	if !value.IsStaleNaN(float64(a[0].Values[2].Value)) {
+		t.Fatalf("merge modified the values: %v", a)
+	}
+
+	m := NewValueMerger(model.Time(2))
+	m.Strategy = MergeStrategyMax
+	for i, v := range []model.Value{a, b} {
+		if err := m.Add(v, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fmt.Sprint(m.Value()) != fmt.Sprint(expected) {
+		t.Fatalf("mismatch\nexpected=%v\nactual=%v", expected, m.Value())
+	}
+
+	// The real sample of a vector is used over a staleness marker
+	result, err := MergeValues(model.Time(0), model.Vector{{Metric: metric, Value: stale, Timestamp: 10}}, model.Vector{{Metric: metric, Value: 5, Timestamp: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vector := result.(model.Vector); len(vector) != 1 || vector[0].Value != 5 {
+		t.Fatalf("unexpected result: %v", result)
+	}
+}
+
+func TestValueAddLabelSet(t *testing.T) {
+	l := model.LabelSet{"cluster": "a"}
+
+	vector := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "up", "cluster": "b"}, Value: 1},
+		{Value: 2},
+	}
+	if err := ValueAddLabelSet(vector, l); err != nil {
+		t.Fatal(err)
+	}
+	expectedVector := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "up", "cluster": "a"}, Value: 1},
+		{Metric: model.Metric{"cluster": "a"}, Value: 2},
+	}
+	if !reflect.DeepEqual(vector, expectedVector) {
+		t.Fatalf("mismatch in vector expected=%v actual=%v", expectedVector, vector)
+	}
+
+	matrix := model.Matrix{{Values: []model.SamplePair{{Value: 1}}}}
+	if err := ValueAddLabelSet(matrix, l); err != nil {
+		t.Fatal(err)
+	}
+	if matrix[0].Metric["cluster"] != "a" {
+		t.Fatalf("label wasn't added to the matrix: %v", matrix)
+	}
+}
@@ -0,0 +1,322 @@
+package promhttputil
+
+import (
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// NewValueMerger returns a ValueMerger using the given antiAffinityBuffer
+func NewValueMerger(antiAffinityBuffer model.Time) *ValueMerger {
+	return &ValueMerger{antiAffinityBuffer: antiAffinityBuffer}
+}
+
+// ValueMerger incrementally merges values. Unlike MergeValues (which creates a
+// new value on each merge) the series seen so far are indexed once and merged
+// in-place, so each value can be added (and released) as soon as it arrives
+// instead of holding every downstream response in memory until the end.
+//
+// Each value is added with an order; regardless of the order values are added
+// in the series in the result are ordered as if they were added in ascending order.
+type ValueMerger struct {
+	antiAffinityBuffer model.Time
+
+	// Strategy, if set, resolves the conflicting points of the series (instead of filling
+	// the holes of a series with the points of the others); it must be set before the
+	// first Add. The series are then kept until Value merges them in order.
+	Strategy MergeStrategy
+	// Tolerance, if set, treats the nearly-equal points of the series as duplicates; it must
+	// be set before the first Add
+	Tolerance *DedupTolerance
+	// AntiAffinityLabel, if set, is the label (e.g. set by relabeling) overriding the
+	// antiAffinityBuffer of the series with it, its value is a duration (e.g. 5m). The
+	// label is removed from the series.
+	AntiAffinityLabel model.LabelName
+	// GapFill, if set, fills the short gaps of the merged series (e.g. a missed scrape of a replica)
+	// with the points of the other series, even within the antiAffinityBuffer (see fillGaps)
+	GapFill bool
+	// Limits cap the size of the merged value, the series over the limits are truncated (see
+	// Truncation); it must be set before the first Add
+	Limits MergeLimits
+
+	value        model.Value
+	fingerprints map[model.Fingerprint]int // fingerprint -> index in value
+	positions    []seriesPosition          // position of each series in value
+	order        int                       // order of the value, for scalars and strings
+	pending      [][]orderedSeries         // series of each index in value, if merged by Strategy
+	overrides    map[int]model.Time        // index in value -> antiAffinityBuffer set by the AntiAffinityLabel
+	budget       mergeBudget               // size of the merged value against the Limits
+}
+
+// orderedSeries is a series (a sample or stream) of the value added with the order
+type orderedSeries struct {
+	order  int
+	sample *model.Sample
+	stream *model.SampleStream
+}
+
+// seriesPosition is the position a series would have had if all values were
+// added in ascending order
+type seriesPosition struct {
+	order, index int
+}
+
+func (p seriesPosition) before(o seriesPosition) bool {
+	if p.order != o.order {
+		return p.order < o.order
+	}
+	return p.index < o.index
+}
+
+// Add merges `v` into the value
+func (m *ValueMerger) Add(v model.Value, order int) error {
+	if v == nil {
+		return nil
+	}
+
+	if m.value == nil || (m.value.Type() != v.Type() && isEmptyValue(m.value)) {
+		m.value = nil
+		m.fingerprints = make(map[model.Fingerprint]int)
+		m.positions = nil
+		m.pending = nil
+		m.overrides = make(map[int]model.Time)
+		m.budget = mergeBudget{limits: m.Limits}
+		m.order = order
+	} else if m.value.Type() != v.Type() {
+		if isEmptyValue(v) {
+			return nil
+		}
+		return &ResultTypeMismatchError{A: m.value.Type(), B: v.Type()}
+	}
+
+	limited := m.Limits != MergeLimits{}
+	switch vTyped := v.(type) {
+	case model.Vector:
+		value, _ := m.value.(model.Vector)
+		for i, item := range vTyped {
+			pos := seriesPosition{order, i}
+			m.seriesAntiAffinity(item.Metric)
+			finger := item.Metric.Fingerprint()
+			if index, ok := m.fingerprints[finger]; ok {
+				if m.Strategy != MergeStrategyDefault {
+					// The pending samples are held until they are merged
+					if limited && m.budget.fit(0, 1) == 0 {
+						m.budget.truncate(item.Metric, finger)
+						continue
+					}
+					m.budget.add(0, 1)
+					m.pending[index] = append(m.pending[index], orderedSeries{order: order, sample: item})
+				} else if item.Value != model.SampleValue(0) && (value[index].Value == model.SampleValue(0) || pos.before(m.positions[index])) {
+					value[index].Value = item.Value
+				}
+				if pos.before(m.positions[index]) {
+					m.positions[index] = pos
+				}
+			} else {
+				if limited {
+					labelBytes := seriesBytes(item.Metric)
+					if m.budget.fit(labelBytes, 1) == 0 {
+						m.budget.truncate(item.Metric, finger)
+						continue
+					}
+					m.budget.add(labelBytes, 1)
+				}
+				value = append(value, item)
+				m.positions = append(m.positions, pos)
+				m.fingerprints[finger] = len(value) - 1
+				if m.Strategy != MergeStrategyDefault {
+					m.pending = append(m.pending, []orderedSeries{{order: order, sample: item}})
+				}
+			}
+		}
+		m.value = value
+
+	case model.Matrix:
+		value, _ := m.value.(model.Matrix)
+		for i, stream := range vTyped {
+			pos := seriesPosition{order, i}
+			override, overridden := m.seriesAntiAffinity(stream.Metric)
+			finger := stream.Metric.Fingerprint()
+			if index, ok := m.fingerprints[finger]; ok {
+				if _, ok := m.overrides[index]; overridden && !ok {
+					m.overrides[index] = override
+				}
+				if m.Strategy != MergeStrategyDefault {
+					// The pending streams are held until they are merged
+					if limited {
+						if stream = m.limitStream(stream, finger, 0); stream == nil {
+							continue
+						}
+					}
+					m.pending[index] = append(m.pending[index], orderedSeries{order: order, stream: stream})
+				} else {
+					merged, err := mergeSampleStream(m.buffer(index), m.Tolerance, value[index], stream)
+					if err != nil {
+						return err
+					}
+					if m.GapFill {
+						if values := fillGaps(merged.Values, value[index].Values, stream.Values); len(values) != len(merged.Values) {
+							merged = &model.SampleStream{Metric: merged.Metric, Values: values}
+						}
+					}
+					// The series isn't merged if the merged points exceed the limits
+					if added := len(merged.Values) - len(value[index].Values); limited && added > 0 {
+						if m.budget.fit(0, added) < added {
+							m.budget.truncate(stream.Metric, finger)
+							continue
+						}
+						m.budget.add(0, added)
+					}
+					value[index] = merged
+				}
+				if pos.before(m.positions[index]) {
+					m.positions[index] = pos
+				}
+			} else {
+				if limited {
+					if stream = m.limitStream(stream, finger, seriesBytes(stream.Metric)); stream == nil {
+						continue
+					}
+				}
+				value = append(value, stream)
+				m.positions = append(m.positions, pos)
+				m.fingerprints[finger] = len(value) - 1
+				if overridden {
+					m.overrides[len(value)-1] = override
+				}
+				if m.Strategy != MergeStrategyDefault {
+					m.pending = append(m.pending, []orderedSeries{{order: order, stream: stream}})
+				}
+			}
+		}
+		m.value = value
+
+	// Scalars and strings are a single datapoint, so there is nothing to index
+	default:
+		if m.value == nil {
+			m.value = v
+			return nil
+		}
+		a, b := m.value, v
+		if order < m.order {
+			a, b = b, a
+			m.order = order
+		}
+		merged, err := MergeValues(m.antiAffinityBuffer, a, b)
+		if err != nil {
+			return err
+		}
+		m.value = merged
+	}
+
+	return nil
+}
+
+// limitStream returns the stream truncated to the samples within the Limits (nil if none are),
+// adding them to the size of the merged value
+func (m *ValueMerger) limitStream(stream *model.SampleStream, fingerprint model.Fingerprint, labelBytes int) *model.SampleStream {
+	n := m.budget.fit(labelBytes, len(stream.Values))
+	if n < len(stream.Values) {
+		m.budget.truncate(stream.Metric, fingerprint)
+		if n == 0 {
+			return nil
+		}
+		stream = &model.SampleStream{Metric: stream.Metric, Values: stream.Values[:n]}
+	}
+	m.budget.add(labelBytes, n)
+	return stream
+}
+
+// Truncation returns the warning identifying the series truncated by the Limits, nil if none were
+func (m *ValueMerger) Truncation() *TruncationWarning {
+	return m.budget.warning
+}
+
+// seriesAntiAffinity removes the AntiAffinityLabel from the metric, returning the
+// antiAffinityBuffer it sets (if its value is a valid duration)
+func (m *ValueMerger) seriesAntiAffinity(metric model.Metric) (model.Time, bool) {
+	if m.AntiAffinityLabel == "" {
+		return 0, false
+	}
+	v, ok := metric[m.AntiAffinityLabel]
+	if !ok {
+		return 0, false
+	}
+	delete(metric, m.AntiAffinityLabel)
+	d, err := model.ParseDuration(string(v))
+	if err != nil {
+		return 0, false
+	}
+	return model.Time(time.Duration(d) / time.Millisecond), true
+}
+
+// buffer returns the antiAffinityBuffer of the series at the index in value
+func (m *ValueMerger) buffer(index int) model.Time {
+	if override, ok := m.overrides[index]; ok {
+		return override
+	}
+	return m.antiAffinityBuffer
+}
+
+// Value returns the merged value
+func (m *ValueMerger) Value() model.Value {
+	m.mergePending()
+	switch vTyped := m.value.(type) {
+	case model.Vector:
+		sort.Sort(&positionSorter{vTyped, m.positions})
+	case model.Matrix:
+		sort.Sort(&positionSorter{vTyped, m.positions})
+	}
+	return m.value
+}
+
+// mergePending merges the series added more than once by the Strategy, in order
+func (m *ValueMerger) mergePending() {
+	for index, series := range m.pending {
+		if len(series) < 2 {
+			continue
+		}
+		sort.SliceStable(series, func(i, j int) bool { return series[i].order < series[j].order })
+
+		merged := orderedSeries{order: series[0].order}
+		switch vTyped := m.value.(type) {
+		case model.Vector:
+			samples := make([]*model.Sample, len(series))
+			for i, item := range series {
+				samples[i] = item.sample
+			}
+			merged.sample = m.Strategy.mergeSamples(samples)
+			vTyped[index] = merged.sample
+		case model.Matrix:
+			streams := make([]*model.SampleStream, len(series))
+			for i, item := range series {
+				streams[i] = item.stream
+			}
+			merged.stream = m.Strategy.mergeStreams(m.buffer(index), m.Tolerance, streams)
+			// Filling the gaps of counters could add decreases
+			if m.GapFill && m.Strategy != MergeStrategyCounter {
+				for _, stream := range streams {
+					merged.stream.Values = fillGaps(merged.stream.Values, stream.Values)
+				}
+			}
+			vTyped[index] = merged.stream
+		}
+		m.pending[index] = []orderedSeries{merged}
+	}
+}
+
+// positionSorter sorts series (a Vector or Matrix) by their seriesPosition
+type positionSorter struct {
+	series    sort.Interface
+	positions []seriesPosition
+}
+
+func (s *positionSorter) Len() int { return len(s.positions) }
+
+func (s *positionSorter) Less(i, j int) bool { return s.positions[i].before(s.positions[j]) }
+
+func (s *positionSorter) Swap(i, j int) {
+	s.series.Swap(i, j)
+	s.positions[i], s.positions[j] = s.positions[j], s.positions[i]
+}
@@ -0,0 +1,472 @@
+package promhttputil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestValueMerger(t *testing.T) {
+	metric := func(v string) model.Metric {
+		return model.Metric{model.MetricNameLabel: "testmetric", "a": model.LabelValue(v)}
+	}
+	stream := func(v string, ts ...model.Time) *model.SampleStream {
+		s := &model.SampleStream{Metric: metric(v)}
+		for _, t := range ts {
+			s.Values = append(s.Values, model.SamplePair{Timestamp: t, Value: 1})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name   string
+		values func() []model.Value
+		r      model.Value
+		err    bool
+	}{
+		{
+			name: "vector",
+			values: func() []model.Value {
+				return []model.Value{
+					model.Vector{{Metric: metric("1"), Value: 1}, {Metric: metric("2"), Value: 0}},
+					model.Vector{{Metric: metric("2"), Value: 2}, {Metric: metric("3"), Value: 3}},
+					model.Vector{{Metric: metric("2"), Value: 4}},
+				}
+			},
+			r: model.Vector{{Metric: metric("1"), Value: 1}, {Metric: metric("2"), Value: 2}, {Metric: metric("3"), Value: 3}},
+		},
+		{
+			name: "matrix",
+			values: func() []model.Value {
+				return []model.Value{
+					model.Matrix{stream("1", 10, 20), stream("2", 10)},
+					model.Matrix{stream("2", 20), stream("3", 10)},
+				}
+			},
+			r: model.Matrix{stream("1", 10, 20), stream("2", 10, 20), stream("3", 10)},
+		},
+		{
+			name: "scalar",
+			values: func() []model.Value {
+				return []model.Value{
+					&model.Scalar{},
+					&model.Scalar{Value: 10, Timestamp: 100},
+				}
+			},
+			r: &model.Scalar{Value: 10, Timestamp: 100},
+		},
+		{
+			name: "empty",
+			values: func() []model.Value {
+				return []model.Value{
+					model.Matrix{},
+					nil,
+					model.Vector{{Metric: metric("1"), Value: 1}},
+				}
+			},
+			r: model.Vector{{Metric: metric("1"), Value: 1}},
+		},
+		{
+			name: "mismatch",
+			values: func() []model.Value {
+				return []model.Value{
+					model.Matrix{stream("1", 10)},
+					model.Vector{{Metric: metric("1"), Value: 1}},
+				}
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		// The result must be the same whether values are added in order or not
+		for _, reverse := range []bool{false, true} {
+			t.Run(test.name, func(t *testing.T) {
+				m := NewValueMerger(model.Time(0))
+				values := test.values()
+				var err error
+				for i := range values {
+					order := i
+					if reverse {
+						order = len(values) - 1 - i
+					}
+					if err = m.Add(values[order], order); err != nil {
+						break
+					}
+				}
+				if (err != nil) != test.err {
+					t.Fatalf("expected err=%v got %v", test.err, err)
+				}
+				if err != nil {
+					return
+				}
+				if !reflect.DeepEqual(m.Value(), test.r) {
+					t.Fatalf("mismatch (reverse=%v) \nexpected=%v\nactual=%v", reverse, test.r, m.Value())
+				}
+			})
+		}
+	}
+}
+
+func TestValueMergerStrategy(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "testmetric"}
+	stream := func(points ...model.SamplePair) model.Matrix {
+		return model.Matrix{{Metric: metric, Values: points}}
+	}
+	p := func(t model.Time, v model.SampleValue) model.SamplePair {
+		return model.SamplePair{Timestamp: t, Value: v}
+	}
+
+	// Points within the anti-affinity buffer (2) are the same point, 40 is only in the first value
+	matrices := []model.Value{
+		stream(p(10, 1), p(20, 5), p(40, 7)),
+		stream(p(11, 3), p(20, 2), p(30, 4)),
+		stream(p(10, 2), p(21, 8)),
+	}
+	vectors := []model.Value{
+		model.Vector{{Metric: metric, Value: 1, Timestamp: 10}},
+		model.Vector{{Metric: metric, Value: 6, Timestamp: 12}},
+		model.Vector{{Metric: metric, Value: 2, Timestamp: 11}},
+	}
+
+	tests := []struct {
+		strategy MergeStrategy
+		matrix   model.Value
+		vector   model.Value
+	}{
+		{
+			strategy: MergeStrategyPreferFirst,
+			matrix:   stream(p(10, 1), p(20, 5), p(30, 4), p(40, 7)),
+			vector:   model.Vector{{Metric: metric, Value: 1, Timestamp: 10}},
+		},
+		{
+			strategy: MergeStrategyMax,
+			matrix:   stream(p(10, 3), p(20, 8), p(30, 4), p(40, 7)),
+			vector:   model.Vector{{Metric: metric, Value: 6, Timestamp: 10}},
+		},
+		{
+			strategy: MergeStrategyMin,
+			matrix:   stream(p(10, 1), p(20, 2), p(30, 4), p(40, 7)),
+			vector:   model.Vector{{Metric: metric, Value: 1, Timestamp: 10}},
+		},
+		{
+			strategy: MergeStrategyAverage,
+			matrix:   stream(p(10, 2), p(20, 5), p(30, 4), p(40, 7)),
+			vector:   model.Vector{{Metric: metric, Value: 3, Timestamp: 10}},
+		},
+		{
+			strategy: MergeStrategyLatest,
+			matrix:   stream(p(11, 3), p(21, 8), p(30, 4), p(40, 7)),
+			vector:   model.Vector{{Metric: metric, Value: 6, Timestamp: 12}},
+		},
+	}
+
+	for _, test := range tests {
+		for _, values := range [][]model.Value{matrices, vectors} {
+			expected := test.matrix
+			if values[0].Type() == model.ValVector {
+				expected = test.vector
+			}
+			// The values are merged in order, regardless of the order they are added in
+			for _, reverse := range []bool{false, true} {
+				t.Run(string(test.strategy), func(t *testing.T) {
+					m := NewValueMerger(model.Time(2))
+					m.Strategy = test.strategy
+					for i := range values {
+						order := i
+						if reverse {
+							order = len(values) - 1 - i
+						}
+						// Copy the value, as the merger may modify it
+						var v model.Value
+						switch vTyped := values[order].(type) {
+						case model.Matrix:
+							v = stream(append([]model.SamplePair(nil), vTyped[0].Values...)...)
+						case model.Vector:
+							sample := *vTyped[0]
+							v = model.Vector{&sample}
+						}
+						if err := m.Add(v, order); err != nil {
+							t.Fatal(err)
+						}
+					}
+					if !reflect.DeepEqual(m.Value(), expected) {
+						t.Fatalf("mismatch (reverse=%v) \nexpected=%v\nactual=%v", reverse, expected, m.Value())
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestValueMergerTolerance(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "testmetric"}
+	p := func(t model.Time, v model.SampleValue) model.SamplePair {
+		return model.SamplePair{Timestamp: t, Value: v}
+	}
+
+	// The replicas scrape 15s apart, the points with nearly-equal values are duplicates
+	a := []model.SamplePair{p(0, 100), p(30000, 101), p(60000, 150), p(90000, 103)}
+	b := []model.SamplePair{p(15000, 100.5), p(45000, 130), p(75000, 102), p(105000, 103.2)}
+
+	tests := []struct {
+		name      string
+		strategy  MergeStrategy
+		tolerance *DedupTolerance
+		r         []model.SamplePair
+	}{
+		{
+			name: "interleaved",
+			r:    []model.SamplePair{p(0, 100), p(15000, 100.5), p(30000, 101), p(45000, 130), p(60000, 150), p(75000, 102), p(90000, 103), p(105000, 103.2)},
+		},
+		{
+			name:      "value",
+			tolerance: &DedupTolerance{Time: 15000, Value: 1},
+			r:         []model.SamplePair{p(0, 100), p(30000, 101), p(45000, 130), p(60000, 150), p(90000, 103)},
+		},
+		{
+			name:      "ratio",
+			tolerance: &DedupTolerance{Time: 15000, Ratio: 0.2},
+			r:         []model.SamplePair{p(0, 100), p(30000, 101), p(60000, 150), p(90000, 103)},
+		},
+		{
+			name:      "time",
+			tolerance: &DedupTolerance{Time: 10000, Ratio: 0.2},
+			r:         []model.SamplePair{p(0, 100), p(15000, 100.5), p(30000, 101), p(45000, 130), p(60000, 150), p(75000, 102), p(90000, 103), p(105000, 103.2)},
+		},
+		{
+			name:      "max",
+			strategy:  MergeStrategyMax,
+			tolerance: &DedupTolerance{Time: 15000, Value: 1},
+			// Each point is a duplicate of at most one point of the other replica
+			r: []model.SamplePair{p(0, 100.5), p(30000, 101), p(45000, 130), p(60000, 150), p(90000, 103), p(105000, 103.2)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewValueMerger(model.Time(1000))
+			m.Strategy = test.strategy
+			m.Tolerance = test.tolerance
+			for i, values := range [][]model.SamplePair{a, b} {
+				v := model.Matrix{{Metric: metric, Values: append([]model.SamplePair(nil), values...)}}
+				if err := m.Add(v, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected := model.Matrix{{Metric: metric, Values: test.r}}
+			if !reflect.DeepEqual(m.Value(), expected) {
+				t.Fatalf("mismatch\nexpected=%v\nactual=%v", expected, m.Value())
+			}
+		})
+	}
+}
+
+func TestValueMergerCounter(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "testmetric"}
+	p := func(t model.Time, v model.SampleValue) model.SamplePair {
+		return model.SamplePair{Timestamp: t, Value: v}
+	}
+
+	// The replicas scrape 15s apart, b lags behind a, a has a gap (restart) after 30s and b resets at 95s
+	a := []model.SamplePair{p(0, 100), p(15000, 110), p(30000, 120), p(90000, 165), p(105000, 175)}
+	b := []model.SamplePair{p(5000, 90), p(20000, 100), p(35000, 110), p(50000, 114), p(65000, 118), p(80000, 128), p(95000, 3)}
+
+	m := NewValueMerger(model.Time(1000))
+	m.Strategy = MergeStrategyCounter
+	for i, values := range [][]model.SamplePair{a, b} {
+		v := model.Matrix{{Metric: metric, Values: append([]model.SamplePair(nil), values...)}}
+		if err := m.Add(v, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The points of a are used until its gap, the decrease when switching to b isn't a reset
+	expected := model.Matrix{{Metric: metric, Values: []model.SamplePair{p(0, 100), p(15000, 110), p(30000, 120), p(65000, 120), p(80000, 130), p(95000, 3)}}}
+	if !reflect.DeepEqual(m.Value(), expected) {
+		t.Fatalf("mismatch\nexpected=%v\nactual=%v", expected, m.Value())
+	}
+}
+
+func TestValueMergerAntiAffinityLabel(t *testing.T) {
+	metric := func(v string, antiAffinity model.LabelValue) model.Metric {
+		m := model.Metric{model.MetricNameLabel: "testmetric", "a": model.LabelValue(v)}
+		if antiAffinity != "" {
+			m["__anti_affinity__"] = antiAffinity
+		}
+		return m
+	}
+	stream := func(metric model.Metric, ts ...model.Time) *model.SampleStream {
+		s := &model.SampleStream{Metric: metric}
+		for _, t := range ts {
+			s.Values = append(s.Values, model.SamplePair{Timestamp: t, Value: 1})
+		}
+		return s
+	}
+
+	// The series are pushed every 5m, the replicas 1m apart
+	m := NewValueMerger(model.Time(2000))
+	m.AntiAffinityLabel = "__anti_affinity__"
+	values := []model.Value{
+		model.Matrix{stream(metric("1", "5m"), 0, 300000, 600000), stream(metric("2", ""), 0, 300000, 600000), stream(metric("3", "invalid"), 0)},
+		model.Matrix{stream(metric("1", "5m"), 60000, 360000, 660000), stream(metric("2", ""), 60000, 360000, 660000), stream(metric("3", "invalid"), 1000)},
+	}
+	for i, v := range values {
+		if err := m.Add(v, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the series with the label are merged by its anti-affinity, the label is removed
+	expected := model.Matrix{
+		stream(metric("1", ""), 0, 300000, 600000),
+		stream(metric("2", ""), 0, 60000, 300000, 360000, 600000, 660000),
+		stream(metric("3", ""), 0),
+	}
+	if !reflect.DeepEqual(m.Value(), expected) {
+		t.Fatalf("mismatch\nexpected=%v\nactual=%v", expected, m.Value())
+	}
+}
+
+func TestValueMergerGapFill(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "testmetric"}
+	stream := func(ts ...model.Time) *model.SampleStream {
+		s := &model.SampleStream{Metric: metric}
+		for _, t := range ts {
+			s.Values = append(s.Values, model.SamplePair{Timestamp: t, Value: model.SampleValue(t)})
+		}
+		return s
+	}
+
+	// The replicas scrape every 15s 7s apart, each missed a scrape
+	a := stream(0, 15000, 45000, 60000, 75000)
+	b := stream(7000, 22000, 37000, 52000, 82000)
+
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		gapFill  bool
+		r        *model.SampleStream
+	}{
+		{
+			name: "default",
+			r:    stream(0, 15000, 45000, 60000, 75000),
+		},
+		{
+			name:    "gap_fill",
+			gapFill: true,
+			r:       stream(0, 15000, 37000, 45000, 60000, 75000),
+		},
+		{
+			// The points within the anti-affinity are combined first
+			name:     "gap_fill max",
+			strategy: MergeStrategyMax,
+			gapFill:  true,
+			r: &model.SampleStream{Metric: metric, Values: []model.SamplePair{
+				{Timestamp: 0, Value: 7000}, {Timestamp: 15000, Value: 22000}, {Timestamp: 37000, Value: 37000},
+				{Timestamp: 45000, Value: 45000}, {Timestamp: 60000, Value: 60000}, {Timestamp: 75000, Value: 82000},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewValueMerger(model.Time(15000))
+			m.Strategy = test.strategy
+			m.GapFill = test.gapFill
+			for i, s := range []*model.SampleStream{a, b} {
+				v := model.Matrix{{Metric: metric, Values: append([]model.SamplePair(nil), s.Values...)}}
+				if err := m.Add(v, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected := model.Matrix{test.r}
+			if !reflect.DeepEqual(m.Value(), expected) {
+				t.Fatalf("mismatch\nexpected=%v\nactual=%v", expected, m.Value())
+			}
+		})
+	}
+}
+
+func TestValueMergerLimits(t *testing.T) {
+	metric := func(v string) model.Metric {
+		return model.Metric{model.MetricNameLabel: "testmetric", "a": model.LabelValue(v)}
+	}
+	stream := func(v string, ts ...model.Time) *model.SampleStream {
+		s := &model.SampleStream{Metric: metric(v)}
+		for _, t := range ts {
+			s.Values = append(s.Values, model.SamplePair{Timestamp: t, Value: 1})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		limits   MergeLimits
+		strategy MergeStrategy
+		r        model.Value
+		warning  string
+	}{
+		{
+			name: "unlimited",
+			r:    model.Matrix{stream("1", 10, 20, 30, 40, 50), stream("2", 10, 20, 30), stream("3", 10)},
+		},
+		{
+			// 2 is truncated, then 1 isn't merged (it would exceed the limit) and 3 is dropped
+			name:    "samples",
+			limits:  MergeLimits{MaxSamples: 5},
+			r:       model.Matrix{stream("1", 10, 20, 30), stream("2", 10, 20)},
+			warning: `merged result truncated at the limit of 5 samples, 3 series truncated: testmetric{a="2"}, testmetric{a="1"}, testmetric{a="3"}`,
+		},
+		{
+			// 1 is merged (adding 2 samples), 3 is dropped
+			name:    "samples merge",
+			limits:  MergeLimits{MaxSamples: 8},
+			r:       model.Matrix{stream("1", 10, 20, 30, 40, 50), stream("2", 10, 20, 30)},
+			warning: `merged result truncated at the limit of 8 samples, 1 series truncated: testmetric{a="3"}`,
+		},
+		{
+			// The labels of each series are 20 bytes
+			name:    "bytes",
+			limits:  MergeLimits{MaxBytes: 20 + 3*16 + 20 + 2*16},
+			r:       model.Matrix{stream("1", 10, 20, 30), stream("2", 10, 20)},
+			warning: `merged result truncated at the limit of 120 bytes, 3 series truncated: testmetric{a="2"}, testmetric{a="1"}, testmetric{a="3"}`,
+		},
+		{
+			// The pending streams of the strategy are held, so they count towards the limit
+			name:     "strategy",
+			limits:   MergeLimits{MaxSamples: 7},
+			strategy: MergeStrategyMax,
+			r:        model.Matrix{stream("1", 10, 20, 30), stream("2", 10, 20, 30)},
+			warning:  `merged result truncated at the limit of 7 samples, 2 series truncated: testmetric{a="1"}, testmetric{a="3"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewValueMerger(model.Time(5))
+			m.Limits = test.limits
+			m.Strategy = test.strategy
+			values := []model.Value{
+				model.Matrix{stream("1", 10, 20, 30), stream("2", 10, 20, 30)},
+				model.Matrix{stream("1", 10, 20, 30, 40, 50), stream("3", 10)},
+			}
+			for i, v := range values {
+				if err := m.Add(v, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(m.Value(), test.r) {
+				t.Fatalf("mismatch\nexpected=%v\nactual=%v", test.r, m.Value())
+			}
+			var warning string
+			if truncation := m.Truncation(); truncation != nil {
+				warning = truncation.String()
+			}
+			if warning != test.warning {
+				t.Fatalf("mismatch in warning\nexpected=%s\nactual=%s", test.warning, warning)
+			}
+		})
+	}
+}
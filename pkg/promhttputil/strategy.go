@@ -0,0 +1,261 @@
+package promhttputil
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/prometheus/common/model"
+)
+
+// MergeStrategy resolves the conflicting points of a series returned by multiple
+// downstreams (e.g. the replicas of an HA pair), points within the anti-affinity
+// buffer of each other are the same point
+type MergeStrategy string
+
+// The merge strategies, by default the points of the series with the most points
+// are used and the holes are filled with the points of the others
+const (
+	MergeStrategyDefault MergeStrategy = ""
+	// MergeStrategyPreferFirst uses the point of the first downstream (in order)
+	MergeStrategyPreferFirst MergeStrategy = "prefer_first"
+	// MergeStrategyMax uses the maximum value of the points
+	MergeStrategyMax MergeStrategy = "max"
+	// MergeStrategyMin uses the minimum value of the points
+	MergeStrategyMin MergeStrategy = "min"
+	// MergeStrategyAverage uses the average value of the points
+	MergeStrategyAverage MergeStrategy = "average"
+	// MergeStrategyLatest uses the point with the most recent timestamp
+	MergeStrategyLatest MergeStrategy = "latest"
+	// MergeStrategyCounter is for counters: the points of a single series are used until it has
+	// a gap (as the penalty-based deduplication of Thanos does), and decreases caused by switching
+	// between the series aren't counter resets
+	MergeStrategyCounter MergeStrategy = "counter"
+)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *MergeStrategy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	switch strategy := MergeStrategy(str); strategy {
+	case MergeStrategyDefault, MergeStrategyPreferFirst, MergeStrategyMax, MergeStrategyMin, MergeStrategyAverage, MergeStrategyLatest, MergeStrategyCounter:
+		*s = strategy
+		return nil
+	}
+	return fmt.Errorf("invalid merge strategy %q, must be one of prefer_first, max, min, average, latest or counter", str)
+}
+
+// mergePoint is a point merged from the points of multiple series
+type mergePoint struct {
+	model.SamplePair
+	// sum and count of the values of the points, for the average
+	sum   float64
+	count int
+}
+
+func newMergePoint(p model.SamplePair) mergePoint {
+	return mergePoint{SamplePair: p, sum: float64(p.Value), count: 1}
+}
+
+// combine merges the point `b` into `a` (of a downstream earlier in order)
+func (s MergeStrategy) combine(a mergePoint, b model.SamplePair) mergePoint {
+	// A staleness marker is only used if neither point is real
+	switch {
+	case isStale(b.Value):
+		return a
+	case isStale(a.Value):
+		return newMergePoint(b)
+	}
+
+	switch s {
+	// The counter with the larger value is the more recent one
+	case MergeStrategyMax, MergeStrategyCounter:
+		if b.Value > a.Value {
+			a.Value = b.Value
+		}
+	case MergeStrategyMin:
+		if b.Value < a.Value {
+			a.Value = b.Value
+		}
+	case MergeStrategyAverage:
+		a.sum += float64(b.Value)
+		a.count++
+		a.Value = model.SampleValue(a.sum / float64(a.count))
+	case MergeStrategyLatest:
+		if b.Timestamp > a.Timestamp {
+			a = newMergePoint(b)
+		}
+	}
+	return a
+}
+
+// mergePoints merges the points `b` into the points `a` (of downstreams earlier in order), the
+// points within the antiAffinityBuffer of each other (or duplicates by the tolerance) are
+// combined by the strategy
+func (s MergeStrategy) mergePoints(antiAffinityBuffer model.Time, tolerance *DedupTolerance, a []mergePoint, b []model.SamplePair) []mergePoint {
+	ret := make([]mergePoint, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && (withinBuffer(antiAffinityBuffer, a[i].Timestamp, b[j].Timestamp) || tolerance.duplicate(a[i].SamplePair, b[j])):
+			ret = append(ret, s.combine(a[i], b[j]))
+			i++
+			j++
+		case j == len(b) || (i < len(a) && a[i].Timestamp < b[j].Timestamp):
+			ret = append(ret, a[i])
+			i++
+		default:
+			ret = append(ret, newMergePoint(b[j]))
+			j++
+		}
+	}
+	// The latest points may have moved past the following ones
+	if s == MergeStrategyLatest {
+		sort.SliceStable(ret, func(i, j int) bool { return ret[i].Timestamp < ret[j].Timestamp })
+	}
+	return ret
+}
+
+// withinBuffer returns whether the timestamps are within the antiAffinityBuffer of each other
+func withinBuffer(antiAffinityBuffer, a, b model.Time) bool {
+	return a-b <= antiAffinityBuffer && b-a <= antiAffinityBuffer
+}
+
+// mergeSamples merges the samples of a series (in order) by the strategy
+func (s MergeStrategy) mergeSamples(samples []*model.Sample) *model.Sample {
+	p := newMergePoint(model.SamplePair{Timestamp: samples[0].Timestamp, Value: samples[0].Value})
+	for _, sample := range samples[1:] {
+		p = s.combine(p, model.SamplePair{Timestamp: sample.Timestamp, Value: sample.Value})
+	}
+	return &model.Sample{Metric: samples[0].Metric, Value: p.Value, Timestamp: p.Timestamp}
+}
+
+// mergeStreams merges the streams of a series (in order) by the strategy
+func (s MergeStrategy) mergeStreams(antiAffinityBuffer model.Time, tolerance *DedupTolerance, streams []*model.SampleStream) *model.SampleStream {
+	if s == MergeStrategyCounter {
+		values := streams[0].Values
+		for _, stream := range streams[1:] {
+			values = penaltyDedup(values, stream.Values)
+		}
+		return &model.SampleStream{Metric: streams[0].Metric, Values: adjustCounter(values)}
+	}
+
+	points := make([]mergePoint, len(streams[0].Values))
+	for i, p := range streams[0].Values {
+		points[i] = newMergePoint(p)
+	}
+	for _, stream := range streams[1:] {
+		points = s.mergePoints(antiAffinityBuffer, tolerance, points, stream.Values)
+	}
+
+	values := make([]model.SamplePair, len(points))
+	for i, p := range points {
+		values[i] = p.SamplePair
+	}
+	return &model.SampleStream{Metric: streams[0].Metric, Values: values}
+}
+
+// initialPenalty is the penalty (in ms) of the series not used for the first point of penaltyDedup
+const initialPenalty = 5000
+
+// penaltyDedup merges the points of two replicas of a series as the penalty-based deduplication
+// of Thanos does: the point with the smaller timestamp is used, and the next point of the other
+// series must be at least twice the last interval later. Such that the points of one series are
+// used until it has a gap, instead of interleaving the points of both.
+func penaltyDedup(a, b []model.SamplePair) []model.SamplePair {
+	ret := make([]model.SamplePair, 0, len(a))
+	lastT := model.Earliest
+	var penA, penB model.Time
+	i, j := 0, 0
+	// seek returns the index of the first point at or after t
+	seek := func(values []model.SamplePair, i int, t model.Time) int {
+		for i < len(values) && values[i].Timestamp < t {
+			i++
+		}
+		return i
+	}
+	for {
+		if len(ret) > 0 {
+			i = seek(a, i, lastT+1+penA)
+			j = seek(b, j, lastT+1+penB)
+		}
+		switch {
+		case i == len(a) && j == len(b):
+			return ret
+		case i == len(a):
+			return append(ret, b[j:]...)
+		case j == len(b):
+			return append(ret, a[i:]...)
+		}
+
+		// Penalize the series which isn't used by twice the interval (or initialPenalty at first)
+		useA := a[i].Timestamp <= b[j].Timestamp
+		t := b[j].Timestamp
+		if useA {
+			t = a[i].Timestamp
+		}
+		penalty := model.Time(initialPenalty)
+		if len(ret) > 0 {
+			penalty = 2 * (t - lastT)
+		}
+		if useA {
+			ret = append(ret, a[i])
+			penA, penB = 0, penalty
+		} else {
+			ret = append(ret, b[j])
+			penA, penB = penalty, 0
+		}
+		lastT = t
+	}
+}
+
+// adjustCounter removes the decreases of the counter which aren't resets (e.g. after switching
+// between the replicas of a series), a decrease to less than half of the value is a reset
+func adjustCounter(values []model.SamplePair) []model.SamplePair {
+	ret := make([]model.SamplePair, len(values))
+	var adjustment model.SampleValue
+	for i, p := range values {
+		p.Value += adjustment
+		if i > 0 && p.Value < ret[i-1].Value {
+			last := ret[i-1].Value
+			if p.Value-adjustment < last/2 {
+				// A reset, the counter starts over
+				p.Value -= adjustment
+				adjustment = 0
+			} else {
+				adjustment += last - p.Value
+				p.Value = last
+			}
+		}
+		ret[i] = p
+	}
+	return ret
+}
+
+// DedupTolerance treats nearly-equal points of a series from multiple downstreams (e.g. HA
+// replicas scraping at slightly different times) as duplicates, instead of interleaving them
+type DedupTolerance struct {
+	// Time is the maximum time between duplicate points
+	Time model.Time
+	// Value is the maximum absolute difference of the values of duplicate points
+	Value float64
+	// Ratio is the maximum difference of the values of duplicate points, relative to the larger value
+	Ratio float64
+}
+
+// duplicate returns whether the points are duplicates (false for a nil tolerance)
+func (t *DedupTolerance) duplicate(a, b model.SamplePair) bool {
+	if t == nil {
+		return false
+	}
+	if !withinBuffer(t.Time, a.Timestamp, b.Timestamp) {
+		return false
+	}
+	diff := math.Abs(float64(a.Value - b.Value))
+	if diff <= t.Value {
+		return true
+	}
+	return diff <= t.Ratio*math.Max(math.Abs(float64(a.Value)), math.Abs(float64(b.Value)))
+}
@@ -12,10 +12,12 @@ const (
 type ErrorType string
 
 const (
-	ErrorNone     ErrorType = ""
-	ErrorTimeout  ErrorType = "timeout"
-	ErrorCanceled ErrorType = "canceled"
-	ErrorExec     ErrorType = "execution"
-	ErrorBadData  ErrorType = "bad_data"
-	ErrorInternal ErrorType = "internal"
+	ErrorNone        ErrorType = ""
+	ErrorTimeout     ErrorType = "timeout"
+	ErrorCanceled    ErrorType = "canceled"
+	ErrorExec        ErrorType = "execution"
+	ErrorBadData     ErrorType = "bad_data"
+	ErrorInternal    ErrorType = "internal"
+	ErrorUnavailable ErrorType = "unavailable"
+	ErrorNotFound    ErrorType = "not_found"
 )
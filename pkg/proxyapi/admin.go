@@ -0,0 +1,113 @@
+package proxyapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// respondAdmin writes the per-downstream results of an admin action, the
+// request fails if the action failed on any of the downstreams
+func respondAdmin(w http.ResponseWriter, results []promclient.AdminResult, warnings v1.Warnings) {
+	if results == nil {
+		results = []promclient.AdminResult{}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Server < results[j].Server
+	})
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		writeResponse(w, http.StatusInternalServerError, &response{
+			Status:    promhttputil.StatusError,
+			Data:      results,
+			ErrorType: promhttputil.ErrorInternal,
+			Error:     fmt.Sprintf("failed on %d of %d downstreams", failed, len(results)),
+			Warnings:  warnings,
+		})
+		return
+	}
+
+	respond(w, results, warnings)
+}
+
+// deleteSeries serves /api/v1/admin/tsdb/delete_series, deleting the series from
+// all downstreams which may have them
+func (a *API) deleteSeries(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondError(w, promhttputil.ErrorBadData, err, nil)
+		return
+	}
+	matches := r.Form["match[]"]
+	if len(matches) == 0 {
+		respondError(w, promhttputil.ErrorBadData, errors.New("no match[] parameter provided"), nil)
+		return
+	}
+	for _, m := range matches {
+		if _, err := parser.ParseMetricSelector(m); err != nil {
+			respondError(w, promhttputil.ErrorBadData, err, nil)
+			return
+		}
+	}
+
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		respondError(w, promhttputil.ErrorBadData, err, nil)
+		return
+	}
+
+	results, warnings, err := a.Client().DeleteSeries(r.Context(), matches, start, end)
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	respondAdmin(w, results, warnings)
+}
+
+// cleanTombstones serves /api/v1/admin/tsdb/clean_tombstones, cleaning the
+// tombstones of all downstreams
+func (a *API) cleanTombstones(w http.ResponseWriter, r *http.Request) {
+	results, warnings, err := a.Client().CleanTombstones(r.Context())
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	respondAdmin(w, results, warnings)
+}
+
+// snapshot serves /api/v1/admin/tsdb/snapshot, creating a snapshot on all
+// downstreams (the name of each snapshot is returned in the results)
+func (a *API) snapshot(w http.ResponseWriter, r *http.Request) {
+	var skipHead bool
+	if s := r.FormValue("skip_head"); s != "" {
+		var err error
+		skipHead, err = strconv.ParseBool(s)
+		if err != nil {
+			respondError(w, promhttputil.ErrorBadData, fmt.Errorf("unable to parse boolean 'skip_head' argument: %v", err), nil)
+			return
+		}
+	}
+
+	results, warnings, err := a.Client().Snapshot(r.Context(), skipHead)
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	respondAdmin(w, results, warnings)
+}
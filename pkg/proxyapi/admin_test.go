@@ -0,0 +1,113 @@
+package proxyapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+func TestDeleteSeries(t *testing.T) {
+	tests := []struct {
+		url     string
+		results []promclient.AdminResult
+		code    int
+		args    []interface{}
+	}{
+		{
+			url:     "/api/v1/admin/tsdb/delete_series?match[]=up&start=10&end=20",
+			results: []promclient.AdminResult{{Server: "b:9090"}, {Server: "a:9090"}},
+			code:    http.StatusOK,
+			args:    []interface{}{[]string{"up"}, time.Unix(10, 0).UTC(), time.Unix(20, 0).UTC()},
+		},
+		// Failures on any downstream fail the request
+		{
+			url:     "/api/v1/admin/tsdb/delete_series?match[]=up",
+			results: []promclient.AdminResult{{Server: "a:9090"}, {Server: "b:9090", Error: "unavailable"}},
+			code:    http.StatusInternalServerError,
+			args:    []interface{}{[]string{"up"}, minTime, maxTime},
+		},
+		// A selector is required
+		{
+			url:  "/api/v1/admin/tsdb/delete_series",
+			code: http.StatusBadRequest,
+		},
+		{
+			url:  "/api/v1/admin/tsdb/delete_series?match[]=up{",
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			client := &stubClient{admin: test.results}
+
+			// The endpoint is only served if the admin API is enabled
+			if code, _ := doRequest(t, client, "POST", test.url); code != http.StatusServiceUnavailable {
+				t.Fatalf("expected admin API to be disabled, got %d", code)
+			}
+
+			api := &API{Client: func() promclient.API { return client }, EnableAdmin: true}
+			code, resp := doAPIRequest(t, api, "POST", test.url)
+			if code != test.code {
+				t.Fatalf("mismatch in status code expected=%d actual=%d: %v", test.code, code, resp)
+			}
+			if !reflect.DeepEqual(client.deleteSeriesArgs, test.args) {
+				t.Fatalf("mismatch in args expected=%v actual=%v", test.args, client.deleteSeriesArgs)
+			}
+			if test.results == nil {
+				return
+			}
+
+			var data []promclient.AdminResult
+			if err := json.Unmarshal(resp.Data, &data); err != nil {
+				t.Fatalf("error unmarshaling data: %v", err)
+			}
+			if len(data) != len(test.results) || data[0].Server != "a:9090" {
+				t.Fatalf("expected results sorted by server, got %v", data)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	client := &stubClient{admin: []promclient.AdminResult{
+		{Server: "a:9090", Name: "20210101T000000Z-1"},
+		{Server: "b:9090", Error: "unavailable"},
+	}}
+	api := &API{Client: func() promclient.API { return client }, EnableAdmin: true}
+
+	code, resp := doAPIRequest(t, api, "POST", "/api/v1/admin/tsdb/snapshot?skip_head=true")
+	if code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+	if !reflect.DeepEqual(client.snapshotArgs, []interface{}{true}) {
+		t.Fatalf("unexpected args: %v", client.snapshotArgs)
+	}
+
+	// The results of each downstream are returned even though the request failed
+	var data []promclient.AdminResult
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("error unmarshaling data: %v", err)
+	}
+	if !reflect.DeepEqual(data, client.admin) {
+		t.Fatalf("mismatch in results expected=%v actual=%v", client.admin, data)
+	}
+
+	if code, resp := doAPIRequest(t, api, "POST", "/api/v1/admin/tsdb/snapshot?skip_head=maybe"); code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+}
+
+func TestCleanTombstones(t *testing.T) {
+	client := &stubClient{admin: []promclient.AdminResult{{Server: "a:9090"}}}
+	api := &API{Client: func() promclient.API { return client }, EnableAdmin: true}
+
+	code, resp := doAPIRequest(t, api, "PUT", "/api/v1/admin/tsdb/clean_tombstones")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+}
@@ -0,0 +1,41 @@
+package proxyapi
+
+import (
+	"net/http"
+	"net/url"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+// AlertmanagerRetriever provides the alertmanagers promxy itself sends alerts to
+type AlertmanagerRetriever interface {
+	Alertmanagers() []*url.URL
+	DroppedAlertmanagers() []*url.URL
+}
+
+func toAlertManagers(urls []*url.URL) []v1.AlertManager {
+	ret := make([]v1.AlertManager, len(urls))
+	for i, u := range urls {
+		ret[i] = v1.AlertManager{URL: u.String()}
+	}
+	return ret
+}
+
+// alertmanagers serves /api/v1/alertmanagers, merging the alertmanagers of promxy and all downstreams
+func (a *API) alertmanagers(w http.ResponseWriter, r *http.Request) {
+	result, warnings, err := a.Client().AlertManagers(r.Context())
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	alertManagers := v1.AlertManagersResult{Active: []v1.AlertManager{}, Dropped: []v1.AlertManager{}}
+	if a.Alertmanagers != nil {
+		alertManagers.Active = toAlertManagers(a.Alertmanagers.Alertmanagers())
+		alertManagers.Dropped = toAlertManagers(a.Alertmanagers.DroppedAlertmanagers())
+	}
+
+	respond(w, promclient.MergeAlertManagers(alertManagers, result), warnings)
+}
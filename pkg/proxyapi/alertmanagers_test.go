@@ -0,0 +1,59 @@
+package proxyapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+type stubAlertmanagers struct {
+	active, dropped []*url.URL
+}
+
+func (s *stubAlertmanagers) Alertmanagers() []*url.URL        { return s.active }
+func (s *stubAlertmanagers) DroppedAlertmanagers() []*url.URL { return s.dropped }
+
+func TestAlertmanagers(t *testing.T) {
+	client := &stubClient{
+		ams: v1.AlertManagersResult{
+			Active:  []v1.AlertManager{{URL: "http://am1/api/v1/alerts"}, {URL: "http://am2/api/v1/alerts"}},
+			Dropped: []v1.AlertManager{{URL: "http://am3/api/v1/alerts"}},
+		},
+	}
+	local := &stubAlertmanagers{
+		active: []*url.URL{{Scheme: "http", Host: "am1", Path: "/api/v1/alerts"}},
+	}
+
+	r := httprouter.New()
+	api := &API{Client: func() promclient.API { return client }, Alertmanagers: local}
+	api.Register(r, "/api/v1")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/alertmanagers", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data v1.AlertManagersResult `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error unmarshaling response: %v", err)
+	}
+
+	expected := v1.AlertManagersResult{
+		Active:  []v1.AlertManager{{URL: "http://am1/api/v1/alerts"}, {URL: "http://am2/api/v1/alerts"}},
+		Dropped: []v1.AlertManager{{URL: "http://am3/api/v1/alerts"}},
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("mismatch in alertmanagers expected=%v actual=%v", expected, resp.Data)
+	}
+}
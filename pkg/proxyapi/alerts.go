@@ -0,0 +1,48 @@
+package proxyapi
+
+import (
+	"net/http"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/prometheus/rules"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+type alertDiscovery struct {
+	Alerts []*alert `json:"alerts"`
+}
+
+// localAlerts returns the active alerts of the rules evaluated by promxy itself
+func (a *API) localAlerts() []*v1.Alert {
+	var alerts []*v1.Alert
+	if a.Rules == nil {
+		return alerts
+	}
+
+	for _, grp := range a.Rules.RuleGroups() {
+		for _, r := range grp.Rules() {
+			if rule, ok := r.(*rules.AlertingRule); ok {
+				alerts = append(alerts, localAlerts(rule.ActiveAlerts())...)
+			}
+		}
+	}
+	return alerts
+}
+
+// alerts serves /api/v1/alerts, merging the alerts of promxy and all downstreams
+func (a *API) alerts(w http.ResponseWriter, r *http.Request) {
+	result, warnings, err := a.Client().Alerts(r.Context())
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	downstreamAlerts := make([]*v1.Alert, len(result.Alerts))
+	for i := range result.Alerts {
+		downstreamAlerts[i] = &result.Alerts[i]
+	}
+	alerts := promclient.MergeAlerts(a.localAlerts(), downstreamAlerts)
+
+	respond(w, &alertDiscovery{Alerts: toAPIAlerts(alerts)}, warnings)
+}
@@ -0,0 +1,48 @@
+package proxyapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+func TestAlerts(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	client := &stubClient{
+		alerts: v1.AlertsResult{Alerts: []v1.Alert{
+			{Labels: model.LabelSet{"alertname": "Down", "job": "a"}, State: v1.AlertStateFiring, ActiveAt: now, Value: "0"},
+			{Labels: model.LabelSet{"alertname": "Down", "job": "a"}, State: v1.AlertStateFiring, ActiveAt: now.Add(-time.Minute), Value: "0"},
+			{Labels: model.LabelSet{"alertname": "Down", "job": "b"}, State: v1.AlertStatePending, ActiveAt: now, Value: "0"},
+		}},
+	}
+
+	code, resp := doRequest(t, client, "GET", "/api/v1/alerts")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+
+	var data struct {
+		Alerts []struct {
+			Labels   model.LabelSet `json:"labels"`
+			State    string         `json:"state"`
+			ActiveAt time.Time      `json:"activeAt"`
+		} `json:"alerts"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("error unmarshaling data: %v", err)
+	}
+
+	if len(data.Alerts) != 2 {
+		t.Fatalf("expected duplicate alerts to be merged: %s", resp.Data)
+	}
+	if !data.Alerts[0].ActiveAt.Equal(now.Add(-time.Minute)) || data.Alerts[0].State != "firing" {
+		t.Fatalf("expected the earliest alert to be used: %s", resp.Data)
+	}
+	if data.Alerts[1].Labels["job"] != "b" || data.Alerts[1].State != "pending" {
+		t.Fatalf("unexpected alert: %s", resp.Data)
+	}
+}
@@ -0,0 +1,192 @@
+// Package proxyapi implements the parts of the prometheus HTTP API which must be
+// answered by the downstream servergroups instead of promxy's local state (e.g.
+// metadata about the metrics scraped by the downstream prometheus hosts).
+package proxyapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// API serves the prometheus HTTP API endpoints which are fanned out to the downstreams
+type API struct {
+	// Client returns the current client to the downstreams
+	Client func() promclient.API
+	// Rules (optional) provides the rules evaluated by promxy, which are included in the rules and alerts
+	Rules RulesRetriever
+	// Alertmanagers (optional) provides the alertmanagers promxy sends alerts to
+	Alertmanagers AlertmanagerRetriever
+	// EnableAdmin enables the admin endpoints, which expose or modify the state of the downstreams
+	EnableAdmin bool
+	// ServerGroups (optional) enables the admin endpoints managing the server groups at runtime
+	ServerGroups ServerGroupStore
+	// Query (optional) serves the query endpoints evaluated by promxy, which are wrapped to
+	// track the active queries and add the stats of the downstream requests (with stats=)
+	Query http.Handler
+
+	queries queryTracker
+
+	l              sync.Mutex
+	externalLabels model.LabelSet
+}
+
+// Register registers the API handlers on the router under the given prefix (e.g. /api/v1)
+func (a *API) Register(r *httprouter.Router, prefix string) {
+	if a.Query != nil {
+		r.HandlerFunc("GET", path.Join(prefix, "/query"), a.query)
+		r.HandlerFunc("POST", path.Join(prefix, "/query"), a.query)
+		r.HandlerFunc("GET", path.Join(prefix, "/query_range"), a.query)
+		r.HandlerFunc("POST", path.Join(prefix, "/query_range"), a.query)
+		r.HandlerFunc("GET", path.Join(prefix, "/admin/queries"), a.admin(a.activeQueries))
+		r.HandlerFunc("DELETE", path.Join(prefix, "/admin/queries/:id"), a.admin(a.cancelQuery))
+	}
+	r.HandlerFunc("GET", path.Join(prefix, "/label/:name/values"), a.labelValues)
+	r.HandlerFunc("GET", path.Join(prefix, "/metadata"), a.metadata)
+	r.HandlerFunc("GET", path.Join(prefix, "/targets"), a.targets)
+	r.HandlerFunc("GET", path.Join(prefix, "/rules"), a.rules)
+	r.HandlerFunc("GET", path.Join(prefix, "/alerts"), a.alerts)
+	r.HandlerFunc("GET", path.Join(prefix, "/alertmanagers"), a.alertmanagers)
+	r.HandlerFunc("GET", path.Join(prefix, "/query_exemplars"), a.queryExemplars)
+	r.HandlerFunc("POST", path.Join(prefix, "/query_exemplars"), a.queryExemplars)
+	r.HandlerFunc("GET", path.Join(prefix, "/status/tsdb"), a.tsdbStatus)
+	r.HandlerFunc("GET", path.Join(prefix, "/status/downstreams"), a.downstreamsStatus)
+	r.HandlerFunc("GET", path.Join(prefix, "/status/downstreams/config"), a.admin(a.downstreamsConfig))
+	r.HandlerFunc("POST", path.Join(prefix, "/admin/tsdb/delete_series"), a.admin(a.deleteSeries))
+	r.HandlerFunc("PUT", path.Join(prefix, "/admin/tsdb/delete_series"), a.admin(a.deleteSeries))
+	r.HandlerFunc("POST", path.Join(prefix, "/admin/tsdb/clean_tombstones"), a.admin(a.cleanTombstones))
+	r.HandlerFunc("PUT", path.Join(prefix, "/admin/tsdb/clean_tombstones"), a.admin(a.cleanTombstones))
+	r.HandlerFunc("POST", path.Join(prefix, "/admin/tsdb/snapshot"), a.admin(a.snapshot))
+	r.HandlerFunc("PUT", path.Join(prefix, "/admin/tsdb/snapshot"), a.admin(a.snapshot))
+	r.HandlerFunc("GET", path.Join(prefix, "/server_groups"), a.admin(a.serverGroups))
+	r.HandlerFunc("PUT", path.Join(prefix, "/server_groups/:name"), a.admin(a.putServerGroup))
+	r.HandlerFunc("DELETE", path.Join(prefix, "/server_groups/:name"), a.admin(a.deleteServerGroup))
+}
+
+// admin wraps a handler of an admin endpoint, which is only served if EnableAdmin is set
+func (a *API) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.EnableAdmin {
+			respondError(w, promhttputil.ErrorUnavailable, errors.New("admin APIs disabled"), nil)
+			return
+		}
+		h(w, r)
+	}
+}
+
+type response struct {
+	Status    promhttputil.Status    `json:"status"`
+	Data      interface{}            `json:"data,omitempty"`
+	ErrorType promhttputil.ErrorType `json:"errorType,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Warnings  []string               `json:"warnings,omitempty"`
+}
+
+// respond writes a successful response with the given data and warnings
+func respond(w http.ResponseWriter, data interface{}, warnings v1.Warnings) {
+	writeResponse(w, http.StatusOK, &response{
+		Status:   promhttputil.StatusSuccess,
+		Data:     data,
+		Warnings: warnings,
+	})
+}
+
+// respondError writes an error response, the status code is derived from the error type
+func respondError(w http.ResponseWriter, errorType promhttputil.ErrorType, err error, warnings v1.Warnings) {
+	code := http.StatusInternalServerError
+	switch errorType {
+	case promhttputil.ErrorBadData:
+		code = http.StatusBadRequest
+	case promhttputil.ErrorExec:
+		code = http.StatusUnprocessableEntity
+	case promhttputil.ErrorNotFound:
+		code = http.StatusNotFound
+	case promhttputil.ErrorCanceled, promhttputil.ErrorTimeout, promhttputil.ErrorUnavailable:
+		code = http.StatusServiceUnavailable
+	}
+
+	writeResponse(w, code, &response{
+		Status:    promhttputil.StatusError,
+		ErrorType: errorType,
+		Error:     err.Error(),
+		Warnings:  warnings,
+	})
+}
+
+// errorType returns the ErrorType for an error returned by the downstreams
+func errorType(err error) promhttputil.ErrorType {
+	switch err {
+	case context.Canceled:
+		return promhttputil.ErrorCanceled
+	case context.DeadlineExceeded:
+		return promhttputil.ErrorTimeout
+	}
+	return promhttputil.ErrorInternal
+}
+
+var (
+	minTime = time.Unix(math.MinInt64/1000+62135596801, 0).UTC()
+	maxTime = time.Unix(math.MaxInt64/1000-62135596801, 999999999).UTC()
+)
+
+// parseTime parses a time as the prometheus API does (unix timestamp or RFC3339)
+func parseTime(s string, defaultTime time.Time) (time.Time, error) {
+	if s == "" {
+		return defaultTime, nil
+	}
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, ns := math.Modf(t)
+		ns = math.Round(ns*1000) / 1000
+		return time.Unix(int64(sec), int64(ns*float64(time.Second))).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
+// parseTimeRange parses the start and end parameters of the request
+func parseTimeRange(r *http.Request) (start, end time.Time, err error) {
+	start, err = parseTime(r.FormValue("start"), minTime)
+	if err != nil {
+		return start, end, fmt.Errorf("invalid parameter 'start': %v", err)
+	}
+	end, err = parseTime(r.FormValue("end"), maxTime)
+	if err != nil {
+		return start, end, fmt.Errorf("invalid parameter 'end': %v", err)
+	}
+	if end.Before(start) {
+		return start, end, fmt.Errorf("end timestamp must not be before start time")
+	}
+	return start, end, nil
+}
+
+func writeResponse(w http.ResponseWriter, code int, resp *response) {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		logrus.Errorf("error marshaling API response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(b); err != nil {
+		logrus.Errorf("error writing API response: %v", err)
+	}
+}
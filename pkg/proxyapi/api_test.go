@@ -0,0 +1,254 @@
+package proxyapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// stubClient implements the methods of promclient.API required by the tests
+type stubClient struct {
+	promclient.API
+	metadata    map[string][]v1.Metadata
+	targets     v1.TargetsResult
+	rules       v1.RulesResult
+	alerts      v1.AlertsResult
+	ams         v1.AlertManagersResult
+	exemplars   []promclient.ExemplarQueryResult
+	tsdb        promclient.TSDBResult
+	buildinfo   []promclient.BuildinfoResult
+	runtimeinfo []promclient.RuntimeinfoResult
+	config      []promclient.ConfigResult
+	admin       []promclient.AdminResult
+
+	// arguments of the last LabelValues call
+	labelValuesArgs []interface{}
+	// arguments of the last DeleteSeries call
+	deleteSeriesArgs []interface{}
+	// arguments of the last Snapshot call
+	snapshotArgs []interface{}
+	warnings     v1.Warnings
+	err          error
+}
+
+func (s *stubClient) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	if s.err != nil {
+		return nil, s.warnings, s.err
+	}
+	ret := make(map[string][]v1.Metadata)
+	for k, v := range s.metadata {
+		if metric == "" || metric == k {
+			ret[k] = v
+		}
+	}
+	return ret, s.warnings, nil
+}
+
+func (s *stubClient) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	return s.targets, s.warnings, s.err
+}
+
+func (s *stubClient) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	return s.rules, s.warnings, s.err
+}
+
+func (s *stubClient) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	return s.alerts, s.warnings, s.err
+}
+
+func (s *stubClient) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	return s.ams, s.warnings, s.err
+}
+
+func (s *stubClient) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]promclient.ExemplarQueryResult, v1.Warnings, error) {
+	return s.exemplars, s.warnings, s.err
+}
+
+func (s *stubClient) TSDB(ctx context.Context) (promclient.TSDBResult, v1.Warnings, error) {
+	return s.tsdb, s.warnings, s.err
+}
+
+func (s *stubClient) Buildinfo(ctx context.Context) ([]promclient.BuildinfoResult, v1.Warnings, error) {
+	return s.buildinfo, s.warnings, s.err
+}
+
+func (s *stubClient) Runtimeinfo(ctx context.Context) ([]promclient.RuntimeinfoResult, v1.Warnings, error) {
+	return s.runtimeinfo, s.warnings, s.err
+}
+
+func (s *stubClient) Config(ctx context.Context) ([]promclient.ConfigResult, v1.Warnings, error) {
+	return s.config, s.warnings, s.err
+}
+
+func (s *stubClient) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]promclient.AdminResult, v1.Warnings, error) {
+	s.deleteSeriesArgs = []interface{}{matches, startTime, endTime}
+	return s.admin, s.warnings, s.err
+}
+
+func (s *stubClient) CleanTombstones(ctx context.Context) ([]promclient.AdminResult, v1.Warnings, error) {
+	return s.admin, s.warnings, s.err
+}
+
+func (s *stubClient) Snapshot(ctx context.Context, skipHead bool) ([]promclient.AdminResult, v1.Warnings, error) {
+	s.snapshotArgs = []interface{}{skipHead}
+	return s.admin, s.warnings, s.err
+}
+
+func (s *stubClient) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	s.labelValuesArgs = []interface{}{label, matchers, startTime, endTime}
+	return model.LabelValues{"a", "b"}, s.warnings, s.err
+}
+
+type testResponse struct {
+	Status    promhttputil.Status    `json:"status"`
+	Data      json.RawMessage        `json:"data"`
+	ErrorType promhttputil.ErrorType `json:"errorType"`
+	Error     string                 `json:"error"`
+	Warnings  []string               `json:"warnings"`
+}
+
+// doRequest makes a request against the API with the given client, returning the status code and response
+func doRequest(t *testing.T, client promclient.API, method, url string) (int, *testResponse) {
+	return doAPIRequest(t, &API{Client: func() promclient.API { return client }}, method, url)
+}
+
+// doAPIRequest makes a request against the given API, returning the status code and response
+func doAPIRequest(t *testing.T, api *API, method, url string) (int, *testResponse) {
+	r := httprouter.New()
+	api.Register(r, "/api/v1")
+
+	req := httptest.NewRequest(method, url, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	resp := &testResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatalf("error unmarshaling response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+func TestMetadata(t *testing.T) {
+	metadata := map[string][]v1.Metadata{
+		"requests_total": {{Type: v1.MetricTypeCounter, Help: "Total requests"}},
+		"temperature":    {{Type: v1.MetricTypeGauge, Help: "Temperature", Unit: "celsius"}},
+	}
+
+	tests := []struct {
+		client   *stubClient
+		url      string
+		code     int
+		data     map[string][]v1.Metadata
+		warnings []string
+	}{
+		{
+			client: &stubClient{metadata: metadata},
+			url:    "/api/v1/metadata",
+			code:   http.StatusOK,
+			data:   metadata,
+		},
+		{
+			client: &stubClient{metadata: metadata, warnings: v1.Warnings{"downstream a failed"}},
+			url:    "/api/v1/metadata?metric=temperature",
+			code:   http.StatusOK,
+			data: map[string][]v1.Metadata{
+				"temperature": metadata["temperature"],
+			},
+			warnings: []string{"downstream a failed"},
+		},
+		{
+			client: &stubClient{metadata: metadata},
+			url:    "/api/v1/metadata?limit=a",
+			code:   http.StatusBadRequest,
+		},
+		{
+			client: &stubClient{err: fmt.Errorf("downstream error")},
+			url:    "/api/v1/metadata",
+			code:   http.StatusInternalServerError,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			code, resp := doRequest(t, test.client, "GET", test.url)
+			if code != test.code {
+				t.Fatalf("mismatch in status code expected=%d actual=%d: %v", test.code, code, resp)
+			}
+			if code != http.StatusOK {
+				if resp.Status != promhttputil.StatusError || resp.Error == "" {
+					t.Fatalf("expected error response, got %v", resp)
+				}
+				return
+			}
+
+			var data map[string][]v1.Metadata
+			if err := json.Unmarshal(resp.Data, &data); err != nil {
+				t.Fatalf("error unmarshaling data: %v", err)
+			}
+			if !reflect.DeepEqual(data, test.data) {
+				t.Fatalf("mismatch in data expected=%v actual=%v", test.data, data)
+			}
+			if !reflect.DeepEqual(resp.Warnings, test.warnings) {
+				t.Fatalf("mismatch in warnings expected=%v actual=%v", test.warnings, resp.Warnings)
+			}
+		})
+	}
+}
+
+func TestTargets(t *testing.T) {
+	client := &stubClient{
+		targets: v1.TargetsResult{
+			Active: []v1.ActiveTarget{{
+				Labels:    model.LabelSet{"job": "a", "sg": "1"},
+				ScrapeURL: "http://a/metrics",
+				Health:    v1.HealthGood,
+			}},
+			Dropped: []v1.DroppedTarget{{
+				DiscoveredLabels: map[string]string{"__address__": "b"},
+			}},
+		},
+	}
+
+	tests := []struct {
+		url     string
+		active  int
+		dropped int
+	}{
+		{url: "/api/v1/targets", active: 1, dropped: 1},
+		{url: "/api/v1/targets?state=any", active: 1, dropped: 1},
+		{url: "/api/v1/targets?state=active", active: 1, dropped: 0},
+		{url: "/api/v1/targets?state=dropped", active: 0, dropped: 1},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			code, resp := doRequest(t, client, "GET", test.url)
+			if code != http.StatusOK {
+				t.Fatalf("unexpected status code %d: %v", code, resp)
+			}
+
+			var data v1.TargetsResult
+			if err := json.Unmarshal(resp.Data, &data); err != nil {
+				t.Fatalf("error unmarshaling data: %v", err)
+			}
+			if len(data.Active) != test.active || len(data.Dropped) != test.dropped {
+				t.Fatalf("mismatch in targets expected active=%d dropped=%d actual=%v", test.active, test.dropped, data)
+			}
+			if test.active > 0 && !data.Active[0].Labels.Equal(client.targets.Active[0].Labels) {
+				t.Fatalf("mismatch in target labels expected=%v actual=%v", client.targets.Active[0].Labels, data.Active[0].Labels)
+			}
+		})
+	}
+}
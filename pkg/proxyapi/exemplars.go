@@ -0,0 +1,32 @@
+package proxyapi
+
+import (
+	"net/http"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// queryExemplars serves /api/v1/query_exemplars, merging the exemplars of all downstreams
+func (a *API) queryExemplars(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		respondError(w, promhttputil.ErrorBadData, err, nil)
+		return
+	}
+
+	query := r.FormValue("query")
+	if _, err := parser.ParseExpr(query); err != nil {
+		respondError(w, promhttputil.ErrorBadData, err, nil)
+		return
+	}
+
+	exemplars, warnings, err := a.Client().QueryExemplars(r.Context(), query, start, end)
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	respond(w, exemplars, warnings)
+}
@@ -0,0 +1,55 @@
+package proxyapi
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		s   string
+		t   time.Time
+		err bool
+	}{
+		{s: "", t: minTime},
+		{s: "1600096945.479", t: time.Unix(1600096945, 479000000).UTC()},
+		{s: "2020-09-14T15:22:25.479Z", t: time.Unix(1600096945, 479000000).UTC()},
+		{s: "foo", err: true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			ts, err := parseTime(test.s, minTime)
+			if (err != nil) != test.err {
+				t.Fatalf("mismatch in error expected=%v actual=%v", test.err, err)
+			}
+			if !ts.Equal(test.t) {
+				t.Fatalf("mismatch in time expected=%v actual=%v", test.t, ts)
+			}
+		})
+	}
+}
+
+func TestQueryExemplars(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		code   int
+	}{
+		{method: "GET", url: "/api/v1/query_exemplars?query=a&start=1&end=2", code: http.StatusOK},
+		{method: "POST", url: "/api/v1/query_exemplars?query=a", code: http.StatusOK},
+		{method: "GET", url: "/api/v1/query_exemplars?query=a(", code: http.StatusBadRequest},
+		{method: "GET", url: "/api/v1/query_exemplars?query=a&start=2&end=1", code: http.StatusBadRequest},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			code, resp := doRequest(t, &stubClient{}, test.method, test.url)
+			if code != test.code {
+				t.Fatalf("mismatch in status code expected=%d actual=%d: %v", test.code, code, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package proxyapi
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/sirupsen/logrus"
+
+	proxyconfig "github.com/jacksontj/promxy/pkg/config"
+)
+
+// ApplyConfig applies the parts of the config used by the API (the external labels)
+func (a *API) ApplyConfig(cfg *proxyconfig.Config) error {
+	externalLabels := make(model.LabelSet, len(cfg.PromConfig.GlobalConfig.ExternalLabels))
+	for _, l := range cfg.PromConfig.GlobalConfig.ExternalLabels {
+		externalLabels[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	a.l.Lock()
+	defer a.l.Unlock()
+	a.externalLabels = externalLabels
+	return nil
+}
+
+// Federate serves /federate, the latest samples of the series matching the match[] selectors
+// in the merged view of the downstreams, with promxy's external labels attached. The selectors
+// are evaluated as instant queries, so the samples are exposed without timestamps (and get the
+// timestamp of the scrape).
+func (a *API) Federate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "error parsing form values: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, s := range r.Form["match[]"] {
+		if _, err := parser.ParseMetricSelector(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The series matching multiple selectors are only exposed once
+	now := time.Now()
+	series := make(map[model.Fingerprint]*model.Sample)
+	for _, s := range r.Form["match[]"] {
+		v, _, err := a.Client().Query(r.Context(), s, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		vector, ok := v.(model.Vector)
+		if !ok {
+			continue
+		}
+		for _, sample := range vector {
+			series[sample.Metric.Fingerprint()] = sample
+		}
+	}
+
+	vector := make(model.Vector, 0, len(series))
+	for _, sample := range series {
+		vector = append(vector, sample)
+	}
+	sort.Slice(vector, func(i, j int) bool {
+		if ni, nj := vector[i].Metric[model.MetricNameLabel], vector[j].Metric[model.MetricNameLabel]; ni != nj {
+			return ni < nj
+		}
+		return vector[i].Metric.Before(vector[j].Metric)
+	})
+
+	a.l.Lock()
+	externalLabels := a.externalLabels
+	a.l.Unlock()
+
+	format := expfmt.Negotiate(r.Header)
+	w.Header().Set("Content-Type", string(format))
+	enc := expfmt.NewEncoder(w, format)
+
+	var family *dto.MetricFamily
+	for _, sample := range vector {
+		name := string(sample.Metric[model.MetricNameLabel])
+		if name == "" {
+			continue
+		}
+		if family == nil || family.GetName() != name {
+			if family != nil {
+				if err := enc.Encode(family); err != nil {
+					logrus.Errorf("Error encoding the federated metrics: %v", err)
+					return
+				}
+			}
+			family = &dto.MetricFamily{Name: &name, Type: dto.MetricType_UNTYPED.Enum()}
+		}
+		family.Metric = append(family.Metric, federatedMetric(sample, externalLabels))
+	}
+	if family != nil {
+		if err := enc.Encode(family); err != nil {
+			logrus.Errorf("Error encoding the federated metrics: %v", err)
+		}
+	}
+}
+
+// federatedMetric returns the metric of the sample, with the external labels it doesn't have
+// (and an empty instance label, as prometheus does) attached
+func federatedMetric(sample *model.Sample, externalLabels model.LabelSet) *dto.Metric {
+	metric := make(model.LabelSet, len(sample.Metric)+len(externalLabels)+1)
+	metric[model.InstanceLabel] = ""
+	for k, v := range externalLabels {
+		metric[k] = v
+	}
+	for k, v := range sample.Metric {
+		if k != model.MetricNameLabel && v != "" {
+			metric[k] = v
+		}
+	}
+
+	names := make(model.LabelNames, 0, len(metric))
+	for k := range metric {
+		names = append(names, k)
+	}
+	sort.Sort(names)
+
+	value := float64(sample.Value)
+	ret := &dto.Metric{Untyped: &dto.Untyped{Value: &value}}
+	for _, k := range names {
+		name, value := string(k), string(metric[k])
+		ret.Label = append(ret.Label, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	return ret
+}
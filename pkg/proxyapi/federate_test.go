@@ -0,0 +1,65 @@
+package proxyapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	proxyconfig "github.com/jacksontj/promxy/pkg/config"
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+// queryClient returns the vector of the queried selector
+type queryClient struct {
+	promclient.API
+	vectors map[string]model.Vector
+}
+
+func (q *queryClient) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	return q.vectors[query], nil, nil
+}
+
+func TestFederate(t *testing.T) {
+	client := &queryClient{vectors: map[string]model.Vector{
+		`{job="a"}`: {
+			{Metric: model.Metric{"__name__": "up", "job": "a", "instance": "x:9090"}, Value: 1},
+			{Metric: model.Metric{"__name__": "requests_total", "job": "a", "region": "us"}, Value: 10},
+		},
+		`up`: {
+			{Metric: model.Metric{"__name__": "up", "job": "a", "instance": "x:9090"}, Value: 1},
+			{Metric: model.Metric{"__name__": "up", "job": "b", "instance": "y:9090"}, Value: 0},
+		},
+	}}
+	api := &API{Client: func() promclient.API { return client }}
+	cfg := &proxyconfig.Config{}
+	cfg.PromConfig.GlobalConfig.ExternalLabels = labels.FromStrings("region", "eu")
+	api.ApplyConfig(cfg)
+
+	w := httptest.NewRecorder()
+	api.Federate(w, httptest.NewRequest("GET", `/federate?match[]={job="a"}&match[]=up`, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", w.Code, w.Body)
+	}
+	// The series of both selectors are merged, external labels don't override the series' labels
+	expected := `# TYPE requests_total untyped
+requests_total{instance="",job="a",region="us"} 10
+# TYPE up untyped
+up{instance="x:9090",job="a",region="eu"} 1
+up{instance="y:9090",job="b",region="eu"} 0
+`
+	if w.Body.String() != expected {
+		t.Fatalf("unexpected response:\n%s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	api.Federate(w, httptest.NewRequest("GET", `/federate?match[]={job="a"`, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,51 @@
+package proxyapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// labelValues serves /api/v1/label/:name/values, passing the matchers and time
+// range through to the downstreams instead of fetching all values of all time
+func (a *API) labelValues(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+	if !model.LabelNameRE.MatchString(name) {
+		respondError(w, promhttputil.ErrorBadData, fmt.Errorf("invalid label name: %q", name), nil)
+		return
+	}
+
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		respondError(w, promhttputil.ErrorBadData, err, nil)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		respondError(w, promhttputil.ErrorBadData, err, nil)
+		return
+	}
+	matchers := r.Form["match[]"]
+	for _, m := range matchers {
+		if _, err := parser.ParseMetricSelector(m); err != nil {
+			respondError(w, promhttputil.ErrorBadData, err, nil)
+			return
+		}
+	}
+
+	values, warnings, err := a.Client().LabelValues(r.Context(), name, matchers, start, end)
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+	if values == nil {
+		values = model.LabelValues{}
+	}
+
+	respond(w, values, warnings)
+}
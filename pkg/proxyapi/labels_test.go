@@ -0,0 +1,53 @@
+package proxyapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLabelValues(t *testing.T) {
+	tests := []struct {
+		url  string
+		code int
+		args []interface{}
+	}{
+		{
+			url:  "/api/v1/label/job/values",
+			code: http.StatusOK,
+			args: []interface{}{"job", []string(nil), minTime, maxTime},
+		},
+		{
+			url:  "/api/v1/label/job/values?match[]=up&match[]=process_start_time_seconds&start=1&end=2",
+			code: http.StatusOK,
+			args: []interface{}{"job", []string{"up", "process_start_time_seconds"}, time.Unix(1, 0).UTC(), time.Unix(2, 0).UTC()},
+		},
+		{
+			url:  "/api/v1/label/job/values?match[]=up{",
+			code: http.StatusBadRequest,
+		},
+		{
+			url:  "/api/v1/label/job/values?start=a",
+			code: http.StatusBadRequest,
+		},
+		{
+			url:  "/api/v1/label/0job/values",
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			client := &stubClient{}
+			code, resp := doRequest(t, client, "GET", test.url)
+			if code != test.code {
+				t.Fatalf("mismatch in status code expected=%d actual=%d: %v", test.code, code, resp)
+			}
+			if !reflect.DeepEqual(client.labelValuesArgs, test.args) {
+				t.Fatalf("mismatch in args expected=%v actual=%v", test.args, client.labelValuesArgs)
+			}
+		})
+	}
+}
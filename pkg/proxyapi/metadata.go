@@ -0,0 +1,28 @@
+package proxyapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// metadata serves /api/v1/metadata, merging the metric metadata of all downstreams
+func (a *API) metadata(w http.ResponseWriter, r *http.Request) {
+	limit := r.FormValue("limit")
+	if limit != "" {
+		if _, err := strconv.Atoi(limit); err != nil {
+			respondError(w, promhttputil.ErrorBadData, fmt.Errorf("limit must be a number"), nil)
+			return
+		}
+	}
+
+	metadata, warnings, err := a.Client().Metadata(r.Context(), r.FormValue("metric"), limit)
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	respond(w, metadata, warnings)
+}
@@ -0,0 +1,128 @@
+package proxyapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// activeQuery is a query being evaluated by promxy
+type activeQuery struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query"`
+	Client    string    `json:"client"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Start     time.Time `json:"start"`
+	// Elapsed is the time (in seconds) since the start of the query
+	Elapsed float64 `json:"elapsed"`
+	// Downstreams are the requests to the downstreams made for the query so far
+	Downstreams []promclient.DownstreamStats `json:"downstreams"`
+
+	stats  *promclient.QueryStats
+	cancel context.CancelFunc
+}
+
+// queryTracker tracks the active queries, such that they can be listed and cancelled
+type queryTracker struct {
+	l       sync.Mutex
+	lastID  uint64
+	queries map[string]*activeQuery
+}
+
+// add adds the query (assigning its ID), the returned func removes it
+func (t *queryTracker) add(q *activeQuery) func() {
+	t.l.Lock()
+	defer t.l.Unlock()
+	if t.queries == nil {
+		t.queries = make(map[string]*activeQuery)
+	}
+	t.lastID++
+	q.ID = strconv.FormatUint(t.lastID, 10)
+	t.queries[q.ID] = q
+
+	return func() {
+		t.l.Lock()
+		defer t.l.Unlock()
+		delete(t.queries, q.ID)
+	}
+}
+
+// list returns the active queries, oldest first
+func (t *queryTracker) list() []activeQuery {
+	t.l.Lock()
+	defer t.l.Unlock()
+	now := time.Now()
+	ret := make([]activeQuery, 0, len(t.queries))
+	for _, q := range t.queries {
+		item := *q
+		item.Elapsed = now.Sub(q.Start).Seconds()
+		item.Downstreams = q.stats.Downstreams()
+		ret = append(ret, item)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Start.Before(ret[j].Start)
+	})
+	return ret
+}
+
+// cancel cancels the query with the given ID, returning whether it is active
+func (t *queryTracker) cancel(id string) bool {
+	t.l.Lock()
+	defer t.l.Unlock()
+	q, ok := t.queries[id]
+	if ok {
+		q.cancel()
+	}
+	return ok
+}
+
+// query serves the query endpoints with the Query handler, tracking the query while
+// it is evaluated (see queryStats for the stats parameter)
+func (a *API) query(w http.ResponseWriter, r *http.Request) {
+	s := &promclient.QueryStats{Param: r.FormValue("stats")}
+	ctx, cancel := context.WithCancel(promclient.WithQueryStats(r.Context(), s))
+	defer cancel()
+
+	remove := a.queries.add(&activeQuery{
+		Path:      r.URL.Path,
+		Query:     r.FormValue("query"),
+		Client:    r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+		Start:     time.Now(),
+		stats:     s,
+		cancel:    cancel,
+	})
+	defer remove()
+
+	r = r.WithContext(ctx)
+	if s.Param == "" {
+		a.Query.ServeHTTP(w, r)
+		return
+	}
+	a.queryStats(w, r, s)
+}
+
+// activeQueries serves /api/v1/admin/queries, listing the queries being evaluated
+func (a *API) activeQueries(w http.ResponseWriter, r *http.Request) {
+	respond(w, a.queries.list(), nil)
+}
+
+// cancelQuery serves /api/v1/admin/queries/:id, cancelling the query
+func (a *API) cancelQuery(w http.ResponseWriter, r *http.Request) {
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	if !a.queries.cancel(id) {
+		respondError(w, promhttputil.ErrorNotFound, errors.New("query not found"), nil)
+		return
+	}
+	respond(w, nil, nil)
+}
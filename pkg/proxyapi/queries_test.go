@@ -0,0 +1,74 @@
+package proxyapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+func TestActiveQueries(t *testing.T) {
+	started := make(chan struct{})
+	// query blocks until the query is cancelled
+	query := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		promclient.QueryStatsFromContext(r.Context()).Add(promclient.DownstreamStats{Server: "http://a", Path: "/api/v1/query", Query: "up"})
+		close(started)
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	api := &API{Query: query, EnableAdmin: true}
+
+	done := make(chan int)
+	go func() {
+		r := httptest.NewRequest("GET", "/api/v1/query?query=up", nil)
+		w := httptest.NewRecorder()
+		api.query(w, r)
+		done <- w.Code
+	}()
+	<-started
+
+	code, resp := doAPIRequest(t, api, "GET", "/api/v1/admin/queries")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+	var queries []activeQuery
+	if err := json.Unmarshal(resp.Data, &queries); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 || queries[0].Query != "up" || queries[0].Path != "/api/v1/query" || len(queries[0].Downstreams) != 1 {
+		t.Fatalf("unexpected active queries: %+v", queries)
+	}
+
+	if code, resp := doAPIRequest(t, api, "DELETE", "/api/v1/admin/queries/unknown"); code != http.StatusNotFound {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+	if code, resp := doAPIRequest(t, api, "DELETE", "/api/v1/admin/queries/"+queries[0].ID); code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+	select {
+	case code := <-done:
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("unexpected status code of the cancelled query %d", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("query wasn't cancelled")
+	}
+
+	// Once done the query is no longer active
+	_, resp = doAPIRequest(t, api, "GET", "/api/v1/admin/queries")
+	if err := json.Unmarshal(resp.Data, &queries); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 0 {
+		t.Fatalf("unexpected active queries: %+v", queries)
+	}
+
+	// The admin endpoints are only served if enabled
+	api.EnableAdmin = false
+	if code, resp := doAPIRequest(t, api, "GET", "/api/v1/admin/queries"); code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+}
@@ -0,0 +1,226 @@
+package proxyapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/rules"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+// RulesRetriever provides the rule groups evaluated by promxy itself
+type RulesRetriever interface {
+	RuleGroups() []*rules.Group
+}
+
+// The v1 client types don't marshal to the same JSON as the prometheus API
+// (e.g. the type of the rules is lost), so we have our own types for the responses
+
+type ruleDiscovery struct {
+	RuleGroups []*ruleGroup `json:"groups"`
+}
+
+type ruleGroup struct {
+	Name     string        `json:"name"`
+	File     string        `json:"file"`
+	Rules    []interface{} `json:"rules"`
+	Interval float64       `json:"interval"`
+}
+
+type alertingRule struct {
+	State       string         `json:"state"`
+	Name        string         `json:"name"`
+	Query       string         `json:"query"`
+	Duration    float64        `json:"duration"`
+	Labels      model.LabelSet `json:"labels"`
+	Annotations model.LabelSet `json:"annotations"`
+	Alerts      []*alert       `json:"alerts"`
+	Health      v1.RuleHealth  `json:"health"`
+	LastError   string         `json:"lastError,omitempty"`
+	Type        string         `json:"type"`
+}
+
+type recordingRule struct {
+	Name      string         `json:"name"`
+	Query     string         `json:"query"`
+	Labels    model.LabelSet `json:"labels,omitempty"`
+	Health    v1.RuleHealth  `json:"health"`
+	LastError string         `json:"lastError,omitempty"`
+	Type      string         `json:"type"`
+}
+
+type alert struct {
+	Labels      model.LabelSet `json:"labels"`
+	Annotations model.LabelSet `json:"annotations"`
+	State       v1.AlertState  `json:"state"`
+	ActiveAt    *time.Time     `json:"activeAt,omitempty"`
+	Value       string         `json:"value"`
+}
+
+func toAPIAlerts(alerts []*v1.Alert) []*alert {
+	ret := make([]*alert, len(alerts))
+	for i, a := range alerts {
+		activeAt := a.ActiveAt
+		ret[i] = &alert{
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			State:       a.State,
+			ActiveAt:    &activeAt,
+			Value:       a.Value,
+		}
+	}
+	return ret
+}
+
+// alertingRuleState returns the state of an alerting rule based on its alerts
+func alertingRuleState(alerts []*v1.Alert) string {
+	state := rules.StateInactive
+	for _, a := range alerts {
+		switch a.State {
+		case v1.AlertStateFiring:
+			return rules.StateFiring.String()
+		case v1.AlertStatePending:
+			state = rules.StatePending
+		}
+	}
+	return state.String()
+}
+
+func labelsToLabelSet(lbls labels.Labels) model.LabelSet {
+	ret := make(model.LabelSet, len(lbls))
+	for _, l := range lbls {
+		ret[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	return ret
+}
+
+func localAlerts(alerts []*rules.Alert) []*v1.Alert {
+	ret := make([]*v1.Alert, len(alerts))
+	for i, a := range alerts {
+		ret[i] = &v1.Alert{
+			ActiveAt:    a.ActiveAt,
+			Annotations: labelsToLabelSet(a.Annotations),
+			Labels:      labelsToLabelSet(a.Labels),
+			State:       v1.AlertState(a.State.String()),
+			Value:       strconv.FormatFloat(a.Value, 'e', -1, 64),
+		}
+	}
+	return ret
+}
+
+// localRules returns the rules evaluated by promxy itself
+func (a *API) localRules() v1.RulesResult {
+	result := v1.RulesResult{Groups: []v1.RuleGroup{}}
+	if a.Rules == nil {
+		return result
+	}
+
+	for _, grp := range a.Rules.RuleGroups() {
+		group := v1.RuleGroup{
+			Name:     grp.Name(),
+			File:     grp.File(),
+			Interval: grp.Interval().Seconds(),
+			Rules:    v1.Rules{},
+		}
+		for _, r := range grp.Rules() {
+			lastError := ""
+			if r.LastError() != nil {
+				lastError = r.LastError().Error()
+			}
+			switch rule := r.(type) {
+			case *rules.AlertingRule:
+				group.Rules = append(group.Rules, v1.AlertingRule{
+					Name:        rule.Name(),
+					Query:       rule.Query().String(),
+					Duration:    rule.HoldDuration().Seconds(),
+					Labels:      labelsToLabelSet(rule.Labels()),
+					Annotations: labelsToLabelSet(rule.Annotations()),
+					Alerts:      localAlerts(rule.ActiveAlerts()),
+					Health:      v1.RuleHealth(rule.Health()),
+					LastError:   lastError,
+				})
+			case *rules.RecordingRule:
+				group.Rules = append(group.Rules, v1.RecordingRule{
+					Name:      rule.Name(),
+					Query:     rule.Query().String(),
+					Labels:    labelsToLabelSet(rule.Labels()),
+					Health:    v1.RuleHealth(rule.Health()),
+					LastError: lastError,
+				})
+			}
+		}
+		result.Groups = append(result.Groups, group)
+	}
+	return result
+}
+
+// rules serves /api/v1/rules, merging the rules of promxy and all downstreams
+func (a *API) rules(w http.ResponseWriter, r *http.Request) {
+	typ := strings.ToLower(r.FormValue("type"))
+	if typ != "" && typ != "alert" && typ != "record" {
+		respondError(w, promhttputil.ErrorBadData, fmt.Errorf("invalid parameter 'type': not supported value %q", typ), nil)
+		return
+	}
+	returnAlerts := typ == "" || typ == "alert"
+	returnRecording := typ == "" || typ == "record"
+
+	result, warnings, err := a.Client().Rules(r.Context())
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+	result = promclient.MergeRules(a.localRules(), result)
+
+	res := &ruleDiscovery{RuleGroups: make([]*ruleGroup, len(result.Groups))}
+	for i, grp := range result.Groups {
+		group := &ruleGroup{
+			Name:     grp.Name,
+			File:     grp.File,
+			Interval: grp.Interval,
+			Rules:    []interface{}{},
+		}
+		for _, rule := range grp.Rules {
+			switch rule := rule.(type) {
+			case v1.AlertingRule:
+				if !returnAlerts {
+					continue
+				}
+				group.Rules = append(group.Rules, alertingRule{
+					State:       alertingRuleState(rule.Alerts),
+					Name:        rule.Name,
+					Query:       rule.Query,
+					Duration:    rule.Duration,
+					Labels:      rule.Labels,
+					Annotations: rule.Annotations,
+					Alerts:      toAPIAlerts(rule.Alerts),
+					Health:      rule.Health,
+					LastError:   rule.LastError,
+					Type:        "alerting",
+				})
+			case v1.RecordingRule:
+				if !returnRecording {
+					continue
+				}
+				group.Rules = append(group.Rules, recordingRule{
+					Name:      rule.Name,
+					Query:     rule.Query,
+					Labels:    rule.Labels,
+					Health:    rule.Health,
+					LastError: rule.LastError,
+					Type:      "recording",
+				})
+			}
+		}
+		res.RuleGroups[i] = group
+	}
+
+	respond(w, res, warnings)
+}
@@ -0,0 +1,82 @@
+package proxyapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+func TestRules(t *testing.T) {
+	client := &stubClient{
+		rules: v1.RulesResult{Groups: []v1.RuleGroup{{
+			Name: "a",
+			File: "a.rules",
+			Rules: v1.Rules{
+				v1.RecordingRule{Name: "job:up:sum", Query: "sum(up) by (job)", Health: v1.RuleHealthGood},
+				v1.AlertingRule{
+					Name:   "Down",
+					Query:  "up == 0",
+					Health: v1.RuleHealthGood,
+					Alerts: []*v1.Alert{{Labels: model.LabelSet{"alertname": "Down"}, State: v1.AlertStateFiring, Value: "0"}},
+				},
+			},
+		}}},
+	}
+
+	tests := []struct {
+		url   string
+		code  int
+		types []string
+	}{
+		{url: "/api/v1/rules", code: http.StatusOK, types: []string{"recording", "alerting"}},
+		{url: "/api/v1/rules?type=record", code: http.StatusOK, types: []string{"recording"}},
+		{url: "/api/v1/rules?type=alert", code: http.StatusOK, types: []string{"alerting"}},
+		{url: "/api/v1/rules?type=foo", code: http.StatusBadRequest},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			code, resp := doRequest(t, client, "GET", test.url)
+			if code != test.code {
+				t.Fatalf("mismatch in status code expected=%d actual=%d: %v", test.code, code, resp)
+			}
+			if code != http.StatusOK {
+				return
+			}
+
+			var data struct {
+				Groups []struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						Type   string `json:"type"`
+						State  string `json:"state"`
+						Alerts []struct {
+							State  string         `json:"state"`
+							Labels model.LabelSet `json:"labels"`
+						} `json:"alerts"`
+					} `json:"rules"`
+				} `json:"groups"`
+			}
+			if err := json.Unmarshal(resp.Data, &data); err != nil {
+				t.Fatalf("error unmarshaling data: %v", err)
+			}
+			if len(data.Groups) != 1 || len(data.Groups[0].Rules) != len(test.types) {
+				t.Fatalf("unexpected rules: %s", resp.Data)
+			}
+			for j, rule := range data.Groups[0].Rules {
+				if rule.Type != test.types[j] {
+					t.Fatalf("mismatch in rule type expected=%s actual=%s", test.types[j], rule.Type)
+				}
+				if rule.Type == "alerting" {
+					if rule.State != "firing" || len(rule.Alerts) != 1 || rule.Alerts[0].State != "firing" {
+						t.Fatalf("unexpected alerting rule: %s", resp.Data)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package proxyapi
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	yaml "gopkg.in/yaml.v2"
+
+	proxyconfig "github.com/jacksontj/promxy/pkg/config"
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+	"github.com/jacksontj/promxy/pkg/servergroup"
+)
+
+// maxServerGroupSize is the maximum size of a server group config in a request
+const maxServerGroupSize = 1 << 20
+
+// ServerGroupStore manages the (named) server groups of the running config
+type ServerGroupStore interface {
+	ServerGroups() ([]*servergroup.Config, error)
+	// PutServerGroup adds or replaces the server group (as YAML) with the given name
+	PutServerGroup(name string, cfg []byte) error
+	DeleteServerGroup(name string) error
+}
+
+// serverGroup is a server group as returned by /api/v1/server_groups
+type serverGroup struct {
+	Name   string `json:"name"`
+	Config string `json:"config"`
+}
+
+// serverGroupStoreErrorType returns the ErrorType for an error returned by the ServerGroupStore
+func serverGroupStoreErrorType(err error) promhttputil.ErrorType {
+	switch err.(type) {
+	case *proxyconfig.ServerGroupNotFoundError:
+		return promhttputil.ErrorNotFound
+	case *proxyconfig.InvalidServerGroupError:
+		return promhttputil.ErrorBadData
+	}
+	return promhttputil.ErrorInternal
+}
+
+// serverGroups serves GET /api/v1/server_groups, listing the configured server groups
+func (a *API) serverGroups(w http.ResponseWriter, r *http.Request) {
+	if a.ServerGroups == nil {
+		respondError(w, promhttputil.ErrorUnavailable, errors.New("server group API disabled"), nil)
+		return
+	}
+
+	cfgs, err := a.ServerGroups.ServerGroups()
+	if err != nil {
+		respondError(w, serverGroupStoreErrorType(err), err, nil)
+		return
+	}
+
+	groups := make([]serverGroup, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		b, err := yaml.Marshal(cfg)
+		if err != nil {
+			respondError(w, promhttputil.ErrorInternal, err, nil)
+			return
+		}
+		groups = append(groups, serverGroup{Name: cfg.Name, Config: string(b)})
+	}
+	respond(w, groups, nil)
+}
+
+// putServerGroup serves PUT /api/v1/server_groups/:name, adding or replacing
+// the server group with the YAML config in the request body
+func (a *API) putServerGroup(w http.ResponseWriter, r *http.Request) {
+	if a.ServerGroups == nil {
+		respondError(w, promhttputil.ErrorUnavailable, errors.New("server group API disabled"), nil)
+		return
+	}
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxServerGroupSize))
+	if err != nil {
+		respondError(w, promhttputil.ErrorBadData, err, nil)
+		return
+	}
+
+	if err := a.ServerGroups.PutServerGroup(name, b); err != nil {
+		respondError(w, serverGroupStoreErrorType(err), err, nil)
+		return
+	}
+	respond(w, nil, nil)
+}
+
+// deleteServerGroup serves DELETE /api/v1/server_groups/:name, removing the server group
+func (a *API) deleteServerGroup(w http.ResponseWriter, r *http.Request) {
+	if a.ServerGroups == nil {
+		respondError(w, promhttputil.ErrorUnavailable, errors.New("server group API disabled"), nil)
+		return
+	}
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+	if err := a.ServerGroups.DeleteServerGroup(name); err != nil {
+		respondError(w, serverGroupStoreErrorType(err), err, nil)
+		return
+	}
+	respond(w, nil, nil)
+}
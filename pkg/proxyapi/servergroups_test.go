@@ -0,0 +1,97 @@
+package proxyapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	proxyconfig "github.com/jacksontj/promxy/pkg/config"
+	"github.com/jacksontj/promxy/pkg/servergroup"
+)
+
+type stubServerGroupStore struct {
+	groups map[string]string
+}
+
+func (s *stubServerGroupStore) ServerGroups() ([]*servergroup.Config, error) {
+	cfgs := make([]*servergroup.Config, 0, len(s.groups))
+	for name := range s.groups {
+		cfgs = append(cfgs, &servergroup.Config{Name: name})
+	}
+	return cfgs, nil
+}
+
+func (s *stubServerGroupStore) PutServerGroup(name string, cfg []byte) error {
+	if strings.Contains(string(cfg), "invalid") {
+		return &proxyconfig.InvalidServerGroupError{Err: errors.New("invalid server group")}
+	}
+	s.groups[name] = string(cfg)
+	return nil
+}
+
+func (s *stubServerGroupStore) DeleteServerGroup(name string) error {
+	if _, ok := s.groups[name]; !ok {
+		return &proxyconfig.ServerGroupNotFoundError{Name: name}
+	}
+	delete(s.groups, name)
+	return nil
+}
+
+func TestServerGroups(t *testing.T) {
+	store := &stubServerGroupStore{groups: map[string]string{}}
+	api := &API{ServerGroups: store}
+
+	do := func(method, url, body string) int {
+		r := httprouter.New()
+		api.Register(r, "/api/v1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code
+	}
+
+	// The endpoints are only served if the admin API is enabled
+	if code := do("PUT", "/api/v1/server_groups/a", "scheme: http"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected admin API to be disabled, got %d", code)
+	}
+	api.EnableAdmin = true
+
+	if code := do("PUT", "/api/v1/server_groups/a", "scheme: http"); code != http.StatusOK {
+		t.Fatalf("unexpected status code adding a server group: %d", code)
+	}
+	if store.groups["a"] != "scheme: http" {
+		t.Fatalf("server group wasn't stored: %v", store.groups)
+	}
+	if code := do("PUT", "/api/v1/server_groups/b", "invalid"); code != http.StatusBadRequest {
+		t.Fatalf("expected bad request for an invalid server group, got %d", code)
+	}
+
+	code, resp := doAPIRequest(t, api, "GET", "/api/v1/server_groups")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code listing server groups: %d", code)
+	}
+	var groups []serverGroup
+	if err := json.Unmarshal(resp.Data, &groups); err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].Name != "a" {
+		t.Fatalf("unexpected server groups: %v", groups)
+	}
+
+	if code := do("DELETE", "/api/v1/server_groups/a", ""); code != http.StatusOK {
+		t.Fatalf("unexpected status code deleting a server group: %d", code)
+	}
+	if code := do("DELETE", "/api/v1/server_groups/a", ""); code != http.StatusNotFound {
+		t.Fatalf("expected not found deleting a missing server group, got %d", code)
+	}
+
+	// Without a store the endpoints are unavailable
+	api.ServerGroups = nil
+	if code, _ := doAPIRequest(t, api, "GET", "/api/v1/server_groups"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected server group API to be disabled, got %d", code)
+	}
+}
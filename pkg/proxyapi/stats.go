@@ -0,0 +1,102 @@
+package proxyapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+// querySamplesStats are the sample stats of a query (as returned with stats=all)
+type querySamplesStats struct {
+	TotalQueryableSamples int64 `json:"totalQueryableSamples"`
+	PeakSamples           int64 `json:"peakSamples"`
+}
+
+// bufferedResponseWriter buffers the response, such that it can be modified before it is written
+type bufferedResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponseWriter) Header() http.Header         { return b.header }
+func (b *bufferedResponseWriter) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponseWriter) WriteHeader(code int)        { b.code = code }
+
+// queryStats serves the query with the Query handler, collecting the stats of the downstream
+// requests in s which are added to the stats of the response (along with the sums of their
+// sample stats), such that the execution of the query can be diagnosed end-to-end
+func (a *API) queryStats(w http.ResponseWriter, r *http.Request, s *promclient.QueryStats) {
+	buf := &bufferedResponseWriter{header: w.Header(), code: http.StatusOK}
+	a.Query.ServeHTTP(buf, r)
+
+	body := buf.body.Bytes()
+	if b, err := addDownstreamStats(body, s.Downstreams()); err != nil {
+		logrus.Errorf("Error adding downstream stats to query response: %v", err)
+	} else {
+		body = b
+	}
+	w.Header().Del("Content-Length")
+	w.WriteHeader(buf.code)
+	if _, err := w.Write(body); err != nil {
+		logrus.Errorf("error writing API response: %v", err)
+	}
+}
+
+// addDownstreamStats adds the downstream stats to the stats of the query response (if it has any)
+func addDownstreamStats(body []byte, downstreams []promclient.DownstreamStats) ([]byte, error) {
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(resp["data"], &data); err != nil || data["stats"] == nil {
+		// Responses without stats (e.g. errors) are returned as-is
+		return body, nil
+	}
+	var stats map[string]json.RawMessage
+	if err := json.Unmarshal(data["stats"], &stats); err != nil {
+		return nil, err
+	}
+
+	if downstreams == nil {
+		downstreams = []promclient.DownstreamStats{}
+	}
+	var samples *querySamplesStats
+	for _, d := range downstreams {
+		var downstreamStats struct {
+			Samples *querySamplesStats `json:"samples"`
+		}
+		if err := json.Unmarshal(d.Stats, &downstreamStats); err != nil || downstreamStats.Samples == nil {
+			continue
+		}
+		if samples == nil {
+			samples = &querySamplesStats{}
+		}
+		samples.TotalQueryableSamples += downstreamStats.Samples.TotalQueryableSamples
+		if downstreamStats.Samples.PeakSamples > samples.PeakSamples {
+			samples.PeakSamples = downstreamStats.Samples.PeakSamples
+		}
+	}
+
+	var err error
+	if stats["downstreams"], err = json.Marshal(downstreams); err != nil {
+		return nil, err
+	}
+	if samples != nil {
+		if stats["samples"], err = json.Marshal(samples); err != nil {
+			return nil, err
+		}
+	}
+	if data["stats"], err = json.Marshal(stats); err != nil {
+		return nil, err
+	}
+	if resp["data"], err = json.Marshal(data); err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
@@ -0,0 +1,64 @@
+package proxyapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+func TestQueryStats(t *testing.T) {
+	// query serves a query with 2 downstream requests, like the local engine would
+	query := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s := promclient.QueryStatsFromContext(r.Context()); s != nil {
+			s.Add(promclient.DownstreamStats{Server: "http://a", Path: "/api/v1/query", Query: "sum(up)", Stats: json.RawMessage(`{"samples":{"totalQueryableSamples":10,"peakSamples":4}}`)})
+			s.Add(promclient.DownstreamStats{Server: "http://b", Path: "/api/v1/query", Query: "sum(up)", Stats: json.RawMessage(`{"samples":{"totalQueryableSamples":5,"peakSamples":6}}`)})
+		}
+		data := `{"resultType":"vector","result":[]}`
+		if r.FormValue("stats") != "" {
+			data = `{"resultType":"vector","result":[],"stats":{"timings":{"evalTotalTime":0.1}}}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":` + data + `}`))
+	})
+
+	tests := []struct {
+		url   string
+		stats map[string]interface{}
+	}{
+		{url: "/api/v1/query?query=sum(up)"},
+		{
+			url: "/api/v1/query?query=sum(up)&stats=all",
+			stats: map[string]interface{}{
+				"timings": map[string]interface{}{"evalTotalTime": 0.1},
+				"samples": map[string]interface{}{"totalQueryableSamples": 15.0, "peakSamples": 6.0},
+				"downstreams": []interface{}{
+					map[string]interface{}{"server": "http://a", "path": "/api/v1/query", "query": "sum(up)", "execTime": 0.0, "stats": map[string]interface{}{"samples": map[string]interface{}{"totalQueryableSamples": 10.0, "peakSamples": 4.0}}},
+					map[string]interface{}{"server": "http://b", "path": "/api/v1/query", "query": "sum(up)", "execTime": 0.0, "stats": map[string]interface{}{"samples": map[string]interface{}{"totalQueryableSamples": 5.0, "peakSamples": 6.0}}},
+				},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			code, resp := doAPIRequest(t, &API{Query: query}, "GET", test.url)
+			if code != http.StatusOK {
+				t.Fatalf("unexpected status code %d: %v", code, resp)
+			}
+
+			var data struct {
+				Stats map[string]interface{} `json:"stats"`
+			}
+			if err := json.Unmarshal(resp.Data, &data); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data.Stats, test.stats) {
+				t.Fatalf("mismatch in stats expected=%v actual=%v", test.stats, data.Stats)
+			}
+		})
+	}
+}
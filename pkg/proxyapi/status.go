@@ -0,0 +1,108 @@
+package proxyapi
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// tsdbStatus serves /api/v1/status/tsdb, summing the TSDB statistics of all downstreams
+func (a *API) tsdbStatus(w http.ResponseWriter, r *http.Request) {
+	tsdb, warnings, err := a.Client().TSDB(r.Context())
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	respond(w, tsdb, warnings)
+}
+
+// downstreamStatus is the version and runtime information of a single downstream
+type downstreamStatus struct {
+	Server           string    `json:"server"`
+	Version          string    `json:"version"`
+	Revision         string    `json:"revision"`
+	GoVersion        string    `json:"goVersion"`
+	StorageRetention string    `json:"storageRetention"`
+	StartTime        time.Time `json:"startTime"`
+	Uptime           string    `json:"uptime"`
+	// Error is set if the information couldn't be fetched from the downstream
+	Error string `json:"error,omitempty"`
+}
+
+// downstreamsStatus serves /api/v1/status/downstreams, listing the build and
+// runtime information of every downstream (to make version skew visible)
+func (a *API) downstreamsStatus(w http.ResponseWriter, r *http.Request) {
+	client := a.Client()
+	buildinfo, warnings, err := client.Buildinfo(r.Context())
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+	runtimeinfo, runtimeWarnings, err := client.Runtimeinfo(r.Context())
+	warnings = append(warnings, runtimeWarnings...)
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	statuses := make([]*downstreamStatus, 0, len(buildinfo))
+	byServer := make(map[string]*downstreamStatus, len(buildinfo))
+	get := func(server string) *downstreamStatus {
+		s, ok := byServer[server]
+		if !ok {
+			s = &downstreamStatus{Server: server}
+			byServer[server] = s
+			statuses = append(statuses, s)
+		}
+		return s
+	}
+
+	for _, info := range buildinfo {
+		s := get(info.Server)
+		if info.Error != "" {
+			s.Error = info.Error
+			continue
+		}
+		s.Version = info.Version
+		s.Revision = info.Revision
+		s.GoVersion = info.GoVersion
+	}
+	now := time.Now()
+	for _, info := range runtimeinfo {
+		s := get(info.Server)
+		if info.Error != "" {
+			if s.Error == "" {
+				s.Error = info.Error
+			}
+			continue
+		}
+		s.StorageRetention = info.StorageRetention
+		s.StartTime = info.StartTime
+		if !info.StartTime.IsZero() {
+			s.Uptime = now.Sub(info.StartTime).Truncate(time.Second).String()
+		}
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Server < statuses[j].Server
+	})
+
+	respond(w, statuses, warnings)
+}
+
+// downstreamsConfig serves /api/v1/status/downstreams/config, returning the
+// configuration of every downstream
+func (a *API) downstreamsConfig(w http.ResponseWriter, r *http.Request) {
+	configs, warnings, err := a.Client().Config(r.Context())
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	sort.SliceStable(configs, func(i, j int) bool {
+		return configs[i].Server < configs[j].Server
+	})
+
+	respond(w, configs, warnings)
+}
@@ -0,0 +1,108 @@
+package proxyapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+	"github.com/jacksontj/promxy/pkg/promhttputil"
+)
+
+func TestTSDBStatus(t *testing.T) {
+	client := &stubClient{
+		tsdb: promclient.TSDBResult{
+			HeadStats: promclient.TSDBHeadStats{NumSeries: 10, ChunkCount: 20},
+			SeriesCountByMetricName: []promclient.TSDBStat{
+				{Name: "up", Value: 10, Servers: map[string]uint64{"a:9090": 4, "b:9090": 6}},
+			},
+		},
+	}
+
+	code, resp := doRequest(t, client, "GET", "/api/v1/status/tsdb")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+
+	var data promclient.TSDBResult
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("error unmarshaling data: %v", err)
+	}
+	if !reflect.DeepEqual(data, client.tsdb) {
+		t.Fatalf("mismatch in tsdb status expected=%v actual=%v", client.tsdb, data)
+	}
+}
+
+func TestDownstreamsStatus(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	client := &stubClient{
+		buildinfo: []promclient.BuildinfoResult{
+			{Server: "b:9090", Version: "2.26.0"},
+			{Server: "a:9090", Version: "2.24.1"},
+			{Server: "c:9090", Error: "unavailable"},
+		},
+		runtimeinfo: []promclient.RuntimeinfoResult{
+			{Server: "a:9090", RuntimeinfoResult: v1.RuntimeinfoResult{StartTime: start, StorageRetention: "15d"}},
+			{Server: "c:9090", Error: "unavailable"},
+		},
+	}
+
+	code, resp := doRequest(t, client, "GET", "/api/v1/status/downstreams")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+
+	var data []downstreamStatus
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("error unmarshaling data: %v", err)
+	}
+	if len(data) != 3 {
+		t.Fatalf("expected 3 downstreams, got %v", data)
+	}
+	if data[0].Server != "a:9090" || data[0].Version != "2.24.1" || data[0].StorageRetention != "15d" || data[0].Uptime == "" {
+		t.Fatalf("unexpected status for a:9090: %+v", data[0])
+	}
+	if data[1].Server != "b:9090" || data[1].Version != "2.26.0" || data[1].Uptime != "" {
+		t.Fatalf("unexpected status for b:9090: %+v", data[1])
+	}
+	if data[2].Server != "c:9090" || data[2].Error != "unavailable" {
+		t.Fatalf("unexpected status for c:9090: %+v", data[2])
+	}
+}
+
+func TestDownstreamsConfig(t *testing.T) {
+	client := &stubClient{
+		config: []promclient.ConfigResult{
+			{Server: "b:9090", YAML: "global: {}"},
+			{Server: "a:9090", YAML: "scrape_configs: []"},
+		},
+	}
+
+	// The endpoint is only served if the admin API is enabled
+	code, resp := doRequest(t, client, "GET", "/api/v1/status/downstreams/config")
+	if code != http.StatusServiceUnavailable || resp.ErrorType != promhttputil.ErrorUnavailable {
+		t.Fatalf("expected admin API to be disabled, got %d: %v", code, resp)
+	}
+
+	api := &API{Client: func() promclient.API { return client }, EnableAdmin: true}
+	code, resp = doAPIRequest(t, api, "GET", "/api/v1/status/downstreams/config")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %v", code, resp)
+	}
+
+	var data []promclient.ConfigResult
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("error unmarshaling data: %v", err)
+	}
+	expected := []promclient.ConfigResult{
+		{Server: "a:9090", YAML: "scrape_configs: []"},
+		{Server: "b:9090", YAML: "global: {}"},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Fatalf("mismatch in configs expected=%v actual=%v", expected, data)
+	}
+}
@@ -0,0 +1,30 @@
+package proxyapi
+
+import (
+	"net/http"
+	"strings"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// targets serves /api/v1/targets, merging the targets of all downstreams
+func (a *API) targets(w http.ResponseWriter, r *http.Request) {
+	targets, warnings, err := a.Client().Targets(r.Context())
+	if err != nil {
+		respondError(w, errorType(err), err, warnings)
+		return
+	}
+
+	// Filter by state, as prometheus does: "active", "dropped" or "any" (the default)
+	state := strings.ToLower(r.FormValue("state"))
+	showActive := state == "" || state == "any" || state == "active"
+	showDropped := state == "" || state == "any" || state == "dropped"
+	if !showActive || targets.Active == nil {
+		targets.Active = []v1.ActiveTarget{}
+	}
+	if !showDropped || targets.Dropped == nil {
+		targets.Dropped = []v1.DroppedTarget{}
+	}
+
+	respond(w, targets, warnings)
+}
@@ -95,7 +95,7 @@ func (h *ProxyQuerier) LabelValues(name string) ([]string, storage.Warnings, err
 		}).Debug("LabelValues")
 	}()
 
-	result, w, err := h.Client.LabelValues(h.Ctx, name)
+	result, w, err := h.Client.LabelValues(h.Ctx, name, nil, h.Start, h.End)
 	warnings := promhttputil.WarningsConvert(w)
 	if err != nil {
 		return nil, warnings, errors.Cause(err)
@@ -0,0 +1,62 @@
+package proxystorage
+
+import (
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// fanoutAppender appends the samples to the primary appender and the secondaries,
+// errors of the secondaries are logged (such that they don't fail the primary)
+type fanoutAppender struct {
+	primary     storage.Appender
+	secondaries []storage.Appender
+}
+
+func (f *fanoutAppender) Add(l labels.Labels, t int64, v float64) (uint64, error) {
+	ref, err := f.primary.Add(l, t, v)
+	if err != nil {
+		return ref, err
+	}
+
+	for _, appender := range f.secondaries {
+		if _, err := appender.Add(l, t, v); err != nil {
+			logrus.Errorf("Error appending to secondary appender: %v", err)
+		}
+	}
+	return ref, nil
+}
+
+// AddFast only adds to the primary, as the references are those of the primary
+func (f *fanoutAppender) AddFast(ref uint64, t int64, v float64) error {
+	return f.primary.AddFast(ref, t, v)
+}
+
+// Commit submits the collected samples and purges the batch.
+func (f *fanoutAppender) Commit() error {
+	err := f.primary.Commit()
+
+	for _, appender := range f.secondaries {
+		if err == nil {
+			if secondaryErr := appender.Commit(); secondaryErr != nil {
+				logrus.Errorf("Error committing secondary appender: %v", secondaryErr)
+			}
+		} else {
+			if secondaryErr := appender.Rollback(); secondaryErr != nil {
+				logrus.Errorf("Error rolling back secondary appender: %v", secondaryErr)
+			}
+		}
+	}
+	return err
+}
+
+func (f *fanoutAppender) Rollback() error {
+	err := f.primary.Rollback()
+
+	for _, appender := range f.secondaries {
+		if secondaryErr := appender.Rollback(); secondaryErr != nil {
+			logrus.Errorf("Error rolling back secondary appender: %v", secondaryErr)
+		}
+	}
+	return err
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/timestamp"
@@ -31,13 +34,33 @@ import (
 
 const MetricNameWorkaroundLabel = "__name"
 
+var shadowResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "server_group_shadow_results_total",
+	Help: "Number of comparisons of the shadow server_groups' responses to the primary (by result: match, mismatch or error)",
+}, []string{"call", "result"})
+
+func init() {
+	prometheus.MustRegister(shadowResults)
+}
+
 type proxyStorageState struct {
 	sgs            []*servergroup.ServerGroup
 	client         promclient.API
+	drain          *promclient.DrainAPI
 	cfg            *proxyconfig.PromxyConfig
 	remoteStorage  *remote.Storage
 	appender       storage.Appender
 	appenderCloser func() error
+	// local is whether the series of the local storage are merged into the results
+	local bool
+	// sharded is whether any of the (non-shadow) servergroups is sharded, the aggregations
+	// of whose shards can't be merged like those of replicas
+	sharded bool
+
+	// globalSemaphore and dedupRegistry are shared by the servergroups, they are kept
+	// across reloads so unchanged servergroups can be reused
+	globalSemaphore *promclient.Semaphore
+	dedupRegistry   *promclient.DedupRegistry
 }
 
 // Ready blocks until all servergroups are ready
@@ -54,10 +77,16 @@ func (p *proxyStorageState) Ready() {
 	}
 }
 
-// Cancel this state
+// Cancel this state, the servergroups which were carried over to the new state are kept running
 func (p *proxyStorageState) Cancel(n *proxyStorageState) {
-	if p.sgs != nil {
-		for _, sg := range p.sgs {
+	kept := make(map[*servergroup.ServerGroup]struct{})
+	if n != nil {
+		for _, sg := range n.sgs {
+			kept[sg] = struct{}{}
+		}
+	}
+	for _, sg := range p.sgs {
+		if _, ok := kept[sg]; !ok {
 			sg.Cancel()
 		}
 	}
@@ -69,6 +98,82 @@ func (p *proxyStorageState) Cancel(n *proxyStorageState) {
 	}
 }
 
+// Retire cancels this state once the requests in-flight through it are done (or the
+// timeout is reached), so replacing it doesn't drop those requests
+func (p *proxyStorageState) Retire(n *proxyStorageState, timeout time.Duration) {
+	if p.drain != nil {
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		if err := p.drain.Drain(ctx); err != nil {
+			logrus.Warnf("Cancelling the previous config with requests still in-flight: %v", err)
+		}
+	}
+	p.Cancel(n)
+}
+
+// reusable returns the servergroup of this state which can be carried over as-is for
+// the config, that is one with the same name and config which isn't taken already
+func (p *proxyStorageState) reusable(name string, cfg *servergroup.Config, taken map[*servergroup.ServerGroup]struct{}) *servergroup.ServerGroup {
+	for _, sg := range p.sgs {
+		if _, ok := taken[sg]; ok {
+			continue
+		}
+		if sg.Name == name && reflect.DeepEqual(sg.Cfg, cfg) {
+			return sg
+		}
+	}
+	return nil
+}
+
+// confinedServerGroup returns the servergroup all of the selectors in the expression are
+// confined to, or nil if they may select series of multiple servergroups. Only servergroups
+// whose hosts are all replicas (not shards or hosts with different labels) have all of the
+// series of the selectors on each host.
+func (p *proxyStorageState) confinedServerGroup(ctx context.Context, expr parser.Expr) *servergroup.ServerGroup {
+	// The children of a node may be inspected concurrently
+	var l sync.Mutex
+	var selectors [][]*labels.Matcher
+	_, err := parser.Inspect(ctx, &parser.EvalStmt{Expr: expr}, func(node parser.Node, _ []parser.Node) error {
+		if n, ok := node.(*parser.VectorSelector); ok {
+			l.Lock()
+			selectors = append(selectors, n.LabelMatchers)
+			l.Unlock()
+		}
+		return nil
+	}, nil)
+	// The series of the local storage may match the selectors of any servergroup
+	if err != nil || len(selectors) == 0 || p.local {
+		return nil
+	}
+
+	var confined *servergroup.ServerGroup
+	for _, sg := range p.sgs {
+		if sg.Cfg == nil || sg.Cfg.Shadow {
+			continue
+		}
+		for _, matchers := range selectors {
+			if sg.MatchersMatch(matchers) {
+				if confined != nil {
+					return nil
+				}
+				confined = sg
+				break
+			}
+		}
+	}
+	if confined == nil || confined.Cfg.Sharding != nil {
+		return nil
+	}
+	if state := confined.State(); state == nil || !state.Replicas {
+		return nil
+	}
+	return confined
+}
+
 // NewProxyStorage creates a new ProxyStorage
 func NewProxyStorage(NoStepSubqueryIntervalFn func(rangeMillis int64) int64) (*ProxyStorage, error) {
 	return &ProxyStorage{NoStepSubqueryIntervalFn: NoStepSubqueryIntervalFn}, nil
@@ -77,7 +182,13 @@ func NewProxyStorage(NoStepSubqueryIntervalFn func(rangeMillis int64) int64) (*P
 // ProxyStorage implements prometheus' Storage interface
 type ProxyStorage struct {
 	NoStepSubqueryIntervalFn func(rangeMillis int64) int64
-	state                    atomic.Value
+	// LocalStorage (if set) is where the samples appended to the ProxyStorage (e.g. the
+	// output of recording rules) are stored, its series are merged with the servergroups'
+	LocalStorage storage.Storage
+	// DrainTimeout is the max time to wait for the requests in-flight through the
+	// previous config to finish before it is cancelled on reload (zero is unbounded)
+	DrainTimeout time.Duration
+	state        atomic.Value
 }
 
 // GetState returns the current state of the ProxyStorage
@@ -89,30 +200,114 @@ func (p *ProxyStorage) GetState() *proxyStorageState {
 	return &proxyStorageState{}
 }
 
+// Client returns the client to all servergroups of the current state
+func (p *ProxyStorage) Client() promclient.API {
+	return p.GetState().client
+}
+
 // ApplyConfig updates the current state of this ProxyStorage
 func (p *ProxyStorage) ApplyConfig(c *proxyconfig.Config) error {
 	oldState := p.GetState() // Fetch the old state
 
 	failed := false
 
-	apis := make([]promclient.API, len(c.ServerGroups))
+	var apis, fallbackAPIs, shadowAPIs []promclient.API
 	newState := &proxyStorageState{
-		sgs: make([]*servergroup.ServerGroup, len(c.ServerGroups)),
-		cfg: &c.PromxyConfig,
+		sgs:   make([]*servergroup.ServerGroup, len(c.ServerGroups)),
+		cfg:   &c.PromxyConfig,
+		local: p.LocalStorage != nil,
+	}
+	// Servergroups whose config (including the settings shared by all of them) is
+	// unchanged are carried over, so only the added/changed ones are (re)started
+	reuse := oldState.cfg != nil && oldState.cfg.MaxConcurrentRequests == c.MaxConcurrentRequests &&
+		oldState.cfg.QueryLimits.MergeLimits() == c.QueryLimits.MergeLimits()
+	if reuse {
+		newState.globalSemaphore = oldState.globalSemaphore
+		newState.dedupRegistry = oldState.dedupRegistry
+	} else {
+		if c.MaxConcurrentRequests > 0 {
+			newState.globalSemaphore = servergroup.NewRequestSemaphore(c.MaxConcurrentRequests, "global")
+		}
+		newState.dedupRegistry = promclient.NewDedupRegistry()
+	}
+
+	reused := make(map[*servergroup.ServerGroup]struct{})
+	var created []*servergroup.ServerGroup
+	// cancelCreated stops the servergroups started for the new state if it isn't applied
+	cancelCreated := func() {
+		for _, sg := range created {
+			sg.Cancel()
+		}
 	}
 	for i, sgCfg := range c.ServerGroups {
-		tmp := servergroup.New()
-		if err := tmp.ApplyConfig(sgCfg); err != nil {
-			failed = true
-			logrus.Errorf("Error applying config to server group: %s", err)
+		name := sgCfg.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		var tmp *servergroup.ServerGroup
+		if reuse {
+			tmp = oldState.reusable(name, sgCfg, reused)
+		}
+		if tmp != nil {
+			reused[tmp] = struct{}{}
+		} else {
+			tmp = servergroup.New()
+			tmp.Name = name
+			tmp.GlobalSemaphore = newState.globalSemaphore
+			tmp.DedupRegistry = newState.dedupRegistry
+			tmp.MergeLimits = c.QueryLimits.MergeLimits()
+			created = append(created, tmp)
+			if err := tmp.ApplyConfig(sgCfg); err != nil {
+				failed = true
+				logrus.Errorf("Error applying config to server group: %s", err)
+			}
 		}
 		newState.sgs[i] = tmp
-		apis[i] = tmp
+		if sgCfg.Sharding != nil && !sgCfg.Shadow {
+			newState.sharded = true
+		}
+		if sgCfg.Shadow {
+			shadowAPIs = append(shadowAPIs, tmp)
+		} else if sgCfg.Fallback {
+			fallbackAPIs = append(fallbackAPIs, tmp)
+		} else {
+			apis = append(apis, tmp)
+		}
+	}
+	if p.LocalStorage != nil {
+		apis = append(apis, &promclient.StorageAPI{Queryable: p.LocalStorage})
+	}
+	mergeLimits := promclient.WithMergeLimits(c.QueryLimits.MergeLimits())
+	var client promclient.API = promclient.NewMultiAPI(apis, model.TimeFromUnix(0), nil, len(apis), mergeLimits)
+	if len(fallbackAPIs) > 0 {
+		client = &promclient.FallbackAPI{
+			Primary:  client,
+			Fallback: promclient.NewMultiAPI(fallbackAPIs, model.TimeFromUnix(0), nil, len(fallbackAPIs), mergeLimits),
+		}
+	}
+	if len(shadowAPIs) > 0 {
+		client = &promclient.ShadowAPI{
+			API:        client,
+			Shadow:     promclient.NewMultiAPI(shadowAPIs, model.TimeFromUnix(0), nil, len(shadowAPIs), mergeLimits),
+			Timeout:    c.ShadowTimeout,
+			ResultFunc: func(call, result string) { shadowResults.WithLabelValues(call, result).Inc() },
+		}
+	}
+	if limits := c.QueryLimits; limits != nil {
+		client = &promclient.LimitAPI{
+			API:        client,
+			MaxSeries:  limits.MaxSeries,
+			MaxSamples: limits.MaxSamples,
+			Truncate:   !limits.Fail,
+			Scope:      "merged",
+		}
 	}
-	newState.client = promclient.NewTimeTruncate(promclient.NewMultiAPI(apis, model.TimeFromUnix(0), nil, len(apis)))
+	// Requests to the same downstream in multiple servergroups are deduplicated per-request
+	newState.drain = &promclient.DrainAPI{API: promclient.NewTimeTruncate(&promclient.DedupScopeAPI{API: client})}
+	newState.client = newState.drain
 
 	if failed {
-		newState.Cancel(nil)
+		cancelCreated()
 		return fmt.Errorf("error applying config to one or more server group(s)")
 	}
 
@@ -120,12 +315,14 @@ func (p *ProxyStorage) ApplyConfig(c *proxyconfig.Config) error {
 	if c.PromConfig.RemoteWriteConfigs != nil {
 		if oldState.remoteStorage != nil {
 			if err := oldState.remoteStorage.ApplyConfig(&c.PromConfig); err != nil {
+				cancelCreated()
 				return err
 			}
 			newState.remoteStorage = oldState.remoteStorage
 		} else {
 			remote := remote.NewStorage(logging.NewLogger(logrus.WithField("component", "remote_write").Logger), func() (int64, error) { return 0, nil }, 1*time.Second)
 			if err := remote.ApplyConfig(&c.PromConfig); err != nil {
+				cancelCreated()
 				return err
 			}
 			newState.remoteStorage = remote
@@ -136,6 +333,7 @@ func (p *ProxyStorage) ApplyConfig(c *proxyconfig.Config) error {
 		var err error
 		newState.appender, err = newState.remoteStorage.Appender()
 		if err != nil {
+			cancelCreated()
 			return err
 		}
 
@@ -145,9 +343,9 @@ func (p *ProxyStorage) ApplyConfig(c *proxyconfig.Config) error {
 
 	newState.Ready()        // Wait for the newstate to be ready
 	p.state.Store(newState) // Store the new state
-	if oldState != nil && oldState.appender != newState.appender {
-		oldState.Cancel(newState) // Cancel the old one
-	}
+	logrus.Infof("Applied config to %d server group(s), %d started and %d kept", len(newState.sgs), len(created), len(reused))
+	// Cancel the old one once the requests in-flight through it are done
+	go oldState.Retire(newState, p.DrainTimeout)
 
 	return nil
 }
@@ -155,14 +353,31 @@ func (p *ProxyStorage) ApplyConfig(c *proxyconfig.Config) error {
 // Querier returns a new Querier on the storage.
 func (p *ProxyStorage) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
 	state := p.GetState()
-	return &proxyquerier.ProxyQuerier{
+	querier := &proxyquerier.ProxyQuerier{
 		ctx,
 		timestamp.Time(mint).UTC(),
 		timestamp.Time(maxt).UTC(),
 		state.client,
 
 		state.cfg,
-	}, nil
+	}
+	if state.drain == nil {
+		return querier, nil
+	}
+	// The state is held for the whole query, not only while its selects are running
+	return &heldQuerier{Querier: querier, release: state.drain.Hold()}, nil
+}
+
+// heldQuerier releases the hold on the state it queries when closed
+type heldQuerier struct {
+	storage.Querier
+	release func()
+}
+
+// Close releases the resources of the Querier.
+func (h *heldQuerier) Close() error {
+	defer h.release()
+	return h.Querier.Close()
 }
 
 // StartTime returns the oldest timestamp stored in the storage.
@@ -171,8 +386,17 @@ func (p *ProxyStorage) StartTime() (int64, error) {
 }
 
 // Appender returns a new appender against the storage.
-func (p *ProxyStorage) Appender(context.Context) storage.Appender {
-	return p.GetState().appender
+func (p *ProxyStorage) Appender(ctx context.Context) storage.Appender {
+	state := p.GetState()
+	if p.LocalStorage == nil {
+		return state.appender
+	}
+
+	local := p.LocalStorage.Appender(ctx)
+	if _, ok := state.appender.(*appenderStub); ok || state.appender == nil {
+		return local
+	}
+	return &fanoutAppender{primary: local, secondaries: []storage.Appender{state.appender}}
 }
 
 // Close releases the resources of the Querier.
@@ -208,6 +432,17 @@ func (p *ProxyStorage) NodeReplacer(ctx context.Context, s *parser.EvalStmt, nod
 		return ok
 	}
 
+	isSubQueryCall := func(node parser.Node) bool {
+		if n, ok := node.(*parser.Call); ok {
+			for _, arg := range n.Args {
+				if isSubQuery(arg) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
 	// If we are a child of a subquery; we just skip replacement (since it already did a nodereplacer for those)
 	for _, n := range path {
 		if isSubQuery(n) {
@@ -226,10 +461,24 @@ func (p *ProxyStorage) NodeReplacer(ctx context.Context, s *parser.EvalStmt, nod
 		return nil, err
 	}
 
+	state := p.GetState()
+	client := state.client
+
 	if aggFinder.Found > 0 {
 		// If there was a single agg and that was us, then we're okay
 		if !((isAgg(node) || isSubQuery(node)) && aggFinder.Found == 1) {
-			return nil, nil
+			// Functions over subqueries with aggregations (e.g. `max_over_time(sum(foo)[1h:1m])`) can
+			// be sent as-is if all of the selectors are confined to a single servergroup (as it then
+			// has all of the data to aggregate), otherwise the subquery is evaluated locally
+			if !isSubQueryCall(node) {
+				return nil, nil
+			}
+			sg := state.confinedServerGroup(ctx, node.(parser.Expr))
+			if sg == nil {
+				return nil, nil
+			}
+			logrus.Debugf("subquery confined to servergroup %s: %v", sg.Name, node)
+			client = promclient.NewTimeTruncate(&promclient.DedupScopeAPI{API: sg})
 		}
 	}
 
@@ -253,13 +502,19 @@ func (p *ProxyStorage) NodeReplacer(ctx context.Context, s *parser.EvalStmt, nod
 		return err
 	}
 
-	state := p.GetState()
 	switch n := node.(type) {
 	// Some AggregateExprs can be composed (meaning they are "reentrant". If the aggregation op
 	// is reentrant/composable then we'll do so, otherwise we let it fall through to normal query mechanisms
 	case *parser.AggregateExpr:
 		logrus.Debugf("AggregateExpr %v %s", n, n.Op)
 
+		// The partial aggregations of the shards of a servergroup have the same labels, so
+		// they would be merged (deduplicated) rather than aggregated -- we let it fall through
+		// to fetching the series instead
+		if state.sharded {
+			return nil, nil
+		}
+
 		var result model.Value
 		var warnings v1.Warnings
 		var err error
@@ -267,7 +522,7 @@ func (p *ProxyStorage) NodeReplacer(ctx context.Context, s *parser.EvalStmt, nod
 		// Not all Aggregation functions are composable, so we'll do what we can
 		switch n.Op {
 		// All "reentrant" cases (meaning they can be done repeatedly and the outcome doesn't change)
-		case parser.SUM, parser.MIN, parser.MAX, parser.TOPK, parser.BOTTOMK:
+		case parser.SUM, parser.MIN, parser.MAX, parser.TOPK, parser.BOTTOMK, parser.GROUP:
 			removeOffsetFn()
 
 			if s.Interval > 0 {
@@ -448,13 +703,13 @@ func (p *ProxyStorage) NodeReplacer(ctx context.Context, s *parser.EvalStmt, nod
 		var warnings v1.Warnings
 		var err error
 		if s.Interval > 0 {
-			result, warnings, err = state.client.QueryRange(ctx, n.String(), v1.Range{
+			result, warnings, err = client.QueryRange(ctx, n.String(), v1.Range{
 				Start: s.Start.Add(-offset),
 				End:   s.End.Add(-offset),
 				Step:  s.Interval,
 			})
 		} else {
-			result, warnings, err = state.client.Query(ctx, n.String(), s.Start.Add(-offset))
+			result, warnings, err = client.Query(ctx, n.String(), s.Start.Add(-offset))
 		}
 
 		if err != nil {
@@ -0,0 +1,133 @@
+// Package queryage enforces a maximum age of the queries evaluated by promxy, such that
+// long-term storage backends are protected from accidentally huge ranges (e.g. dashboards
+// querying "since 1970").
+package queryage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+var queriesLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "query_max_age_queries_total",
+	Help: "Number of queries older than the maximum query age, by the action (rejected or clamped)",
+}, []string{"action"})
+
+func init() {
+	prometheus.MustRegister(queriesLimited)
+}
+
+// Limiter enforces the maximum age of the queries
+type Limiter struct {
+	l   sync.RWMutex
+	cfg *Config
+}
+
+// New returns a new Limiter
+func New() *Limiter {
+	return &Limiter{}
+}
+
+// ApplyConfig updates the config of the limiter, a nil config doesn't limit the queries
+func (l *Limiter) ApplyConfig(cfg *Config) error {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.cfg = cfg
+	return nil
+}
+
+// Handler returns a handler which rejects (or clamps the start of) the queries older than
+// the maximum age. Queries with invalid parameters are passed on as-is, such that their
+// error is returned by the API.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.l.RLock()
+		cfg := l.cfg
+		l.l.RUnlock()
+		if cfg == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		maxAge := cfg.maxAge(r.Header.Get(cfg.TenantHeader))
+		if maxAge == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		minTime := time.Now().Add(-time.Duration(maxAge))
+
+		param := "time"
+		if strings.HasSuffix(r.URL.Path, "/query_range") {
+			param = "start"
+		}
+		start, err := parseTime(r.FormValue(param))
+		if err != nil || !start.Before(minTime) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cfg.Clamp && param == "start" {
+			if clamped, ok := clampStart(r, start, minTime); ok {
+				queriesLimited.WithLabelValues("clamped").Inc()
+				r.Form.Set("start", strconv.FormatFloat(float64(clamped.UnixNano())/1e9, 'f', -1, 64))
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		queriesLimited.WithLabelValues("rejected").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":    "error",
+			"errorType": "bad_data",
+			"error":     fmt.Sprintf("query %s %s is older than the maximum query age of %v", param, start.Format(time.RFC3339), maxAge),
+		})
+	})
+}
+
+// clampStart returns the first step of the range query at or after minTime, and whether
+// it is within the range of the query
+func clampStart(r *http.Request, start, minTime time.Time) (time.Time, bool) {
+	end, err := parseTime(r.FormValue("end"))
+	if err != nil {
+		return start, false
+	}
+	step, err := parseDuration(r.FormValue("step"))
+	if err != nil || step <= 0 {
+		return start, false
+	}
+	steps := (minTime.Sub(start) + step - 1) / step
+	clamped := start.Add(steps * step)
+	return clamped, !clamped.After(end)
+}
+
+// parseTime parses a timestamp parameter (unix seconds or RFC3339)
+func parseTime(s string) (time.Time, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, ns := math.Modf(t)
+		ns = math.Round(ns*1000) / 1000
+		return time.Unix(int64(sec), int64(ns*float64(time.Second))).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
+// parseDuration parses a duration parameter (seconds or a duration, e.g. 5m)
+func parseDuration(s string) (time.Duration, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(d * float64(time.Second)), nil
+	}
+	d, err := model.ParseDuration(s)
+	return time.Duration(d), err
+}
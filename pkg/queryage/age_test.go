@@ -0,0 +1,65 @@
+package queryage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New()
+	l.ApplyConfig(&Config{
+		MaxAge:       model.Duration(24 * time.Hour),
+		TenantHeader: "X-Scope-OrgID",
+		TenantMaxAge: map[string]model.Duration{"archive": 0},
+	})
+
+	var form url.Values
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.Form
+	}))
+	unix := func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) }
+	now := time.Now().Truncate(time.Minute)
+
+	tests := []struct {
+		url    string
+		tenant string
+		clamp  bool
+		code   int
+		start  string
+	}{
+		{url: "/api/v1/query?query=up", code: http.StatusOK},
+		{url: "/api/v1/query?query=up&time=" + unix(now.Add(-time.Hour)), code: http.StatusOK},
+		{url: "/api/v1/query?query=up&time=" + unix(now.Add(-48*time.Hour)), code: http.StatusBadRequest},
+		{url: "/api/v1/query_range?query=up&step=60&start=" + unix(now.Add(-time.Hour)) + "&end=" + unix(now), code: http.StatusOK},
+		{url: "/api/v1/query_range?query=up&step=60&start=0&end=" + unix(now), code: http.StatusBadRequest},
+		// The tenant's maximum age overrides the global one
+		{url: "/api/v1/query_range?query=up&step=60&start=0&end=" + unix(now), tenant: "archive", code: http.StatusOK},
+		// Clamped queries start at the oldest allowed step
+		{url: "/api/v1/query_range?query=up&step=60&start=0&end=" + unix(now), clamp: true, code: http.StatusOK, start: unix(now.Add(-24 * time.Hour).Add(time.Minute))},
+		{url: "/api/v1/query_range?query=up&step=60&start=0&end=" + unix(now.Add(-48*time.Hour)), clamp: true, code: http.StatusBadRequest},
+		// Invalid params are left to the API
+		{url: "/api/v1/query_range?query=up&start=invalid", code: http.StatusOK},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			l.cfg.Clamp = test.clamp
+			r := httptest.NewRequest("GET", test.url, nil)
+			r.Header.Set("X-Scope-OrgID", test.tenant)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != test.code {
+				t.Fatalf("expected status code %d, got %d: %s", test.code, w.Code, w.Body)
+			}
+			if test.start != "" && form.Get("start") != test.start {
+				t.Fatalf("expected start %s, got %s", test.start, form.Get("start"))
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package queryage
+
+import (
+	"fmt"
+
+	"github.com/prometheus/common/model"
+)
+
+// Config configures the maximum age of the queries evaluated by promxy
+type Config struct {
+	// MaxAge is the maximum age of the start of the queries (0 is unlimited)
+	MaxAge model.Duration `yaml:"max_age"`
+	// Clamp moves the start of range queries older than the maximum age to the oldest
+	// allowed step, instead of failing them
+	Clamp bool `yaml:"clamp"`
+	// TenantHeader is the request header with the tenant of the query, which is used to
+	// look up the tenant's maximum age in TenantMaxAge (instead of MaxAge)
+	TenantHeader string                    `yaml:"tenant_header"`
+	TenantMaxAge map[string]model.Duration `yaml:"tenant_max_age"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = Config{TenantHeader: "X-Scope-OrgID"}
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.MaxAge < 0 {
+		return fmt.Errorf("query_max_age max_age must not be negative, got %v", c.MaxAge)
+	}
+	for tenant, maxAge := range c.TenantMaxAge {
+		if maxAge < 0 {
+			return fmt.Errorf("query_max_age max_age of tenant %q must not be negative, got %v", tenant, maxAge)
+		}
+	}
+	return nil
+}
+
+// maxAge returns the maximum age for the tenant (0 is unlimited)
+func (c *Config) maxAge(tenant string) model.Duration {
+	if maxAge, ok := c.TenantMaxAge[tenant]; ok && tenant != "" {
+		return maxAge
+	}
+	return c.MaxAge
+}
@@ -0,0 +1,66 @@
+package querydeny
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Rule denies the queries matching either its Regex or its Query
+type Rule struct {
+	// Regex matches the denied queries, as sent or normalized (e.g. `count\(\{__name__=~"\.\+"\}\)`)
+	Regex string `yaml:"regex,omitempty"`
+	// Query is a denied query, which is compared to the normalized queries (the whitespace and
+	// formatting of the queries don't matter)
+	Query string `yaml:"query,omitempty"`
+	// Reason is included in the error returned for the denied queries
+	Reason string `yaml:"reason,omitempty"`
+
+	regex *regexp.Regexp
+	query string
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (r *Rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*r = Rule{}
+	type plain Rule
+	if err := unmarshal((*plain)(r)); err != nil {
+		return err
+	}
+
+	if (r.Regex == "") == (r.Query == "") {
+		return fmt.Errorf("query_deny_list rules require exactly one of regex or query")
+	}
+	if r.Regex != "" {
+		regex, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid query_deny_list regex %q: %v", r.Regex, err)
+		}
+		r.regex = regex
+	} else {
+		query, ok := normalize(r.Query)
+		if !ok {
+			return fmt.Errorf("invalid query_deny_list query %q", r.Query)
+		}
+		r.query = query
+	}
+	return nil
+}
+
+// normalize returns the query formatted by the PromQL printer, and whether it is valid
+func normalize(query string) (string, bool) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return query, false
+	}
+	return expr.String(), true
+}
+
+// matches returns whether the rule denies the query (and its normalized form)
+func (r *Rule) matches(query, normalized string) bool {
+	if r.regex != nil {
+		return r.regex.MatchString(query) || r.regex.MatchString(normalized)
+	}
+	return r.query == normalized
+}
@@ -0,0 +1,90 @@
+// Package querydeny implements a deny-list of the queries promxy refuses to evaluate,
+// such that known pathological (e.g. dashboard) queries can be blocked centrally while
+// they are being fixed.
+package querydeny
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var queriesDenied = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "query_deny_list_denied_total",
+	Help: "Number of queries denied by the query deny-list, by the index of the rule",
+}, []string{"rule"})
+
+func init() {
+	prometheus.MustRegister(queriesDenied)
+}
+
+// DeniedError is returned for a query denied by a rule of the deny-list
+type DeniedError struct {
+	Rule *Rule
+}
+
+func (e *DeniedError) Error() string {
+	msg := "query denied by the promxy query deny-list"
+	if e.Rule.Reason != "" {
+		msg += ": " + e.Rule.Reason
+	}
+	return msg
+}
+
+// DenyList denies the queries matching any of its rules
+type DenyList struct {
+	l     sync.RWMutex
+	rules []*Rule
+}
+
+// New returns a new (empty) DenyList
+func New() *DenyList {
+	return &DenyList{}
+}
+
+// ApplyConfig updates the rules of the deny-list
+func (d *DenyList) ApplyConfig(rules []*Rule) error {
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.rules = rules
+	return nil
+}
+
+// Check returns a DeniedError if the query is denied
+func (d *DenyList) Check(query string) error {
+	d.l.RLock()
+	rules := d.rules
+	d.l.RUnlock()
+	if len(rules) == 0 {
+		return nil
+	}
+
+	normalized, _ := normalize(query)
+	for i, rule := range rules {
+		if rule.matches(query, normalized) {
+			queriesDenied.WithLabelValues(strconv.Itoa(i)).Inc()
+			return &DeniedError{Rule: rule}
+		}
+	}
+	return nil
+}
+
+// Handler returns a handler which responds to the denied queries with an error
+func (d *DenyList) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := d.Check(r.FormValue("query")); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status":    "error",
+				"errorType": "execution",
+				"error":     err.Error(),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,69 @@
+package querydeny
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestDenyList(t *testing.T) {
+	var rules []*Rule
+	if err := yaml.Unmarshal([]byte(`
+- regex: '\{__name__=~"\.[+*]"\}'
+  reason: selects every series
+- query: sum(rate(http_requests_total[5m])) by (path)
+`), &rules); err != nil {
+		t.Fatal(err)
+	}
+	d := New()
+	d.ApplyConfig(rules)
+
+	tests := []struct {
+		query  string
+		denied bool
+	}{
+		{query: `count({__name__=~".+"})`, denied: true},
+		{query: `count({__name__=~".*"}) by (job)`, denied: true},
+		{query: `count({__name__=~"up"})`},
+		// Queries are compared after normalization
+		{query: `sum by(path) (rate(http_requests_total[5m]))`, denied: true},
+		{query: "sum(\n  rate(http_requests_total[5m])\n) by (path)", denied: true},
+		{query: `sum(rate(http_requests_total[1m])) by (path)`},
+		// Invalid queries are left to the engine
+		{query: `sum(`},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := d.Check(test.query)
+			if denied := err != nil; denied != test.denied {
+				t.Fatalf("expected denied=%v for %q, got %v", test.denied, test.query, err)
+			}
+		})
+	}
+
+	if err := d.Check(`{__name__=~".+"}`); err == nil || err.Error() != "query denied by the promxy query deny-list: selects every series" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	h := d.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", `/api/v1/query?query=count({__name__=~".%2B"})`, nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("unexpected status code %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/query?query=up", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", w.Code, w.Body)
+	}
+
+	// Rules require exactly one of regex or query
+	for _, invalid := range []string{"- reason: x", "- {regex: a, query: up}", "- regex: '('", "- query: 'sum('"} {
+		if err := yaml.Unmarshal([]byte(invalid), &rules); err == nil {
+			t.Fatalf("expected an error for %s", invalid)
+		}
+	}
+}
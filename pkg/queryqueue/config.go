@@ -0,0 +1,88 @@
+package queryqueue
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Priority is the priority of a query in the queue, queries of a higher priority
+// are evaluated first
+type Priority int
+
+// The priorities of the queries, e.g. rules > interactive dashboards > API scripts
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	numPriorities
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+// ParsePriority parses the name of a priority (high, normal or low)
+func ParsePriority(s string) (Priority, error) {
+	for p, name := range priorityNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("invalid priority %q, must be one of high, normal or low", s)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (p *Priority) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	var err error
+	*p, err = ParsePriority(s)
+	return err
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (p Priority) MarshalYAML() (interface{}, error) {
+	return p.String(), nil
+}
+
+// Config configures the queue of the queries evaluated by promxy
+type Config struct {
+	// MaxConcurrency is the maximum number of queries evaluated concurrently, the
+	// other queries wait in the queue (the highest priority first)
+	MaxConcurrency int `yaml:"max_concurrency"`
+	// PriorityHeader is the request header with the priority of the query (high, normal or low)
+	PriorityHeader string `yaml:"priority_header"`
+	// TenantHeader is the request header with the tenant of the query, which is used to look up
+	// the priority in TenantPriorities if the request has no priority header
+	TenantHeader     string              `yaml:"tenant_header"`
+	TenantPriorities map[string]Priority `yaml:"tenant_priorities"`
+	// DefaultPriority is the priority of the queries without a priority header or tenant priority
+	DefaultPriority Priority `yaml:"default_priority"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = Config{
+		PriorityHeader:  "X-Query-Priority",
+		TenantHeader:    "X-Scope-OrgID",
+		DefaultPriority: PriorityNormal,
+	}
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.MaxConcurrency < 1 {
+		return fmt.Errorf("query_queue max_concurrency must be at least 1, got %d", c.MaxConcurrency)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Package queryqueue implements a queue of the queries evaluated by promxy, which
+// bounds the number of concurrent queries and evaluates the queries waiting in the
+// queue by priority, such that background bulk queries can't starve the interactive
+// users (or the rules) during overload.
+package queryqueue
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queriesQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "query_queue_queries_queued",
+		Help: "Number of queries waiting in the query queue",
+	}, []string{"priority"})
+
+	queryQueueSummary = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "query_queue_duration_seconds",
+		Help: "Summary of time queries waited in the query queue",
+	}, []string{"priority"})
+)
+
+func init() {
+	prometheus.MustRegister(queriesQueued)
+	prometheus.MustRegister(queryQueueSummary)
+}
+
+// waiter is a query waiting in the queue, ch is closed once it may run
+type waiter struct {
+	ch      chan struct{}
+	granted bool
+}
+
+// Queue bounds the number of concurrent queries, the queries over the limit wait
+// in the queue and are run by priority (FIFO within a priority). Without a config
+// (or with a nil one) queries aren't limited.
+type Queue struct {
+	l       sync.Mutex
+	cfg     *Config
+	running int
+	waiting [numPriorities][]*waiter
+}
+
+// New returns a new Queue
+func New() *Queue {
+	return &Queue{}
+}
+
+// ApplyConfig updates the config of the queue
+func (q *Queue) ApplyConfig(cfg *Config) error {
+	q.l.Lock()
+	defer q.l.Unlock()
+	q.cfg = cfg
+	q.grant()
+	return nil
+}
+
+// available returns whether another query may run, the lock must be held
+func (q *Queue) available() bool {
+	return q.cfg == nil || q.running < q.cfg.MaxConcurrency
+}
+
+// grant runs the waiting queries (highest priority first) while there are slots
+// available, the lock must be held
+func (q *Queue) grant() {
+	for p := numPriorities - 1; p >= 0; p-- {
+		for len(q.waiting[p]) > 0 && q.available() {
+			w := q.waiting[p][0]
+			q.waiting[p] = q.waiting[p][1:]
+			q.running++
+			w.granted = true
+			close(w.ch)
+		}
+	}
+}
+
+// Acquire blocks until a query of the priority may run or the context is done, the
+// returned func must be called once the query is done
+func (q *Queue) Acquire(ctx context.Context, p Priority) (func(), error) {
+	q.l.Lock()
+	if q.available() {
+		q.running++
+		q.l.Unlock()
+		queryQueueSummary.WithLabelValues(p.String()).Observe(0)
+		return q.release, nil
+	}
+
+	w := &waiter{ch: make(chan struct{})}
+	q.waiting[p] = append(q.waiting[p], w)
+	q.l.Unlock()
+
+	queued := queriesQueued.WithLabelValues(p.String())
+	queued.Inc()
+	defer queued.Dec()
+	start := time.Now()
+
+	select {
+	case <-w.ch:
+		queryQueueSummary.WithLabelValues(p.String()).Observe(time.Since(start).Seconds())
+		return q.release, nil
+	case <-ctx.Done():
+		q.l.Lock()
+		defer q.l.Unlock()
+		if w.granted {
+			// The slot was granted concurrently, so it is passed on
+			q.running--
+			q.grant()
+		} else {
+			for i, waiting := range q.waiting[p] {
+				if waiting == w {
+					q.waiting[p] = append(q.waiting[p][:i], q.waiting[p][i+1:]...)
+					break
+				}
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// release releases the slot of a query, running the next waiting query
+func (q *Queue) release() {
+	q.l.Lock()
+	defer q.l.Unlock()
+	q.running--
+	q.grant()
+}
+
+// Priority returns the priority of the query request, from the priority header or
+// the priority of its tenant
+func (q *Queue) Priority(r *http.Request) Priority {
+	q.l.Lock()
+	cfg := q.cfg
+	q.l.Unlock()
+	if cfg == nil {
+		return PriorityNormal
+	}
+
+	if v := r.Header.Get(cfg.PriorityHeader); cfg.PriorityHeader != "" && v != "" {
+		if p, err := ParsePriority(v); err == nil {
+			return p
+		}
+	}
+	if v := r.Header.Get(cfg.TenantHeader); cfg.TenantHeader != "" && v != "" {
+		if p, ok := cfg.TenantPriorities[v]; ok {
+			return p
+		}
+	}
+	return cfg.DefaultPriority
+}
+
+// Handler returns a handler which runs the queries through the queue
+func (q *Queue) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := q.Acquire(r.Context(), q.Priority(r))
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status":    "error",
+				"errorType": "canceled",
+				"error":     "query cancelled while queued: " + err.Error(),
+			})
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
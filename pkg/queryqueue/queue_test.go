@@ -0,0 +1,105 @@
+package queryqueue
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	q := New()
+	q.ApplyConfig(&Config{MaxConcurrency: 1})
+
+	release, err := q.Acquire(context.TODO(), PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Queue a query of each priority (in order of the lowest first)
+	order := make(chan Priority, numPriorities)
+	var wg sync.WaitGroup
+	for _, p := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+		wg.Add(1)
+		go func(p Priority) {
+			defer wg.Done()
+			release, err := q.Acquire(context.TODO(), p)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- p
+			release()
+		}(p)
+		// Wait for the query to be queued
+		for {
+			q.l.Lock()
+			queued := len(q.waiting[p])
+			q.l.Unlock()
+			if queued == 1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// A queued query whose context is done leaves the queue
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Acquire(ctx, PriorityHigh); err != context.DeadlineExceeded {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	release()
+	var actual []Priority
+	for i := 0; i < int(numPriorities); i++ {
+		actual = append(actual, <-order)
+	}
+	expected := []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("mismatch in order expected=%v actual=%v", expected, actual)
+	}
+	// All of the slots are released once the queries are done
+	wg.Wait()
+	q.l.Lock()
+	running := q.running
+	q.l.Unlock()
+	if running != 0 {
+		t.Fatalf("unexpected running queries: %d", running)
+	}
+}
+
+func TestQueuePriority(t *testing.T) {
+	q := New()
+	q.ApplyConfig(&Config{
+		MaxConcurrency:   1,
+		PriorityHeader:   "X-Query-Priority",
+		TenantHeader:     "X-Scope-OrgID",
+		TenantPriorities: map[string]Priority{"scripts": PriorityLow},
+		DefaultPriority:  PriorityNormal,
+	})
+
+	tests := []struct {
+		headers  map[string]string
+		priority Priority
+	}{
+		{priority: PriorityNormal},
+		{headers: map[string]string{"X-Query-Priority": "high"}, priority: PriorityHigh},
+		{headers: map[string]string{"X-Query-Priority": "invalid"}, priority: PriorityNormal},
+		{headers: map[string]string{"X-Scope-OrgID": "scripts"}, priority: PriorityLow},
+		{headers: map[string]string{"X-Scope-OrgID": "scripts", "X-Query-Priority": "high"}, priority: PriorityHigh},
+		{headers: map[string]string{"X-Scope-OrgID": "dashboards"}, priority: PriorityNormal},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/query", nil)
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		if p := q.Priority(r); p != test.priority {
+			t.Fatalf("mismatch in priority for %v expected=%v actual=%v", test.headers, test.priority, p)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package queryrewrite
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Rule rewrites the queries, either replacing the expression Expr with Replacement or
+// adding the Matchers to every selector
+type Rule struct {
+	// Expr is the replaced expression, which is compared to the (sub-)expressions of the
+	// queries after normalizing the formatting of both
+	Expr string `yaml:"expr,omitempty"`
+	// Replacement is the expression replacing Expr (e.g. the equivalent recording rule)
+	Replacement string `yaml:"replacement,omitempty"`
+	// Matchers are the matchers added to every selector of the queries (e.g. `env="prod"`)
+	Matchers []string `yaml:"matchers,omitempty"`
+
+	expr     string
+	matchers []*labels.Matcher
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (r *Rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*r = Rule{}
+	type plain Rule
+	if err := unmarshal((*plain)(r)); err != nil {
+		return err
+	}
+
+	if (r.Expr == "") == (len(r.Matchers) == 0) {
+		return fmt.Errorf("query_rewrite_rules require exactly one of expr or matchers")
+	}
+	if r.Expr != "" {
+		expr, err := parser.ParseExpr(r.Expr)
+		if err != nil {
+			return fmt.Errorf("invalid query_rewrite_rules expr %q: %v", r.Expr, err)
+		}
+		replacement, err := parser.ParseExpr(r.Replacement)
+		if err != nil {
+			return fmt.Errorf("invalid query_rewrite_rules replacement %q: %v", r.Replacement, err)
+		}
+		if expr.Type() != replacement.Type() {
+			return fmt.Errorf("query_rewrite_rules replacement %q must be of the type of the expr (%s), got %s", r.Replacement, expr.Type(), replacement.Type())
+		}
+		r.expr = expr.String()
+	}
+	for _, m := range r.Matchers {
+		matchers, err := parser.ParseMetricSelector("{" + m + "}")
+		if err != nil || len(matchers) != 1 {
+			return fmt.Errorf("invalid query_rewrite_rules matcher %q: %v", m, err)
+		}
+		r.matchers = append(r.matchers, matchers[0])
+	}
+	return nil
+}
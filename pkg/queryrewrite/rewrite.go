@@ -0,0 +1,126 @@
+// Package queryrewrite implements the rewriting of the queries to promxy before they
+// are evaluated, e.g. to substitute an expensive expression with its recording rule
+// or to add a mandatory matcher to every selector.
+package queryrewrite
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+var queriesRewritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "query_rewrite_rules_rewrites_total",
+	Help: "Number of expressions replaced (or selectors with added matchers) by the query rewrite rules, by the index of the rule",
+}, []string{"rule"})
+
+func init() {
+	prometheus.MustRegister(queriesRewritten)
+}
+
+// Rewriter rewrites the queries with its rules
+type Rewriter struct {
+	l     sync.RWMutex
+	rules []*Rule
+}
+
+// New returns a new Rewriter (without rules)
+func New() *Rewriter {
+	return &Rewriter{}
+}
+
+// ApplyConfig updates the rules of the rewriter
+func (rw *Rewriter) ApplyConfig(rules []*Rule) error {
+	rw.l.Lock()
+	defer rw.l.Unlock()
+	rw.rules = rules
+	return nil
+}
+
+// Rewrite returns the query rewritten by the rules, the expressions are replaced before
+// the matchers are added (such that they are also added to the replacements)
+func (rw *Rewriter) Rewrite(ctx context.Context, query string) (string, error) {
+	rw.l.RLock()
+	rules := rw.rules
+	rw.l.RUnlock()
+	if len(rules) == 0 {
+		return query, nil
+	}
+
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", err
+	}
+
+	replacer := func(_ context.Context, _ *parser.EvalStmt, node parser.Node, _ []parser.Node) (parser.Node, error) {
+		e, ok := node.(parser.Expr)
+		if !ok {
+			return nil, nil
+		}
+		s := e.String()
+		for i, rule := range rules {
+			if rule.expr == "" || rule.expr != s {
+				continue
+			}
+			replacement, err := parser.ParseExpr(rule.Replacement)
+			if err != nil {
+				return nil, err
+			}
+			queriesRewritten.WithLabelValues(strconv.Itoa(i)).Inc()
+			return replacement, nil
+		}
+		return nil, nil
+	}
+
+	root, err := parser.Inspect(ctx, &parser.EvalStmt{Expr: expr}, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		for i, rule := range rules {
+			added := false
+			for _, m := range rule.matchers {
+				if !hasMatcher(vs.LabelMatchers, m) {
+					vs.LabelMatchers = append(vs.LabelMatchers, m)
+					added = true
+				}
+			}
+			if added {
+				queriesRewritten.WithLabelValues(strconv.Itoa(i)).Inc()
+			}
+		}
+		return nil
+	}, replacer)
+	if err != nil {
+		return "", err
+	}
+	return root.String(), nil
+}
+
+// hasMatcher returns whether the matchers include the matcher
+func hasMatcher(matchers []*labels.Matcher, m *labels.Matcher) bool {
+	for _, existing := range matchers {
+		if existing.Name == m.Name && existing.Type == m.Type && existing.Value == m.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler returns a handler which rewrites the queries of the requests, invalid queries
+// are passed on as-is (such that their error is returned by the engine)
+func (rw *Rewriter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if query := r.FormValue("query"); query != "" {
+			if rewritten, err := rw.Rewrite(r.Context(), query); err == nil && rewritten != query {
+				r.Form.Set("query", rewritten)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,74 @@
+package queryrewrite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestRewriter(t *testing.T) {
+	var rules []*Rule
+	if err := yaml.Unmarshal([]byte(`
+- expr: sum(rate(http_requests_total[5m])) by (job)
+  replacement: job:http_requests:rate5m
+- matchers: ['env="prod"']
+`), &rules); err != nil {
+		t.Fatal(err)
+	}
+	rw := New()
+	rw.ApplyConfig(rules)
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{query: `up`, expected: `up{env="prod"}`},
+		{query: `up{env="prod"}`, expected: `up{env="prod"}`},
+		{query: `rate(up{job="a"}[5m])`, expected: `rate(up{env="prod",job="a"}[5m])`},
+		// Sub-expressions are replaced regardless of their formatting
+		{query: `sum by(job) (rate(http_requests_total[5m]))`, expected: `job:http_requests:rate5m{env="prod"}`},
+		{query: "max(\n  sum(rate(http_requests_total[5m])) by (job)\n) / 2", expected: `max(job:http_requests:rate5m{env="prod"}) / 2`},
+		{query: `sum(rate(http_requests_total[1m])) by (job)`, expected: `sum by(job) (rate(http_requests_total{env="prod"}[1m]))`},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			rewritten, err := rw.Rewrite(context.TODO(), test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rewritten != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, rewritten)
+			}
+		})
+	}
+
+	var query string
+	h := rw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.FormValue("query")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/query?query=up", nil))
+	if query != `up{env="prod"}` {
+		t.Fatalf("unexpected query of the request: %s", query)
+	}
+	// Invalid queries are passed on as-is
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/query?query=sum(", nil))
+	if query != "sum(" {
+		t.Fatalf("unexpected query of the request: %s", query)
+	}
+
+	for _, invalid := range []string{
+		"- replacement: up",
+		"- {expr: up, matchers: ['a=\"b\"']}",
+		"- {expr: 'sum(up)', replacement: 'sum('}",
+		"- {expr: up, replacement: '1'}",
+		"- matchers: ['a=']",
+	} {
+		if err := yaml.Unmarshal([]byte(invalid), &rules); err == nil {
+			t.Fatalf("expected an error for %s", invalid)
+		}
+	}
+}
@@ -66,6 +66,26 @@ func DecodeReadRequest(r *http.Request) (*prompb.ReadRequest, error) {
 	return &req, nil
 }
 
+// DecodeWriteRequest reads a remote.WriteRequest from a http.Request.
+func DecodeWriteRequest(r *http.Request) (*prompb.WriteRequest, error) {
+	compressed, err := ioutil.ReadAll(io.LimitReader(r.Body, decodeReadLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	reqBuf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(reqBuf, &req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
 // EncodeReadResponse writes a remote.Response to a http.ResponseWriter.
 func EncodeReadResponse(resp *prompb.ReadResponse, w http.ResponseWriter) error {
 	data, err := proto.Marshal(resp)
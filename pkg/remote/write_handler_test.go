@@ -0,0 +1,114 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage"
+)
+
+func TestRemoteWriteHandler(t *testing.T) {
+	buf := encodeWriteRequest(t, &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 10}, {Value: 2, Timestamp: 20}},
+		},
+	}})
+
+	appendable := &mockAppendable{}
+	handler := NewWriteHandler(appendable)
+
+	req, err := http.NewRequest("POST", "", bytes.NewReader(buf))
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Equal(t, []mockSample{
+		{labels.FromStrings("__name__", "up", "job", "a"), 10, 1},
+		{labels.FromStrings("__name__", "up", "job", "a"), 20, 2},
+	}, appendable.samples)
+	require.True(t, appendable.committed)
+}
+
+func TestRemoteWriteHandlerBadRequest(t *testing.T) {
+	// Invalid label names are rejected
+	buf := encodeWriteRequest(t, &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "in-valid", Value: "a"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 10}},
+		},
+	}})
+
+	for _, body := range [][]byte{buf, []byte("not snappy")} {
+		appendable := &mockAppendable{}
+		req, err := http.NewRequest("POST", "", bytes.NewReader(body))
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		NewWriteHandler(appendable).ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		require.False(t, appendable.committed)
+	}
+}
+
+func encodeWriteRequest(t *testing.T, req *prompb.WriteRequest) []byte {
+	data, err := proto.Marshal(req)
+	require.NoError(t, err)
+	return snappy.Encode(nil, data)
+}
+
+type mockSample struct {
+	l labels.Labels
+	t int64
+	v float64
+}
+
+type mockAppendable struct {
+	samples   []mockSample
+	committed bool
+}
+
+func (m *mockAppendable) Appender(_ context.Context) storage.Appender {
+	return m
+}
+
+func (m *mockAppendable) Add(l labels.Labels, t int64, v float64) (uint64, error) {
+	m.samples = append(m.samples, mockSample{l, t, v})
+	return 0, nil
+}
+
+func (m *mockAppendable) AddFast(_ uint64, _ int64, _ float64) error {
+	return storage.ErrNotFound
+}
+
+func (m *mockAppendable) Commit() error {
+	m.committed = true
+	return nil
+}
+
+func (*mockAppendable) Rollback() error {
+	return nil
+}
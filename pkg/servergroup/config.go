@@ -2,6 +2,11 @@ package servergroup
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
 	config_util "github.com/prometheus/common/config"
@@ -9,6 +14,8 @@ import (
 
 	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/pkg/relabel"
+
+	"github.com/jacksontj/promxy/pkg/promhttputil"
 )
 
 var (
@@ -18,8 +25,14 @@ var (
 		Scheme:         "http",
 		RemoteReadPath: "api/v1/read",
 		Timeout:        0,
+		Quorum:         1,
 		HTTPConfig: HTTPClientConfig{
-			DialTimeout: time.Millisecond * 200, // Default dial timeout of 200ms
+			DialTimeout:         time.Millisecond * 200, // Default dial timeout of 200ms
+			MaxIdleConns:        20000,
+			MaxIdleConnsPerHost: 1000, // see https://github.com/golang/go/issues/13801
+			// 5 minutes is typically above the maximum sane scrape interval. So we can
+			// use keepalive for all configurations.
+			IdleConnTimeout: 5 * time.Minute,
 		},
 	}
 )
@@ -32,6 +45,10 @@ const (
 // Config is the configuration for a ServerGroup that promxy will talk to.
 // This is where the vast majority of options exist.
 type Config struct {
+	// Name identifies this servergroup in metrics, by default servergroups are
+	// identified by their index in the config
+	Name string `yaml:"name"`
+
 	// RemoteRead directs promxy to load RAW data (meaning matrix selectors such as `foo[1h]`)
 	// through the RemoteRead API on prom.
 	// Pros:
@@ -53,10 +70,20 @@ type Config struct {
 	RemoteRead bool `yaml:"remote_read"`
 	// RemoteReadPath sets the remote read path for the hosts in this servergroup
 	RemoteReadPath string `yaml:"remote_read_path"`
+	// ThanosStoreAPI directs promxy to talk to the hosts in this servergroup through the
+	// Thanos StoreAPI (gRPC), e.g. Thanos sidecars, stores or queriers. The StoreAPI only serves
+	// raw data, so queries are evaluated by promxy (using https if the scheme is https, with the
+	// tls_config of the http_client).
+	ThanosStoreAPI bool `yaml:"thanos_store_api"`
+	// VictoriaMetrics marks the hosts in this servergroup as VictoriaMetrics, such that its
+	// extensions are used (e.g. raw data is loaded through the export API) and the differences
+	// in its responses are handled (e.g. partial responses are returned as warnings)
+	VictoriaMetrics bool `yaml:"victoria_metrics"`
 	// HTTP client config for promxy to use when connecting to the various server_groups
 	// this is the same config as prometheus
 	HTTPConfig HTTPClientConfig `yaml:"http_client"`
-	// Scheme defines how promxy talks to this server group (http, https, etc.)
+	// Scheme defines how promxy talks to this server group (http or https), this applies
+	// to all discovered targets regardless of any __scheme__ from service discovery
 	Scheme string `yaml:"scheme"`
 	// Labels is a set of labels that will be added to all metrics retrieved
 	// from this server group
@@ -88,13 +115,29 @@ type Config struct {
 	// So in reality its "the same", the difference is in prometheus these apply to the labels/targets of a scrape job,
 	// in promxy they apply to the prometheus hosts in the servergroup - but the behavior is the same.
 	RelabelConfigs []*relabel.Config `yaml:"relabel_configs,omitempty"`
+	// MetricRelabelConfigs are applied to the series returned by the hosts in this servergroup
+	// (like prometheus' metric_relabel_configs, but at read time) before the Labels are added.
+	// This allows normalizing inconsistent labeling schemes across clusters (renaming labels,
+	// rewriting label values, dropping series). Note that queries are not rewritten, selectors
+	// sent to the hosts match the series as the hosts have them.
+	MetricRelabelConfigs []*relabel.Config `yaml:"metric_relabel_configs,omitempty"`
+	// ReplicaLabels are labels which only differ between HA replicas (e.g. a `replica` external
+	// label), they are dropped from the series returned by the hosts in this servergroup which
+	// have them as external labels (loaded from their config), such that the series of the
+	// replicas are merged
+	ReplicaLabels []string `yaml:"replica_labels,omitempty"`
+	// MatcherRewrites renames labels in the queries sent to the hosts in this servergroup
+	// (label name as queried -> label name in the hosts), such that servergroups with a
+	// different labeling scheme can be queried with a consistent one. This is typically
+	// paired with MetricRelabelConfigs renaming the labels of the results.
+	MatcherRewrites map[string]string `yaml:"matcher_rewrites,omitempty"`
 	// ServiceDiscoveryConfigs is a set of ServiceDiscoveryConfig options that allow promxy to discover
 	// all hosts in the server_group
 	ServiceDiscoveryConfigs discovery.Configs `yaml:"-"`
 	// PathPrefix to prepend to all queries to hosts in this servergroup
 	PathPrefix string `yaml:"path_prefix"`
 	// QueryParams are a map of query params to add to all HTTP calls made to this downstream
-	// the main use-case for this is to add `nocache=1` to VictoriaMetrics downstreams
+	// (including remote_read), the main use-case for this is to add `nocache=1` to VictoriaMetrics downstreams
 	// (see https://github.com/jacksontj/promxy/issues/202)
 	QueryParams map[string]string `yaml:"query_params"`
 	// TODO cache this as a model.Time after unmarshal
@@ -108,6 +151,28 @@ type Config struct {
 	// any one of these can cause the resulting data in prometheus to have the same time but in reality
 	// come from different points in time. Best practice for this value is to set it to your scrape interval
 	AntiAffinity time.Duration `yaml:"anti_affinity,omitempty"`
+	// ScrapeInterval, if set, is the scrape interval of the hosts, which is used as the anti_affinity
+	ScrapeInterval time.Duration `yaml:"scrape_interval,omitempty"`
+	// AntiAffinityAuto learns the anti_affinity from the spacing of the samples returned by the
+	// hosts (i.e. their scrape interval), starting from the anti_affinity (or scrape_interval)
+	AntiAffinityAuto bool `yaml:"anti_affinity_auto,omitempty"`
+	// AntiAffinityLabel, if set, is the label (e.g. set by metric_relabel_configs) overriding the
+	// anti_affinity of the series with it by its value (a duration, e.g. 5m), such that series with
+	// different scrape intervals in the same servergroup are merged correctly. The label is removed.
+	AntiAffinityLabel model.LabelName `yaml:"anti_affinity_label,omitempty"`
+
+	// MergeStrategy selects how the conflicting points of a series from multiple hosts (within
+	// the anti_affinity of each other) are resolved: prefer_first, max, min, average or latest.
+	// By default the series with the most points is used, with its holes filled from the others.
+	MergeStrategy promhttputil.MergeStrategy `yaml:"merge_strategy,omitempty"`
+
+	// DedupTolerance, if set, treats nearly-equal points of a series from multiple hosts (e.g.
+	// HA replicas scraping at slightly different times) as duplicates instead of interleaving them
+	DedupTolerance *DedupToleranceConfig `yaml:"dedup_tolerance"`
+
+	// GapFill fills the short gaps of a merged series (e.g. a missed scrape of one host) with the
+	// points of the other hosts, even within the anti_affinity of the points around the gap
+	GapFill bool `yaml:"gap_fill,omitempty"`
 
 	// Timeout, if non-zero, specifies the amount of
 	// time to wait for a server's response headers after fully
@@ -115,11 +180,132 @@ type Config struct {
 	// time does not include the time to read the response body.
 	Timeout time.Duration `yaml:"timeout,omitempty"`
 
+	// MaxConcurrentRequests, if non-zero, limits the number of concurrent requests
+	// to the hosts in this servergroup; requests over the limit wait in a queue
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests"`
+
+	// DownstreamTimeout, if non-zero, is the maximum amount of time to wait for each
+	// host in this servergroup to respond. Hosts that take longer are cut off and
+	// treated as errors, such that the results of the faster replicas are used.
+	// This is independent of the global query timeout, which bounds the whole query.
+	DownstreamTimeout time.Duration `yaml:"downstream_timeout,omitempty"`
+
 	// IgnoreError will hide all errors from this given servergroup effectively making
 	// the responses from this servergroup "not required" for the result.
+	// The errors are returned as warnings instead.
 	// Note: this allows you to make the tradeoff between availability of queries and consistency of results
 	IgnoreError bool `yaml:"ignore_error"`
 
+	// Fallback marks this servergroup as a fallback tier; it is only queried when
+	// the other (primary) servergroups fail or return no data. An example use-case
+	// would be a slower long-term-storage backend which shouldn't be hit for every query.
+	Fallback bool `yaml:"fallback"`
+
+	// Shadow marks this servergroup as a shadow: queries are also sent to it (in the
+	// background) and its responses are compared to the other servergroups', but never
+	// returned. This allows validating e.g. an upgrade or a migration before cutting over.
+	Shadow bool `yaml:"shadow"`
+
+	// Quorum is the number of hosts within this servergroup with the same labels (replicas)
+	// that must successfully respond for a query to succeed. The default of 1 means that
+	// a response from any single replica is sufficient. Raising this ensures that a single
+	// flaky replica returning partial data can't silently produce incomplete results.
+	Quorum int `yaml:"quorum"`
+
+	// Hedge enables hedged requests to the hosts within this servergroup. Instead of
+	// querying all replicas only `quorum` are queried initially; if they are slow to
+	// respond a backup request is sent to another replica and the first response wins.
+	Hedge *HedgeConfig `yaml:"hedge"`
+
+	// LoadBalance, if set, sends each query to a weighted-random subset of the hosts with
+	// the same labels (replicas) instead of all of them, failing over to the others on error.
+	// This trades the resilience of merging the responses of all replicas for less load.
+	LoadBalance *LoadBalanceConfig `yaml:"load_balance"`
+
+	// FirstSuccess returns the first successful response(s) from hosts with the same
+	// labels (replicas), cancelling the rest, instead of merging all of them. This is
+	// useful when the hosts are identical HA replicas, where merging is wasted work.
+	FirstSuccess bool `yaml:"first_success"`
+
+	// CircuitBreaker, if set, stops sending requests to hosts in this servergroup
+	// which are failing for a cooldown period, instead of waiting on them for every query.
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker"`
+
+	// HealthCheck, if set, actively probes the hosts in this servergroup and fails
+	// requests to unhealthy hosts immediately until they recover
+	HealthCheck *HealthCheckConfig `yaml:"health_check"`
+
+	// CapabilityDetection, if set, detects the version of each host in this servergroup
+	// (from its build info) when it is discovered, such that features the version doesn't
+	// support (e.g. matchers on label values) are avoided
+	CapabilityDetection *CapabilityDetectionConfig `yaml:"capability_detection"`
+
+	// Tenant, if set, sets the tenant header (e.g. X-Scope-OrgID for Cortex/Mimir) on
+	// requests to the hosts in this servergroup based on the tenant of the incoming request
+	Tenant *TenantConfig `yaml:"tenant"`
+
+	// Retry, if set, retries requests to hosts in this servergroup which fail with
+	// transient errors (e.g. 5xx responses or connection resets)
+	Retry *RetryConfig `yaml:"retry"`
+
+	// Limits, if set, limits the number of series/samples returned by each host in this
+	// servergroup, protecting promxy's memory from runaway selectors
+	Limits *LimitsConfig `yaml:"limits"`
+
+	// CallTimeouts, if set, applies a timeout to requests to the hosts in this servergroup
+	// by the type of call (e.g. range queries may take longer than label lookups)
+	CallTimeouts *CallTimeoutsConfig `yaml:"call_timeouts"`
+
+	// QuerySplit, if set, splits long range queries to this servergroup into aligned
+	// sub-ranges which are queried in parallel and stitched together
+	QuerySplit *QuerySplitConfig `yaml:"query_split"`
+
+	// QuerySharding, if set, shards queries of composable aggregations (e.g. sum) to this
+	// servergroup by the series (for downstreams which support shard matchers, e.g. Mimir)
+	// and evaluates the shards concurrently
+	QuerySharding *QueryShardingConfig `yaml:"query_sharding"`
+
+	// Downsampling, if set, selects the resolution of the data used by the range queries to
+	// this servergroup (e.g. Thanos' downsampled data) by their step
+	Downsampling *DownsamplingConfig `yaml:"downsampling"`
+
+	// LookbackDelta, if non-zero, is sent with the queries to the hosts in this servergroup
+	// as their lookback delta (`lookback_delta`, `max_lookback` for VictoriaMetrics), such that
+	// it can match their scrape interval. This requires support by the hosts (e.g. Thanos).
+	// Defaults to the global lookback_delta.
+	LookbackDelta time.Duration `yaml:"lookback_delta,omitempty"`
+	// AlignQueriesWithStep aligns the start and end of the range queries to the hosts in this
+	// servergroup to multiples of their step. Defaults to the global align_queries_with_step.
+	AlignQueriesWithStep *bool `yaml:"align_queries_with_step,omitempty"`
+
+	// RateLimit, if set, limits the rate of (and concurrent) requests to each host
+	// in this servergroup, protecting small downstreams from bursts of queries
+	RateLimit *RateLimitConfig `yaml:"rate_limit"`
+
+	// FailurePolicy defines when partial failures of hosts within this servergroup
+	// should fail the query, allowing a choice of correctness over availability.
+	// By default any failures are tolerated as long as the quorum is met.
+	FailurePolicy *FailurePolicyConfig `yaml:"failure_policy"`
+
+	// Zones, if set, makes the quorum zone-aware: hosts are grouped by the value of
+	// a (post-relabel) target label and a query fails unless enough zones respond.
+	Zones *ZonesConfig `yaml:"zones"`
+
+	// LabelFilter, if set, only sends queries to the hosts in this servergroup if
+	// their selectors may match the label values of the host (e.g. of a `cluster`
+	// label), instead of sending every query to every host
+	LabelFilter *LabelFilterConfig `yaml:"label_filter"`
+
+	// Sharding, if set, marks the hosts in this servergroup as hashmod shards of the series
+	// (e.g. prometheus hosts sharding their scrape targets). Queries are sent to all shards
+	// but fail if any shard doesn't respond, and can be pruned to the shards whose series
+	// the equality matchers of the query select.
+	Sharding *ShardingConfig `yaml:"sharding"`
+
+	// Record, if set, records the requests to (and responses from) the hosts in this
+	// servergroup to a file, such that they can be replayed to debug merging issues
+	Record *RecordConfig `yaml:"record"`
+
 	// RelativeTimeRangeConfig defines a relative time range that this servergroup will respond to
 	// An example use-case would be if a specific servergroup was long-term storage, it might only
 	// have data 3d old and retain 90d of data.
@@ -136,11 +322,37 @@ func (c *Config) GetScheme() string {
 	return c.Scheme
 }
 
-// GetAntiAffinity returns the AntiAffinity time for this servergroup
+// GetAntiAffinity returns the AntiAffinity time for this servergroup, the ScrapeInterval if set
 func (c *Config) GetAntiAffinity() model.Time {
+	if c.ScrapeInterval > 0 {
+		return model.Time(c.ScrapeInterval / time.Millisecond)
+	}
 	return model.TimeFromUnix(int64((c.AntiAffinity).Seconds()))
 }
 
+// queryArgs returns the query params to add to the HTTP calls to the hosts in this
+// servergroup, the QueryParams and the lookback delta (if set)
+func (c *Config) queryArgs() map[string]string {
+	if c.LookbackDelta == 0 {
+		return c.QueryParams
+	}
+	args := make(map[string]string, len(c.QueryParams)+1)
+	for k, v := range c.QueryParams {
+		args[k] = v
+	}
+	name := "lookback_delta"
+	if c.VictoriaMetrics {
+		name = "max_lookback"
+	}
+	args[name] = model.Duration(c.LookbackDelta).String()
+	return args
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (c *Config) MarshalYAML() (interface{}, error) {
+	return discovery.MarshalYAMLWithInlineConfigs(c)
+}
+
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
 func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	*c = DefaultConfig
@@ -149,13 +361,576 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 
+	// The http client config is inlined, so its own validation isn't run
+	if err := c.HTTPConfig.HTTPConfig.Validate(); err != nil {
+		return err
+	}
+	if oauth2 := c.HTTPConfig.OAuth2; oauth2 != nil {
+		if err := oauth2.Validate(); err != nil {
+			return err
+		}
+		if httpCfg := c.HTTPConfig.HTTPConfig; httpCfg.BasicAuth != nil || len(httpCfg.BearerToken) > 0 || len(httpCfg.BearerTokenFile) > 0 {
+			return fmt.Errorf("at most one of basic_auth, oauth2, bearer_token & bearer_token_file must be configured")
+		}
+	}
+
+	if httpCfg := c.HTTPConfig; httpCfg.MaxIdleConns < 0 || httpCfg.MaxIdleConnsPerHost < 0 || httpCfg.MaxConnsPerHost < 0 {
+		return fmt.Errorf("http_client connection limits must not be negative")
+	}
+
+	if c.Scheme != "http" && c.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", c.Scheme)
+	}
+
+	if (c.ThanosStoreAPI && c.RemoteRead) || (c.VictoriaMetrics && (c.RemoteRead || c.ThanosStoreAPI)) {
+		return fmt.Errorf("at most one of remote_read, thanos_store_api & victoria_metrics must be configured")
+	}
+
+	if c.Quorum < 1 {
+		return fmt.Errorf("quorum must be at least 1, got %d", c.Quorum)
+	}
+
+	for _, name := range c.ReplicaLabels {
+		if !model.LabelName(name).IsValid() || name == model.MetricNameLabel {
+			return fmt.Errorf("invalid replica_labels label name %q", name)
+		}
+	}
+
+	for from, to := range c.MatcherRewrites {
+		for _, name := range []string{from, to} {
+			if !model.LabelName(name).IsValid() || name == model.MetricNameLabel {
+				return fmt.Errorf("invalid matcher_rewrites label name %q", name)
+			}
+		}
+	}
+
+	if c.CircuitBreaker != nil && c.CircuitBreaker.ErrorThreshold < 1 {
+		return fmt.Errorf("circuit_breaker error_threshold must be at least 1, got %d", c.CircuitBreaker.ErrorThreshold)
+	}
+
+	if c.RateLimit != nil && (c.RateLimit.RequestsPerSecond < 0 || c.RateLimit.Burst < 0 || c.RateLimit.MaxInflight < 0) {
+		return fmt.Errorf("rate_limit values must not be negative")
+	}
+
+	if c.ScrapeInterval < 0 {
+		return fmt.Errorf("scrape_interval must not be negative, got %v", c.ScrapeInterval)
+	}
+
+	if c.AntiAffinityLabel != "" && !c.AntiAffinityLabel.IsValid() {
+		return fmt.Errorf("invalid anti_affinity_label label name %q", c.AntiAffinityLabel)
+	}
+
+	if c.FailurePolicy != nil && (c.FailurePolicy.MaxFailureRatio < 0 || c.FailurePolicy.MaxFailureRatio > 1) {
+		return fmt.Errorf("failure_policy max_failure_ratio must be between 0 and 1, got %v", c.FailurePolicy.MaxFailureRatio)
+	}
+
+	if c.Zones != nil {
+		if !model.LabelName(c.Zones.Label).IsValid() {
+			return fmt.Errorf("zones label %q is not a valid label name", c.Zones.Label)
+		}
+		if c.Zones.MaxFailures < 0 {
+			return fmt.Errorf("zones max_failures must not be negative, got %d", c.Zones.MaxFailures)
+		}
+	}
+
+	if c.Shadow && c.Fallback {
+		return fmt.Errorf("a servergroup can't be both a shadow and a fallback")
+	}
+
+	if c.Record != nil && c.Record.Path == "" {
+		return fmt.Errorf("record path must be set")
+	}
+
+	if c.Hedge != nil {
+		if c.Hedge.Delay <= 0 {
+			return fmt.Errorf("hedge delay must be positive, got %v", c.Hedge.Delay)
+		}
+		if c.Hedge.Quantile < 0 || c.Hedge.Quantile > 1 {
+			return fmt.Errorf("hedge quantile must be between 0 and 1, got %v", c.Hedge.Quantile)
+		}
+	}
+
+	if c.LoadBalance != nil {
+		if c.LoadBalance.SubsetSize < c.Quorum {
+			return fmt.Errorf("load_balance subset_size must be at least the quorum (%d), got %d", c.Quorum, c.LoadBalance.SubsetSize)
+		}
+		if c.LoadBalance.WeightLabel != "" && !model.LabelName(c.LoadBalance.WeightLabel).IsValid() {
+			return fmt.Errorf("load_balance weight_label %q is not a valid label name", c.LoadBalance.WeightLabel)
+		}
+		if c.Hedge != nil {
+			return fmt.Errorf("at most one of hedge & load_balance must be configured")
+		}
+	}
+
+	return nil
+}
+
+// HedgeConfig configures hedged requests within a servergroup
+type HedgeConfig struct {
+	// Delay is how long to wait for a response before sending a backup request (which
+	// must be positive). If Quantile is set this is used until enough latency has been observed.
+	Delay time.Duration `yaml:"delay"`
+	// Quantile (0-1), if set, derives the delay from the given quantile of the recently
+	// observed latency of each call to the servergroup (e.g. 0.95 for p95)
+	Quantile float64 `yaml:"quantile"`
+}
+
+// ShardingConfig configures the hashmod shards of a servergroup
+type ShardingConfig struct {
+	// Modulus is the number of shards
+	Modulus uint64 `yaml:"modulus"`
+	// ShardLabel is the target label (after relabeling) containing the shard (0 to modulus-1) of each host
+	ShardLabel string `yaml:"shard_label"`
+	// SourceLabels, if set, are the series labels the shards are hashed by (e.g. instance),
+	// queries with equality matchers on all of them are only sent to the matching shard
+	SourceLabels []string `yaml:"source_labels"`
+	// Separator is placed between the values of the SourceLabels before hashing
+	Separator string `yaml:"separator"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *ShardingConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = ShardingConfig{ShardLabel: "__shard__", Separator: ";"}
+	type plain ShardingConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.Modulus < 1 {
+		return fmt.Errorf("sharding modulus must be at least 1, got %d", c.Modulus)
+	}
+	for _, name := range append([]string{c.ShardLabel}, c.SourceLabels...) {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid sharding label name %q", name)
+		}
+	}
+	return nil
+}
+
+// LoadBalanceConfig configures load balancing of the queries within a servergroup
+type LoadBalanceConfig struct {
+	// SubsetSize is the number of hosts with the same labels each query is sent to
+	SubsetSize int `yaml:"subset_size"`
+	// WeightLabel, if set, is the target label (after relabeling) containing the weight
+	// of each host, hosts without the label have a weight of 1
+	WeightLabel string `yaml:"weight_label"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *LoadBalanceConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = LoadBalanceConfig{SubsetSize: 1}
+	type plain LoadBalanceConfig
+	return unmarshal((*plain)(c))
+}
+
+// FailurePolicyConfig configures when partial failures in a servergroup fail a query
+type FailurePolicyConfig struct {
+	// MaxFailures, if set, fails the query if more than this many hosts error
+	MaxFailures *int `yaml:"max_failures"`
+	// MaxFailureRatio, if non-zero, fails the query if more than this ratio (0-1) of hosts error
+	MaxFailureRatio float64 `yaml:"max_failure_ratio"`
+	// RequiredTargets is a list of targets (host:port) which fail the query if they error
+	RequiredTargets []string `yaml:"required_targets"`
+}
+
+// ZonesConfig configures zone-aware quorum within a servergroup
+type ZonesConfig struct {
+	// Label is the target label (after relabeling) containing the zone of each host
+	Label string `yaml:"label"`
+	// MaxFailures is the number of zones which may have no successful response
+	MaxFailures int `yaml:"max_failures"`
+}
+
+// LabelFilterConfig configures the label values used to filter the queries sent
+// to each host in a servergroup
+type LabelFilterConfig struct {
+	// DynamicLabels are labels whose values are loaded from each host
+	DynamicLabels []string `yaml:"dynamic_labels"`
+	// SyncInterval is how often the values of the DynamicLabels are reloaded
+	SyncInterval time.Duration `yaml:"sync_interval"`
+	// StaticLabelsInclude maps label names to the only values the hosts have
+	StaticLabelsInclude map[string][]string `yaml:"static_labels_include"`
+	// StaticLabelsExclude maps label names to values the hosts don't have
+	StaticLabelsExclude map[string][]string `yaml:"static_labels_exclude"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *LabelFilterConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	c.SyncInterval = 5 * time.Minute
+	type plain LabelFilterConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	return c.validate()
+}
+
+func (c *LabelFilterConfig) validate() error {
+	names := append([]string(nil), c.DynamicLabels...)
+	for name := range c.StaticLabelsInclude {
+		names = append(names, name)
+	}
+	for name := range c.StaticLabelsExclude {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid label_filter label name %q", name)
+		}
+	}
+	if len(c.DynamicLabels) > 0 && c.SyncInterval <= 0 {
+		return fmt.Errorf("label_filter sync_interval must be positive, got %v", c.SyncInterval)
+	}
+	return nil
+}
+
+// RecordConfig configures recording of requests to the hosts in a servergroup
+type RecordConfig struct {
+	// Path is the file the records are appended to (as JSON lines)
+	Path string `yaml:"path"`
+	// RedactLabels are labels whose values are redacted in the recorded responses
+	RedactLabels []string `yaml:"redact_labels"`
+}
+
+// RetryConfig configures retries of requests to hosts in a servergroup
+type RetryConfig struct {
+	// Retries is the maximum number of retries for a single request
+	Retries int `yaml:"retries"`
+	// Backoff is how long to wait before the first retry, this is doubled for each retry
+	Backoff time.Duration `yaml:"backoff"`
+	// MaxBackoff, if non-zero, caps the time waited between retries
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// LimitsConfig configures the limits of the results returned by each host in a servergroup
+type LimitsConfig struct {
+	// MaxSeries, if non-zero, is the maximum number of series in a result
+	MaxSeries int `yaml:"max_series"`
+	// MaxSamples, if non-zero, is the maximum number of samples in a result
+	MaxSamples int `yaml:"max_samples"`
+	// Truncate returns results over the limits truncated with a warning, instead of failing
+	Truncate bool `yaml:"truncate"`
+}
+
+// CallTimeoutsConfig configures the timeout for each type of call to the hosts in a
+// servergroup, a zero timeout means calls of that type have no timeout
+type CallTimeoutsConfig struct {
+	Query       time.Duration `yaml:"query"`
+	QueryRange  time.Duration `yaml:"query_range"`
+	Series      time.Duration `yaml:"series"`
+	LabelNames  time.Duration `yaml:"label_names"`
+	LabelValues time.Duration `yaml:"label_values"`
+	// GetValue is the timeout for fetching raw data (e.g. for matrix selectors)
+	GetValue time.Duration `yaml:"get_value"`
+}
+
+// RateLimitConfig configures the rate limit for each host in a servergroup
+type RateLimitConfig struct {
+	// RequestsPerSecond, if non-zero, is the sustained rate of requests allowed to each host
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	// Burst is the number of requests allowed over RequestsPerSecond in a burst
+	Burst int `yaml:"burst"`
+	// MaxInflight, if non-zero, limits the number of concurrent requests to each host
+	MaxInflight int `yaml:"max_inflight"`
+}
+
+// CircuitBreakerConfig configures the circuit breaker for each host in a servergroup
+type CircuitBreakerConfig struct {
+	// ErrorThreshold is the number of consecutive failures which opens the circuit
+	ErrorThreshold int `yaml:"error_threshold"`
+	// LatencyThreshold, if non-zero, causes requests taking longer than it to count as failures
+	LatencyThreshold time.Duration `yaml:"latency_threshold"`
+	// Cooldown is how long the circuit stays open before a trial request is let through
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// HealthCheckConfig configures the health check of each host in a servergroup
+type HealthCheckConfig struct {
+	// Path is requested (under the path_prefix) to check the health of the hosts
+	Path string `yaml:"path"`
+	// Interval is the time between checks
+	Interval time.Duration `yaml:"interval"`
+	// Timeout is the maximum time to wait for a check
+	Timeout time.Duration `yaml:"timeout"`
+	// UnhealthyThreshold is the number of consecutive failed checks which mark a host as unhealthy
+	UnhealthyThreshold int `yaml:"unhealthy_threshold"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *HealthCheckConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = HealthCheckConfig{
+		Path:               "/-/ready",
+		Interval:           10 * time.Second,
+		Timeout:            2 * time.Second,
+		UnhealthyThreshold: 2,
+	}
+	type plain HealthCheckConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.Interval <= 0 {
+		return fmt.Errorf("health_check interval must be positive, got %v", c.Interval)
+	}
+	if c.UnhealthyThreshold < 1 {
+		return fmt.Errorf("health_check unhealthy_threshold must be at least 1, got %d", c.UnhealthyThreshold)
+	}
+	return nil
+}
+
+// CapabilityDetectionConfig configures the detection of the capabilities of each host in a servergroup
+type CapabilityDetectionConfig struct {
+	// Interval is how often the capabilities are detected again (e.g. after an upgrade)
+	Interval time.Duration `yaml:"interval"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *CapabilityDetectionConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = CapabilityDetectionConfig{Interval: 10 * time.Minute}
+	type plain CapabilityDetectionConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.Interval <= 0 {
+		return fmt.Errorf("capability_detection interval must be positive, got %v", c.Interval)
+	}
+	return nil
+}
+
+// QuerySplitConfig configures the splitting of the range queries to a servergroup
+type QuerySplitConfig struct {
+	// Interval is the interval the sub-ranges are aligned to (e.g. 24h for a sub-range per day)
+	Interval time.Duration `yaml:"interval"`
+	// MaxConcurrency is the maximum number of sub-ranges queried at a time (0 is unlimited)
+	MaxConcurrency int `yaml:"max_concurrency"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *QuerySplitConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = QuerySplitConfig{Interval: 24 * time.Hour}
+	type plain QuerySplitConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.Interval <= 0 {
+		return fmt.Errorf("query_split interval must be positive, got %v", c.Interval)
+	}
+	if c.MaxConcurrency < 0 {
+		return fmt.Errorf("query_split max_concurrency must not be negative, got %d", c.MaxConcurrency)
+	}
+	return nil
+}
+
+// DedupToleranceConfig configures when points of a series from multiple hosts are duplicates,
+// a point is a duplicate of another within Time if their values are within Value or Ratio
+type DedupToleranceConfig struct {
+	// Time is the maximum time between duplicate points (e.g. the scrape interval)
+	Time time.Duration `yaml:"time"`
+	// Value is the maximum absolute difference of the values of duplicate points
+	Value float64 `yaml:"value"`
+	// Ratio is the maximum difference of the values of duplicate points, relative to the larger value
+	Ratio float64 `yaml:"ratio"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *DedupToleranceConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DedupToleranceConfig{}
+	type plain DedupToleranceConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.Time <= 0 {
+		return fmt.Errorf("dedup_tolerance time must be positive, got %v", c.Time)
+	}
+	if c.Value < 0 || c.Ratio < 0 {
+		return fmt.Errorf("dedup_tolerance value and ratio must not be negative, got value=%v ratio=%v", c.Value, c.Ratio)
+	}
+	return nil
+}
+
+// tolerance returns the DedupTolerance of the config
+func (c *DedupToleranceConfig) tolerance() *promhttputil.DedupTolerance {
+	return &promhttputil.DedupTolerance{
+		Time:  model.TimeFromUnixNano(c.Time.Nanoseconds()),
+		Value: c.Value,
+		Ratio: c.Ratio,
+	}
+}
+
+// DownsamplingConfig configures the selection of the resolution of the data used by the
+// range queries to a servergroup
+type DownsamplingConfig struct {
+	// Resolutions are the resolutions of the downsampled data kept by the hosts (e.g. 5m and 1h)
+	Resolutions []time.Duration `yaml:"resolutions"`
+	// StepFactor is the minimum number of samples of the selected resolution per step, range
+	// queries with shorter steps use a finer resolution (or the raw data)
+	StepFactor int `yaml:"step_factor"`
+	// Param is the query param with the max resolution of the data used by the query
+	Param string `yaml:"param"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *DownsamplingConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DownsamplingConfig{StepFactor: 5, Param: "max_source_resolution"}
+	type plain DownsamplingConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if len(c.Resolutions) == 0 {
+		return fmt.Errorf("downsampling requires at least one resolution")
+	}
+	for _, res := range c.Resolutions {
+		if res <= 0 {
+			return fmt.Errorf("downsampling resolutions must be positive, got %v", res)
+		}
+	}
+	sort.Slice(c.Resolutions, func(i, j int) bool { return c.Resolutions[i] < c.Resolutions[j] })
+	if c.StepFactor < 1 {
+		return fmt.Errorf("downsampling step_factor must be at least 1, got %d", c.StepFactor)
+	}
+	if c.Param == "" {
+		return fmt.Errorf("downsampling param must not be empty")
+	}
+	return nil
+}
+
+// QueryShardingConfig configures the sharding of the queries to a servergroup
+type QueryShardingConfig struct {
+	// Shards is the number of shards each query is split into
+	Shards int `yaml:"shards"`
+	// Label is the label of the shard matchers (e.g. `__query_shard__="1_of_16"`)
+	Label string `yaml:"label"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *QueryShardingConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = QueryShardingConfig{Label: "__query_shard__"}
+	type plain QueryShardingConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.Shards < 2 {
+		return fmt.Errorf("query_sharding shards must be at least 2, got %d", c.Shards)
+	}
+	if !model.LabelName(c.Label).IsValid() {
+		return fmt.Errorf("query_sharding label %q is not a valid label name", c.Label)
+	}
+	return nil
+}
+
+// TenantConfig configures the tenant of the requests to a servergroup
+type TenantConfig struct {
+	// Header is the header of the tenant, both on the incoming requests and the requests to the hosts
+	Header string `yaml:"header"`
+	// Map maps incoming tenants to the tenants of the servergroup, unmapped tenants are passed as-is
+	// (so the incoming requests choose the tenant queried) unless RejectUnmapped is set
+	Map map[string]string `yaml:"map"`
+	// RejectUnmapped fails the requests of incoming tenants which aren't in the Map
+	RejectUnmapped bool `yaml:"reject_unmapped"`
+	// Default is the tenant of requests without one (e.g. rule evaluation), if
+	// unset the header isn't set on these requests
+	Default string `yaml:"default"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *TenantConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = TenantConfig{Header: "X-Scope-OrgID"}
+	type plain TenantConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.Header == "" {
+		return fmt.Errorf("tenant header must not be empty")
+	}
 	return nil
 }
 
 // HTTPClientConfig extends prometheus' HTTPClientConfig
 type HTTPClientConfig struct {
-	DialTimeout time.Duration                `yaml:"dial_timeout"`
-	HTTPConfig  config_util.HTTPClientConfig `yaml:",inline"`
+	// Headers are set on all requests to the hosts (e.g. a static X-Scope-OrgID)
+	Headers     map[string]string `yaml:"headers"`
+	DialTimeout time.Duration     `yaml:"dial_timeout"`
+	// TLSHandshakeTimeout, if non-zero, is the maximum time to wait for a TLS handshake
+	TLSHandshakeTimeout time.Duration `yaml:"tls_handshake_timeout"`
+	// MaxIdleConns is the maximum number of idle (keep-alive) connections to all hosts
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// MaxIdleConnsPerHost is the maximum number of idle (keep-alive) connections to each host
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	// MaxConnsPerHost, if non-zero, limits the number of connections to each host
+	MaxConnsPerHost int `yaml:"max_conns_per_host"`
+	// IdleConnTimeout is how long idle connections are kept open
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout"`
+	OAuth2          *OAuth2Config `yaml:"oauth2,omitempty"`
+	// NoProxy is a list of hosts which are connected to directly instead of through
+	// the proxy_url, entries may be hostnames (matching subdomains), host:port or CIDRs
+	NoProxy    []string                     `yaml:"no_proxy,omitempty"`
+	HTTPConfig config_util.HTTPClientConfig `yaml:",inline"`
+}
+
+// UseProxy returns whether requests to the host (host or host:port) should use the proxy_url
+func (c *HTTPClientConfig) UseProxy(host string) bool {
+	if c.HTTPConfig.ProxyURL.URL == nil {
+		return false
+	}
+
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	ip := net.ParseIP(hostname)
+
+	for _, entry := range c.NoProxy {
+		if entry == "*" || entry == host {
+			return false
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return false
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(entry, ".")
+		if hostname == entry || strings.HasSuffix(hostname, "."+entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// Proxy returns the proxy to use for the request (for use as http.Transport.Proxy)
+func (c *HTTPClientConfig) Proxy(req *http.Request) (*url.URL, error) {
+	if !c.UseProxy(req.URL.Host) {
+		return nil, nil
+	}
+	return c.HTTPConfig.ProxyURL.URL, nil
+}
+
+// OAuth2Config configures OAuth2 (client credentials grant) authentication of
+// the requests to the hosts in a servergroup
+type OAuth2Config struct {
+	ClientID         string             `yaml:"client_id"`
+	ClientSecret     config_util.Secret `yaml:"client_secret"`
+	ClientSecretFile string             `yaml:"client_secret_file"`
+	Scopes           []string           `yaml:"scopes,omitempty"`
+	TokenURL         string             `yaml:"token_url"`
+	EndpointParams   map[string]string  `yaml:"endpoint_params,omitempty"`
+}
+
+// Validate validates the OAuth2Config
+func (c *OAuth2Config) Validate() error {
+	if c.ClientID == "" || c.TokenURL == "" {
+		return fmt.Errorf("oauth2 client_id and token_url must be configured")
+	}
+	if len(c.ClientSecret) > 0 && len(c.ClientSecretFile) > 0 {
+		return fmt.Errorf("at most one of oauth2 client_secret & client_secret_file must be configured")
+	}
+	return nil
 }
 
 // RelativeTimeRangeConfig configures durations relative from "now" to define
@@ -0,0 +1,70 @@
+package servergroup
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type requestHeaderKey struct{}
+
+// WithRequestHeader returns a context carrying the header of the incoming request,
+// which the tenant of the requests to the servergroups is based on
+func WithRequestHeader(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, requestHeaderKey{}, header)
+}
+
+// requestHeader returns the header of the incoming request (if any)
+func requestHeader(ctx context.Context) http.Header {
+	header, _ := ctx.Value(requestHeaderKey{}).(http.Header)
+	return header
+}
+
+// headerRoundTripper sets the static headers and the tenant on all requests
+type headerRoundTripper struct {
+	headers map[string]string
+	tenant  *TenantConfig
+	rt      http.RoundTripper
+}
+
+// tenantOf returns the tenant of the servergroup for the request, or "" if there is none.
+// Unmapped tenants are an error if RejectUnmapped is set.
+func (h *headerRoundTripper) tenantOf(req *http.Request) (string, error) {
+	tenant := requestHeader(req.Context()).Get(h.tenant.Header)
+	if tenant == "" {
+		return h.tenant.Default, nil
+	}
+	if mapped, ok := h.tenant.Map[tenant]; ok {
+		return mapped, nil
+	}
+	if h.tenant.RejectUnmapped {
+		return "", fmt.Errorf("tenant %q is not mapped to a tenant of the servergroup", tenant)
+	}
+	return tenant, nil
+}
+
+func (h *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request
+	req = req.Clone(req.Context())
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	if h.tenant != nil {
+		tenant, err := h.tenantOf(req)
+		if err != nil {
+			return nil, err
+		}
+		if tenant != "" {
+			req.Header.Set(h.tenant.Header, tenant)
+		}
+	}
+	return h.rt.RoundTrip(req)
+}
+
+// RequestHeaderHandler wraps the handler so that the header of the incoming requests is
+// available to the servergroups (see WithRequestHeader)
+func RequestHeaderHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(WithRequestHeader(r.Context(), r.Header)))
+	})
+}
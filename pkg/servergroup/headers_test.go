@@ -0,0 +1,158 @@
+package servergroup
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// roundTripFunc is an http.RoundTripper calling the func
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestHeaderRoundTripper(t *testing.T) {
+	tenant := &TenantConfig{
+		Header:  "X-Scope-OrgID",
+		Map:     map[string]string{"team-a": "cortex-team-a"},
+		Default: "promxy",
+	}
+	rejectUnmapped := &TenantConfig{
+		Header:         "X-Scope-OrgID",
+		Map:            map[string]string{"team-a": "cortex-team-a"},
+		RejectUnmapped: true,
+	}
+
+	tests := []struct {
+		headers map[string]string
+		tenant  *TenantConfig
+		// incoming is the header of the incoming request, nil if there is none
+		incoming http.Header
+		expected http.Header
+		err      bool
+	}{
+		// Static headers
+		{
+			headers:  map[string]string{"X-Static": "a"},
+			expected: http.Header{"X-Static": []string{"a"}},
+		},
+		{
+			headers:  map[string]string{"X-Scope-OrgID": "static"},
+			incoming: http.Header{"X-Scope-Orgid": []string{"team-a"}},
+			expected: http.Header{"X-Scope-Orgid": []string{"static"}},
+		},
+		// Mapped tenant
+		{
+			tenant:   tenant,
+			incoming: http.Header{"X-Scope-Orgid": []string{"team-a"}},
+			expected: http.Header{"X-Scope-Orgid": []string{"cortex-team-a"}},
+		},
+		// Unmapped tenants are passed as-is
+		{
+			tenant:   tenant,
+			incoming: http.Header{"X-Scope-Orgid": []string{"team-b"}},
+			expected: http.Header{"X-Scope-Orgid": []string{"team-b"}},
+		},
+		// Requests without a tenant use the default
+		{
+			tenant:   tenant,
+			expected: http.Header{"X-Scope-Orgid": []string{"promxy"}},
+		},
+		{
+			tenant:   tenant,
+			incoming: http.Header{"X-Other": []string{"a"}},
+			expected: http.Header{"X-Scope-Orgid": []string{"promxy"}},
+		},
+		// Without a default the header isn't set
+		{
+			tenant:   rejectUnmapped,
+			expected: http.Header{},
+		},
+		// Static headers and the tenant are combined
+		{
+			headers:  map[string]string{"X-Static": "a"},
+			tenant:   tenant,
+			incoming: http.Header{"X-Scope-Orgid": []string{"team-a"}},
+			expected: http.Header{"X-Static": []string{"a"}, "X-Scope-Orgid": []string{"cortex-team-a"}},
+		},
+		// Unmapped tenants are rejected with reject_unmapped
+		{
+			tenant:   rejectUnmapped,
+			incoming: http.Header{"X-Scope-Orgid": []string{"team-a"}},
+			expected: http.Header{"X-Scope-Orgid": []string{"cortex-team-a"}},
+		},
+		{
+			tenant:   rejectUnmapped,
+			incoming: http.Header{"X-Scope-Orgid": []string{"team-b"}},
+			err:      true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var sent *http.Request
+			rt := &headerRoundTripper{
+				headers: test.headers,
+				tenant:  test.tenant,
+				rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					sent = req
+					return &http.Response{StatusCode: http.StatusOK}, nil
+				}),
+			}
+
+			ctx := context.TODO()
+			if test.incoming != nil {
+				ctx = WithRequestHeader(ctx, test.incoming)
+			}
+			req := httptest.NewRequest("GET", "http://localhost:9090/api/v1/query", nil).WithContext(ctx)
+			req.Header = http.Header{}
+
+			_, err := rt.RoundTrip(req)
+			if test.err {
+				if err == nil {
+					t.Fatalf("missing expected error")
+				}
+				if sent != nil {
+					t.Fatalf("rejected request was sent")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(sent.Header, test.expected) {
+				t.Fatalf("mismatch in headers expected=%v actual=%v", test.expected, sent.Header)
+			}
+			// The request is cloned rather than modified
+			if sent == req {
+				t.Fatalf("request was not cloned")
+			}
+			if len(req.Header) != 0 {
+				t.Fatalf("original request was modified: %v", req.Header)
+			}
+		})
+	}
+}
+
+func TestRequestHeaderHandler(t *testing.T) {
+	var header http.Header
+	h := RequestHeaderHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = requestHeader(r.Context())
+	}))
+
+	r := httptest.NewRequest("GET", "/api/v1/query", nil)
+	r.Header.Set("X-Scope-OrgID", "team-a")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if tenant := header.Get("X-Scope-OrgID"); tenant != "team-a" {
+		t.Fatalf("expected the incoming tenant in the context, got %q", tenant)
+	}
+
+	// Without the handler there is no incoming header
+	if header := requestHeader(context.TODO()); header != nil {
+		t.Fatalf("unexpected header: %v", header)
+	}
+}
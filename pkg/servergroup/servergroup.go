@@ -2,10 +2,14 @@ package servergroup
 
 import (
 	"context"
+	"crypto/tls"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -22,8 +26,12 @@ import (
 	"github.com/prometheus/prometheus/pkg/relabel"
 	"github.com/prometheus/prometheus/storage/remote"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	yaml "gopkg.in/yaml.v2"
 
 	"github.com/jacksontj/promxy/pkg/promclient"
+	"github.com/jacksontj/promxy/pkg/promhttputil"
 	//	sd_config "github.com/prometheus/prometheus/discovery/config"
 )
 
@@ -33,10 +41,64 @@ var (
 		Name: "server_group_request_duration_seconds",
 		Help: "Summary of calls to servergroup instances",
 	}, []string{"host", "call", "status"})
+
+	serverGroupResponseSeries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "server_group_response_series_total",
+		Help: "Number of series returned by servergroup instances",
+	}, []string{"host", "call"})
+
+	serverGroupResponseSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "server_group_response_samples_total",
+		Help: "Number of samples returned by servergroup instances",
+	}, []string{"host", "call"})
+
+	serverGroupCircuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "server_group_circuit_breaker_state",
+		Help: "State of the circuit breaker for servergroup instances (0=closed, 1=open, 2=half-open)",
+	}, []string{"host"})
+
+	serverGroupTargetHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "server_group_target_healthy",
+		Help: "Result of the health check of servergroup instances (1=healthy, 0=unhealthy)",
+	}, []string{"host"})
+
+	serverGroupRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "server_group_rate_limited_total",
+		Help: "Number of requests to servergroup instances which waited on the rate limit (by reason: rate or inflight)",
+	}, []string{"host", "reason"})
+
+	serverGroupRequestsQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "server_group_requests_queued",
+		Help: "Number of requests to servergroup instances waiting on a concurrency limit",
+	}, []string{"limit"})
+
+	serverGroupRequestQueueSummary = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "server_group_request_queue_duration_seconds",
+		Help: "Summary of time requests to servergroup instances waited on a concurrency limit",
+	}, []string{"limit"})
 )
 
+// newThanosStoreAPI creates the StoreAPI client of a target (replaced in tests)
+var newThanosStoreAPI = promclient.NewThanosStoreAPI
+
 func init() {
 	prometheus.MustRegister(serverGroupSummary)
+	prometheus.MustRegister(serverGroupResponseSeries)
+	prometheus.MustRegister(serverGroupResponseSamples)
+	prometheus.MustRegister(serverGroupCircuitBreakerState)
+	prometheus.MustRegister(serverGroupTargetHealthy)
+	prometheus.MustRegister(serverGroupRateLimited)
+	prometheus.MustRegister(serverGroupRequestsQueued)
+	prometheus.MustRegister(serverGroupRequestQueueSummary)
+}
+
+// NewRequestSemaphore returns a semaphore limiting concurrent requests to
+// servergroup instances; limit is used to label the queue metrics
+func NewRequestSemaphore(max int, limit string) *promclient.Semaphore {
+	return promclient.NewSemaphore(max,
+		serverGroupRequestsQueued.WithLabelValues(limit).Add,
+		serverGroupRequestQueueSummary.WithLabelValues(limit).Observe,
+	)
 }
 
 // New creates a new servergroup
@@ -68,8 +130,14 @@ func New() *ServerGroup {
 // ServerGroupState encapsulates the state of a serverGroup from service discovery
 type ServerGroupState struct {
 	// Targets is the list of target URLs for this discovery round
-	Targets   []string
+	Targets []string
+	// Replicas is whether all of the targets have the same labels, that is whether
+	// they are replicas of each other (rather than each having some of the series)
+	Replicas  bool
 	apiClient promclient.API
+
+	// dedupUnregister unregisters the targets of this state from the DedupRegistry
+	dedupUnregister []func()
 }
 
 // ServerGroup encapsulates a set of prometheus downstreams to query/aggregate
@@ -87,12 +155,134 @@ type ServerGroup struct {
 
 	OriginalURLs []string
 
+	// Name identifies the servergroup in metrics, this must be set before ApplyConfig
+	Name string
+
+	// GlobalSemaphore (if set) limits concurrent requests to the targets of all
+	// servergroups sharing it, this must be set before ApplyConfig
+	GlobalSemaphore *promclient.Semaphore
+	// DedupRegistry (if set) is used to deduplicate requests to the same target
+	// across servergroups, this must be set before ApplyConfig
+	DedupRegistry *promclient.DedupRegistry
+
+	// MergeLimits cap the size of the results merged from the targets, this must be set
+	// before ApplyConfig
+	MergeLimits promhttputil.MergeLimits
+
+	// semaphores limit the concurrent requests to the targets of this servergroup
+	semaphores []*promclient.Semaphore
+	// antiAffinityTracker (if anti_affinity_auto) learns the anti-affinity, it is kept
+	// across service discovery updates
+	antiAffinityTracker *promclient.AntiAffinityTracker
+	// hedgeTracker (if hedge) tracks the latency the hedge delay is derived from, it is
+	// kept across service discovery updates
+	hedgeTracker *promclient.HedgeTracker
+
 	state atomic.Value
+
+	// breakers holds the circuit breaker for each target so their state is
+	// kept across service discovery updates; this is only accessed by Sync
+	breakers map[string]*promclient.CircuitBreaker
+	// healthChecks holds the health check for each target so they keep running
+	// across service discovery updates; this is only accessed by Sync
+	healthChecks map[string]*promclient.HealthCheck
+	// rateLimiters holds the rate limiter for each target so the limits are
+	// kept across service discovery updates; this is only accessed by Sync
+	rateLimiters map[string]*promclient.RateLimiter
+	// capabilityDetectors holds the capability detector for each target so they keep running
+	// across service discovery updates; this is only accessed by Sync
+	capabilityDetectors map[string]*promclient.CapabilityDetector
+	// thanosStores holds the StoreAPI client for each target so their connections
+	// are kept across service discovery updates; this is only accessed by Sync
+	thanosStores map[string]*promclient.ThanosStoreAPI
+
+	// recordFile (if set) is the file the requests to the targets are recorded to
+	recordFile *os.File
+	recorder   *promclient.Recorder
+
+	// oauth2TokenSource (if set) provides the (refreshed) oauth2 tokens for the requests to the targets
+	oauth2TokenSource oauth2.TokenSource
+}
+
+// newOAuth2TokenSource returns a token source using the client credentials grant,
+// the tokens are cached and refreshed as they expire
+func newOAuth2TokenSource(ctx context.Context, cfg *OAuth2Config, rt http.RoundTripper) (oauth2.TokenSource, error) {
+	clientSecret := string(cfg.ClientSecret)
+	if cfg.ClientSecretFile != "" {
+		b, err := ioutil.ReadFile(cfg.ClientSecretFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading oauth2 client_secret_file")
+		}
+		clientSecret = strings.TrimSpace(string(b))
+	}
+
+	endpointParams := make(url.Values, len(cfg.EndpointParams))
+	for k, v := range cfg.EndpointParams {
+		endpointParams.Set(k, v)
+	}
+	ccCfg := &clientcredentials.Config{
+		ClientID:       cfg.ClientID,
+		ClientSecret:   clientSecret,
+		Scopes:         cfg.Scopes,
+		TokenURL:       cfg.TokenURL,
+		EndpointParams: endpointParams,
+	}
+
+	// The token requests use the same transport (e.g. TLS config) as the requests to the targets
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: rt})
+	return ccCfg.TokenSource(ctx), nil
 }
 
 // Cancel stops backround processes (e.g. discovery manager)
 func (s *ServerGroup) Cancel() {
 	s.ctxCancel()
+	if state := s.State(); state != nil {
+		for _, unregister := range state.dedupUnregister {
+			unregister()
+		}
+	}
+	if s.recordFile != nil {
+		s.recordFile.Close()
+	}
+}
+
+// dedupConfig returns the parts of the config which change the responses
+// from a target, to be used as part of the key to deduplicate requests
+func (s *ServerGroup) dedupConfig() string {
+	b, _ := yaml.Marshal(struct {
+		RemoteRead              bool                     `yaml:"remote_read"`
+		RemoteReadPath          string                   `yaml:"remote_read_path"`
+		ThanosStoreAPI          bool                     `yaml:"thanos_store_api"`
+		VictoriaMetrics         bool                     `yaml:"victoria_metrics"`
+		QueryParams             map[string]string        `yaml:"query_params"`
+		MetricRelabelConfigs    []*relabel.Config        `yaml:"metric_relabel_configs"`
+		ReplicaLabels           []string                 `yaml:"replica_labels"`
+		MatcherRewrites         map[string]string        `yaml:"matcher_rewrites"`
+		Headers                 map[string]string        `yaml:"headers"`
+		Tenant                  *TenantConfig            `yaml:"tenant"`
+		LabelFilter             *LabelFilterConfig       `yaml:"label_filter"`
+		Sharding                *ShardingConfig          `yaml:"sharding"`
+		Limits                  *LimitsConfig            `yaml:"limits"`
+		RelativeTimeRangeConfig *RelativeTimeRangeConfig `yaml:"relative_time_range"`
+		AbsoluteTimeRangeConfig *AbsoluteTimeRangeConfig `yaml:"absolute_time_range"`
+	}{
+		s.Cfg.RemoteRead,
+		s.Cfg.RemoteReadPath,
+		s.Cfg.ThanosStoreAPI,
+		s.Cfg.VictoriaMetrics,
+		s.Cfg.QueryParams,
+		s.Cfg.MetricRelabelConfigs,
+		s.Cfg.ReplicaLabels,
+		s.Cfg.MatcherRewrites,
+		s.Cfg.HTTPConfig.Headers,
+		s.Cfg.Tenant,
+		s.Cfg.LabelFilter,
+		s.Cfg.Sharding,
+		s.Cfg.Limits,
+		s.Cfg.RelativeTimeRangeConfig,
+		s.Cfg.AbsoluteTimeRangeConfig,
+	})
+	return string(b)
 }
 
 // Sync updates the targets from our discovery manager
@@ -103,7 +293,43 @@ SYNC_LOOP:
 	for targetGroupMap := range syncCh {
 		logrus.Debug("Updating targets from discovery manager")
 		targets := make([]string, 0)
+		var zones []string
+		var weights []float64
+		var shards []int
 		apiClients := make([]promclient.API, 0)
+		breakers := make(map[string]*promclient.CircuitBreaker)
+		rateLimiters := make(map[string]*promclient.RateLimiter)
+		healthChecks := make(map[string]*promclient.HealthCheck)
+		thanosStores := make(map[string]*promclient.ThanosStoreAPI)
+		capabilityDetectors := make(map[string]*promclient.CapabilityDetector)
+		var dedupUnregister []func()
+		dedupConfig := s.dedupConfig()
+		var targetLabels model.LabelSet
+		replicas := true
+
+		// discard stops what was started for the targets of this round (and isn't kept
+		// from the previous one), for rounds which aren't applied
+		discard := func() {
+			for host, check := range healthChecks {
+				if _, ok := s.healthChecks[host]; !ok {
+					check.Stop()
+					serverGroupTargetHealthy.DeleteLabelValues(host)
+				}
+			}
+			for host, detector := range capabilityDetectors {
+				if _, ok := s.capabilityDetectors[host]; !ok {
+					detector.Stop()
+				}
+			}
+			for host, store := range thanosStores {
+				if _, ok := s.thanosStores[host]; !ok {
+					store.Close()
+				}
+			}
+			for _, unregister := range dedupUnregister {
+				unregister()
+			}
+		}
 
 		for _, targetGroupList := range targetGroupMap {
 			for _, targetGroup := range targetGroupList {
@@ -111,12 +337,16 @@ SYNC_LOOP:
 
 					lbls := make([]labels.Label, 0, len(target)+len(targetGroup.Labels)+2)
 
+					// The scheme and path prefix of the servergroup take precedence over any
+					// discovered ones (they can still be changed with relabel_configs)
 					for ln, lv := range target {
-						lbls = append(lbls, labels.Label{Name: string(ln), Value: string(lv)})
+						if ln != model.SchemeLabel && ln != PathPrefixLabel {
+							lbls = append(lbls, labels.Label{Name: string(ln), Value: string(lv)})
+						}
 					}
 
 					for ln, lv := range targetGroup.Labels {
-						if _, ok := target[ln]; !ok {
+						if _, ok := target[ln]; !ok && ln != model.SchemeLabel && ln != PathPrefixLabel {
 							lbls = append(lbls, labels.Label{Name: string(ln), Value: string(lv)})
 						}
 					}
@@ -137,6 +367,7 @@ SYNC_LOOP:
 					// If there is no address, then we can't use this set of targets
 					if v := lset.Get(model.AddressLabel); v == "" {
 						logrus.Errorf("Discovery target is missing address label: %v", lset)
+						discard()
 						continue SYNC_LOOP
 					}
 
@@ -146,35 +377,135 @@ SYNC_LOOP:
 						Path:   lset.Get(PathPrefixLabel),
 					}
 
-					targets = append(targets, u.Host)
+					var shard uint64
+					if sharding := s.Cfg.Sharding; sharding != nil {
+						var err error
+						if shard, err = strconv.ParseUint(lset.Get(sharding.ShardLabel), 10, 64); err != nil || shard >= sharding.Modulus {
+							logrus.Errorf("Invalid shard %q for target %s, skipping it", lset.Get(sharding.ShardLabel), u.Host)
+							continue
+						}
+					}
+
+					weight := 1.0
+					if lb := s.Cfg.LoadBalance; lb != nil && lb.WeightLabel != "" {
+						if v := lset.Get(lb.WeightLabel); v != "" {
+							var err error
+							if weight, err = strconv.ParseFloat(v, 64); err != nil || weight < 0 {
+								logrus.Errorf("Invalid load_balance weight %q for target %s, using 1", v, u.Host)
+								weight = 1
+							}
+						}
+					}
 
 					client, err := api.NewClient(api.Config{Address: u.String(), RoundTripper: s.client.Transport})
 					if err != nil {
 						panic(err) // TODO: shouldn't be possible? If this happens I guess we log and skip?
 					}
+					client = promclient.NewStatsClient(client)
+					if s.Cfg.Downsampling != nil {
+						client = promclient.NewContextArgsClient(client)
+					}
 
-					if len(s.Cfg.QueryParams) > 0 {
-						client = promclient.NewClientArgsWrap(client, s.Cfg.QueryParams)
+					if args := s.Cfg.queryArgs(); len(args) > 0 {
+						client = promclient.NewClientArgsWrap(client, args)
 					}
 
 					var apiClient promclient.API
-					apiClient = &promclient.PromAPIV1{v1.NewAPI(client)}
+					if s.Cfg.VictoriaMetrics {
+						apiClient = promclient.NewVictoriaMetricsAPI(client)
+					} else {
+						apiClient = promclient.NewPromAPIV1(client)
+					}
+
+					if s.Cfg.ThanosStoreAPI {
+						store, ok := s.thanosStores[u.Host]
+						if !ok {
+							var tlsConfig *tls.Config
+							if u.Scheme == "https" {
+								if tlsConfig, err = config_util.NewTLSConfig(&s.Cfg.HTTPConfig.HTTPConfig.TLSConfig); err != nil {
+									logrus.Errorf("Error loading TLS config for Thanos StoreAPI %s: %v", u.Host, err)
+									continue
+								}
+							}
+							if store, err = newThanosStoreAPI(s.ctx, u.Host, tlsConfig); err != nil {
+								logrus.Errorf("Error connecting to Thanos StoreAPI %s: %v", u.Host, err)
+								continue
+							}
+						}
+						thanosStores[u.Host] = store
+						apiClient = store
+					}
+
+					// The StoreAPI has no build info, so the capabilities of the hosts can't be detected
+					if cfg := s.Cfg.CapabilityDetection; cfg != nil && !s.Cfg.ThanosStoreAPI {
+						detector, ok := s.capabilityDetectors[u.Host]
+						if !ok {
+							detector = promclient.NewCapabilityDetector(apiClient, cfg.Interval)
+							detector.Start(s.ctx)
+						}
+						capabilityDetectors[u.Host] = detector
+						apiClient = &promclient.CapabilityAPI{API: apiClient, Detector: detector}
+					}
 
 					if s.Cfg.RemoteRead {
+						httpConfig := s.Cfg.HTTPConfig.HTTPConfig
+						if !s.Cfg.HTTPConfig.UseProxy(u.Host) {
+							httpConfig.ProxyURL = config_util.URL{}
+						}
 						u.Path = path.Join(u.Path, s.Cfg.RemoteReadPath)
+						if len(s.Cfg.QueryParams) > 0 {
+							q := u.Query()
+							for k, v := range s.Cfg.QueryParams {
+								q.Set(k, v)
+							}
+							u.RawQuery = q.Encode()
+						}
 						cfg := &remote.ClientConfig{
 							URL:              &config_util.URL{u},
-							HTTPClientConfig: s.Cfg.HTTPConfig.HTTPConfig,
+							HTTPClientConfig: httpConfig,
 							Timeout:          model.Duration(time.Minute * 2),
 						}
 						remoteStorageClient, err := remote.NewReadClient("foo", cfg)
 						if err != nil {
 							panic(err)
 						}
+						// The remote read client creates its own http client, so we add the headers and oauth2 token to it
+						if c, ok := remoteStorageClient.(*remote.Client); ok {
+							if len(s.Cfg.HTTPConfig.Headers) > 0 || s.Cfg.Tenant != nil {
+								c.Client.Transport = &headerRoundTripper{headers: s.Cfg.HTTPConfig.Headers, tenant: s.Cfg.Tenant, rt: c.Client.Transport}
+							}
+							if s.oauth2TokenSource != nil {
+								c.Client.Transport = &oauth2.Transport{Source: s.oauth2TokenSource, Base: c.Client.Transport}
+							}
+						}
 
 						apiClient = &promclient.PromAPIRemoteRead{apiClient, remoteStorageClient}
 					}
 
+					if s.recorder != nil {
+						apiClient = &promclient.RecordAPI{API: apiClient, Recorder: s.recorder, Server: u.Host}
+					}
+
+					if filter := s.Cfg.LabelFilter; filter != nil {
+						apiClient = &promclient.LabelFilterClient{
+							API:           apiClient,
+							StaticInclude: filter.StaticLabelsInclude,
+							StaticExclude: filter.StaticLabelsExclude,
+							DynamicLabels: filter.DynamicLabels,
+							SyncInterval:  filter.SyncInterval,
+						}
+					}
+
+					if sharding := s.Cfg.Sharding; sharding != nil && len(sharding.SourceLabels) > 0 {
+						apiClient = &promclient.ShardFilterClient{
+							API:          apiClient,
+							Shard:        shard,
+							Modulus:      sharding.Modulus,
+							SourceLabels: sharding.SourceLabels,
+							Separator:    sharding.Separator,
+						}
+					}
+
 					// Optionally add time range layers
 					if s.Cfg.AbsoluteTimeRangeConfig != nil {
 						apiClient = &promclient.AbsoluteTimeFilter{
@@ -194,6 +525,106 @@ SYNC_LOOP:
 						}
 					}
 
+					if s.Cfg.Limits != nil {
+						apiClient = &promclient.LimitAPI{
+							API:        apiClient,
+							MaxSeries:  s.Cfg.Limits.MaxSeries,
+							MaxSamples: s.Cfg.Limits.MaxSamples,
+							Truncate:   s.Cfg.Limits.Truncate,
+						}
+					}
+
+					if s.Cfg.RateLimit != nil {
+						limiter, ok := s.rateLimiters[u.Host]
+						if !ok {
+							host := u.Host
+							limiter = promclient.NewRateLimiter(
+								s.Cfg.RateLimit.RequestsPerSecond,
+								s.Cfg.RateLimit.Burst,
+								s.Cfg.RateLimit.MaxInflight,
+								func(reason string) {
+									serverGroupRateLimited.WithLabelValues(host, reason).Inc()
+								},
+							)
+						}
+						rateLimiters[u.Host] = limiter
+						apiClient = &promclient.RateLimitAPI{API: apiClient, Limiter: limiter}
+					}
+
+					if s.Cfg.Retry != nil {
+						apiClient = &promclient.RetryAPI{
+							API:        apiClient,
+							Retries:    s.Cfg.Retry.Retries,
+							Backoff:    s.Cfg.Retry.Backoff,
+							MaxBackoff: s.Cfg.Retry.MaxBackoff,
+						}
+					}
+
+					if timeouts := s.Cfg.CallTimeouts; timeouts != nil {
+						apiClient = &promclient.TimeoutAPI{
+							API:                apiClient,
+							QueryTimeout:       timeouts.Query,
+							QueryRangeTimeout:  timeouts.QueryRange,
+							SeriesTimeout:      timeouts.Series,
+							LabelNamesTimeout:  timeouts.LabelNames,
+							LabelValuesTimeout: timeouts.LabelValues,
+							GetValueTimeout:    timeouts.GetValue,
+						}
+					}
+
+					if s.Cfg.CircuitBreaker != nil {
+						breaker, ok := s.breakers[u.Host]
+						if !ok {
+							host := u.Host
+							breaker = promclient.NewCircuitBreaker(
+								s.Cfg.CircuitBreaker.ErrorThreshold,
+								s.Cfg.CircuitBreaker.LatencyThreshold,
+								s.Cfg.CircuitBreaker.Cooldown,
+								func(state promclient.CircuitBreakerState) {
+									serverGroupCircuitBreakerState.WithLabelValues(host).Set(float64(state))
+								},
+							)
+							serverGroupCircuitBreakerState.WithLabelValues(host).Set(float64(promclient.CircuitClosed))
+						}
+						breakers[u.Host] = breaker
+						apiClient = &promclient.CircuitBreakerAPI{API: apiClient, Breaker: breaker}
+					}
+
+					if cfg := s.Cfg.HealthCheck; cfg != nil {
+						check, ok := s.healthChecks[u.Host]
+						if !ok {
+							host := u.Host
+							checkURL := url.URL{
+								Scheme: lset.Get(model.SchemeLabel),
+								Host:   host,
+								Path:   path.Join(lset.Get(PathPrefixLabel), cfg.Path),
+							}
+							check = promclient.NewHealthCheck(checkURL.String(), s.client, cfg.Interval, cfg.Timeout, cfg.UnhealthyThreshold, func(healthy bool) {
+								if healthy {
+									serverGroupTargetHealthy.WithLabelValues(host).Set(1)
+								} else {
+									serverGroupTargetHealthy.WithLabelValues(host).Set(0)
+								}
+							})
+							serverGroupTargetHealthy.WithLabelValues(host).Set(1)
+							check.Start(s.ctx)
+						}
+						healthChecks[u.Host] = check
+						apiClient = &promclient.HealthCheckAPI{API: apiClient, Check: check}
+					}
+
+					if len(s.Cfg.ReplicaLabels) > 0 {
+						apiClient = &promclient.ReplicaLabelAPI{API: apiClient, ReplicaLabels: s.Cfg.ReplicaLabels, SyncInterval: 5 * time.Minute}
+					}
+
+					if len(s.Cfg.MetricRelabelConfigs) > 0 {
+						apiClient = &promclient.RelabelAPI{API: apiClient, RelabelConfigs: s.Cfg.MetricRelabelConfigs}
+					}
+
+					if len(s.Cfg.MatcherRewrites) > 0 {
+						apiClient = &promclient.MatcherRewriteAPI{API: apiClient, Rewrites: s.Cfg.MatcherRewrites}
+					}
+
 					// We remove all private labels after we set the target entry
 					modelLabelSet := make(model.LabelSet, len(lset))
 					for _, lbl := range lset {
@@ -203,7 +634,15 @@ SYNC_LOOP:
 					}
 
 					// Add labels
-					apiClient = &promclient.AddLabelClient{apiClient, modelLabelSet.Merge(s.Cfg.Labels)}
+					apiLabels := modelLabelSet.Merge(s.Cfg.Labels)
+					apiClient = &promclient.AddLabelClient{apiClient, apiLabels}
+
+					// Deduplicate requests to the same target (with the same labels) across servergroups
+					if s.DedupRegistry != nil {
+						dedupKey := u.String() + "|" + apiLabels.String() + "|" + dedupConfig
+						dedupUnregister = append(dedupUnregister, s.DedupRegistry.Register(dedupKey))
+						apiClient = &promclient.DedupAPI{API: apiClient, DedupKey: dedupKey, Registry: s.DedupRegistry}
+					}
 
 					// If debug logging is enabled, wrap the client with a debugAPI client
 					// Since these are called in the reverse order of what we add, we want
@@ -212,26 +651,165 @@ SYNC_LOOP:
 						apiClient = &promclient.DebugAPI{apiClient, u.String()}
 					}
 
+					// The target's entries of the slices parallel to apiClients are only added
+					// once its client is, so a skipped target doesn't misalign them
 					apiClients = append(apiClients, apiClient)
+					targets = append(targets, u.Host)
+					if targetLabels == nil {
+						targetLabels = apiLabels
+					} else if !targetLabels.Equal(apiLabels) {
+						replicas = false
+					}
+					if s.Cfg.Sharding != nil {
+						shards = append(shards, int(shard))
+					}
+					if s.Cfg.Zones != nil {
+						zones = append(zones, lset.Get(s.Cfg.Zones.Label))
+					}
+					if lb := s.Cfg.LoadBalance; lb != nil && lb.WeightLabel != "" {
+						weights = append(weights, weight)
+					}
 				}
 			}
 		}
 
-		apiClientMetricFunc := func(i int, api, status string, took float64) {
-			serverGroupSummary.WithLabelValues(targets[i], api, status).Observe(took)
+		for host := range s.breakers {
+			if _, ok := breakers[host]; !ok {
+				serverGroupCircuitBreakerState.DeleteLabelValues(host)
+			}
+		}
+		s.breakers = breakers
+
+		for host, check := range s.healthChecks {
+			if _, ok := healthChecks[host]; !ok {
+				check.Stop()
+				serverGroupTargetHealthy.DeleteLabelValues(host)
+			}
+		}
+		s.healthChecks = healthChecks
+
+		for host := range s.rateLimiters {
+			if _, ok := rateLimiters[host]; !ok {
+				serverGroupRateLimited.DeleteLabelValues(host, promclient.ThrottleRate)
+				serverGroupRateLimited.DeleteLabelValues(host, promclient.ThrottleInflight)
+			}
+		}
+		s.rateLimiters = rateLimiters
+
+		for host, detector := range s.capabilityDetectors {
+			if _, ok := capabilityDetectors[host]; !ok {
+				detector.Stop()
+			}
+		}
+		s.capabilityDetectors = capabilityDetectors
+
+		for host, store := range s.thanosStores {
+			if _, ok := thanosStores[host]; !ok {
+				store.Close()
+			}
+		}
+		s.thanosStores = thanosStores
+
+		apiClientMetricFunc := func(i int, api, status string, took float64, info promclient.MultiAPICallInfo) {
+			serverGroupSummary.WithLabelValues(info.Name, api, status).Observe(took)
+			if info.Series > 0 {
+				serverGroupResponseSeries.WithLabelValues(info.Name, api).Add(float64(info.Series))
+			}
+			if info.Samples > 0 {
+				serverGroupResponseSamples.WithLabelValues(info.Name, api).Add(float64(info.Samples))
+			}
+		}
+
+		multiAPIOpts := []promclient.MultiAPIOption{
+			promclient.WithAPINames(targets),
+			promclient.WithSemaphores(s.semaphores...),
+		}
+		if s.Cfg.DownstreamTimeout > 0 {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithAPITimeout(s.Cfg.DownstreamTimeout))
+		}
+		if policy := s.Cfg.FailurePolicy; policy != nil {
+			if policy.MaxFailures != nil {
+				multiAPIOpts = append(multiAPIOpts, promclient.WithMaxFailures(*policy.MaxFailures))
+			}
+			if policy.MaxFailureRatio > 0 {
+				multiAPIOpts = append(multiAPIOpts, promclient.WithMaxFailureRatio(policy.MaxFailureRatio))
+			}
+			var required []int
+			for i, target := range targets {
+				for _, requiredTarget := range policy.RequiredTargets {
+					if target == requiredTarget {
+						required = append(required, i)
+					}
+				}
+			}
+			multiAPIOpts = append(multiAPIOpts, promclient.WithRequiredAPIs(required...))
+		}
+		if s.Cfg.Zones != nil {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithZones(zones, s.Cfg.Zones.MaxFailures))
+		}
+		if s.Cfg.MergeStrategy != promhttputil.MergeStrategyDefault {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithMergeStrategy(s.Cfg.MergeStrategy))
+		}
+		if s.antiAffinityTracker != nil {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithAntiAffinityTracker(s.antiAffinityTracker))
+		}
+		if s.Cfg.AntiAffinityLabel != "" {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithAntiAffinityLabel(s.Cfg.AntiAffinityLabel))
+		}
+		if s.Cfg.DedupTolerance != nil {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithDedupTolerance(s.Cfg.DedupTolerance.tolerance()))
+		}
+		if s.MergeLimits != (promhttputil.MergeLimits{}) {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithMergeLimits(s.MergeLimits))
+		}
+		if s.Cfg.GapFill {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithGapFill())
+		}
+		if s.Cfg.FirstSuccess {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithFirstSuccess())
+		}
+		if s.hedgeTracker != nil {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithHedging(s.hedgeTracker))
+		}
+		if sharding := s.Cfg.Sharding; sharding != nil {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithShards(shards, int(sharding.Modulus)))
+		}
+		if lb := s.Cfg.LoadBalance; lb != nil {
+			multiAPIOpts = append(multiAPIOpts, promclient.WithLoadBalancing(lb.SubsetSize, weights))
 		}
 
 		logrus.Debugf("Updating targets from discovery manager: %v", targets)
 		newState := &ServerGroupState{
-			Targets:   targets,
-			apiClient: promclient.NewMultiAPI(apiClients, s.Cfg.GetAntiAffinity(), apiClientMetricFunc, 1),
+			Targets:         targets,
+			Replicas:        replicas,
+			apiClient:       promclient.NewMultiAPI(apiClients, s.Cfg.GetAntiAffinity(), apiClientMetricFunc, s.Cfg.Quorum, multiAPIOpts...),
+			dedupUnregister: dedupUnregister,
+		}
+
+		if sharding := s.Cfg.QuerySharding; sharding != nil {
+			newState.apiClient = &promclient.QueryShardingAPI{API: newState.apiClient, Shards: sharding.Shards, Label: sharding.Label}
+		}
+		if split := s.Cfg.QuerySplit; split != nil {
+			newState.apiClient = &promclient.SplitRangeAPI{API: newState.apiClient, Interval: split.Interval, MaxConcurrency: split.MaxConcurrency}
+		}
+		if ds := s.Cfg.Downsampling; ds != nil {
+			newState.apiClient = &promclient.ResolutionAPI{API: newState.apiClient, Resolutions: ds.Resolutions, StepFactor: ds.StepFactor, Param: ds.Param}
+		}
+		if align := s.Cfg.AlignQueriesWithStep; align != nil && *align {
+			newState.apiClient = &promclient.StepAlignAPI{API: newState.apiClient}
 		}
 
 		if s.Cfg.IgnoreError {
 			newState.apiClient = &promclient.IgnoreErrorAPI{newState.apiClient}
 		}
 
+		oldState := s.State()
 		s.state.Store(newState)
+		if oldState != nil {
+			for _, unregister := range oldState.dedupUnregister {
+				unregister()
+			}
+		}
 
 		if !s.loaded {
 			s.loaded = true
@@ -245,6 +823,25 @@ SYNC_LOOP:
 func (s *ServerGroup) ApplyConfig(cfg *Config) error {
 	s.Cfg = cfg
 
+	// The servergroup limit is acquired first so we don't hold the global
+	// limit while waiting on our own
+	s.semaphores = nil
+	if cfg.MaxConcurrentRequests > 0 {
+		s.semaphores = append(s.semaphores, NewRequestSemaphore(cfg.MaxConcurrentRequests, "server_group:"+s.Name))
+	}
+	if s.GlobalSemaphore != nil {
+		s.semaphores = append(s.semaphores, s.GlobalSemaphore)
+	}
+
+	s.antiAffinityTracker = nil
+	if cfg.AntiAffinityAuto {
+		s.antiAffinityTracker = promclient.NewAntiAffinityTracker(cfg.GetAntiAffinity())
+	}
+	s.hedgeTracker = nil
+	if cfg.Hedge != nil {
+		s.hedgeTracker = promclient.NewHedgeTracker(cfg.Hedge.Delay, cfg.Hedge.Quantile)
+	}
+
 	// Copy/paste from upstream prometheus/common until https://github.com/prometheus/common/issues/144 is resolved
 	tlsConfig, err := config_util.NewTLSConfig(&cfg.HTTPConfig.HTTPConfig.TLSConfig)
 	if err != nil {
@@ -253,14 +850,14 @@ func (s *ServerGroup) ApplyConfig(cfg *Config) error {
 	// The only timeout we care about is the configured scrape timeout.
 	// It is applied on request. So we leave out any timings here.
 	var rt http.RoundTripper = &http.Transport{
-		Proxy:               http.ProxyURL(cfg.HTTPConfig.HTTPConfig.ProxyURL.URL),
-		MaxIdleConns:        20000,
-		MaxIdleConnsPerHost: 1000, // see https://github.com/golang/go/issues/13801
-		DisableKeepAlives:   false,
-		TLSClientConfig:     tlsConfig,
-		// 5 minutes is typically above the maximum sane scrape interval. So we can
-		// use keepalive for all configurations.
-		IdleConnTimeout:       5 * time.Minute,
+		Proxy:                 cfg.HTTPConfig.Proxy,
+		MaxIdleConns:          cfg.HTTPConfig.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.HTTPConfig.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.HTTPConfig.MaxConnsPerHost,
+		DisableKeepAlives:     false,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   cfg.HTTPConfig.TLSHandshakeTimeout,
+		IdleConnTimeout:       cfg.HTTPConfig.IdleConnTimeout,
 		DialContext:           (&net.Dialer{Timeout: cfg.HTTPConfig.DialTimeout}).DialContext,
 		ResponseHeaderTimeout: cfg.Timeout,
 	}
@@ -277,8 +874,30 @@ func (s *ServerGroup) ApplyConfig(cfg *Config) error {
 		rt = config_util.NewBasicAuthRoundTripper(cfg.HTTPConfig.HTTPConfig.BasicAuth.Username, cfg.HTTPConfig.HTTPConfig.BasicAuth.Password, cfg.HTTPConfig.HTTPConfig.BasicAuth.PasswordFile, rt)
 	}
 
+	if len(cfg.HTTPConfig.Headers) > 0 || cfg.Tenant != nil {
+		rt = &headerRoundTripper{headers: cfg.HTTPConfig.Headers, tenant: cfg.Tenant, rt: rt}
+	}
+
+	s.oauth2TokenSource = nil
+	if cfg.HTTPConfig.OAuth2 != nil {
+		s.oauth2TokenSource, err = newOAuth2TokenSource(s.ctx, cfg.HTTPConfig.OAuth2, rt)
+		if err != nil {
+			return err
+		}
+		rt = &oauth2.Transport{Source: s.oauth2TokenSource, Base: rt}
+	}
+
 	s.client = &http.Client{Transport: rt}
 
+	if cfg.Record != nil {
+		f, err := os.OpenFile(cfg.Record.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return errors.Wrap(err, "error opening record file")
+		}
+		s.recordFile = f
+		s.recorder = promclient.NewRecorder(f, cfg.Record.RedactLabels)
+	}
+
 	if err := s.targetManager.ApplyConfig(map[string]discovery.Configs{"foo": cfg.ServiceDiscoveryConfigs}); err != nil {
 		return err
 	}
@@ -294,6 +913,20 @@ func (s *ServerGroup) State() *ServerGroupState {
 	return nil
 }
 
+// MatchersMatch returns whether the servergroup may have series matching the matchers,
+// which is the case unless a matcher on one of its Labels doesn't match the label's value
+func (s *ServerGroup) MatchersMatch(matchers []*labels.Matcher) bool {
+	if s.Cfg == nil {
+		return true
+	}
+	for _, m := range matchers {
+		if v, ok := s.Cfg.Labels[model.LabelName(m.Name)]; ok && !m.Matches(string(v)) {
+			return false
+		}
+	}
+	return true
+}
+
 // GetValue loads the raw data for a given set of matchers in the time range
 func (s *ServerGroup) GetValue(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) (model.Value, v1.Warnings, error) {
 	return s.State().apiClient.GetValue(ctx, start, end, matchers)
@@ -310,8 +943,8 @@ func (s *ServerGroup) QueryRange(ctx context.Context, query string, r v1.Range)
 }
 
 // LabelValues performs a query for the values of the given label.
-func (s *ServerGroup) LabelValues(ctx context.Context, label string) (model.LabelValues, v1.Warnings, error) {
-	return s.State().apiClient.LabelValues(ctx, label)
+func (s *ServerGroup) LabelValues(ctx context.Context, label string, matchers []string, startTime, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	return s.State().apiClient.LabelValues(ctx, label, matchers, startTime, endTime)
 }
 
 // LabelNames returns all the unique label names present in the block in sorted order.
@@ -323,3 +956,68 @@ func (s *ServerGroup) LabelNames(ctx context.Context) ([]string, v1.Warnings, er
 func (s *ServerGroup) Series(ctx context.Context, matches []string, startTime, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
 	return s.State().apiClient.Series(ctx, matches, startTime, endTime)
 }
+
+// Metadata returns metadata about metrics currently scraped by the metric name.
+func (s *ServerGroup) Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, v1.Warnings, error) {
+	return s.State().apiClient.Metadata(ctx, metric, limit)
+}
+
+// Targets returns an overview of the current state of the Prometheus target discovery.
+func (s *ServerGroup) Targets(ctx context.Context) (v1.TargetsResult, v1.Warnings, error) {
+	return s.State().apiClient.Targets(ctx)
+}
+
+// Rules returns a list of alerting and recording rules that are currently loaded.
+func (s *ServerGroup) Rules(ctx context.Context) (v1.RulesResult, v1.Warnings, error) {
+	return s.State().apiClient.Rules(ctx)
+}
+
+// Alerts returns a list of all active alerts.
+func (s *ServerGroup) Alerts(ctx context.Context) (v1.AlertsResult, v1.Warnings, error) {
+	return s.State().apiClient.Alerts(ctx)
+}
+
+// AlertManagers returns an overview of the current state of the Prometheus alert manager discovery.
+func (s *ServerGroup) AlertManagers(ctx context.Context) (v1.AlertManagersResult, v1.Warnings, error) {
+	return s.State().apiClient.AlertManagers(ctx)
+}
+
+// QueryExemplars performs a query for exemplars by the given query and time range.
+func (s *ServerGroup) QueryExemplars(ctx context.Context, query string, startTime, endTime time.Time) ([]promclient.ExemplarQueryResult, v1.Warnings, error) {
+	return s.State().apiClient.QueryExemplars(ctx, query, startTime, endTime)
+}
+
+// TSDB returns the cardinality statistics of the TSDB.
+func (s *ServerGroup) TSDB(ctx context.Context) (promclient.TSDBResult, v1.Warnings, error) {
+	return s.State().apiClient.TSDB(ctx)
+}
+
+// Buildinfo returns the build information of each server.
+func (s *ServerGroup) Buildinfo(ctx context.Context) ([]promclient.BuildinfoResult, v1.Warnings, error) {
+	return s.State().apiClient.Buildinfo(ctx)
+}
+
+// Runtimeinfo returns the runtime information of each server.
+func (s *ServerGroup) Runtimeinfo(ctx context.Context) ([]promclient.RuntimeinfoResult, v1.Warnings, error) {
+	return s.State().apiClient.Runtimeinfo(ctx)
+}
+
+// Config returns the configuration of each server.
+func (s *ServerGroup) Config(ctx context.Context) ([]promclient.ConfigResult, v1.Warnings, error) {
+	return s.State().apiClient.Config(ctx)
+}
+
+// DeleteSeries deletes data for a selection of series in a time range.
+func (s *ServerGroup) DeleteSeries(ctx context.Context, matches []string, startTime, endTime time.Time) ([]promclient.AdminResult, v1.Warnings, error) {
+	return s.State().apiClient.DeleteSeries(ctx, matches, startTime, endTime)
+}
+
+// CleanTombstones removes the deleted data from disk and cleans up the existing tombstones.
+func (s *ServerGroup) CleanTombstones(ctx context.Context) ([]promclient.AdminResult, v1.Warnings, error) {
+	return s.State().apiClient.CleanTombstones(ctx)
+}
+
+// Snapshot creates a snapshot of all current data on each server.
+func (s *ServerGroup) Snapshot(ctx context.Context, skipHead bool) ([]promclient.AdminResult, v1.Warnings, error) {
+	return s.State().apiClient.Snapshot(ctx, skipHead)
+}
@@ -0,0 +1,268 @@
+package servergroup
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/jacksontj/promxy/pkg/promclient"
+)
+
+// requestCount returns the number of requests to the host recorded for the call
+func requestCount(t *testing.T, host, call string) uint64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Error gathering metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "server_group_request_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["host"] == host && labels["call"] == call {
+				return m.GetSummary().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
+
+func TestSyncThanosStoreAPIUnreachable(t *testing.T) {
+	newStore := newThanosStoreAPI
+	defer func() { newThanosStoreAPI = newStore }()
+	newThanosStoreAPI = func(ctx context.Context, address string, tlsConfig *tls.Config) (*promclient.ThanosStoreAPI, error) {
+		if address == "unreachable-store:10901" {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return newStore(ctx, address, tlsConfig)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(`
+thanos_store_api: true
+static_configs:
+  - targets: ['healthy-store-a:10901']
+    labels:
+      zone: a
+  - targets: ['unreachable-store:10901']
+    labels:
+      zone: b
+  - targets: ['healthy-store-b:10901']
+    labels:
+      zone: b
+zones:
+  label: zone
+`), &cfg); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	sg := New()
+	defer sg.Cancel()
+	if err := sg.ApplyConfig(&cfg); err != nil {
+		t.Fatalf("Error applying config: %v", err)
+	}
+	select {
+	case <-sg.Ready:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("servergroup not ready")
+	}
+
+	// The order of the targets of the static configs isn't stable
+	targets := append([]string(nil), sg.State().Targets...)
+	sort.Strings(targets)
+	if !reflect.DeepEqual(targets, []string{"healthy-store-a:10901", "healthy-store-b:10901"}) {
+		t.Fatalf("unexpected targets: %v", targets)
+	}
+
+	// The requests to each client are recorded under the name of its own target
+	if _, _, err := sg.Targets(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for host, expected := range map[string]uint64{
+		"healthy-store-a:10901":   1,
+		"unreachable-store:10901": 0,
+		"healthy-store-b:10901":   1,
+	} {
+		if count := requestCount(t, host, "targets"); count != expected {
+			t.Errorf("expected %d requests recorded for %s, got %d", expected, host, count)
+		}
+	}
+}
+
+// logHook closes ch once an entry containing msg is logged
+type logHook struct {
+	msg  string
+	ch   chan struct{}
+	once sync.Once
+}
+
+func (h *logHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *logHook) Fire(e *logrus.Entry) error {
+	if strings.Contains(e.Message, h.msg) {
+		h.once.Do(func() { close(h.ch) })
+	}
+	return nil
+}
+
+// applyDiscarded applies the config (whose targets must include a target without an
+// address) and waits until its service discovery update is discarded
+func applyDiscarded(t *testing.T, sg *ServerGroup, raw string) {
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(raw), &cfg); err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	hook := &logHook{msg: "missing address label", ch: make(chan struct{})}
+	hooks := logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+	defer logrus.StandardLogger().ReplaceHooks(hooks)
+	logrus.AddHook(hook)
+
+	if err := sg.ApplyConfig(&cfg); err != nil {
+		t.Fatalf("Error applying config: %v", err)
+	}
+	select {
+	case <-hook.ch:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("service discovery update not discarded")
+	}
+}
+
+// eventually fails the test if f doesn't return true within a second
+func eventually(t *testing.T, msg string, f func() bool) {
+	for deadline := time.Now().Add(time.Second); !f(); {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSyncDiscardedHealthChecks(t *testing.T) {
+	var probes int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&probes, 1)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	sg := New()
+	defer sg.Cancel()
+	sg.DedupRegistry = promclient.NewDedupRegistry()
+
+	// The target without an address discards the update, after the health check
+	// of the target before it was started
+	applyDiscarded(t, sg, `
+static_configs:
+  - targets: ['`+host+`', 'no-address:9090']
+relabel_configs:
+  - source_labels: [__address__]
+    regex: no-address:9090
+    target_label: __address__
+    replacement: ''
+health_check:
+  interval: 10ms
+`)
+
+	eventually(t, "health check of the discarded update is still running", func() bool {
+		before := atomic.LoadInt64(&probes)
+		time.Sleep(50 * time.Millisecond)
+		return atomic.LoadInt64(&probes) == before
+	})
+
+	// The target of the discarded update isn't registered for deduplication
+	u := &url.URL{Scheme: "http", Host: host}
+	key := u.String() + "|{}|" + sg.dedupConfig()
+	defer sg.DedupRegistry.Register(key)()
+	if sg.DedupRegistry.Shared(key) {
+		t.Fatalf("target of the discarded update is still registered")
+	}
+}
+
+func TestSyncDiscardedCapabilityDetectors(t *testing.T) {
+	var detections int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&detections, 1)
+		w.Write([]byte(`{"status":"success","data":{"version":"2.26.0"}}`))
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	sg := New()
+	defer sg.Cancel()
+	applyDiscarded(t, sg, `
+static_configs:
+  - targets: ['`+host+`', 'no-address:9090']
+relabel_configs:
+  - source_labels: [__address__]
+    regex: no-address:9090
+    target_label: __address__
+    replacement: ''
+capability_detection:
+  interval: 10ms
+`)
+
+	eventually(t, "capability detector of the discarded update is still running", func() bool {
+		before := atomic.LoadInt64(&detections)
+		time.Sleep(50 * time.Millisecond)
+		return atomic.LoadInt64(&detections) == before
+	})
+}
+
+func TestSyncDiscardedThanosStoreAPIs(t *testing.T) {
+	var l sync.Mutex
+	var stores []*promclient.ThanosStoreAPI
+	newStore := newThanosStoreAPI
+	defer func() { newThanosStoreAPI = newStore }()
+	newThanosStoreAPI = func(ctx context.Context, address string, tlsConfig *tls.Config) (*promclient.ThanosStoreAPI, error) {
+		store, err := newStore(ctx, address, tlsConfig)
+		l.Lock()
+		stores = append(stores, store)
+		l.Unlock()
+		return store, err
+	}
+
+	sg := New()
+	defer sg.Cancel()
+	applyDiscarded(t, sg, `
+thanos_store_api: true
+static_configs:
+  - targets: ['store:10901', 'no-address:10901']
+relabel_configs:
+  - source_labels: [__address__]
+    regex: no-address:10901
+    target_label: __address__
+    replacement: ''
+`)
+
+	l.Lock()
+	defer l.Unlock()
+	if len(stores) != 1 {
+		t.Fatalf("expected a single store, got %d", len(stores))
+	}
+	// Calls through a closed connection fail immediately
+	eventually(t, "connection of the discarded update isn't closed", func() bool {
+		ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+		defer cancel()
+		_, _, err := stores[0].LabelNames(ctx)
+		return err != nil && strings.Contains(err.Error(), "closing")
+	})
+}
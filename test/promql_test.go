@@ -8,6 +8,7 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -101,6 +102,36 @@ promxy:
           insecure_skip_verify: true
 `
 
+const rawShardedPSConfig = `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets:
+          - localhost:8087
+          labels:
+            __shard__: "0"
+        - targets:
+          - localhost:8089
+          labels:
+            __shard__: "1"
+      sharding:
+        modulus: 2
+`
+
+const rawLabeledHostsPSConfig = `
+promxy:
+  server_groups:
+    - static_configs:
+        - targets:
+          - localhost:8087
+          labels:
+            host: a
+        - targets:
+          - localhost:8089
+          labels:
+            host: b
+`
+
 func getProxyStorage(cfg string) *proxystorage.ProxyStorage {
 	// Create promxy in front of it
 	pstorageConfig := &proxyconfig.Config{}
@@ -269,6 +300,106 @@ func TestEvaluations(t *testing.T) {
 	}
 }
 
+// startShardsForTest starts an API for each of the loads (of a promql test) on the listen addresses
+func startShardsForTest(t *testing.T, loads, listens []string) func() {
+	var stop []func()
+	for i, load := range loads {
+		test, err := promql.NewTest(t, load)
+		if err != nil {
+			t.Fatalf("error creating test: %v", err)
+		}
+		if err := test.Run(); err != nil {
+			t.Fatalf("error loading test: %v", err)
+		}
+		srv, stopChan := startAPIForTest(test.Storage(), listens[i])
+		stop = append(stop, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+			srv.Shutdown(ctx)
+			<-stopChan
+			test.Close()
+		})
+	}
+	return func() {
+		for _, f := range stop {
+			f()
+		}
+	}
+}
+
+// evalForTest evaluates the instant query through the ProxyStorage and returns the value of each series
+func evalForTest(t *testing.T, ps *proxystorage.ProxyStorage, query string, ts time.Time) map[string]float64 {
+	engine := promql.NewEngine(promql.EngineOpts{
+		Timeout:    10 * time.Minute,
+		MaxSamples: 50000000,
+	})
+	engine.NodeReplacer = ps.NodeReplacer
+
+	q, err := engine.NewInstantQuery(ps, query, ts)
+	if err != nil {
+		t.Fatalf("error creating query %s: %v", query, err)
+	}
+	defer q.Close()
+	vector, err := q.Exec(context.TODO()).Vector()
+	if err != nil {
+		t.Fatalf("error evaluating query %s: %v", query, err)
+	}
+	values := make(map[string]float64, len(vector))
+	for _, sample := range vector {
+		values[sample.Metric.String()] = sample.V
+	}
+	return values
+}
+
+func TestShardedAggregations(t *testing.T) {
+	stop := startShardsForTest(t, []string{
+		`load 1m
+			foo{instance="a"} 1+0x10
+			foo{instance="b"} 2+0x10`,
+		`load 1m
+			foo{instance="c"} 3+0x10`,
+	}, []string{":8087", ":8089"})
+	defer stop()
+
+	ps := getProxyStorage(rawShardedPSConfig)
+
+	// The aggregations are over the series of all shards
+	for query, expected := range map[string]map[string]float64{
+		"sum(foo)":                       {"{}": 6},
+		"count(foo)":                     {"{}": 3},
+		"max(foo)":                       {"{}": 3},
+		"avg(foo)":                       {"{}": 2},
+		"count_values(\"v\", foo)":       {`{v="1"}`: 1, `{v="2"}`: 1, `{v="3"}`: 1},
+		"sum(rate(foo[5m]))":             {"{}": 0},
+		"max_over_time(sum(foo)[5m:1m])": {"{}": 6},
+	} {
+		t.Run(query, func(t *testing.T) {
+			if values := evalForTest(t, ps, query, time.Unix(300, 0)); !reflect.DeepEqual(values, expected) {
+				t.Fatalf("mismatch in %s expected=%v actual=%v", query, expected, values)
+			}
+		})
+	}
+}
+
+func TestLabeledHostsSubqueries(t *testing.T) {
+	stop := startShardsForTest(t, []string{
+		`load 1m
+			foo{instance="a"} 1+0x10`,
+		`load 1m
+			foo{instance="b"} 2+0x10`,
+	}, []string{":8087", ":8089"})
+	defer stop()
+
+	ps := getProxyStorage(rawLabeledHostsPSConfig)
+
+	// The hosts have different series, so the subquery isn't sent to them as-is
+	query := "max_over_time(sum(foo)[5m:1m])"
+	expected := map[string]float64{"{}": 3}
+	if values := evalForTest(t, ps, query, time.Unix(300, 0)); !reflect.DeepEqual(values, expected) {
+		t.Fatalf("mismatch in %s expected=%v actual=%v", query, expected, values)
+	}
+}
+
 func newTestFromFile(t testutil.T, filename string) (*promql.Test, error) {
 	content, err := ioutil.ReadFile(filename)
 	if err != nil {